@@ -0,0 +1,4 @@
+// Package kvpb is the gRPC API of the storage, the code is generated from kv.proto.
+package kvpb
+
+//go:generate buf generate --template buf.gen.yaml
@@ -2,85 +2,239 @@ package app
 
 import (
 	"database/sql"
+	"expvar"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/dimishpatriot/kv-storage/api/kvpb"
+	"github.com/dimishpatriot/kv-storage/internal/grpcserver"
 	"github.com/dimishpatriot/kv-storage/internal/handler"
+	"github.com/dimishpatriot/kv-storage/internal/migrations"
+	"github.com/dimishpatriot/kv-storage/internal/resp"
 	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
+	"github.com/dimishpatriot/kv-storage/internal/services/raft"
+	"github.com/dimishpatriot/kv-storage/internal/services/replication"
+	"github.com/dimishpatriot/kv-storage/internal/services/router"
+	"github.com/dimishpatriot/kv-storage/internal/services/snapshot"
 	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
 	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger/filelogger"
 	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger/postgreslogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/watch"
 	"github.com/dimishpatriot/kv-storage/internal/storage"
 	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
 	"github.com/dimishpatriot/kv-storage/internal/storage/postgresstorage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/sqlitestorage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/tieredstorage"
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
 )
 
 type App struct {
-	logger     *log.Logger
-	dataLogger transactionlogger.TransactionLogger
-	keyService keyservice.KeyService
-	handler    handler.Handler
-	storage    storage.Storage
-	router     *mux.Router
+	logger       *log.Logger
+	dataLogger   transactionlogger.TransactionLogger
+	logEvictions bool
+	keyService   keyservice.KeyService
+	handler      handler.Handler
+	storage      storage.Storage
+	router       *mux.Router
+	snapshotter  *snapshot.Snapshotter // local storage only
+	adminHandler handler.AdminHandler  // local storage only
+	watchHandler handler.WatchHandler
+	watcher      handler.Watcher
+	addr         string
+	respAddr     string
+	grpcAddr     string
+
+	replicationHandler handler.ReplicationHandler // local storage only
+	follower           *replication.Follower      // replica only
+	leader             string                     // replica only
+
+	raftNode    *raft.Node          // cluster member only
+	raftHandler handler.RaftHandler // cluster member only
+
+	tiered *tieredstorage.TieredStorage // tiered storage only
+
+	keyRouter     *router.Router        // router only
+	routerHandler handler.RouterHandler // router only
 }
 
 type AppConfig struct {
-	StorageType string
+	StorageType      string
+	Shards           int           // of local storage, a single one for < 2
+	SQLiteFilename   string        // database file of sqlite storage
+	SnapshotInterval time.Duration // 0 disables snapshots by time
+	SnapshotEvents   uint64        // 0 disables snapshots by number of events
+	Sync             filelogger.SyncMode
+	SyncInterval     time.Duration // for filelogger.SyncModeInterval
+	Watch            watch.Config
+	Addr             string // to listen on
+	RESPAddr         string // to listen on for Redis clients, none to not serve them
+	GRPCAddr         string // to listen on for gRPC clients, none to not serve them
+
+	Limits       localstorage.Limits // of local storage, zero for no limits
+	LogEvictions bool                // logs evicted keys as deletes, so replay doesn't restore them
+
+	Tiered tieredstorage.Config // of tiered storage, its cache is bounded by Limits
+
+	ReplicateFrom       string        // leader URL, makes the node a read-only replica
+	ReplicationInterval time.Duration // how often an up to date replica polls the leader
+
+	RaftID      string            // makes the node a member of a Raft cluster
+	RaftMembers map[string]string // initial members: ID to base URL, none to join a running cluster
+	RaftDir     string            // where the node keeps its Raft log
+
+	RouterNodes          map[string]string // ID to base URL, makes the node a router to them
+	RouterHealthInterval time.Duration     // how often the router checks the nodes
 }
 
 var (
-	LocalStorage = "local"
-	PGStorage    = "postgres"
+	LocalStorage  = "local"
+	PGStorage     = "postgres"
+	SQLiteStorage = "sqlite"
+	TieredStorage = "tiered"
 )
 
+const sweepInterval = time.Second
+
+// localStorage is a single or a sharded local storage.
+type localStorage interface {
+	storage.Storage
+	Items() []storage.Item
+	Load([]storage.Item)
+	RunSweeper(interval time.Duration, onExpire func(key string)) (stop func())
+	OnEvict(onEvict func(key string))
+}
+
+func newLocalStorage(shards int, limits localstorage.Limits) localStorage {
+	if shards > 1 {
+		return localstorage.NewSharded(shards, limits).(localStorage)
+	}
+
+	return localstorage.NewBounded(limits).(localStorage)
+}
+
 func New(config AppConfig) (*App, error) {
 	var storage storage.Storage
 	var dataLogger transactionlogger.TransactionLogger
 	var err error
 	var db *sql.DB
+	var snapshotter *snapshot.Snapshotter
+	var adminHandler handler.AdminHandler
+	var replicationHandler handler.ReplicationHandler
+	var tiered *tieredstorage.TieredStorage
 
 	logger := log.New(os.Stdout, "INFO:", log.Lshortfile|log.Ltime|log.Lmicroseconds|log.Ldate)
 	logger.Println("logger created")
 
+	if config.ReplicateFrom != "" {
+		return newFollower(logger, config)
+	}
+	if config.RaftID != "" {
+		return newClusterMember(logger, config)
+	}
+	if len(config.RouterNodes) > 0 {
+		return newRouter(logger, config)
+	}
+
 	switch config.StorageType {
 
 	case LocalStorage:
-		storage = localstorage.New()
+		ls := newLocalStorage(config.Shards, config.Limits)
+		storage = ls
 		logger.Println("storage created")
 
-		dataLogger, err = filelogger.New(logger, "transaction.log")
+		dataLogger, err = filelogger.New(logger, filelogger.Config{
+			Filename:     "transaction.log",
+			Sync:         config.Sync,
+			SyncInterval: config.SyncInterval,
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create file-logger: %w", err)
 		}
 		logger.Println("dataLogger created")
-		restoreData(dataLogger, storage)
+
+		snapshotter, err = snapshot.New(logger, snapshot.Config{
+			Interval: config.SnapshotInterval,
+			Events:   config.SnapshotEvents,
+		}, ls, dataLogger.(*filelogger.FileTransactionLogger))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create snapshotter: %w", err)
+		}
+		adminHandler = handler.NewAdmin(snapshotter)
+		replicationHandler = handler.NewReplication(dataLogger.(*filelogger.FileTransactionLogger), snapshotter)
+		logger.Println("snapshotter created")
+
+		after, err := snapshotter.Restore()
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore snapshot: %w", err)
+		}
+		if err = transactionlogger.ReplayAfter(dataLogger, storage, after); err != nil {
+			return nil, fmt.Errorf("failed to restore data: %w", err)
+		}
 		logger.Println("data restored")
 
 	case PGStorage:
-		dbParams := postgreslogger.PostgresDBParams{
-			Host:     os.Getenv("DB_HOST"),
-			DBName:   os.Getenv("DB_NAME"),
-			User:     os.Getenv("DB_USER"),
-			Password: os.Getenv("DB_PASSWORD"),
-			SSLMode:  os.Getenv("DB_SSL_MODE"),
+		dataLogger, db, err = postgreslogger.New(logger, pgParams())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pg-logger: %w", err)
+		}
+		if err = migrate(logger, db, migrations.Postgres); err != nil {
+			return nil, err
+		}
+		storage = postgresstorage.New(db, postgresstorage.DefaultTableName)
+		logger.Println("storage created")
+
+		logger.Println("dataLogger created")
+
+	case TieredStorage:
+		db, err = postgreslogger.Connect(pgParams())
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to db: %w", err)
 		}
+		if err = migrate(logger, db, migrations.Postgres); err != nil {
+			return nil, err
+		}
+		pgLogger := postgreslogger.NewWithDB(logger, db, postgreslogger.DefaultTableName)
+		tiered, err = tieredstorage.New(
+			logger,
+			newLocalStorage(config.Shards, config.Limits),
+			postgresstorage.New(db, postgresstorage.DefaultTableName),
+			pgLogger,
+			config.Tiered,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tiered storage: %w", err)
+		}
+		storage = tiered
+		logger.Println("storage created")
+
+		dataLogger = tiered.Logger(pgLogger)
+		logger.Println("dataLogger created")
 
-		dataLogger, db, err = postgreslogger.New(logger, dbParams)
+	case SQLiteStorage:
+		db, err = sqlitestorage.Open(config.SQLiteFilename)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create pg-logger: %w", err)
+			return nil, fmt.Errorf("failed to open sqlite db: %w", err)
 		}
-		storage = postgresstorage.New(db, "transactions")
+		storage = sqlitestorage.New(db)
 		logger.Println("storage created")
 
+		dataLogger = postgreslogger.NewWithDB(logger, db, postgreslogger.DefaultTableName)
 		logger.Println("dataLogger created")
 
 	default:
 		return nil, fmt.Errorf("invalid type of storage: %s", config.StorageType)
 	}
 
+	hub := watch.New(logger, dataLogger, config.Watch)
+	dataLogger = hub
+	watchHandler := handler.NewWatch(hub)
+	logger.Println("watch hub created")
+
 	keyService := keyservice.New(logger, storage, dataLogger)
 	logger.Println("keyservice created")
 
@@ -90,43 +244,339 @@ func New(config AppConfig) (*App, error) {
 	router := mux.NewRouter()
 	logger.Println("router created")
 
-	return &App{logger, dataLogger, keyService, handler, storage, router}, nil
+	return &App{
+		logger:             logger,
+		dataLogger:         dataLogger,
+		keyService:         keyService,
+		handler:            handler,
+		storage:            storage,
+		router:             router,
+		snapshotter:        snapshotter,
+		adminHandler:       adminHandler,
+		watchHandler:       watchHandler,
+		watcher:            hub,
+		logEvictions:       config.LogEvictions,
+		addr:               config.Addr,
+		respAddr:           config.RESPAddr,
+		grpcAddr:           config.GRPCAddr,
+		replicationHandler: replicationHandler,
+		tiered:             tiered,
+	}, nil
+}
+
+// newFollower makes a read-only replica of a local storage leader.
+// It has no log of its own and catches up from the leader on start.
+func newFollower(logger *log.Logger, config AppConfig) (*App, error) {
+	if config.StorageType != LocalStorage {
+		return nil, fmt.Errorf("replica storage must be %s, not %s", LocalStorage, config.StorageType)
+	}
+
+	ls := newLocalStorage(config.Shards, config.Limits)
+	logger.Println("storage created")
+
+	follower := replication.New(logger, replication.Config{
+		Leader:   config.ReplicateFrom,
+		Interval: config.ReplicationInterval,
+	}, ls)
+	logger.Println("follower created")
+
+	// writes are redirected to the leader, so nothing is logged
+	keyService := keyservice.New(logger, ls, nil)
+	logger.Println("keyservice created")
+
+	return &App{
+		logger:     logger,
+		keyService: keyService,
+		handler:    handler.New(keyService),
+		storage:    ls,
+		router:     mux.NewRouter(),
+		addr:       config.Addr,
+		follower:   follower,
+		leader:     config.ReplicateFrom,
+	}, nil
+}
+
+// newClusterMember makes a member of a Raft cluster of local storages.
+// Its storage is restored from the last snapshot and the committed entries
+// of its log after it.
+func newClusterMember(logger *log.Logger, config AppConfig) (*App, error) {
+	if config.StorageType != LocalStorage {
+		return nil, fmt.Errorf("cluster member storage must be %s, not %s", LocalStorage, config.StorageType)
+	}
+
+	ls := newLocalStorage(config.Shards, config.Limits)
+	logger.Println("storage created")
+
+	persister, err := raft.NewFilePersister(config.RaftDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create raft persister: %w", err)
+	}
+	node, err := raft.New(logger, raft.Config{
+		ID:              config.RaftID,
+		Members:         config.RaftMembers,
+		SnapshotEntries: config.SnapshotEvents,
+	}, ls, raft.NewHTTPTransport(0), persister)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create raft node: %w", err)
+	}
+	logger.Println("raft node created")
+
+	keyService := keyservice.NewConsensus(logger, ls, node)
+	logger.Println("keyservice created")
+
+	return &App{
+		logger:      logger,
+		keyService:  keyService,
+		handler:     handler.New(keyService),
+		storage:     ls,
+		router:      mux.NewRouter(),
+		addr:        config.Addr,
+		raftNode:    node,
+		raftHandler: handler.NewRaft(node),
+	}, nil
+}
+
+// newRouter makes a router which owns no data and forwards key requests
+// to the nodes by the consistent hash ring.
+func newRouter(logger *log.Logger, config AppConfig) (*App, error) {
+	keyRouter, err := router.New(logger, router.Config{
+		Nodes:          config.RouterNodes,
+		HealthInterval: config.RouterHealthInterval,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create router: %w", err)
+	}
+	logger.Println("router created")
+
+	return &App{
+		logger:        logger,
+		router:        mux.NewRouter(),
+		addr:          config.Addr,
+		keyRouter:     keyRouter,
+		routerHandler: handler.NewRouter(keyRouter),
+	}, nil
+}
+
+// Migrate applies the schema migrations of the storage database.
+func Migrate(config AppConfig) error {
+	logger := log.New(os.Stdout, "INFO:", log.Lshortfile|log.Ltime|log.Lmicroseconds|log.Ldate)
+
+	switch config.StorageType {
+	case PGStorage, TieredStorage:
+		db, err := postgreslogger.Connect(pgParams())
+		if err != nil {
+			return fmt.Errorf("failed to connect to db: %w", err)
+		}
+		defer db.Close()
+		return migrate(logger, db, migrations.Postgres)
+
+	case SQLiteStorage:
+		// the file is migrated on open
+		db, err := sqlitestorage.Open(config.SQLiteFilename)
+		if err != nil {
+			return fmt.Errorf("failed to open sqlite db: %w", err)
+		}
+		logger.Println("db schema is up to date")
+		return db.Close()
+
+	default:
+		return fmt.Errorf("storage %s has no schema to migrate", config.StorageType)
+	}
+}
+
+func migrate(logger *log.Logger, db *sql.DB, dialect migrations.Dialect) error {
+	applied, err := migrations.Apply(db, dialect)
+	for _, m := range applied {
+		logger.Printf("migration %d %s applied", m.Version, m.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate db: %w", err)
+	}
+	logger.Println("db schema is up to date")
+
+	return nil
+}
+
+func pgParams() postgreslogger.PostgresDBParams {
+	return postgreslogger.PostgresDBParams{
+		Host:     os.Getenv("DB_HOST"),
+		DBName:   os.Getenv("DB_NAME"),
+		User:     os.Getenv("DB_USER"),
+		Password: os.Getenv("DB_PASSWORD"),
+		SSLMode:  os.Getenv("DB_SSL_MODE"),
+	}
 }
 
 func (app *App) Run() error {
+	if app.follower != nil {
+		app.follower.Run()
+		app.logger.Println("follower ran")
+
+		app.addFollowerRoutes()
+		app.logger.Println("routes added")
+
+		return http.ListenAndServe(app.addr, app.router)
+	}
+
+	if app.keyRouter != nil {
+		app.keyRouter.Run()
+		app.logger.Println("router ran")
+
+		app.addRouterRoutes()
+		app.logger.Println("routes added")
+
+		return http.ListenAndServe(app.addr, app.router)
+	}
+
+	if app.raftNode != nil {
+		app.raftNode.Run()
+		app.logger.Println("raft node ran")
+
+		app.raftNode.RunSweeper(sweepInterval)
+		app.logger.Println("sweeper ran")
+
+		app.addClusterRoutes()
+		app.logger.Println("routes added")
+
+		err := app.serve(app.raftNode.Err())
+		app.raftNode.Stop()
+		return err
+	}
+
 	app.dataLogger.Run()
 	app.logger.Println("dataLogger ran")
 
+	if ls, ok := app.storage.(localStorage); ok {
+		ls.RunSweeper(sweepInterval, func(key string) {
+			if err := app.dataLogger.WriteDelete(key); err != nil {
+				app.logger.Printf("cant log expiration of %s: %s", key, err)
+			}
+		})
+		app.logger.Println("sweeper ran")
+
+		if app.logEvictions {
+			ls.OnEvict(func(key string) {
+				if err := app.dataLogger.WriteDelete(key); err != nil {
+					app.logger.Printf("cant log eviction of %s: %s", key, err)
+				}
+			})
+		}
+	}
+
+	if app.tiered != nil {
+		app.tiered.Run()
+		app.logger.Println("tiered storage ran")
+	}
+
+	if app.snapshotter != nil {
+		app.snapshotter.Run()
+		app.logger.Println("snapshotter ran")
+	}
+
+	if app.respAddr != "" {
+		l, err := net.Listen("tcp", app.respAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for resp: %w", err)
+		}
+		go func() {
+			app.logger.Printf("resp server stopped: %s", resp.New(app.logger, app.keyService).Serve(l))
+		}()
+		app.logger.Println("resp server ran")
+	}
+
+	if app.grpcAddr != "" {
+		l, err := net.Listen("tcp", app.grpcAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for grpc: %w", err)
+		}
+		gs := grpc.NewServer()
+		kvpb.RegisterKVServer(gs, grpcserver.New(app.keyService, app.watcher))
+		go func() {
+			app.logger.Printf("grpc server stopped: %s", gs.Serve(l))
+		}()
+		app.logger.Println("grpc server ran")
+	}
+
 	app.addRoutes()
 	app.logger.Println("routes added")
 
-	return http.ListenAndServe(":8080", app.router)
+	return app.serve(app.dataLogger.Err())
+}
+
+// serve serves the routes until the server or the log fails: a node whose
+// changes can't be logged must not serve keys it would lose on restart.
+func (app *App) serve(logErrors <-chan error) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- http.ListenAndServe(app.addr, app.router)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case err := <-logErrors:
+		return fmt.Errorf("log failed: %w", err)
+	}
 }
 
 func (app *App) addRoutes() {
+	app.router.HandleFunc("/v1", app.handler.Scan).Methods("GET")
+	app.router.HandleFunc("/v1/txn", app.handler.Txn).Methods("POST")
+	app.router.HandleFunc("/v1/batch", app.handler.Batch).Methods("POST")
+	app.router.HandleFunc("/v1/watch", app.watchHandler.Watch).Methods("GET")
 	app.router.HandleFunc("/v1/{key}", app.handler.Put).Methods("PUT")
 	app.router.HandleFunc("/v1/{key}", app.handler.Get).Methods("GET")
 	app.router.HandleFunc("/v1/{key}", app.handler.Delete).Methods("DELETE")
+	if app.adminHandler != nil {
+		app.router.HandleFunc("/admin/snapshot", app.adminHandler.Snapshot).Methods("POST")
+	}
+	if app.replicationHandler != nil {
+		app.router.HandleFunc(replication.EventsPath, app.replicationHandler.Events).Methods("GET")
+		app.router.HandleFunc(replication.SnapshotPath, app.replicationHandler.Snapshot).Methods("GET")
+	}
+	app.router.Handle("/debug/vars", expvar.Handler()).Methods("GET")
 }
 
-func restoreData(
-	fileLogger transactionlogger.TransactionLogger,
-	storage storage.Storage,
-) {
-	var err error
-	events, errors := fileLogger.ReadEvents()
-	e, ok := transactionlogger.Event{}, true
-
-	for ok && err == nil {
-		select {
-		case err, ok = <-errors:
-		case e, ok = <-events:
-			switch e.EventType {
-			case transactionlogger.EventDelete:
-				err = storage.Delete(e.Key)
-			case transactionlogger.EventPut:
-				err = storage.Put(e.Key, e.Value)
-			}
-		}
+// addFollowerRoutes serves reads and redirects the rest to the leader.
+func (app *App) addFollowerRoutes() {
+	toLeader := handler.Redirect(app.leader)
+	app.router.HandleFunc("/v1", app.handler.Scan).Methods("GET")
+	app.router.HandleFunc("/v1/txn", toLeader).Methods("POST")
+	app.router.HandleFunc("/v1/batch", toLeader).Methods("POST")
+	app.router.HandleFunc("/v1/watch", toLeader).Methods("GET")
+	app.router.HandleFunc("/v1/{key}", app.handler.Get).Methods("GET")
+	app.router.HandleFunc("/v1/{key}", toLeader).Methods("PUT", "DELETE")
+	app.router.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+}
+
+// addClusterRoutes serves the requests on the leader and forwards them to
+// the leader from the other members.
+func (app *App) addClusterRoutes() {
+	toLeader := func(h http.HandlerFunc) http.HandlerFunc {
+		return handler.Forward(app.raftNode, h)
 	}
+	app.router.HandleFunc(raft.VotePath, app.raftHandler.Vote).Methods("POST")
+	app.router.HandleFunc(raft.AppendPath, app.raftHandler.Append).Methods("POST")
+	app.router.HandleFunc(raft.SnapshotPath, app.raftHandler.Snapshot).Methods("POST")
+	app.router.HandleFunc("/v1", toLeader(app.handler.Scan)).Methods("GET")
+	app.router.HandleFunc("/v1/txn", toLeader(app.handler.Txn)).Methods("POST")
+	app.router.HandleFunc("/v1/batch", toLeader(app.handler.Batch)).Methods("POST")
+	app.router.HandleFunc("/v1/{key}", toLeader(app.handler.Put)).Methods("PUT")
+	app.router.HandleFunc("/v1/{key}", toLeader(app.handler.Get)).Methods("GET")
+	app.router.HandleFunc("/v1/{key}", toLeader(app.handler.Delete)).Methods("DELETE")
+	app.router.HandleFunc("/admin/raft/members", app.raftHandler.Members).Methods("GET")
+	app.router.HandleFunc("/admin/raft/members/{id}", toLeader(app.raftHandler.AddMember)).Methods("PUT")
+	app.router.HandleFunc("/admin/raft/members/{id}", toLeader(app.raftHandler.RemoveMember)).Methods("DELETE")
+	app.router.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+}
+
+// addRouterRoutes forwards the key requests to the nodes, the rest of the
+// API isn't served by a router.
+func (app *App) addRouterRoutes() {
+	app.router.HandleFunc("/v1/{key}", app.routerHandler.Key).Methods("PUT", "GET", "DELETE")
+	app.router.HandleFunc("/admin/router/nodes", app.routerHandler.Nodes).Methods("GET")
+	app.router.HandleFunc("/admin/router/nodes/{id}", app.routerHandler.AddNode).Methods("PUT")
+	app.router.HandleFunc("/admin/router/nodes/{id}", app.routerHandler.RemoveNode).Methods("DELETE")
+	app.router.HandleFunc("/admin/router/rebalance", app.routerHandler.AbortRebalance).Methods("DELETE")
+	app.router.Handle("/debug/vars", expvar.Handler()).Methods("GET")
 }
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dimishpatriot/kv-storage/internal/handler"
+	"github.com/dimishpatriot/kv-storage/pkg/client"
+)
+
+// chunk is the number of keys of a scan page or a batch, the most the
+// service takes at once.
+const chunk = 1000
+
+// record is a line of the export and import NDJSON.
+type record struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func get(ctx context.Context, k *kvctl, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+	if err := checkKeys(fs.Args()...); err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, key := range fs.Args() {
+		v, err := k.client.Get(ctx, key)
+		if errors.Is(err, client.ErrorNoSuchKey) {
+			missing = append(missing, key)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cant get %s: %w", key, err)
+		}
+		if err = k.out.row(v, column{"key", key}, column{"value", v}); err != nil {
+			return err
+		}
+	}
+
+	return missingKeys(missing)
+}
+
+func put(ctx context.Context, k *kvctl, args []string) error {
+	fs := flag.NewFlagSet("put", flag.ContinueOnError)
+	ttl := fs.Duration("ttl", 0, "expire the key after this")
+	ifAbsent := fs.Bool("if-absent", false, "put only if the key is absent")
+	file := fs.String("f", "", "read the value from the file")
+	if err := parseFlags(fs, args, 1, 2); err != nil {
+		return err
+	}
+	key := fs.Arg(0)
+	if err := checkKeys(key); err != nil {
+		return err
+	}
+	switch {
+	case *ttl < 0:
+		return fmt.Errorf("%w: %s", errorUsage, handler.ErrorInvalidTTL)
+	case *ttl > 0 && *ifAbsent:
+		return fmt.Errorf("%w: %s", errorUsage, handler.ErrorConditionalTTL)
+	case fs.NArg() == 2 && *file != "":
+		return fmt.Errorf("%w: the value is given both as an argument and a file", errorUsage)
+	}
+
+	value := fs.Arg(1)
+	if fs.NArg() == 1 {
+		var err error
+		if value, err = readValue(k.stdin, *file); err != nil {
+			return err
+		}
+	}
+	if err := checkValue(value); err != nil {
+		return err
+	}
+
+	var err error
+	switch {
+	case *ifAbsent:
+		err = k.client.PutIfAbsent(ctx, key, value)
+	case *ttl > 0:
+		err = k.client.PutWithTTL(ctx, key, value, *ttl)
+	default:
+		err = k.client.Put(ctx, key, value)
+	}
+	if err != nil {
+		return fmt.Errorf("cant put %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// readValue reads the value from the file or stdin without the trailing
+// new line, like a shell command substitution.
+func readValue(stdin io.Reader, file string) (string, error) {
+	r := stdin
+	if file != "" && file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", errorUsage, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	// a value longer than this is invalid anyway
+	b, err := io.ReadAll(io.LimitReader(r, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("cant read value: %w", err)
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(string(b), "\n"), "\r"), nil
+}
+
+func del(ctx context.Context, k *kvctl, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+	if err := checkKeys(fs.Args()...); err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, key := range fs.Args() {
+		err := k.client.Delete(ctx, key)
+		if errors.Is(err, client.ErrorNoSuchKey) {
+			missing = append(missing, key)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cant delete %s: %w", key, err)
+		}
+	}
+
+	return missingKeys(missing)
+}
+
+func missingKeys(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", client.ErrorNoSuchKey, strings.Join(keys, ", "))
+}
+
+func scan(ctx context.Context, k *kvctl, args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	prefix := fs.String("prefix", "", "of the keys")
+	after := fs.String("after", "", "start after the key")
+	limit := fs.Int("limit", 0, "print up to this many keys, all if 0")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *limit < 0 {
+		return fmt.Errorf("%w: negative limit", errorUsage)
+	}
+
+	return scanKeys(ctx, k.client, *prefix, *after, *limit, func(keys []string) error {
+		for _, key := range keys {
+			if err := k.out.row(key, column{"key", key}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// scanKeys passes the pages of up to limit keys, all if 0, to the func.
+func scanKeys(ctx context.Context, c *client.Client, prefix, after string, limit int, f func([]string) error) error {
+	for n := 0; limit == 0 || n < limit; {
+		size := chunk
+		if limit > 0 {
+			size = min(size, limit-n)
+		}
+		page, err := c.Scan(ctx, prefix, after, size)
+		if err != nil {
+			return fmt.Errorf("cant scan keys: %w", err)
+		}
+		if err = f(page.Keys); err != nil {
+			return err
+		}
+		n += len(page.Keys)
+		if page.Next == "" {
+			break
+		}
+		after = page.Next
+	}
+
+	return nil
+}
+
+func watchKeys(ctx context.Context, k *kvctl, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	prefix := fs.String("prefix", "", "of the keys")
+	after := fs.Uint64("after", 0, "resume after the sequence, 0 for new changes only")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	events, errs := k.client.Watch(ctx, *prefix, *after)
+	for e := range events {
+		raw := fmt.Sprintf("%s %s", e.Type, e.Key)
+		if e.Type == client.EventPut {
+			raw += " " + e.Value
+		}
+		var expires any
+		if !e.Expires.IsZero() {
+			expires = e.Expires
+		}
+		err := k.out.row(raw,
+			column{"sequence", e.Sequence},
+			column{"type", e.Type},
+			column{"key", e.Key},
+			column{"value", nonEmpty(e.Value)},
+			column{"expires", expires})
+		if err == nil {
+			err = k.out.flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err := <-errs
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		// interrupted
+		return nil
+	}
+
+	return fmt.Errorf("cant watch keys: %w", err)
+}
+
+func nonEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+
+	return s
+}
+
+// export writes the keys with their values as NDJSON whatever the output
+// format is, import reads it back.
+func export(ctx context.Context, k *kvctl, args []string) (err error) {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	prefix := fs.String("prefix", "", "of the keys")
+	file := fs.String("f", "", "write to the file instead of stdout")
+	if err = parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	w := k.stdout
+	if *file != "" && *file != "-" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return fmt.Errorf("%w: %s", errorUsage, err)
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil && cerr != nil {
+				err = fmt.Errorf("cant write export: %w", cerr)
+			}
+		}()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	err = scanKeys(ctx, k.client, *prefix, "", 0, func(keys []string) error {
+		if len(keys) == 0 {
+			return nil
+		}
+		ops := make([]client.Op, len(keys))
+		for i, key := range keys {
+			ops[i] = client.Op{Op: client.OpGet, Key: key}
+		}
+		results, err := k.client.Batch(ctx, ops)
+		if err != nil {
+			return fmt.Errorf("cant get values: %w", err)
+		}
+		for _, res := range results {
+			err = res.Err()
+			if errors.Is(err, client.ErrorNoSuchKey) {
+				// deleted after the scan
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("cant get %s: %w", res.Key, err)
+			}
+			if err = enc.Encode(record{res.Key, res.Value}); err != nil {
+				return fmt.Errorf("cant write export: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		return fmt.Errorf("cant write export: %w", err)
+	}
+
+	return nil
+}
+
+// importKeys puts the keys of the NDJSON export, an invalid record fails
+// the import before anything is put.
+func importKeys(ctx context.Context, k *kvctl, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	file := fs.String("f", "", "read from the file instead of stdin")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	r := k.stdin
+	if *file != "" && *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return fmt.Errorf("%w: %s", errorUsage, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var ops []client.Op
+	dec := json.NewDecoder(bufio.NewReader(r))
+	dec.DisallowUnknownFields()
+	for n := 1; ; n++ {
+		var rec record
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: record %d: %s", errorUsage, n, err)
+		}
+		if err = checkKeys(rec.Key); err == nil {
+			err = checkValue(rec.Value)
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+		ops = append(ops, client.Op{Op: client.OpPut, Key: rec.Key, Value: rec.Value})
+	}
+
+	failed := 0
+	for len(ops) > 0 {
+		n := min(chunk, len(ops))
+		results, err := k.client.Batch(ctx, ops[:n])
+		if err != nil {
+			return fmt.Errorf("cant put keys: %w", err)
+		}
+		for _, res := range results {
+			if err = res.Err(); err != nil {
+				failed++
+				fmt.Fprintf(k.stderr, "kvctl: cant put %s: %s\n", res.Key, err)
+			}
+		}
+		ops = ops[n:]
+	}
+	if failed > 0 {
+		return fmt.Errorf("cant put %d keys", failed)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+// Command kvctl calls a running kv-storage server.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dimishpatriot/kv-storage/internal/handler"
+	"github.com/dimishpatriot/kv-storage/pkg/client"
+)
+
+const usage = `usage: kvctl [flags] <command> [args]
+
+commands:
+  get <key>...                     print the values
+  put [-ttl d] [-if-absent] [-f file] <key> [value]
+                                   put the value, read from the file or stdin if not given
+  delete <key>...                  delete the keys
+  scan [-prefix p] [-after key] [-limit n]
+                                   print the keys in ascending order
+  watch [-prefix p] [-after seq]   print the changes until interrupted
+  export [-prefix p] [-f file]     write the keys and values as NDJSON
+  import [-f file]                 put the keys and values of NDJSON
+
+exit codes: 0 - done, 1 - no such key, 2 - invalid usage or input,
+3 - failed condition, 4 - server or network failure
+
+flags:
+`
+
+const (
+	exitOK = iota
+	exitNoSuchKey
+	exitUsage
+	exitConditionFailed
+	exitFailure
+)
+
+var errorUsage = errors.New("invalid usage")
+
+// kvctl is the state shared by the commands.
+type kvctl struct {
+	client *client.Client
+	out    *output
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command func(ctx context.Context, k *kvctl, args []string) error
+
+var commands = map[string]command{
+	"get":    get,
+	"put":    put,
+	"delete": del,
+	"scan":   scan,
+	"watch":  watchKeys,
+	"export": export,
+	"import": importKeys,
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("kvctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	addr := fs.String("addr", envOr("KVCTL_ADDR", "http://localhost:8080"), "server URL, $KVCTL_ADDR by default")
+	format := fs.String("o", formatRaw, "output format: raw, json or table")
+	timeout := fs.Duration("timeout", client.DefaultTimeout, "of a request, a watch has none")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		return exitUsage
+	}
+	out, err := newOutput(*format, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "kvctl: %s\n", err)
+		return exitUsage
+	}
+	c, err := client.New(client.Config{URL: *addr, HTTPClient: &http.Client{Timeout: *timeout}})
+	if err != nil {
+		fmt.Fprintf(stderr, "kvctl: %s\n", err)
+		return exitUsage
+	}
+
+	k := &kvctl{client: c, out: out, stdin: stdin, stdout: stdout, stderr: stderr}
+	err = cmd(ctx, k, fs.Args()[1:])
+	if ferr := out.flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "kvctl: %s\n", err)
+	}
+
+	return exitCode(err)
+}
+
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, client.ErrorNoSuchKey):
+		return exitNoSuchKey
+	case errors.Is(err, errorUsage), errors.Is(err, client.ErrorInvalidRequest):
+		return exitUsage
+	case errors.Is(err, client.ErrorConditionFailed):
+		return exitConditionFailed
+	default:
+		return exitFailure
+	}
+}
+
+// checkKeys checks the keys by the rules of the server.
+func checkKeys(keys ...string) error {
+	for _, key := range keys {
+		if err := handler.CheckKey(key); err != nil {
+			return fmt.Errorf("%w: key %q: %s", errorUsage, key, err)
+		}
+	}
+
+	return nil
+}
+
+func checkValue(value string) error {
+	if err := handler.CheckValue(value); err != nil {
+		return fmt.Errorf("%w: %s", errorUsage, err)
+	}
+
+	return nil
+}
+
+// parseFlags parses the flags of the command, which takes from minArgs to
+// maxArgs arguments, maxArgs < 0 for any number.
+func parseFlags(fs *flag.FlagSet, args []string, minArgs, maxArgs int) error {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s", errorUsage, err)
+	}
+	if fs.NArg() < minArgs || (maxArgs >= 0 && fs.NArg() > maxArgs) {
+		return fmt.Errorf("%w: %s takes %s", errorUsage, fs.Name(), argsHelp(minArgs, maxArgs))
+	}
+
+	return nil
+}
+
+func argsHelp(minArgs, maxArgs int) string {
+	switch {
+	case maxArgs < 0:
+		return fmt.Sprintf("at least %d arguments", minArgs)
+	case minArgs == maxArgs:
+		return fmt.Sprintf("%d arguments", minArgs)
+	default:
+		return fmt.Sprintf("%d to %d arguments", minArgs, maxArgs)
+	}
+}
+
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/handler"
+	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/watch"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// serve starts the real handler over local storage and returns its URL.
+func serve(t *testing.T) string {
+	t.Helper()
+
+	addr, _ := serveWithHub(t)
+
+	return addr
+}
+
+// serveWithHub is serve which returns the watch hub too.
+func serveWithHub(t *testing.T) (string, *watch.Hub) {
+	t.Helper()
+
+	logger := log.New(io.Discard, "", 0)
+	tLogger := transactionlogger.NewMockTransactionLogger(t)
+	tLogger.EXPECT().WritePut(mock.Anything, mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WritePutWithTTL(mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WriteDelete(mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WriteGroup(mock.Anything).Return(nil).Maybe()
+	hub := watch.New(logger, tLogger, watch.Config{History: 10})
+	h := handler.New(keyservice.New(logger, localstorage.New(), hub))
+
+	r := mux.NewRouter()
+	r.HandleFunc("/v1", h.Scan).Methods("GET")
+	r.HandleFunc("/v1/batch", h.Batch).Methods("POST")
+	r.HandleFunc("/v1/watch", handler.NewWatch(hub).Watch).Methods("GET")
+	r.HandleFunc("/v1/{key}", h.Put).Methods("PUT")
+	r.HandleFunc("/v1/{key}", h.Get).Methods("GET")
+	r.HandleFunc("/v1/{key}", h.Delete).Methods("DELETE")
+	s := httptest.NewServer(r)
+	t.Cleanup(s.Close)
+
+	return s.URL, hub
+}
+
+type result struct {
+	code   int
+	stdout string
+	stderr string
+}
+
+func kvctlRun(ctx context.Context, addr, stdin string, args ...string) result {
+	var stdout, stderr bytes.Buffer
+	code := run(ctx, append([]string{"-addr", addr}, args...), strings.NewReader(stdin), &stdout, &stderr)
+
+	return result{code, stdout.String(), stderr.String()}
+}
+
+func TestRun(t *testing.T) {
+	addr := serve(t)
+	ctx := context.Background()
+	for _, args := range [][]string{
+		{"put", "a1", "1"},
+		{"put", "a2", "2"},
+		{"put", "-ttl", "1h", "b1", "3"},
+	} {
+		require.Equal(t, exitOK, kvctlRun(ctx, addr, "", args...).code, args)
+	}
+
+	tests := []struct {
+		name       string
+		stdin      string
+		args       []string
+		wantCode   int
+		wantStdout string
+	}{
+		{"get", "", []string{"get", "a1"}, exitOK, "1\n"},
+		{"get json", "", []string{"-o", "json", "get", "a1", "a2"}, exitOK,
+			`{"key":"a1","value":"1"}` + "\n" + `{"key":"a2","value":"2"}` + "\n"},
+		{"get table", "", []string{"-o", "table", "get", "a1", "a2"}, exitOK,
+			"KEY  VALUE\na1   1\na2   2\n"},
+		{"get missing", "", []string{"get", "a1", "x"}, exitNoSuchKey, "1\n"},
+		{"get invalid key", "", []string{"get", "a/1"}, exitUsage, ""},
+		{"put from stdin", "from stdin\n", []string{"put", "c1"}, exitOK, ""},
+		{"put if absent", "", []string{"put", "-if-absent", "a1", "x"}, exitConditionFailed, ""},
+		{"put long value", strings.Repeat("x", 129), []string{"put", "c2"}, exitUsage, ""},
+		{"put conditional ttl", "", []string{"put", "-if-absent", "-ttl", "1s", "c2", "x"}, exitUsage, ""},
+		{"scan", "", []string{"scan", "-prefix", "a"}, exitOK, "a1\na2\n"},
+		{"scan limit", "", []string{"scan", "-after", "a1", "-limit", "2"}, exitOK, "a2\nb1\n"},
+		{"delete missing", "", []string{"delete", "x"}, exitNoSuchKey, ""},
+		{"unknown command", "", []string{"list"}, exitUsage, ""},
+		{"unknown format", "", []string{"-o", "xml", "get", "a1"}, exitUsage, ""},
+		{"no arguments", "", []string{"get"}, exitUsage, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := kvctlRun(ctx, addr, tt.stdin, tt.args...)
+
+			assert.Equal(t, tt.wantCode, res.code, res.stderr)
+			assert.Equal(t, tt.wantStdout, res.stdout)
+		})
+	}
+
+	res := kvctlRun(ctx, addr, "", "get", "c1")
+	assert.Equal(t, "from stdin\n", res.stdout)
+
+	res = kvctlRun(ctx, "http://127.0.0.1:1", "", "-timeout", "100ms", "get", "a1")
+	assert.Equal(t, exitFailure, res.code)
+}
+
+func TestRun_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	from, to := serve(t), serve(t)
+	for _, key := range []string{"a1", "a2", "b1"} {
+		require.Equal(t, exitOK, kvctlRun(ctx, from, "", "put", key, "v-"+key).code)
+	}
+	file := filepath.Join(t.TempDir(), "export.ndjson")
+
+	res := kvctlRun(ctx, from, "", "export", "-prefix", "a", "-f", file)
+	require.Equal(t, exitOK, res.code, res.stderr)
+	b, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, `{"key":"a1","value":"v-a1"}`+"\n"+`{"key":"a2","value":"v-a2"}`+"\n", string(b))
+
+	res = kvctlRun(ctx, to, "", "import", "-f", file)
+	require.Equal(t, exitOK, res.code, res.stderr)
+	res = kvctlRun(ctx, to, "", "export")
+	assert.Equal(t, string(b), res.stdout)
+
+	res = kvctlRun(ctx, to, `{"key":"c1","value":"1"}`+"\n"+`{"key":"c 2","value":"2"}`, "import")
+	assert.Equal(t, exitUsage, res.code)
+	assert.Contains(t, res.stderr, "record 2")
+	assert.Equal(t, exitNoSuchKey, kvctlRun(ctx, to, "", "get", "c1").code, "nothing is put")
+}
+
+func TestRun_Watch(t *testing.T) {
+	addr, hub := serveWithHub(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.Equal(t, exitOK, kvctlRun(ctx, addr, "", "put", "a1", "1").code)
+	require.Equal(t, exitOK, kvctlRun(ctx, addr, "", "delete", "a1").code)
+
+	done := make(chan result)
+	go func() { done <- kvctlRun(ctx, addr, "", "-o", "json", "watch", "-after", "0", "-prefix", "a") }()
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, exitOK, kvctlRun(context.Background(), addr, "", "put", "b1", "1").code)
+	require.Equal(t, exitOK, kvctlRun(context.Background(), addr, "", "put", "a2", "2").code)
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	res := <-done
+	assert.Equal(t, exitOK, res.code, res.stderr)
+	want := fmt.Sprintf(`{"sequence":%d,"type":"put","key":"a2","value":"2"}`+"\n", hub.Sequence())
+	assert.Equal(t, want, res.stdout)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	formatRaw   = "raw"
+	formatJSON  = "json"
+	formatTable = "table"
+)
+
+// column is a named value of a row, a nil value is omitted from JSON
+// and printed as empty in a table.
+type column struct {
+	name  string
+	value any
+}
+
+// output prints the rows of a command in the format: raw prints the raw
+// line of the row, json an object per line, table aligned columns under
+// a header.
+type output struct {
+	format string
+	w      io.Writer
+	table  *tabwriter.Writer
+	header bool
+}
+
+func newOutput(format string, w io.Writer) (*output, error) {
+	o := &output{format: format, w: w}
+	switch format {
+	case formatRaw, formatJSON:
+	case formatTable:
+		o.table = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	default:
+		return nil, fmt.Errorf("%w: unknown output format %q", errorUsage, format)
+	}
+
+	return o, nil
+}
+
+func (o *output) row(raw string, cols ...column) error {
+	var err error
+	switch o.format {
+	case formatRaw:
+		_, err = fmt.Fprintln(o.w, raw)
+	case formatJSON:
+		err = o.writeJSON(cols)
+	case formatTable:
+		err = o.writeTable(cols)
+	}
+	if err != nil {
+		return fmt.Errorf("cant write output: %w", err)
+	}
+
+	return nil
+}
+
+func (o *output) writeJSON(cols []column) error {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for _, c := range cols {
+		if c.value == nil {
+			continue
+		}
+		v, err := json.Marshal(c.value)
+		if err != nil {
+			return err
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%q:%s", c.name, v)
+	}
+	b.WriteString("}\n")
+	_, err := o.w.Write(b.Bytes())
+
+	return err
+}
+
+func (o *output) writeTable(cols []column) error {
+	if !o.header {
+		o.header = true
+		names := make([]string, len(cols))
+		for i, c := range cols {
+			names[i] = strings.ToUpper(c.name)
+		}
+		if _, err := fmt.Fprintln(o.table, strings.Join(names, "\t")); err != nil {
+			return err
+		}
+	}
+
+	values := make([]string, len(cols))
+	for i, c := range cols {
+		if c.value != nil {
+			values[i] = fmt.Sprint(c.value)
+		}
+	}
+	_, err := fmt.Fprintln(o.table, strings.Join(values, "\t"))
+
+	return err
+}
+
+// flush writes the buffered table rows, the columns are aligned only
+// within the rows of a flush.
+func (o *output) flush() error {
+	if o.table == nil {
+		return nil
+	}
+	if err := o.table.Flush(); err != nil {
+		return fmt.Errorf("cant write output: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/snapshot"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger/filelogger"
+)
+
+var errorStop = errors.New("stop")
+
+var eventTypes = map[transactionlogger.EventType]string{
+	transactionlogger.EventPut:    "put",
+	transactionlogger.EventDelete: "delete",
+}
+
+// dumpEvent is a line of the dump.
+type dumpEvent struct {
+	Sequence uint64 `json:"sequence"`
+	Type     string `json:"type"`
+	Key      string `json:"key"`
+	Value    string `json:"value,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+}
+
+func newDumpEvent(e transactionlogger.Event) dumpEvent {
+	d := dumpEvent{Sequence: e.Sequence, Type: eventTypes[e.EventType], Key: e.Key, Value: e.Value}
+	if d.Type == "" {
+		d.Type = strconv.Itoa(int(e.EventType))
+	}
+	if e.Expires != 0 {
+		d.Expires = time.Unix(0, e.Expires).UTC().Format(time.RFC3339Nano)
+	}
+
+	return d
+}
+
+func dump(k *kvlog, args []string) error {
+	if err := parseFlags(flag.NewFlagSet("dump", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+	l, err := k.open(k.filename)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	w := bufio.NewWriter(k.stdout)
+	enc := json.NewEncoder(w)
+	err = l.Walk(func(events []transactionlogger.Event, _ filelogger.Position) error {
+		for _, e := range events {
+			if err := enc.Encode(newDumpEvent(e)); err != nil {
+				return fmt.Errorf("cant write dump: %w", err)
+			}
+		}
+		return nil
+	})
+	if ferr := w.Flush(); err == nil && ferr != nil {
+		err = fmt.Errorf("cant write dump: %w", ferr)
+	}
+
+	return k.warnTornTail(err)
+}
+
+func verify(k *kvlog, args []string) error {
+	if err := parseFlags(flag.NewFlagSet("verify", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+	l, err := k.open(k.filename)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	var events, records int
+	var first, last uint64
+	err = k.warnTornTail(l.Walk(func(group []transactionlogger.Event, _ filelogger.Position) error {
+		if records == 0 {
+			first = group[0].Sequence
+		}
+		records++
+		events += len(group)
+		last = group[len(group)-1].Sequence
+		return nil
+	}))
+	if err != nil {
+		return fmt.Errorf("bad record after %d good events, the last sequence %d: %w", events, last, err)
+	}
+
+	if events == 0 {
+		fmt.Fprintln(k.stdout, "ok: no events")
+	} else {
+		fmt.Fprintf(k.stdout, "ok: %d events in %d records, sequences %d to %d\n", events, records, first, last)
+	}
+
+	return nil
+}
+
+// compact compacts the log as the server does, keeping the deletes
+// the snapshots may need.
+func compact(k *kvlog, args []string) error {
+	flags := flag.NewFlagSet("compact", flag.ContinueOnError)
+	dir := flags.String("snapshots", snapshot.DefaultDir, "snapshot dir of the server")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	// deletes after the oldest snapshot are kept, as on the server
+	keepDeletesAfter := uint64(math.MaxUint64)
+	sequences, err := snapshot.List(*dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(sequences) > 0 {
+		keepDeletesAfter = sequences[0]
+	}
+
+	l, err := k.open(k.filename)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	// read it the way the server does, cutting a torn record at the end
+	before := 0
+	events, errs := l.ReadEvents()
+	for range events {
+		before++
+	}
+	if err = <-errs; err != nil {
+		return err
+	}
+	if err = l.CompactAll(keepDeletesAfter); err != nil {
+		return fmt.Errorf("cant compact: %w", err)
+	}
+
+	after := 0
+	err = l.Walk(func(group []transactionlogger.Event, _ filelogger.Position) error {
+		after += len(group)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(k.stdout, "compacted %d events to %d\n", before, after)
+
+	return nil
+}
+
+// replay copies the records up to the sequence to a new log keeping their
+// sequences, so it can be used with a snapshot taken before it.
+// A record of a transaction crossing the sequence isn't copied.
+func replay(k *kvlog, args []string) (err error) {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	until := flags.Uint64("until", 0, "the last sequence to copy")
+	to := flags.String("to", "", "file name of the new log")
+	if err = parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *until == 0 || *to == "" {
+		return fmt.Errorf("%w: replay needs -until and -to", errorUsage)
+	}
+	if logExists(*to) {
+		return fmt.Errorf("%w: %s", errorLogExists, *to)
+	}
+
+	src, err := k.open(k.filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := k.create(*to)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := dst.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("cant close new log: %w", cerr)
+		}
+		if err != nil {
+			removeLog(*to)
+		}
+	}()
+
+	var n int
+	var first, last uint64
+	err = src.Walk(func(group []transactionlogger.Event, _ filelogger.Position) error {
+		if group[len(group)-1].Sequence > *until {
+			return errorStop
+		}
+		if err := dst.Append(group); err != nil {
+			return fmt.Errorf("cant write new log: %w", err)
+		}
+		if n == 0 {
+			first = group[0].Sequence
+		}
+		n += len(group)
+		last = group[len(group)-1].Sequence
+		return nil
+	})
+	if errors.Is(err, errorStop) {
+		err = nil
+	}
+	if err = k.warnTornTail(err); err != nil {
+		return err
+	}
+
+	if first > 1 {
+		fmt.Fprintf(k.stderr, "kvlog: warning: the log starts at sequence %d, "+
+			"the changes before it are only in a snapshot taken before it\n", first)
+	}
+	fmt.Fprintf(k.stdout, "replayed %d events up to sequence %d to %s\n", n, last, *to)
+
+	return nil
+}
+
+// warnTornTail prints a record torn by a crash at the end of the log as
+// a warning, the server cuts it on start.
+func (k *kvlog) warnTornTail(err error) error {
+	if !errors.Is(err, filelogger.ErrorTornTail) {
+		return err
+	}
+	fmt.Fprintf(k.stderr, "kvlog: warning: %s, the server cuts it on start\n", err)
+
+	return nil
+}
+
+// removeLog removes the files of a log which failed to be made.
+func removeLog(filename string) {
+	paths, _ := filepath.Glob(filename + ".*")
+	for _, p := range paths {
+		_ = os.Remove(p)
+	}
+}
@@ -0,0 +1,146 @@
+// Command kvlog inspects and repairs the file transaction log of a stopped
+// server.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger/filelogger"
+)
+
+const usage = `usage: kvlog [flags] <command> [args]
+
+commands:
+  dump                           print the events as JSON lines
+  verify                         check the records and their sequences, report the first bad one
+  compact [-snapshots dir]       merge all the segments into one with the latest event of every key
+  replay -until seq -to file     copy the events up to the sequence to a new log
+
+stop the server first: the commands open the log the same way it does on start.
+exit codes: 0 - done, 1 - bad log, 2 - invalid usage
+
+flags:
+`
+
+const (
+	exitOK = iota
+	exitBadLog
+	exitUsage
+)
+
+var (
+	errorUsage     = errors.New("invalid usage")
+	errorNoLog     = errors.New("no log")
+	errorLogExists = errors.New("log exists")
+)
+
+// kvlog is the state shared by the commands.
+type kvlog struct {
+	filename string
+	logger   *log.Logger
+	stdout   io.Writer
+	stderr   io.Writer
+}
+
+type command func(k *kvlog, args []string) error
+
+var commands = map[string]command{
+	"dump":    dump,
+	"verify":  verify,
+	"compact": compact,
+	"replay":  replay,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("kvlog", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	filename := fs.String("log", "transaction.log", "log file name, the segments are <name>.<id>")
+	verbose := fs.Bool("v", false, "print what the log does")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		return exitUsage
+	}
+	logger := log.New(io.Discard, "", 0)
+	if *verbose {
+		logger = log.New(stderr, "", log.Ltime|log.Lmicroseconds)
+	}
+
+	k := &kvlog{filename: *filename, logger: logger, stdout: stdout, stderr: stderr}
+	err := cmd(k, fs.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(stderr, "kvlog: %s\n", err)
+	}
+
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errorUsage), errors.Is(err, errorNoLog), errors.Is(err, errorLogExists):
+		return exitUsage
+	default:
+		return exitBadLog
+	}
+}
+
+// open opens the existing log through the same path as the server,
+// which migrates a legacy log and removes garbage files.
+func (k *kvlog) open(filename string) (*filelogger.FileTransactionLogger, error) {
+	if !logExists(filename) {
+		return nil, fmt.Errorf("%w: %s", errorNoLog, filename)
+	}
+
+	return k.create(filename)
+}
+
+func (k *kvlog) create(filename string) (*filelogger.FileTransactionLogger, error) {
+	l, err := filelogger.New(k.logger, filelogger.Config{Filename: filename})
+	if err != nil {
+		return nil, err
+	}
+
+	return l.(*filelogger.FileTransactionLogger), nil
+}
+
+// logExists reports if there is a legacy log file, a manifest or a segment.
+func logExists(filename string) bool {
+	if _, err := os.Stat(filename); err == nil {
+		return true
+	}
+	paths, _ := filepath.Glob(filename + ".*")
+
+	return len(paths) > 0
+}
+
+// parseFlags parses the flags of the command, which takes no arguments.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s", errorUsage, err)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: %s takes no arguments", errorUsage, fs.Name())
+	}
+
+	return nil
+}
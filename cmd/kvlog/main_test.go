@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger/filelogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type result struct {
+	code   int
+	stdout string
+	stderr string
+}
+
+func kvlogRun(args ...string) result {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+
+	return result{code, stdout.String(), stderr.String()}
+}
+
+// writeLog writes puts of a, b and c, a delete of b and a group of puts
+// of d and e.
+func writeLog(t *testing.T) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "transaction.log")
+	l, err := filelogger.New(log.New(io.Discard, "", 0), filelogger.Config{Filename: filename, Sync: filelogger.SyncModeAlways})
+	require.NoError(t, err)
+	l.Run()
+	require.NoError(t, l.WritePut("a", "1"))
+	require.NoError(t, l.WritePutWithTTL("b", "2", time.Unix(0, 1700000000000000000)))
+	require.NoError(t, l.WritePut("c", "3"))
+	require.NoError(t, l.WriteDelete("b"))
+	require.NoError(t, l.WriteGroup([]transactionlogger.Event{
+		{EventType: transactionlogger.EventPut, Key: "d", Value: "4"},
+		{EventType: transactionlogger.EventPut, Key: "e", Value: "5"},
+	}))
+	require.NoError(t, l.(*filelogger.FileTransactionLogger).Close())
+
+	return filename
+}
+
+func TestRun_Dump(t *testing.T) {
+	filename := writeLog(t)
+
+	res := kvlogRun("-log", filename, "dump")
+
+	require.Equal(t, exitOK, res.code, res.stderr)
+	assert.Equal(t, `{"sequence":1,"type":"put","key":"a","value":"1"}
+{"sequence":2,"type":"put","key":"b","value":"2","expires":"2023-11-14T22:13:20Z"}
+{"sequence":3,"type":"put","key":"c","value":"3"}
+{"sequence":4,"type":"delete","key":"b"}
+{"sequence":5,"type":"put","key":"d","value":"4"}
+{"sequence":6,"type":"put","key":"e","value":"5"}
+`, res.stdout)
+}
+
+func TestRun_Verify(t *testing.T) {
+	tests := []struct {
+		name       string
+		damage     func(segment []byte) []byte
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{"valid", nil, exitOK, "ok: 6 events in 5 records, sequences 1 to 6\n", ""},
+		{
+			"torn tail",
+			func(b []byte) []byte { return append(b, 20, 0, 0) },
+			exitOK,
+			"ok: 6 events in 5 records, sequences 1 to 6\n",
+			"warning: torn record",
+		},
+		{
+			"corrupted",
+			func(b []byte) []byte { b[len(b)/2] ^= 0xff; return b },
+			exitBadLog,
+			"",
+			"bad record after 2 good events, the last sequence 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := writeLog(t)
+			if tt.damage != nil {
+				b, err := os.ReadFile(filename + ".000001")
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(filename+".000001", tt.damage(b), 0o755))
+			}
+
+			res := kvlogRun("-log", filename, "verify")
+
+			assert.Equal(t, tt.wantCode, res.code, res.stderr)
+			assert.Equal(t, tt.wantStdout, res.stdout)
+			assert.Contains(t, res.stderr, tt.wantStderr)
+		})
+	}
+
+	res := kvlogRun("-log", filepath.Join(t.TempDir(), "transaction.log"), "verify")
+	assert.Equal(t, exitUsage, res.code)
+	assert.Contains(t, res.stderr, "no log")
+}
+
+func TestRun_Compact(t *testing.T) {
+	filename := writeLog(t)
+
+	res := kvlogRun("-log", filename, "compact", "-snapshots", filepath.Join(t.TempDir(), "snapshots"))
+
+	require.Equal(t, exitOK, res.code, res.stderr)
+	assert.Equal(t, "compacted 6 events to 4\n", res.stdout)
+	res = kvlogRun("-log", filename, "dump")
+	assert.Equal(t, `{"sequence":1,"type":"put","key":"a","value":"1"}
+{"sequence":3,"type":"put","key":"c","value":"3"}
+{"sequence":5,"type":"put","key":"d","value":"4"}
+{"sequence":6,"type":"put","key":"e","value":"5"}
+`, res.stdout)
+}
+
+func TestRun_Replay(t *testing.T) {
+	filename := writeLog(t)
+	to := filepath.Join(t.TempDir(), "recovered.log")
+
+	// the group of 5 and 6 is copied all or nothing
+	res := kvlogRun("-log", filename, "replay", "-until", "5", "-to", to)
+
+	require.Equal(t, exitOK, res.code, res.stderr)
+	assert.Equal(t, "replayed 4 events up to sequence 4 to "+to+"\n", res.stdout)
+	res = kvlogRun("-log", to, "verify")
+	assert.Equal(t, "ok: 4 events in 4 records, sequences 1 to 4\n", res.stdout)
+
+	res = kvlogRun("-log", filename, "replay", "-until", "5", "-to", to)
+	assert.Equal(t, exitUsage, res.code)
+	res = kvlogRun("-log", filename, "replay", "-to", to)
+	assert.Equal(t, exitUsage, res.code)
+}
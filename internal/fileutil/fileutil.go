@@ -0,0 +1,43 @@
+package fileutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic replaces the file with data, so that after a crash
+// the file has either old or new content.
+func WriteFileAtomic(name string, data []byte) error {
+	tempName := name + ".tmp"
+	file, err := os.OpenFile(tempName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return fmt.Errorf("cant create temp file: %w", err)
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return fmt.Errorf("cant write temp file: %w", err)
+	}
+
+	if err = os.Rename(tempName, name); err != nil {
+		return fmt.Errorf("cant rename temp file: %w", err)
+	}
+	return SyncDir(filepath.Dir(name))
+}
+
+// SyncDir makes renames and removals in the dir durable.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("cant open dir: %w", err)
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
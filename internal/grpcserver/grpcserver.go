@@ -0,0 +1,256 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/dimishpatriot/kv-storage/api/kvpb"
+	"github.com/dimishpatriot/kv-storage/internal/handler"
+	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
+	"github.com/dimishpatriot/kv-storage/internal/services/raft"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/watch"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+// keys of a Scan response
+const scanPage = 100
+
+var (
+	ErrorConditions = errors.New("if_absent and if_value can't be used together")
+	ErrorUnknownOp  = errors.New("op must be OP_PUT or OP_DELETE")
+)
+
+// Server is the gRPC API of the key service.
+type Server struct {
+	kvpb.UnimplementedKVServer
+	keyService keyservice.KeyService
+	watcher    handler.Watcher // nil if watches aren't served
+}
+
+func New(keyService keyservice.KeyService, watcher handler.Watcher) *Server {
+	return &Server{keyService: keyService, watcher: watcher}
+}
+
+func (s *Server) Get(_ context.Context, req *kvpb.GetRequest) (*kvpb.GetResponse, error) {
+	if err := handler.CheckKey(req.Key); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	v, err := s.keyService.Get(req.Key)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &kvpb.GetResponse{Value: v}, nil
+}
+
+func (s *Server) Put(_ context.Context, req *kvpb.PutRequest) (*kvpb.PutResponse, error) {
+	if err := checkPut(req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var err error
+	switch {
+	case req.IfAbsent:
+		err = s.keyService.PutIfAbsent(req.Key, req.Value)
+	case req.IfValue != nil:
+		err = s.keyService.CompareAndSwap(req.Key, *req.IfValue, req.Value)
+		if errors.Is(err, storage.ErrorNoSuchKey) {
+			err = storage.ErrorConditionFailed
+		}
+	case req.Ttl != nil:
+		err = s.keyService.PutWithTTL(req.Key, req.Value, req.Ttl.AsDuration())
+	default:
+		err = s.keyService.Put(req.Key, req.Value)
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &kvpb.PutResponse{}, nil
+}
+
+func checkPut(req *kvpb.PutRequest) error {
+	if err := handler.CheckKey(req.Key); err != nil {
+		return err
+	}
+	if err := handler.CheckValue(req.Value); err != nil {
+		return err
+	}
+	conditional := req.IfAbsent || req.IfValue != nil
+	switch {
+	case req.IfAbsent && req.IfValue != nil:
+		return ErrorConditions
+	case req.Ttl != nil && conditional:
+		return handler.ErrorConditionalTTL
+	case req.Ttl != nil && (req.Ttl.CheckValid() != nil || req.Ttl.AsDuration() <= 0):
+		return handler.ErrorInvalidTTL
+	}
+
+	return nil
+}
+
+func (s *Server) Delete(_ context.Context, req *kvpb.DeleteRequest) (*kvpb.DeleteResponse, error) {
+	if err := handler.CheckKey(req.Key); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := s.keyService.Delete(req.Key); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &kvpb.DeleteResponse{}, nil
+}
+
+func (s *Server) BatchWrite(_ context.Context, req *kvpb.BatchWriteRequest) (*kvpb.BatchWriteResponse, error) {
+	ops := make([]storage.Op, 0, len(req.Writes))
+	for i, w := range req.Writes {
+		op, err := toOp(w)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("write %d: %s", i, err))
+		}
+		ops = append(ops, op)
+	}
+
+	if req.Atomic {
+		if err := s.keyService.Apply(ops); err != nil {
+			return nil, toStatus(err)
+		}
+		return &kvpb.BatchWriteResponse{}, nil
+	}
+
+	results, err := s.keyService.Batch(ops)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	res := &kvpb.BatchWriteResponse{Results: make([]*kvpb.WriteResult, 0, len(results))}
+	for _, r := range results {
+		if r.Err != nil && !errors.Is(r.Err, storage.ErrorNoSuchKey) {
+			return nil, toStatus(r.Err)
+		}
+		res.Results = append(res.Results, &kvpb.WriteResult{NotFound: r.Err != nil})
+	}
+
+	return res, nil
+}
+
+func toOp(w *kvpb.Write) (storage.Op, error) {
+	if err := handler.CheckKey(w.Key); err != nil {
+		return storage.Op{}, err
+	}
+
+	switch w.Op {
+	case kvpb.Write_OP_PUT:
+		if err := handler.CheckValue(w.Value); err != nil {
+			return storage.Op{}, err
+		}
+		return storage.Op{Type: storage.OpPut, Key: w.Key, Value: w.Value}, nil
+	case kvpb.Write_OP_DELETE:
+		return storage.Op{Type: storage.OpDelete, Key: w.Key}, nil
+	default:
+		return storage.Op{}, ErrorUnknownOp
+	}
+}
+
+// Scan streams the keys by pages, a page is read from the storage at once.
+func (s *Server) Scan(req *kvpb.ScanRequest, stream kvpb.KV_ScanServer) error {
+	for _, k := range []string{req.Prefix, req.StartAfter} {
+		if err := handler.CheckKey(k); k != "" && err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	if req.Limit < 0 {
+		return status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+
+	after, sent := req.StartAfter, 0
+	for {
+		n := scanPage
+		if req.Limit > 0 {
+			n = min(n, int(req.Limit)-sent)
+		}
+		keys, err := s.keyService.Scan(req.Prefix, after, n)
+		if err != nil {
+			return toStatus(err)
+		}
+		if len(keys) > 0 {
+			if err = stream.Send(&kvpb.ScanResponse{Keys: keys}); err != nil {
+				return err
+			}
+		}
+		if len(keys) < n || (req.Limit > 0 && sent+len(keys) == int(req.Limit)) {
+			return nil
+		}
+		after, sent = keys[len(keys)-1], sent+len(keys)
+	}
+}
+
+// Watch streams the changes until the client cancels the call. A client
+// which lags too far behind gets ABORTED and may resume after the
+// sequence of the last received event.
+func (s *Server) Watch(req *kvpb.WatchRequest, stream kvpb.KV_WatchServer) error {
+	if s.watcher == nil {
+		return status.Error(codes.Unimplemented, "watch isn't served")
+	}
+
+	sub, err := s.watcher.Subscribe(req.Prefix, req.After)
+	if err != nil {
+		return toStatus(err)
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e, ok := <-sub.Events():
+			if !ok {
+				return status.Error(codes.Aborted, sub.Err().Error())
+			}
+			if err = stream.Send(toEvent(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func toEvent(e transactionlogger.Event) *kvpb.WatchEvent {
+	t := kvpb.WatchEvent_TYPE_PUT
+	if e.EventType == transactionlogger.EventDelete {
+		t = kvpb.WatchEvent_TYPE_DELETE
+	}
+
+	return &kvpb.WatchEvent{
+		Sequence: e.Sequence,
+		Type:     t,
+		Key:      e.Key,
+		Value:    e.Value,
+		Expires:  e.Expires,
+	}
+}
+
+// toStatus returns the status of a key service or watch error.
+func toStatus(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, storage.ErrorNoSuchKey):
+		code = codes.NotFound
+	case errors.Is(err, storage.ErrorConditionFailed):
+		code = codes.FailedPrecondition
+	case errors.Is(err, storage.ErrorInvalidTTL):
+		code = codes.InvalidArgument
+	case errors.Is(err, storage.ErrorNotSupported):
+		code = codes.Unimplemented
+	case errors.Is(err, watch.ErrorSequenceGone):
+		code = codes.OutOfRange
+	case raft.Retryable(err):
+		code = codes.Unavailable
+	}
+
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,220 @@
+package grpcserver_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/dimishpatriot/kv-storage/api/kvpb"
+	"github.com/dimishpatriot/kv-storage/internal/grpcserver"
+	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/watch"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
+)
+
+var logger = log.New(io.Discard, "", 0)
+
+// serve starts the server over local storage and returns a client of it.
+func serve(t *testing.T) kvpb.KVClient {
+	t.Helper()
+
+	c, _ := serveWithHub(t)
+
+	return c
+}
+
+// serveWithHub is serve which returns the watch hub too.
+func serveWithHub(t *testing.T) (kvpb.KVClient, *watch.Hub) {
+	t.Helper()
+
+	tLogger := transactionlogger.NewMockTransactionLogger(t)
+	tLogger.EXPECT().WritePut(mock.Anything, mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WritePutWithTTL(mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WriteDelete(mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WriteGroup(mock.Anything).Return(nil).Maybe()
+	hub := watch.New(logger, tLogger, watch.Config{})
+
+	s := grpc.NewServer()
+	kvpb.RegisterKVServer(s, grpcserver.New(keyservice.New(logger, localstorage.New(), hub), hub))
+	l := bufconn.Listen(1 << 20)
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return kvpb.NewKVClient(conn), hub
+}
+
+func TestServer_Put(t *testing.T) {
+	ctx := context.Background()
+	c := serve(t)
+	_, err := c.Put(ctx, &kvpb.PutRequest{Key: "one", Value: "1"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		req  *kvpb.PutRequest
+		want codes.Code
+	}{
+		{"put", &kvpb.PutRequest{Key: "two", Value: "2"}, codes.OK},
+		{"ttl", &kvpb.PutRequest{Key: "ttl", Value: "t", Ttl: durationpb.New(time.Hour)}, codes.OK},
+		{"if absent", &kvpb.PutRequest{Key: "three", Value: "3", IfAbsent: true}, codes.OK},
+		{"if absent existing", &kvpb.PutRequest{Key: "one", Value: "x", IfAbsent: true}, codes.FailedPrecondition},
+		{"if value", &kvpb.PutRequest{Key: "one", Value: "ONE", IfValue: proto.String("1")}, codes.OK},
+		{"if other value", &kvpb.PutRequest{Key: "one", Value: "x", IfValue: proto.String("1")}, codes.FailedPrecondition},
+		{"if value absent", &kvpb.PutRequest{Key: "absent", Value: "x", IfValue: proto.String("1")}, codes.FailedPrecondition},
+		{"both conditions", &kvpb.PutRequest{Key: "one", Value: "x", IfAbsent: true, IfValue: proto.String("1")}, codes.InvalidArgument},
+		{"ttl with condition", &kvpb.PutRequest{Key: "one", Value: "x", IfAbsent: true, Ttl: durationpb.New(time.Hour)}, codes.InvalidArgument},
+		{"negative ttl", &kvpb.PutRequest{Key: "one", Value: "x", Ttl: durationpb.New(-time.Hour)}, codes.InvalidArgument},
+		{"invalid key", &kvpb.PutRequest{Key: "a/b", Value: "x"}, codes.InvalidArgument},
+		{"empty value", &kvpb.PutRequest{Key: "one"}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.Put(ctx, tt.req)
+			assert.Equal(t, tt.want, status.Code(err), err)
+		})
+	}
+
+	res, err := c.Get(ctx, &kvpb.GetRequest{Key: "one"})
+	require.NoError(t, err)
+	assert.Equal(t, "ONE", res.Value)
+}
+
+func TestServer_GetDelete(t *testing.T) {
+	ctx := context.Background()
+	c := serve(t)
+	_, err := c.Put(ctx, &kvpb.PutRequest{Key: "one", Value: "1"})
+	require.NoError(t, err)
+
+	_, err = c.Delete(ctx, &kvpb.DeleteRequest{Key: "one"})
+	require.NoError(t, err)
+	_, err = c.Delete(ctx, &kvpb.DeleteRequest{Key: "one"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = c.Get(ctx, &kvpb.GetRequest{Key: "one"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = c.Get(ctx, &kvpb.GetRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_BatchWrite(t *testing.T) {
+	ctx := context.Background()
+	c := serve(t)
+
+	res, err := c.BatchWrite(ctx, &kvpb.BatchWriteRequest{Writes: []*kvpb.Write{
+		{Op: kvpb.Write_OP_PUT, Key: "one", Value: "1"},
+		{Op: kvpb.Write_OP_DELETE, Key: "absent"},
+		{Op: kvpb.Write_OP_PUT, Key: "two", Value: "2"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []bool{false, true, false}, []bool{
+		res.Results[0].NotFound, res.Results[1].NotFound, res.Results[2].NotFound,
+	})
+
+	res, err = c.BatchWrite(ctx, &kvpb.BatchWriteRequest{Atomic: true, Writes: []*kvpb.Write{
+		{Op: kvpb.Write_OP_DELETE, Key: "one"},
+		{Op: kvpb.Write_OP_PUT, Key: "three", Value: "3"},
+	}})
+	require.NoError(t, err)
+	assert.Empty(t, res.Results)
+	_, err = c.Get(ctx, &kvpb.GetRequest{Key: "one"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = c.BatchWrite(ctx, &kvpb.BatchWriteRequest{Writes: []*kvpb.Write{
+		{Op: kvpb.Write_OP_PUT, Key: "four", Value: "4"},
+		{Key: "five"},
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = c.Get(ctx, &kvpb.GetRequest{Key: "four"})
+	assert.Equal(t, codes.NotFound, status.Code(err), "invalid batch is partially written")
+}
+
+func TestServer_Scan(t *testing.T) {
+	ctx := context.Background()
+	c := serve(t)
+	writes := []*kvpb.Write{}
+	all := []string{}
+	for i := 0; i < 250; i++ {
+		k := string(rune('a'+i/26/26%26)) + string(rune('a'+i/26%26)) + string(rune('a'+i%26))
+		writes = append(writes, &kvpb.Write{Op: kvpb.Write_OP_PUT, Key: k, Value: "v"})
+		all = append(all, k)
+	}
+	_, err := c.BatchWrite(ctx, &kvpb.BatchWriteRequest{Writes: writes})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		req  *kvpb.ScanRequest
+		want []string
+	}{
+		{"all by pages", &kvpb.ScanRequest{}, all},
+		{"prefix", &kvpb.ScanRequest{Prefix: "ai"}, all[208:234]},
+		{"after with limit", &kvpb.ScanRequest{StartAfter: all[9], Limit: 150}, all[10:160]},
+		{"limit of a page", &kvpb.ScanRequest{Limit: 100}, all[:100]},
+		{"nothing", &kvpb.ScanRequest{Prefix: "z"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := c.Scan(ctx, tt.req)
+			require.NoError(t, err)
+
+			got := []string{}
+			for {
+				res, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				assert.LessOrEqual(t, len(res.Keys), 100)
+				got = append(got, res.Keys...)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestServer_Watch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, hub := serveWithHub(t)
+	_, err := c.Put(ctx, &kvpb.PutRequest{Key: "user-1", Value: "1"})
+	require.NoError(t, err)
+
+	// resumes after the first change
+	first := hub.Sequence()
+	stream, err := c.Watch(ctx, &kvpb.WatchRequest{Prefix: "user-", After: first})
+	require.NoError(t, err)
+	_, err = c.Put(ctx, &kvpb.PutRequest{Key: "other", Value: "x"})
+	require.NoError(t, err)
+	_, err = c.Delete(ctx, &kvpb.DeleteRequest{Key: "user-1"})
+	require.NoError(t, err)
+
+	e, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, kvpb.WatchEvent_TYPE_DELETE, e.Type)
+	assert.Equal(t, "user-1", e.Key)
+	assert.Equal(t, first+2, e.Sequence)
+
+	_, err = c.Watch(ctx, &kvpb.WatchRequest{After: 100})
+	require.NoError(t, err)
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+//go:generate mockery --name AdminHandler
+type AdminHandler interface {
+	Snapshot(http.ResponseWriter, *http.Request)
+}
+
+// Snapshotter takes a snapshot of the storage and returns its sequence.
+type Snapshotter interface {
+	Take() (uint64, error)
+}
+
+type adminHandler struct {
+	snapshotter Snapshotter
+}
+
+type snapshotResponse struct {
+	Sequence uint64 `json:"sequence"`
+}
+
+func NewAdmin(snapshotter Snapshotter) AdminHandler {
+	return &adminHandler{snapshotter}
+}
+
+func (ah *adminHandler) Snapshot(w http.ResponseWriter, r *http.Request) {
+	sequence, err := ah.snapshotter.Take()
+	if err != nil {
+		http.Error(w,
+			err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(snapshotResponse{sequence})
+}
@@ -0,0 +1,53 @@
+package handler_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dimishpatriot/kv-storage/internal/handler"
+)
+
+type snapshotterFunc func() (uint64, error)
+
+func (f snapshotterFunc) Take() (uint64, error) { return f() }
+
+func TestAdminHandler_Snapshot(t *testing.T) {
+	tests := []struct {
+		name     string
+		take     snapshotterFunc
+		wantCode int
+		wantBody string
+	}{
+		{
+			"taken",
+			func() (uint64, error) { return 42, nil },
+			http.StatusCreated,
+			`{"sequence":42}`,
+		},
+		{
+			"failure",
+			func() (uint64, error) { return 0, errors.New("disk is full") },
+			http.StatusInternalServerError,
+			"disk is full",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ah := handler.NewAdmin(tt.take)
+			res := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/admin/snapshot", nil)
+
+			ah.Snapshot(res, r)
+
+			if res.Code != tt.wantCode {
+				t.Errorf("Snapshot() code = %d, want %d", res.Code, tt.wantCode)
+			}
+			if got := strings.TrimSpace(res.Body.String()); got != tt.wantBody {
+				t.Errorf("Snapshot() body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+const (
+	// batchChunk is the number of operations passed to the key service at once,
+	// a chunk of max size keys and values is logged as one record.
+	batchChunk = 1000
+	ndjsonType = "application/x-ndjson"
+)
+
+var (
+	ErrorInvalidBatch   = errors.New("batch must be a JSON list or NDJSON stream of operations")
+	ErrorInvalidBatchOp = errors.New(`op must be "get", "put" or "delete"`)
+)
+
+var batchOpTypes = map[string]storage.OpType{
+	"get":    storage.OpGet,
+	"put":    storage.OpPut,
+	"delete": storage.OpDelete,
+}
+
+// batchResult is a result of an operation of POST /v1/batch,
+// status is the code of the same single key request.
+type batchResult struct {
+	Key    string `json:"key"`
+	Status int    `json:"status"`
+	Value  string `json:"value,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Batch runs a JSON list or NDJSON stream of get, put and delete operations
+// and returns the results in the same format and order.
+// The operations are independent, a failed one doesn't stop the others.
+func (dh *dataHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	ndjson := strings.HasPrefix(r.Header.Get("Content-Type"), ndjsonType)
+	dec := json.NewDecoder(r.Body)
+	if !ndjson {
+		if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+			http.Error(w,
+				ErrorInvalidBatch.Error(),
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	out := &batchWriter{w: w, ndjson: ndjson}
+	chunk := make([]txnOp, 0, batchChunk)
+	for {
+		more := dec.More()
+		if more {
+			var o txnOp
+			if err := dec.Decode(&o); err != nil {
+				out.fail(ErrorInvalidBatch)
+				return
+			}
+			chunk = append(chunk, o)
+		}
+		if len(chunk) == batchChunk || (!more && len(chunk) > 0) {
+			out.write(dh.runBatch(chunk))
+			chunk = chunk[:0]
+		}
+		if !more {
+			break
+		}
+	}
+	if !ndjson {
+		if t, err := dec.Token(); err != nil || t != json.Delim(']') {
+			out.fail(ErrorInvalidBatch)
+			return
+		}
+	}
+
+	out.close()
+}
+
+func (dh *dataHandler) runBatch(req []txnOp) []batchResult {
+	results := make([]batchResult, len(req))
+	ops := make([]storage.Op, 0, len(req))
+	index := make([]int, 0, len(req)) // of the result of every op
+	for i, o := range req {
+		results[i].Key = o.Key
+		op, err := parseBatchOp(o)
+		if err != nil {
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = err.Error()
+			continue
+		}
+		ops = append(ops, op)
+		index = append(index, i)
+	}
+	if len(ops) == 0 {
+		return results
+	}
+
+	done, err := dh.keyService.Batch(ops)
+	for j, op := range ops {
+		res := &results[index[j]]
+		switch {
+		case err != nil:
+			res.Status = errorStatus(err)
+			res.Error = err.Error()
+		case errors.Is(done[j].Err, storage.ErrorNoSuchKey):
+			res.Status = http.StatusNotFound
+			res.Error = done[j].Err.Error()
+		case done[j].Err != nil:
+			res.Status = http.StatusInternalServerError
+			res.Error = done[j].Err.Error()
+		case op.Type == storage.OpPut:
+			res.Status = http.StatusCreated
+		default:
+			res.Status = http.StatusOK
+			res.Value = done[j].Value
+		}
+	}
+
+	return results
+}
+
+func parseBatchOp(o txnOp) (storage.Op, error) {
+	t, ok := batchOpTypes[o.Op]
+	if !ok {
+		return storage.Op{}, ErrorInvalidBatchOp
+	}
+	if err := CheckKey(o.Key); err != nil {
+		return storage.Op{}, err
+	}
+	if t == storage.OpPut {
+		if err := CheckValue(o.Value); err != nil {
+			return storage.Op{}, err
+		}
+	}
+
+	return storage.Op{Type: t, Key: o.Key, Value: o.Value}, nil
+}
+
+// batchWriter streams the results as they are ready.
+type batchWriter struct {
+	w       http.ResponseWriter
+	ndjson  bool
+	started bool
+	items   int
+}
+
+func (bw *batchWriter) start() {
+	if bw.started {
+		return
+	}
+	bw.started = true
+	if bw.ndjson {
+		bw.w.Header().Set("Content-Type", ndjsonType)
+	} else {
+		bw.w.Header().Set("Content-Type", "application/json")
+	}
+	bw.w.WriteHeader(http.StatusOK)
+	if !bw.ndjson {
+		_, _ = bw.w.Write([]byte("["))
+	}
+}
+
+func (bw *batchWriter) write(results []batchResult) {
+	bw.start()
+	for _, res := range results {
+		b, _ := json.Marshal(res)
+		switch {
+		case bw.ndjson:
+			b = append(b, '\n')
+		case bw.items > 0:
+			b = append([]byte(","), b...)
+		}
+		_, _ = bw.w.Write(b)
+		bw.items++
+	}
+	if f, ok := bw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// fail reports a broken request, after the first results it's the last item.
+func (bw *batchWriter) fail(err error) {
+	if !bw.started {
+		http.Error(bw.w,
+			err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+	bw.write([]batchResult{{Status: http.StatusBadRequest, Error: err.Error()}})
+	bw.close()
+}
+
+func (bw *batchWriter) close() {
+	bw.start()
+	if !bw.ndjson {
+		_, _ = bw.w.Write([]byte("]"))
+	}
+}
@@ -0,0 +1,118 @@
+package handler_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+func TestDataHandler_Batch(t *testing.T) {
+	type want struct {
+		status int
+		body   string
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		ops         []storage.Op // ops passed to the key service
+		results     []storage.Result
+		err         error // error returned by the key service
+		want        want
+	}{
+		{
+			"json list",
+			"application/json",
+			`[{"op":"put","key":"one","value":"1"},{"op":"get","key":"one"},` +
+				`{"op":"delete","key":"two"},{"op":"increment","key":"one"}]`,
+			[]storage.Op{
+				{Type: storage.OpPut, Key: "one", Value: "1"},
+				{Type: storage.OpGet, Key: "one"},
+				{Type: storage.OpDelete, Key: "two"},
+			},
+			[]storage.Result{{}, {Value: "1"}, {Err: storage.ErrorNoSuchKey}},
+			nil,
+			want{
+				http.StatusOK,
+				`[{"key":"one","status":201},{"key":"one","status":200,"value":"1"},` +
+					`{"key":"two","status":404,"error":"no such key"},` +
+					`{"key":"one","status":400,"error":"op must be \"get\", \"put\" or \"delete\""}]`,
+			},
+		},
+		{
+			"ndjson stream",
+			"application/x-ndjson",
+			"{\"op\":\"get\",\"key\":\"one\"}\n{\"op\":\"put\",\"key\":\"a b\",\"value\":\"1\"}\n",
+			[]storage.Op{{Type: storage.OpGet, Key: "one"}},
+			[]storage.Result{{Value: "1"}},
+			nil,
+			want{
+				http.StatusOK,
+				"{\"key\":\"one\",\"status\":200,\"value\":\"1\"}\n" +
+					"{\"key\":\"a b\",\"status\":400,\"error\":\"forbidden symbol in key\"}\n",
+			},
+		},
+		{
+			"failed key service",
+			"application/json",
+			`[{"op":"delete","key":"one"}]`,
+			[]storage.Op{{Type: storage.OpDelete, Key: "one"}},
+			nil,
+			errors.New("db is down"),
+			want{http.StatusOK, `[{"key":"one","status":500,"error":"db is down"}]`},
+		},
+		{
+			"empty list",
+			"application/json",
+			`[]`,
+			nil,
+			nil,
+			nil,
+			want{http.StatusOK, `[]`},
+		},
+		{
+			"not a list",
+			"application/json",
+			`{"op":"get","key":"one"}`,
+			nil,
+			nil,
+			nil,
+			want{http.StatusBadRequest, "batch must be a JSON list or NDJSON stream of operations\n"},
+		},
+		{
+			"broken item",
+			"application/json",
+			`[{"op":"get","key":"one"},{"op":`,
+			nil,
+			nil,
+			nil,
+			want{http.StatusBadRequest, "batch must be a JSON list or NDJSON stream of operations\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := setupTest(t)
+			defer after(t)
+
+			if tt.ops != nil {
+				serviceMock.EXPECT().Batch(tt.ops).Return(tt.results, tt.err)
+			}
+			res := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			dlh.Batch(res, r)
+
+			if res.Code != tt.want.status {
+				t.Errorf("Batch() code = %d, want %d", res.Code, tt.want.status)
+			}
+			if got := res.Body.String(); got != tt.want.body {
+				t.Errorf("Batch() body = %s, want %s", got, tt.want.body)
+			}
+		})
+	}
+}
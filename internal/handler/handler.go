@@ -1,10 +1,15 @@
 package handler
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/fnv"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
 	"github.com/dimishpatriot/kv-storage/internal/storage"
@@ -16,6 +21,9 @@ type Handler interface {
 	Put(http.ResponseWriter, *http.Request)
 	Get(http.ResponseWriter, *http.Request)
 	Delete(http.ResponseWriter, *http.Request)
+	Scan(http.ResponseWriter, *http.Request)
+	Txn(http.ResponseWriter, *http.Request)
+	Batch(http.ResponseWriter, *http.Request)
 }
 
 type dataHandler struct {
@@ -28,8 +36,25 @@ var (
 	ErrorKeyContainsForbiddenSymbol = errors.New("forbidden symbol in key")
 	ErrorEmptyValue                 = errors.New("empty value")
 	ErrorLongValue                  = errors.New("value length > 128 byte")
+	ErrorInvalidTTL                 = errors.New("ttl must be a positive duration or number of seconds")
+	ErrorConditionalTTL             = errors.New("ttl can't be used with conditional put")
+	ErrorInvalidLimit               = errors.New("limit must be a number from 1 to 1000")
 )
 
+const (
+	defaultScanLimit = 100
+	maxScanLimit     = 1000
+)
+
+// TTLHeader is the time left to a key which expires, it's sent along with
+// the value.
+const TTLHeader = "X-TTL"
+
+type scanResponse struct {
+	Keys []string `json:"keys"`
+	Next string   `json:"next,omitempty"` // pass as "after" to get the next page
+}
+
 func New(keyService keyservice.KeyService) Handler {
 	return &dataHandler{keyService}
 }
@@ -43,16 +68,24 @@ func (dh *dataHandler) Put(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ttl, err := getTTLFromRequest(r)
+	if err != nil {
+		http.Error(w,
+			err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
 	bValue, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w,
 			err.Error(),
-			http.StatusInternalServerError)
+			errorStatus(err))
 		return
 	}
 
 	value := string(bValue)
-	err = checkValue(value)
+	err = CheckValue(value)
 	if err != nil {
 		http.Error(w,
 			err.Error(),
@@ -60,17 +93,92 @@ func (dh *dataHandler) Put(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = dh.keyService.Put(key, value)
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	if ttl > 0 && (ifMatch != "" || ifNoneMatch != "") {
+		http.Error(w,
+			ErrorConditionalTTL.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case ifMatch != "":
+		err = dh.putIfMatch(key, value, ifMatch)
+	case ifNoneMatch != "":
+		err = dh.putIfNoneMatch(key, value, ifNoneMatch)
+	case ttl > 0:
+		err = dh.keyService.PutWithTTL(key, value, ttl)
+	default:
+		err = dh.keyService.Put(key, value)
+	}
+	if errors.Is(err, storage.ErrorConditionFailed) {
+		http.Error(w,
+			err.Error(),
+			http.StatusPreconditionFailed)
+		return
+	}
+	if errors.Is(err, storage.ErrorNotSupported) {
+		http.Error(w,
+			err.Error(),
+			http.StatusNotImplemented)
+		return
+	}
 	if err != nil {
 		http.Error(w,
 			err.Error(),
-			http.StatusInternalServerError)
+			errorStatus(err))
 		return
 	}
 
+	w.Header().Set("ETag", makeETag(value))
 	w.WriteHeader(http.StatusCreated)
 }
 
+// putIfMatch replaces the value only if the ETag of the current one matches.
+func (dh *dataHandler) putIfMatch(key, value, ifMatch string) error {
+	current, err := dh.keyService.Get(key)
+	if errors.Is(err, storage.ErrorNoSuchKey) {
+		return storage.ErrorConditionFailed
+	}
+	if err != nil {
+		return err
+	}
+	if !matchETag(ifMatch, makeETag(current), false) {
+		return storage.ErrorConditionFailed
+	}
+
+	err = dh.keyService.CompareAndSwap(key, current, value)
+	if errors.Is(err, storage.ErrorNoSuchKey) {
+		return storage.ErrorConditionFailed
+	}
+	return err
+}
+
+// putIfNoneMatch puts the value only if the key is absent ("*") or the ETag
+// of the current value doesn't match.
+func (dh *dataHandler) putIfNoneMatch(key, value, ifNoneMatch string) error {
+	if ifNoneMatch == "*" {
+		return dh.keyService.PutIfAbsent(key, value)
+	}
+
+	current, err := dh.keyService.Get(key)
+	if errors.Is(err, storage.ErrorNoSuchKey) {
+		return dh.keyService.PutIfAbsent(key, value)
+	}
+	if err != nil {
+		return err
+	}
+	if matchETag(ifNoneMatch, makeETag(current), true) {
+		return storage.ErrorConditionFailed
+	}
+
+	err = dh.keyService.CompareAndSwap(key, current, value)
+	if errors.Is(err, storage.ErrorNoSuchKey) {
+		return storage.ErrorConditionFailed
+	}
+	return err
+}
+
 func (dh *dataHandler) Get(w http.ResponseWriter, r *http.Request) {
 	key, err := dh.getKeyFromRequest(r)
 	if err != nil {
@@ -80,7 +188,7 @@ func (dh *dataHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	value, err := dh.keyService.Get(key)
+	value, ttl, err := dh.keyService.GetWithTTL(key)
 	if errors.Is(err, storage.ErrorNoSuchKey) {
 		http.Error(w,
 			err.Error(),
@@ -90,7 +198,16 @@ func (dh *dataHandler) Get(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		http.Error(w,
 			err.Error(),
-			http.StatusInternalServerError)
+			errorStatus(err))
+		return
+	}
+	if ttl > 0 {
+		w.Header().Set(TTLHeader, ttl.String())
+	}
+	etag := makeETag(value)
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && matchETag(ifNoneMatch, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 	_, _ = w.Write([]byte(value))
@@ -115,19 +232,126 @@ func (dh *dataHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		http.Error(w,
 			err.Error(),
-			http.StatusInternalServerError)
+			errorStatus(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+func (dh *dataHandler) Scan(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix, after := query.Get("prefix"), query.Get("after")
+	for _, k := range []string{prefix, after} {
+		if err := CheckKey(k); k != "" && err != nil {
+			http.Error(w,
+				err.Error(),
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		http.Error(w,
+			err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	// one more key shows if there is a next page
+	keys, err := dh.keyService.Scan(prefix, after, limit+1)
+	if err != nil {
+		http.Error(w,
+			err.Error(),
+			errorStatus(err))
+		return
+	}
+
+	res := scanResponse{Keys: keys}
+	if len(keys) > limit {
+		res.Keys = keys[:limit]
+		res.Next = keys[limit-1]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
 func (dh *dataHandler) getKeyFromRequest(r *http.Request) (string, error) {
 	key := mux.Vars(r)["key"]
-	return key, checkKey(key)
+	return key, CheckKey(key)
+}
+
+func makeETag(value string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(value))
+	return fmt.Sprintf(`"%016x"`, h.Sum64())
+}
+
+// matchETag checks etag against an If-Match or If-None-Match header value,
+// which is "*" or a comma separated list of ETags. A weak ETag matches
+// only with weak comparison, which is for If-None-Match: If-Match requires
+// the strong one (RFC 7232).
+func matchETag(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if weak {
+			t = strings.TrimPrefix(t, "W/")
+		}
+		if t == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getTTLFromRequest returns 0 if the request has no ttl query parameter.
+func getTTLFromRequest(r *http.Request) (time.Duration, error) {
+	ttl := r.URL.Query().Get("ttl")
+	if ttl == "" {
+		return 0, nil
+	}
+	return parseTTL(ttl)
+}
+
+// parseTTL accepts a Go duration ("1m30s") or a number of seconds ("90").
+func parseTTL(s string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(s)
+	if err != nil {
+		seconds, errAtoi := strconv.Atoi(s)
+		if errAtoi != nil {
+			return 0, ErrorInvalidTTL
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+	if ttl <= 0 {
+		return 0, ErrorInvalidTTL
+	}
+
+	return ttl, nil
+}
+
+func parseLimit(s string) (int, error) {
+	if s == "" {
+		return defaultScanLimit, nil
+	}
+
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 || limit > maxScanLimit {
+		return 0, ErrorInvalidLimit
+	}
+
+	return limit, nil
 }
 
-func checkKey(key string) error {
+// CheckKey checks a key of any API: not empty, up to 64 bytes, without
+// spaces, tabs, new lines and slashes.
+func CheckKey(key string) error {
 	if key == "" {
 		return ErrorEmptyKey
 	}
@@ -141,7 +365,8 @@ func checkKey(key string) error {
 	return nil
 }
 
-func checkValue(value string) error {
+// CheckValue checks a value of any API: not empty, up to 128 bytes.
+func CheckValue(value string) error {
 	if value == "" {
 		return ErrorEmptyValue
 	}
@@ -3,9 +3,10 @@ package handler
 import (
 	"errors"
 	"testing"
+	"time"
 )
 
-func TestDataHandler_checkKey(t *testing.T) {
+func TestCheckKey(t *testing.T) {
 	type args struct {
 		key string
 	}
@@ -72,19 +73,19 @@ func TestDataHandler_checkKey(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := checkKey(tt.args.key)
+			err := CheckKey(tt.args.key)
 
 			if (err != nil) != tt.wantErr {
-				t.Errorf("checkKey() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("CheckKey() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			if err != nil && !errors.Is(err, tt.wantErrorType) {
-				t.Errorf("checkKey() errorType = %v, want %v", err, tt.wantErrorType)
+				t.Errorf("CheckKey() errorType = %v, want %v", err, tt.wantErrorType)
 			}
 		})
 	}
 }
 
-func TestDataHandler_checkValue(t *testing.T) {
+func TestCheckValue(t *testing.T) {
 	type args struct {
 		value string
 	}
@@ -143,8 +144,60 @@ func TestDataHandler_checkValue(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := checkValue(tt.args.value); (err != nil) != tt.wantErr {
-				t.Errorf("checkValue() error = %v, wantErr %v", err, tt.wantErr)
+			if err := CheckValue(tt.args.value); (err != nil) != tt.wantErr {
+				t.Errorf("CheckValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDataHandler_parseTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"duration", "1h", time.Hour, false},
+		{"seconds", "15", 15 * time.Second, false},
+		{"zero", "0s", 0, true},
+		{"negative seconds", "-5", 0, true},
+		{"not a number", "abc", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTTL(tt.ttl)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTTL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseTTL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDataHandler_matchETag(t *testing.T) {
+	etag := makeETag("value")
+	tests := []struct {
+		name   string
+		header string
+		weak   bool
+		want   bool
+	}{
+		{"any", "*", false, true},
+		{"same etag", etag, false, true},
+		{"weak etag with weak comparison", "W/" + etag, true, true},
+		{"weak etag with strong comparison", "W/" + etag, false, false},
+		{"list with etag", `"abc", ` + etag, false, true},
+		{"other etag", makeETag("other value"), true, false},
+		{"empty header", "", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchETag(tt.header, etag, tt.weak); got != tt.want {
+				t.Errorf("matchETag() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/dimishpatriot/kv-storage/internal/handler"
 	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
@@ -158,10 +159,10 @@ func TestDataHandler_Get(t *testing.T) {
 			defer after(t)
 
 			if tt.want.status == http.StatusOK {
-				serviceMock.EXPECT().Get(tt.args.key).Return(tt.want.value, nil)
+				serviceMock.EXPECT().GetWithTTL(tt.args.key).Return(tt.want.value, 0, nil)
 			}
 			if tt.want.status == http.StatusNotFound {
-				serviceMock.EXPECT().Get(tt.args.key).Return("", storage.ErrorNoSuchKey)
+				serviceMock.EXPECT().GetWithTTL(tt.args.key).Return("", 0, storage.ErrorNoSuchKey)
 			}
 
 			res := httptest.NewRecorder()
@@ -256,3 +257,356 @@ func TestDataHandler_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestDataHandler_PutWithTTL(t *testing.T) {
+	type args struct {
+		key   string
+		value string
+		ttl   string
+	}
+	type want struct {
+		status int
+		ttl    time.Duration
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			"success put with duration ttl",
+			args{key: "session", value: "token", ttl: "1m30s"},
+			want{status: http.StatusCreated, ttl: 90 * time.Second},
+		},
+		{
+			"success put with seconds ttl",
+			args{key: "session", value: "token", ttl: "30"},
+			want{status: http.StatusCreated, ttl: 30 * time.Second},
+		},
+		{
+			"failed put by zero ttl",
+			args{key: "session", value: "token", ttl: "0"},
+			want{status: http.StatusBadRequest},
+		},
+		{
+			"failed put by negative ttl",
+			args{key: "session", value: "token", ttl: "-1s"},
+			want{status: http.StatusBadRequest},
+		},
+		{
+			"failed put by invalid ttl",
+			args{key: "session", value: "token", ttl: "soon"},
+			want{status: http.StatusBadRequest},
+		},
+		{
+			"failed put by not supporting storage",
+			args{key: "session", value: "token", ttl: "10s"},
+			want{status: http.StatusNotImplemented, ttl: 10 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := setupTest(t)
+			defer after(t)
+
+			if tt.want.status == http.StatusCreated {
+				serviceMock.EXPECT().PutWithTTL(tt.args.key, tt.args.value, tt.want.ttl).Return(nil)
+			}
+			if tt.want.status == http.StatusNotImplemented {
+				serviceMock.EXPECT().PutWithTTL(tt.args.key, tt.args.value, tt.want.ttl).Return(storage.ErrorNotSupported)
+			}
+
+			res := httptest.NewRecorder()
+			r := httptest.NewRequest(
+				http.MethodPut,
+				getPath(tt.args.key)+"?ttl="+tt.args.ttl,
+				strings.NewReader(tt.args.value),
+			)
+			// setup url vars for mux.Vars()
+			r = mux.SetURLVars(r,
+				map[string]string{
+					"key": tt.args.key,
+				})
+
+			dlh.Put(res, r)
+			if res.Code != tt.want.status {
+				t.Errorf("got status %d, wont %d", res.Code, tt.want.status)
+			}
+		})
+	}
+}
+
+// getETag returns the ETag which the handler sends along with the value.
+func getETag(t *testing.T, value string) string {
+	serviceMock.EXPECT().GetWithTTL("etag").Return(value, 0, nil).Once()
+
+	res := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, getPath("etag"), nil)
+	r = mux.SetURLVars(r, map[string]string{"key": "etag"})
+	dlh.Get(res, r)
+
+	etag := res.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag in response")
+	}
+	return etag
+}
+
+func TestDataHandler_ConditionalPut(t *testing.T) {
+	type args struct {
+		key         string
+		value       string
+		current     string // "" if the key is absent
+		ifMatch     string // "current" is replaced by the ETag of the current value
+		ifNoneMatch string
+	}
+	type want struct {
+		status int
+		cas    bool
+		create bool
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			"success put if match",
+			args{key: "1", value: "two", current: "one", ifMatch: "current"},
+			want{status: http.StatusCreated, cas: true},
+		},
+		{
+			"success put if match any",
+			args{key: "1", value: "two", current: "one", ifMatch: "*"},
+			want{status: http.StatusCreated, cas: true},
+		},
+		{
+			"failed put if match by other etag",
+			args{key: "1", value: "two", current: "one", ifMatch: `"0000000000000000"`},
+			want{status: http.StatusPreconditionFailed},
+		},
+		{
+			"failed put if match by absent key",
+			args{key: "1", value: "two", ifMatch: "*"},
+			want{status: http.StatusPreconditionFailed},
+		},
+		{
+			"success put if none match any",
+			args{key: "1", value: "two", ifNoneMatch: "*"},
+			want{status: http.StatusCreated, create: true},
+		},
+		{
+			"failed put if none match any by existing key",
+			args{key: "1", value: "two", current: "one", ifNoneMatch: "*"},
+			want{status: http.StatusPreconditionFailed, create: true},
+		},
+		{
+			"failed put if none match by current etag",
+			args{key: "1", value: "two", current: "one", ifNoneMatch: "current"},
+			want{status: http.StatusPreconditionFailed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := setupTest(t)
+			defer after(t)
+
+			ifMatch, ifNoneMatch := tt.args.ifMatch, tt.args.ifNoneMatch
+			if ifMatch == "current" {
+				ifMatch = getETag(t, tt.args.current)
+			}
+			if ifNoneMatch == "current" {
+				ifNoneMatch = getETag(t, tt.args.current)
+			}
+
+			if ifNoneMatch != "*" {
+				if tt.args.current == "" {
+					serviceMock.EXPECT().Get(tt.args.key).Return("", storage.ErrorNoSuchKey)
+				} else {
+					serviceMock.EXPECT().Get(tt.args.key).Return(tt.args.current, nil)
+				}
+			}
+			if tt.want.cas {
+				serviceMock.EXPECT().CompareAndSwap(tt.args.key, tt.args.current, tt.args.value).Return(nil)
+			}
+			if tt.want.create {
+				var err error
+				if tt.args.current != "" {
+					err = storage.ErrorConditionFailed
+				}
+				serviceMock.EXPECT().PutIfAbsent(tt.args.key, tt.args.value).Return(err)
+			}
+
+			res := httptest.NewRecorder()
+			r := httptest.NewRequest(
+				http.MethodPut,
+				getPath(tt.args.key),
+				strings.NewReader(tt.args.value),
+			)
+			if ifMatch != "" {
+				r.Header.Set("If-Match", ifMatch)
+			}
+			if ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", ifNoneMatch)
+			}
+			// setup url vars for mux.Vars()
+			r = mux.SetURLVars(r,
+				map[string]string{
+					"key": tt.args.key,
+				})
+
+			dlh.Put(res, r)
+			if res.Code != tt.want.status {
+				t.Errorf("got status %d, wont %d", res.Code, tt.want.status)
+			}
+			if res.Code == http.StatusCreated && res.Header().Get("ETag") == "" {
+				t.Errorf("no ETag in response")
+			}
+		})
+	}
+}
+
+func TestDataHandler_GetNotModified(t *testing.T) {
+	after := setupTest(t)
+	defer after(t)
+
+	etag := getETag(t, "one")
+	serviceMock.EXPECT().GetWithTTL("1").Return("one", 0, nil)
+
+	res := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, getPath("1"), nil)
+	r.Header.Set("If-None-Match", etag)
+	r = mux.SetURLVars(r, map[string]string{"key": "1"})
+
+	dlh.Get(res, r)
+
+	if res.Code != http.StatusNotModified {
+		t.Errorf("got status %d, wont %d", res.Code, http.StatusNotModified)
+	}
+	if res.Body.Len() != 0 {
+		t.Errorf("got body %s, want empty", res.Body.String())
+	}
+}
+
+func TestDataHandler_GetTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want string
+	}{
+		{"expiring key", 90 * time.Second, "1m30s"},
+		{"persistent key", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := setupTest(t)
+			defer after(t)
+			serviceMock.EXPECT().GetWithTTL("1").Return("one", tt.ttl, nil)
+
+			res := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, getPath("1"), nil)
+			r = mux.SetURLVars(r, map[string]string{"key": "1"})
+
+			dlh.Get(res, r)
+
+			if res.Code != http.StatusOK {
+				t.Errorf("got status %d, wont %d", res.Code, http.StatusOK)
+			}
+			if got := res.Header().Get(handler.TTLHeader); got != tt.want {
+				t.Errorf("ttl got=%s, want=%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDataHandler_Scan(t *testing.T) {
+	type args struct {
+		query string
+	}
+	type want struct {
+		status int
+		prefix string
+		after  string
+		limit  int      // limit passed to the key service
+		keys   []string // keys returned by the key service
+		body   string
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			"success scan with defaults",
+			args{query: ""},
+			want{
+				status: http.StatusOK,
+				limit:  101,
+				keys:   []string{"a", "b"},
+				body:   `{"keys":["a","b"]}`,
+			},
+		},
+		{
+			"success scan with next page",
+			args{query: "?prefix=user:&after=user:1&limit=2"},
+			want{
+				status: http.StatusOK,
+				prefix: "user:",
+				after:  "user:1",
+				limit:  3,
+				keys:   []string{"user:2", "user:3", "user:4"},
+				body:   `{"keys":["user:2","user:3"],"next":"user:3"}`,
+			},
+		},
+		{
+			"success scan of nothing",
+			args{query: "?prefix=absent"},
+			want{
+				status: http.StatusOK,
+				prefix: "absent",
+				limit:  101,
+				keys:   []string{},
+				body:   `{"keys":[]}`,
+			},
+		},
+		{
+			"failed scan by zero limit",
+			args{query: "?limit=0"},
+			want{status: http.StatusBadRequest},
+		},
+		{
+			"failed scan by big limit",
+			args{query: "?limit=1001"},
+			want{status: http.StatusBadRequest},
+		},
+		{
+			"failed scan by prefix with forbidden symbol",
+			args{query: "?prefix=a%20b"},
+			want{status: http.StatusBadRequest},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := setupTest(t)
+			defer after(t)
+
+			if tt.want.status == http.StatusOK {
+				serviceMock.EXPECT().Scan(tt.want.prefix, tt.want.after, tt.want.limit).Return(tt.want.keys, nil)
+			}
+
+			res := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1"+tt.args.query, nil)
+
+			dlh.Scan(res, r)
+
+			if res.Code != tt.want.status {
+				t.Errorf("got status %d, wont %d", res.Code, tt.want.status)
+			}
+			if res.Code == http.StatusOK {
+				if body := strings.TrimSpace(res.Body.String()); body != tt.want.body {
+					t.Errorf("body got=%s, want=%s", body, tt.want.body)
+				}
+			}
+		})
+	}
+}
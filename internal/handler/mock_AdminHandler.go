@@ -0,0 +1,70 @@
+// Code generated by mockery v2.33.2. DO NOT EDIT.
+
+package handler
+
+import (
+	http "net/http"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockAdminHandler is an autogenerated mock type for the AdminHandler type
+type MockAdminHandler struct {
+	mock.Mock
+}
+
+type MockAdminHandler_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockAdminHandler) EXPECT() *MockAdminHandler_Expecter {
+	return &MockAdminHandler_Expecter{mock: &_m.Mock}
+}
+
+// Snapshot provides a mock function with given fields: _a0, _a1
+func (_m *MockAdminHandler) Snapshot(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockAdminHandler_Snapshot_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Snapshot'
+type MockAdminHandler_Snapshot_Call struct {
+	*mock.Call
+}
+
+// Snapshot is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockAdminHandler_Expecter) Snapshot(_a0 interface{}, _a1 interface{}) *MockAdminHandler_Snapshot_Call {
+	return &MockAdminHandler_Snapshot_Call{Call: _e.mock.On("Snapshot", _a0, _a1)}
+}
+
+func (_c *MockAdminHandler_Snapshot_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockAdminHandler_Snapshot_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockAdminHandler_Snapshot_Call) Return() *MockAdminHandler_Snapshot_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockAdminHandler_Snapshot_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockAdminHandler_Snapshot_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewMockAdminHandler creates a new instance of MockAdminHandler. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockAdminHandler(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockAdminHandler {
+	mock := &MockAdminHandler{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
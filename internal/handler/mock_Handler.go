@@ -21,6 +21,40 @@ func (_m *MockHandler) EXPECT() *MockHandler_Expecter {
 	return &MockHandler_Expecter{mock: &_m.Mock}
 }
 
+// Batch provides a mock function with given fields: _a0, _a1
+func (_m *MockHandler) Batch(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockHandler_Batch_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Batch'
+type MockHandler_Batch_Call struct {
+	*mock.Call
+}
+
+// Batch is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockHandler_Expecter) Batch(_a0 interface{}, _a1 interface{}) *MockHandler_Batch_Call {
+	return &MockHandler_Batch_Call{Call: _e.mock.On("Batch", _a0, _a1)}
+}
+
+func (_c *MockHandler_Batch_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockHandler_Batch_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockHandler_Batch_Call) Return() *MockHandler_Batch_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockHandler_Batch_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockHandler_Batch_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Delete provides a mock function with given fields: _a0, _a1
 func (_m *MockHandler) Delete(_a0 http.ResponseWriter, _a1 *http.Request) {
 	_m.Called(_a0, _a1)
@@ -123,6 +157,74 @@ func (_c *MockHandler_Put_Call) RunAndReturn(run func(http.ResponseWriter, *http
 	return _c
 }
 
+// Scan provides a mock function with given fields: _a0, _a1
+func (_m *MockHandler) Scan(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockHandler_Scan_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Scan'
+type MockHandler_Scan_Call struct {
+	*mock.Call
+}
+
+// Scan is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockHandler_Expecter) Scan(_a0 interface{}, _a1 interface{}) *MockHandler_Scan_Call {
+	return &MockHandler_Scan_Call{Call: _e.mock.On("Scan", _a0, _a1)}
+}
+
+func (_c *MockHandler_Scan_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockHandler_Scan_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockHandler_Scan_Call) Return() *MockHandler_Scan_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockHandler_Scan_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockHandler_Scan_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Txn provides a mock function with given fields: _a0, _a1
+func (_m *MockHandler) Txn(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockHandler_Txn_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Txn'
+type MockHandler_Txn_Call struct {
+	*mock.Call
+}
+
+// Txn is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockHandler_Expecter) Txn(_a0 interface{}, _a1 interface{}) *MockHandler_Txn_Call {
+	return &MockHandler_Txn_Call{Call: _e.mock.On("Txn", _a0, _a1)}
+}
+
+func (_c *MockHandler_Txn_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockHandler_Txn_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockHandler_Txn_Call) Return() *MockHandler_Txn_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockHandler_Txn_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockHandler_Txn_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewMockHandler creates a new instance of MockHandler. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewMockHandler(t interface {
@@ -0,0 +1,240 @@
+// Code generated by mockery v2.33.2. DO NOT EDIT.
+
+package handler
+
+import (
+	http "net/http"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockRaftHandler is an autogenerated mock type for the RaftHandler type
+type MockRaftHandler struct {
+	mock.Mock
+}
+
+type MockRaftHandler_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockRaftHandler) EXPECT() *MockRaftHandler_Expecter {
+	return &MockRaftHandler_Expecter{mock: &_m.Mock}
+}
+
+// AddMember provides a mock function with given fields: _a0, _a1
+func (_m *MockRaftHandler) AddMember(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockRaftHandler_AddMember_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AddMember'
+type MockRaftHandler_AddMember_Call struct {
+	*mock.Call
+}
+
+// AddMember is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockRaftHandler_Expecter) AddMember(_a0 interface{}, _a1 interface{}) *MockRaftHandler_AddMember_Call {
+	return &MockRaftHandler_AddMember_Call{Call: _e.mock.On("AddMember", _a0, _a1)}
+}
+
+func (_c *MockRaftHandler_AddMember_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockRaftHandler_AddMember_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockRaftHandler_AddMember_Call) Return() *MockRaftHandler_AddMember_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockRaftHandler_AddMember_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockRaftHandler_AddMember_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Append provides a mock function with given fields: _a0, _a1
+func (_m *MockRaftHandler) Append(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockRaftHandler_Append_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Append'
+type MockRaftHandler_Append_Call struct {
+	*mock.Call
+}
+
+// Append is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockRaftHandler_Expecter) Append(_a0 interface{}, _a1 interface{}) *MockRaftHandler_Append_Call {
+	return &MockRaftHandler_Append_Call{Call: _e.mock.On("Append", _a0, _a1)}
+}
+
+func (_c *MockRaftHandler_Append_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockRaftHandler_Append_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockRaftHandler_Append_Call) Return() *MockRaftHandler_Append_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockRaftHandler_Append_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockRaftHandler_Append_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Members provides a mock function with given fields: _a0, _a1
+func (_m *MockRaftHandler) Members(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockRaftHandler_Members_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Members'
+type MockRaftHandler_Members_Call struct {
+	*mock.Call
+}
+
+// Members is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockRaftHandler_Expecter) Members(_a0 interface{}, _a1 interface{}) *MockRaftHandler_Members_Call {
+	return &MockRaftHandler_Members_Call{Call: _e.mock.On("Members", _a0, _a1)}
+}
+
+func (_c *MockRaftHandler_Members_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockRaftHandler_Members_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockRaftHandler_Members_Call) Return() *MockRaftHandler_Members_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockRaftHandler_Members_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockRaftHandler_Members_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// RemoveMember provides a mock function with given fields: _a0, _a1
+func (_m *MockRaftHandler) RemoveMember(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockRaftHandler_RemoveMember_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'RemoveMember'
+type MockRaftHandler_RemoveMember_Call struct {
+	*mock.Call
+}
+
+// RemoveMember is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockRaftHandler_Expecter) RemoveMember(_a0 interface{}, _a1 interface{}) *MockRaftHandler_RemoveMember_Call {
+	return &MockRaftHandler_RemoveMember_Call{Call: _e.mock.On("RemoveMember", _a0, _a1)}
+}
+
+func (_c *MockRaftHandler_RemoveMember_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockRaftHandler_RemoveMember_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockRaftHandler_RemoveMember_Call) Return() *MockRaftHandler_RemoveMember_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockRaftHandler_RemoveMember_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockRaftHandler_RemoveMember_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Snapshot provides a mock function with given fields: _a0, _a1
+func (_m *MockRaftHandler) Snapshot(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockRaftHandler_Snapshot_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Snapshot'
+type MockRaftHandler_Snapshot_Call struct {
+	*mock.Call
+}
+
+// Snapshot is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockRaftHandler_Expecter) Snapshot(_a0 interface{}, _a1 interface{}) *MockRaftHandler_Snapshot_Call {
+	return &MockRaftHandler_Snapshot_Call{Call: _e.mock.On("Snapshot", _a0, _a1)}
+}
+
+func (_c *MockRaftHandler_Snapshot_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockRaftHandler_Snapshot_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockRaftHandler_Snapshot_Call) Return() *MockRaftHandler_Snapshot_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockRaftHandler_Snapshot_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockRaftHandler_Snapshot_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Vote provides a mock function with given fields: _a0, _a1
+func (_m *MockRaftHandler) Vote(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockRaftHandler_Vote_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Vote'
+type MockRaftHandler_Vote_Call struct {
+	*mock.Call
+}
+
+// Vote is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockRaftHandler_Expecter) Vote(_a0 interface{}, _a1 interface{}) *MockRaftHandler_Vote_Call {
+	return &MockRaftHandler_Vote_Call{Call: _e.mock.On("Vote", _a0, _a1)}
+}
+
+func (_c *MockRaftHandler_Vote_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockRaftHandler_Vote_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockRaftHandler_Vote_Call) Return() *MockRaftHandler_Vote_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockRaftHandler_Vote_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockRaftHandler_Vote_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewMockRaftHandler creates a new instance of MockRaftHandler. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockRaftHandler(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockRaftHandler {
+	mock := &MockRaftHandler{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,104 @@
+// Code generated by mockery v2.33.2. DO NOT EDIT.
+
+package handler
+
+import (
+	http "net/http"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockReplicationHandler is an autogenerated mock type for the ReplicationHandler type
+type MockReplicationHandler struct {
+	mock.Mock
+}
+
+type MockReplicationHandler_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockReplicationHandler) EXPECT() *MockReplicationHandler_Expecter {
+	return &MockReplicationHandler_Expecter{mock: &_m.Mock}
+}
+
+// Events provides a mock function with given fields: _a0, _a1
+func (_m *MockReplicationHandler) Events(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockReplicationHandler_Events_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Events'
+type MockReplicationHandler_Events_Call struct {
+	*mock.Call
+}
+
+// Events is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockReplicationHandler_Expecter) Events(_a0 interface{}, _a1 interface{}) *MockReplicationHandler_Events_Call {
+	return &MockReplicationHandler_Events_Call{Call: _e.mock.On("Events", _a0, _a1)}
+}
+
+func (_c *MockReplicationHandler_Events_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockReplicationHandler_Events_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockReplicationHandler_Events_Call) Return() *MockReplicationHandler_Events_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockReplicationHandler_Events_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockReplicationHandler_Events_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Snapshot provides a mock function with given fields: _a0, _a1
+func (_m *MockReplicationHandler) Snapshot(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockReplicationHandler_Snapshot_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Snapshot'
+type MockReplicationHandler_Snapshot_Call struct {
+	*mock.Call
+}
+
+// Snapshot is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockReplicationHandler_Expecter) Snapshot(_a0 interface{}, _a1 interface{}) *MockReplicationHandler_Snapshot_Call {
+	return &MockReplicationHandler_Snapshot_Call{Call: _e.mock.On("Snapshot", _a0, _a1)}
+}
+
+func (_c *MockReplicationHandler_Snapshot_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockReplicationHandler_Snapshot_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockReplicationHandler_Snapshot_Call) Return() *MockReplicationHandler_Snapshot_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockReplicationHandler_Snapshot_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockReplicationHandler_Snapshot_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewMockReplicationHandler creates a new instance of MockReplicationHandler. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockReplicationHandler(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockReplicationHandler {
+	mock := &MockReplicationHandler{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,206 @@
+// Code generated by mockery v2.33.2. DO NOT EDIT.
+
+package handler
+
+import (
+	http "net/http"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockRouterHandler is an autogenerated mock type for the RouterHandler type
+type MockRouterHandler struct {
+	mock.Mock
+}
+
+type MockRouterHandler_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockRouterHandler) EXPECT() *MockRouterHandler_Expecter {
+	return &MockRouterHandler_Expecter{mock: &_m.Mock}
+}
+
+// AbortRebalance provides a mock function with given fields: _a0, _a1
+func (_m *MockRouterHandler) AbortRebalance(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockRouterHandler_AbortRebalance_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AbortRebalance'
+type MockRouterHandler_AbortRebalance_Call struct {
+	*mock.Call
+}
+
+// AbortRebalance is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockRouterHandler_Expecter) AbortRebalance(_a0 interface{}, _a1 interface{}) *MockRouterHandler_AbortRebalance_Call {
+	return &MockRouterHandler_AbortRebalance_Call{Call: _e.mock.On("AbortRebalance", _a0, _a1)}
+}
+
+func (_c *MockRouterHandler_AbortRebalance_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockRouterHandler_AbortRebalance_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockRouterHandler_AbortRebalance_Call) Return() *MockRouterHandler_AbortRebalance_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockRouterHandler_AbortRebalance_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockRouterHandler_AbortRebalance_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// AddNode provides a mock function with given fields: _a0, _a1
+func (_m *MockRouterHandler) AddNode(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockRouterHandler_AddNode_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AddNode'
+type MockRouterHandler_AddNode_Call struct {
+	*mock.Call
+}
+
+// AddNode is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockRouterHandler_Expecter) AddNode(_a0 interface{}, _a1 interface{}) *MockRouterHandler_AddNode_Call {
+	return &MockRouterHandler_AddNode_Call{Call: _e.mock.On("AddNode", _a0, _a1)}
+}
+
+func (_c *MockRouterHandler_AddNode_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockRouterHandler_AddNode_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockRouterHandler_AddNode_Call) Return() *MockRouterHandler_AddNode_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockRouterHandler_AddNode_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockRouterHandler_AddNode_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Key provides a mock function with given fields: _a0, _a1
+func (_m *MockRouterHandler) Key(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockRouterHandler_Key_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Key'
+type MockRouterHandler_Key_Call struct {
+	*mock.Call
+}
+
+// Key is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockRouterHandler_Expecter) Key(_a0 interface{}, _a1 interface{}) *MockRouterHandler_Key_Call {
+	return &MockRouterHandler_Key_Call{Call: _e.mock.On("Key", _a0, _a1)}
+}
+
+func (_c *MockRouterHandler_Key_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockRouterHandler_Key_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockRouterHandler_Key_Call) Return() *MockRouterHandler_Key_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockRouterHandler_Key_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockRouterHandler_Key_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Nodes provides a mock function with given fields: _a0, _a1
+func (_m *MockRouterHandler) Nodes(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockRouterHandler_Nodes_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Nodes'
+type MockRouterHandler_Nodes_Call struct {
+	*mock.Call
+}
+
+// Nodes is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockRouterHandler_Expecter) Nodes(_a0 interface{}, _a1 interface{}) *MockRouterHandler_Nodes_Call {
+	return &MockRouterHandler_Nodes_Call{Call: _e.mock.On("Nodes", _a0, _a1)}
+}
+
+func (_c *MockRouterHandler_Nodes_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockRouterHandler_Nodes_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockRouterHandler_Nodes_Call) Return() *MockRouterHandler_Nodes_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockRouterHandler_Nodes_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockRouterHandler_Nodes_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// RemoveNode provides a mock function with given fields: _a0, _a1
+func (_m *MockRouterHandler) RemoveNode(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockRouterHandler_RemoveNode_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'RemoveNode'
+type MockRouterHandler_RemoveNode_Call struct {
+	*mock.Call
+}
+
+// RemoveNode is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockRouterHandler_Expecter) RemoveNode(_a0 interface{}, _a1 interface{}) *MockRouterHandler_RemoveNode_Call {
+	return &MockRouterHandler_RemoveNode_Call{Call: _e.mock.On("RemoveNode", _a0, _a1)}
+}
+
+func (_c *MockRouterHandler_RemoveNode_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockRouterHandler_RemoveNode_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockRouterHandler_RemoveNode_Call) Return() *MockRouterHandler_RemoveNode_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockRouterHandler_RemoveNode_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockRouterHandler_RemoveNode_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewMockRouterHandler creates a new instance of MockRouterHandler. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockRouterHandler(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockRouterHandler {
+	mock := &MockRouterHandler{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,70 @@
+// Code generated by mockery v2.33.2. DO NOT EDIT.
+
+package handler
+
+import (
+	http "net/http"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockWatchHandler is an autogenerated mock type for the WatchHandler type
+type MockWatchHandler struct {
+	mock.Mock
+}
+
+type MockWatchHandler_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockWatchHandler) EXPECT() *MockWatchHandler_Expecter {
+	return &MockWatchHandler_Expecter{mock: &_m.Mock}
+}
+
+// Watch provides a mock function with given fields: _a0, _a1
+func (_m *MockWatchHandler) Watch(_a0 http.ResponseWriter, _a1 *http.Request) {
+	_m.Called(_a0, _a1)
+}
+
+// MockWatchHandler_Watch_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Watch'
+type MockWatchHandler_Watch_Call struct {
+	*mock.Call
+}
+
+// Watch is a helper method to define mock.On call
+//   - _a0 http.ResponseWriter
+//   - _a1 *http.Request
+func (_e *MockWatchHandler_Expecter) Watch(_a0 interface{}, _a1 interface{}) *MockWatchHandler_Watch_Call {
+	return &MockWatchHandler_Watch_Call{Call: _e.mock.On("Watch", _a0, _a1)}
+}
+
+func (_c *MockWatchHandler_Watch_Call) Run(run func(_a0 http.ResponseWriter, _a1 *http.Request)) *MockWatchHandler_Watch_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(http.ResponseWriter), args[1].(*http.Request))
+	})
+	return _c
+}
+
+func (_c *MockWatchHandler_Watch_Call) Return() *MockWatchHandler_Watch_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockWatchHandler_Watch_Call) RunAndReturn(run func(http.ResponseWriter, *http.Request)) *MockWatchHandler_Watch_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewMockWatchHandler creates a new instance of MockWatchHandler. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockWatchHandler(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockWatchHandler {
+	mock := &MockWatchHandler{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/raft"
+	"github.com/gorilla/mux"
+)
+
+// forwardedHeader marks a request forwarded to the leader, a node which
+// isn't the leader anymore doesn't forward it again.
+const forwardedHeader = "X-Raft-Forwarded"
+
+//go:generate mockery --name RaftHandler
+type RaftHandler interface {
+	Vote(http.ResponseWriter, *http.Request)
+	Append(http.ResponseWriter, *http.Request)
+	Snapshot(http.ResponseWriter, *http.Request)
+	Members(http.ResponseWriter, *http.Request)
+	AddMember(http.ResponseWriter, *http.Request)
+	RemoveMember(http.ResponseWriter, *http.Request)
+}
+
+// RaftNode is a member of a Raft cluster.
+type RaftNode interface {
+	LeaderLocator
+	HandleRequestVote(raft.RequestVoteRequest) raft.RequestVoteResponse
+	HandleAppendEntries(raft.AppendEntriesRequest) raft.AppendEntriesResponse
+	HandleInstallSnapshot(raft.InstallSnapshotRequest) raft.InstallSnapshotResponse
+	Members() map[string]string
+	AddMember(id, addr string) error
+	RemoveMember(id string) error
+}
+
+// LeaderLocator returns the address of the leader and if the node is the leader.
+type LeaderLocator interface {
+	Leader() (string, bool)
+}
+
+type raftHandler struct {
+	node RaftNode
+}
+
+type membersResponse struct {
+	Leader  string            `json:"leader"`
+	Members map[string]string `json:"members"`
+}
+
+func NewRaft(node RaftNode) RaftHandler {
+	return &raftHandler{node}
+}
+
+func (rh *raftHandler) Vote(w http.ResponseWriter, r *http.Request) {
+	var req raft.RequestVoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w,
+			err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rh.node.HandleRequestVote(req))
+}
+
+func (rh *raftHandler) Append(w http.ResponseWriter, r *http.Request) {
+	var req raft.AppendEntriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w,
+			err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rh.node.HandleAppendEntries(req))
+}
+
+func (rh *raftHandler) Snapshot(w http.ResponseWriter, r *http.Request) {
+	var req raft.InstallSnapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w,
+			err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rh.node.HandleInstallSnapshot(req))
+}
+
+// Members returns the members known to the node and the leader address.
+func (rh *raftHandler) Members(w http.ResponseWriter, r *http.Request) {
+	leader, _ := rh.node.Leader()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(membersResponse{leader, rh.node.Members()})
+}
+
+// AddMember adds the node with the ID to the cluster, the body is its address.
+func (rh *raftHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	addr, err := io.ReadAll(r.Body)
+	if err != nil || len(addr) == 0 {
+		http.Error(w,
+			"member address is expected in the body",
+			http.StatusBadRequest)
+		return
+	}
+	if _, err = url.ParseRequestURI(string(addr)); err != nil {
+		http.Error(w,
+			err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	rh.changeMembers(w, rh.node.AddMember(mux.Vars(r)["id"], string(addr)))
+}
+
+// RemoveMember removes the node with the ID from the cluster.
+func (rh *raftHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	rh.changeMembers(w, rh.node.RemoveMember(mux.Vars(r)["id"]))
+}
+
+func (rh *raftHandler) changeMembers(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, raft.ErrorUnknownMember):
+		http.Error(w,
+			err.Error(),
+			http.StatusNotFound)
+	case errors.Is(err, raft.ErrorConfigChange):
+		http.Error(w,
+			err.Error(),
+			http.StatusConflict)
+	default:
+		http.Error(w,
+			err.Error(),
+			errorStatus(err))
+	}
+}
+
+// Forward serves the request on the leader and proxies it to the leader
+// from the other nodes.
+func Forward(node LeaderLocator, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		leader, isLeader := node.Leader()
+		if isLeader {
+			next(w, r)
+			return
+		}
+		if leader == "" || r.Header.Get(forwardedHeader) != "" {
+			http.Error(w,
+				raft.ErrorNoLeader.Error(),
+				http.StatusServiceUnavailable)
+			return
+		}
+		target, err := url.Parse(leader)
+		if err != nil {
+			http.Error(w,
+				err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+
+		r.Header.Set(forwardedHeader, "1")
+		httputil.NewSingleHostReverseProxy(target).ServeHTTP(w, r)
+	}
+}
+
+// errorStatus returns 503 for the errors a client may retry after a leader
+// change and 500 for the rest.
+func errorStatus(err error) int {
+	if raft.Retryable(err) {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
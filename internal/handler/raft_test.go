@@ -0,0 +1,188 @@
+package handler_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dimishpatriot/kv-storage/internal/handler"
+	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
+	"github.com/dimishpatriot/kv-storage/internal/services/raft"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRaftNode struct {
+	leader   string
+	isLeader bool
+	members  map[string]string
+	err      error
+}
+
+func (n *fakeRaftNode) Leader() (string, bool) { return n.leader, n.isLeader }
+
+func (n *fakeRaftNode) HandleRequestVote(req raft.RequestVoteRequest) raft.RequestVoteResponse {
+	return raft.RequestVoteResponse{Term: req.Term, VoteGranted: true}
+}
+
+func (n *fakeRaftNode) HandleAppendEntries(req raft.AppendEntriesRequest) raft.AppendEntriesResponse {
+	return raft.AppendEntriesResponse{Term: req.Term, Success: len(req.Entries) > 0}
+}
+
+func (n *fakeRaftNode) HandleInstallSnapshot(req raft.InstallSnapshotRequest) raft.InstallSnapshotResponse {
+	return raft.InstallSnapshotResponse{Term: req.Term + req.Snapshot.Index}
+}
+
+func (n *fakeRaftNode) Members() map[string]string { return n.members }
+
+func (n *fakeRaftNode) AddMember(id, addr string) error {
+	if n.err == nil {
+		n.members[id] = addr
+	}
+	return n.err
+}
+
+func (n *fakeRaftNode) RemoveMember(id string) error {
+	if _, ok := n.members[id]; !ok {
+		return raft.ErrorUnknownMember
+	}
+	return n.err
+}
+
+func TestRaftHandler_RPC(t *testing.T) {
+	rh := handler.NewRaft(&fakeRaftNode{})
+	tests := []struct {
+		name     string
+		serve    http.HandlerFunc
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			"vote",
+			rh.Vote,
+			`{"term":2,"candidate_id":"n1","last_log_index":1,"last_log_term":1}`,
+			http.StatusOK,
+			`{"term":2,"vote_granted":true}`,
+		},
+		{
+			"append",
+			rh.Append,
+			`{"term":2,"leader_id":"n1","entries":[{"term":2,"index":1,"command":{"type":2,"key":"one","value":"1"}}]}`,
+			http.StatusOK,
+			`{"term":2,"success":true}`,
+		},
+		{
+			"snapshot",
+			rh.Snapshot,
+			`{"term":2,"leader_id":"n1","snapshot":{"index":10,"term":2,"members":{"n1":"n1"},"data":"S1ZTUw=="}}`,
+			http.StatusOK,
+			`{"term":12}`,
+		},
+		{
+			"invalid request",
+			rh.Append,
+			`{"term":`,
+			http.StatusBadRequest,
+			"unexpected EOF",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/raft/rpc", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			tt.serve(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, strings.TrimSpace(w.Body.String()))
+		})
+	}
+}
+
+func TestRaftHandler_Members(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		id       string
+		body     string
+		err      error
+		wantCode int
+	}{
+		{"add", http.MethodPut, "n4", "http://localhost:8084", nil, http.StatusOK},
+		{"add without address", http.MethodPut, "n4", "", nil, http.StatusBadRequest},
+		{"add invalid address", http.MethodPut, "n4", "localhost", nil, http.StatusBadRequest},
+		{"add while changing", http.MethodPut, "n4", "http://localhost:8084", raft.ErrorConfigChange, http.StatusConflict},
+		{"add on follower", http.MethodPut, "n4", "http://localhost:8084", raft.ErrorNotLeader, http.StatusServiceUnavailable},
+		{"remove", http.MethodDelete, "n1", "", nil, http.StatusOK},
+		{"remove unknown", http.MethodDelete, "n9", "", nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &fakeRaftNode{members: map[string]string{"n1": "http://localhost:8081"}, err: tt.err}
+			rh := handler.NewRaft(node)
+			router := mux.NewRouter()
+			router.HandleFunc("/admin/raft/members/{id}", rh.AddMember).Methods("PUT")
+			router.HandleFunc("/admin/raft/members/{id}", rh.RemoveMember).Methods("DELETE")
+			r := httptest.NewRequest(tt.method, "/admin/raft/members/"+tt.id, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func TestForward(t *testing.T) {
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "leader %s %s %s", r.Method, r.URL.RequestURI(), b)
+	}))
+	defer leader.Close()
+	local := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "local")
+	}
+	tests := []struct {
+		name      string
+		node      *fakeRaftNode
+		forwarded bool
+		wantCode  int
+		wantBody  string
+	}{
+		{"leader", &fakeRaftNode{isLeader: true}, false, http.StatusOK, "local"},
+		{"follower", &fakeRaftNode{leader: leader.URL}, false, http.StatusOK, "leader PUT /v1/one?ttl=1m 1"},
+		{"no leader", &fakeRaftNode{}, false, http.StatusServiceUnavailable, raft.ErrorNoLeader.Error()},
+		{"forwarded twice", &fakeRaftNode{leader: leader.URL}, true, http.StatusServiceUnavailable, raft.ErrorNoLeader.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/v1/one?ttl=1m", strings.NewReader("1"))
+			if tt.forwarded {
+				r.Header.Set("X-Raft-Forwarded", "1")
+			}
+			w := httptest.NewRecorder()
+
+			handler.Forward(tt.node, local)(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, strings.TrimSpace(w.Body.String()))
+		})
+	}
+}
+
+func TestDataHandler_NotLeader(t *testing.T) {
+	serviceMock := keyservice.NewMockKeyService(t)
+	serviceMock.EXPECT().Put("one", "1").Return(raft.ErrorLeadershipLost).Times(1)
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/{key}", handler.New(serviceMock).Put).Methods("PUT")
+	r := httptest.NewRequest(http.MethodPut, "/v1/one", strings.NewReader("1"))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
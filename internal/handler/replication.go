@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/replication"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger/filelogger"
+)
+
+//go:generate mockery --name ReplicationHandler
+type ReplicationHandler interface {
+	Events(http.ResponseWriter, *http.Request)
+	Snapshot(http.ResponseWriter, *http.Request)
+}
+
+// ReplicationLog returns the log records after the sequence for followers.
+type ReplicationLog interface {
+	Epoch() uint64
+	LastSequence() uint64
+	ReadRecordsAfter(after uint64, limit int) ([][]transactionlogger.Event, error)
+}
+
+// SnapshotExporter returns an encoded snapshot of the storage and its sequence.
+type SnapshotExporter interface {
+	Export() (uint64, []byte)
+}
+
+type replicationHandler struct {
+	log      ReplicationLog
+	exporter SnapshotExporter
+}
+
+func NewReplication(log ReplicationLog, exporter SnapshotExporter) ReplicationHandler {
+	return &replicationHandler{log, exporter}
+}
+
+// Events returns the log records after the sequence, 410 if the follower
+// has to start over from a snapshot.
+func (rh *replicationHandler) Events(w http.ResponseWriter, r *http.Request) {
+	after, err := strconv.ParseUint(r.URL.Query().Get("after"), 10, 64)
+	if err != nil {
+		http.Error(w,
+			ErrorInvalidSequence.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		http.Error(w,
+			err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	records, err := rh.log.ReadRecordsAfter(after, limit)
+	if errors.Is(err, filelogger.ErrorSequenceGone) {
+		http.Error(w,
+			err.Error(),
+			http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w,
+			err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(replication.EventsResponse{
+		Epoch:    rh.log.Epoch(),
+		Sequence: rh.log.LastSequence(),
+		Records:  records,
+	})
+}
+
+// Snapshot returns a snapshot of the storage for a follower to start from
+// and the epoch of the log it continues with.
+func (rh *replicationHandler) Snapshot(w http.ResponseWriter, r *http.Request) {
+	_, b := rh.exporter.Export()
+
+	w.Header().Set(replication.EpochHeader, strconv.FormatUint(rh.log.Epoch(), 10))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(b)
+}
+
+// Redirect sends the request to the same path of the leader,
+// 307 keeps the method and the body.
+func Redirect(leader string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, leader+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+	}
+}
@@ -0,0 +1,113 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dimishpatriot/kv-storage/internal/handler"
+	"github.com/dimishpatriot/kv-storage/internal/services/replication"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger/filelogger"
+)
+
+type fakeReplicationLog []transactionlogger.Event
+
+func (l fakeReplicationLog) Epoch() uint64 { return 5 }
+
+func (l fakeReplicationLog) LastSequence() uint64 { return uint64(len(l)) }
+
+func (l fakeReplicationLog) ReadRecordsAfter(after uint64, limit int) ([][]transactionlogger.Event, error) {
+	if after == 0 || after > uint64(len(l)) {
+		return nil, fmt.Errorf("%w: %d", filelogger.ErrorSequenceGone, after)
+	}
+	records := [][]transactionlogger.Event{}
+	for _, e := range l[after:min(len(l), int(after)+limit)] {
+		records = append(records, []transactionlogger.Event{e})
+	}
+	return records, nil
+}
+
+type exporterFunc func() (uint64, []byte)
+
+func (f exporterFunc) Export() (uint64, []byte) { return f() }
+
+func TestReplicationHandler_Events(t *testing.T) {
+	log := fakeReplicationLog{
+		{Sequence: 1, EventType: transactionlogger.EventPut, Key: "one", Value: "1"},
+		{Sequence: 2, EventType: transactionlogger.EventDelete, Key: "one"},
+		{Sequence: 3, EventType: transactionlogger.EventPut, Key: "two", Value: "2"},
+	}
+	tests := []struct {
+		name     string
+		target   string
+		wantCode int
+		wantBody string
+	}{
+		{
+			"after sequence",
+			"/replication/events?after=1&limit=1",
+			http.StatusOK,
+			`{"epoch":5,"sequence":3,"records":[[{"sequence":2,"type":1,"key":"one"}]]}`,
+		},
+		{
+			"dropped sequence",
+			"/replication/events?after=0",
+			http.StatusGone,
+			"changes after the sequence are dropped from the log: 0",
+		},
+		{
+			"no sequence",
+			"/replication/events",
+			http.StatusBadRequest,
+			"sequence must be a number",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rh := handler.NewReplication(log, nil)
+			res := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+
+			rh.Events(res, r)
+
+			if res.Code != tt.wantCode {
+				t.Errorf("Events() code = %d, want %d", res.Code, tt.wantCode)
+			}
+			if got := strings.TrimSpace(res.Body.String()); got != tt.wantBody {
+				t.Errorf("Events() body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestReplicationHandler_Snapshot(t *testing.T) {
+	rh := handler.NewReplication(fakeReplicationLog{}, exporterFunc(func() (uint64, []byte) { return 7, []byte("snapshot") }))
+	res := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/replication/snapshot", nil)
+
+	rh.Snapshot(res, r)
+
+	if res.Code != http.StatusOK || res.Body.String() != "snapshot" {
+		t.Errorf("Snapshot() = %d %s, want %d snapshot", res.Code, res.Body.String(), http.StatusOK)
+	}
+	if got := res.Header().Get(replication.EpochHeader); got != "5" {
+		t.Errorf("Snapshot() epoch = %s, want 5", got)
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	res := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/v1/key?ttl=10", strings.NewReader("value"))
+
+	handler.Redirect("http://leader:8080")(res, r)
+
+	if res.Code != http.StatusTemporaryRedirect {
+		t.Errorf("Redirect() code = %d, want %d", res.Code, http.StatusTemporaryRedirect)
+	}
+	if got := res.Header().Get("Location"); got != "http://leader:8080/v1/key?ttl=10" {
+		t.Errorf("Redirect() location = %s", got)
+	}
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/router"
+	"github.com/gorilla/mux"
+)
+
+//go:generate mockery --name RouterHandler
+type RouterHandler interface {
+	Key(http.ResponseWriter, *http.Request)
+	Nodes(http.ResponseWriter, *http.Request)
+	AddNode(http.ResponseWriter, *http.Request)
+	RemoveNode(http.ResponseWriter, *http.Request)
+	AbortRebalance(http.ResponseWriter, *http.Request)
+}
+
+// KeyRouter sends key requests to the nodes which own the keys.
+type KeyRouter interface {
+	Do(key string, req *http.Request) (*http.Response, error)
+	Nodes() []router.Node
+	Rebalancing() bool
+	RebalanceError() error
+	AddNode(id, addr string) error
+	RemoveNode(id string) error
+	AbortRebalance() error
+}
+
+type routerHandler struct {
+	router KeyRouter
+}
+
+type nodesResponse struct {
+	Rebalancing bool          `json:"rebalancing"`
+	Error       string        `json:"error,omitempty"` // the rebalance retries after
+	Nodes       []router.Node `json:"nodes"`
+}
+
+func NewRouter(router KeyRouter) RouterHandler {
+	return &routerHandler{router}
+}
+
+// Key proxies the request of the key to the node which owns it.
+func (rh *routerHandler) Key(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	if err := CheckKey(key); err != nil {
+		http.Error(w,
+			err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	res, err := rh.router.Do(key, r)
+	if errors.Is(err, router.ErrorNodeDown) || errors.Is(err, router.ErrorNoNodes) {
+		http.Error(w,
+			err.Error(),
+			http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w,
+			err.Error(),
+			http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(res.StatusCode)
+	_, _ = io.Copy(w, res.Body)
+}
+
+// Nodes returns the nodes, if their keys are being rebalanced and why
+// the rebalance is retried.
+func (rh *routerHandler) Nodes(w http.ResponseWriter, r *http.Request) {
+	res := nodesResponse{Rebalancing: rh.router.Rebalancing(), Nodes: rh.router.Nodes()}
+	if err := rh.router.RebalanceError(); err != nil {
+		res.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// AddNode adds the node with the ID to the router, the body is its URL.
+func (rh *routerHandler) AddNode(w http.ResponseWriter, r *http.Request) {
+	addr, err := io.ReadAll(r.Body)
+	if err != nil || len(addr) == 0 {
+		http.Error(w,
+			"node url is expected in the body",
+			http.StatusBadRequest)
+		return
+	}
+
+	rh.changeNodes(w, rh.router.AddNode(mux.Vars(r)["id"], string(addr)))
+}
+
+// RemoveNode removes the node with the ID from the router.
+func (rh *routerHandler) RemoveNode(w http.ResponseWriter, r *http.Request) {
+	rh.changeNodes(w, rh.router.RemoveNode(mux.Vars(r)["id"]))
+}
+
+// AbortRebalance stops moving the keys of the last nodes change.
+func (rh *routerHandler) AbortRebalance(w http.ResponseWriter, r *http.Request) {
+	rh.changeNodes(w, rh.router.AbortRebalance())
+}
+
+func (rh *routerHandler) changeNodes(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusAccepted)
+	case errors.Is(err, router.ErrorUnknownNode):
+		http.Error(w,
+			err.Error(),
+			http.StatusNotFound)
+	case errors.Is(err, router.ErrorRebalancing),
+		errors.Is(err, router.ErrorNodeExists),
+		errors.Is(err, router.ErrorLastNode),
+		errors.Is(err, router.ErrorNotRebalancing):
+		http.Error(w,
+			err.Error(),
+			http.StatusConflict)
+	default:
+		http.Error(w,
+			err.Error(),
+			http.StatusBadRequest)
+	}
+}
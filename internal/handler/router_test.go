@@ -0,0 +1,156 @@
+package handler_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dimishpatriot/kv-storage/internal/handler"
+	"github.com/dimishpatriot/kv-storage/internal/services/router"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeKeyRouter struct {
+	res          *http.Response
+	nodes        []router.Node
+	err          error
+	rebalanceErr error
+}
+
+func (kr *fakeKeyRouter) Do(key string, req *http.Request) (*http.Response, error) {
+	return kr.res, kr.err
+}
+
+func (kr *fakeKeyRouter) Nodes() []router.Node { return kr.nodes }
+
+func (kr *fakeKeyRouter) Rebalancing() bool { return kr.rebalanceErr != nil }
+
+func (kr *fakeKeyRouter) RebalanceError() error { return kr.rebalanceErr }
+
+func (kr *fakeKeyRouter) AddNode(id, addr string) error { return kr.err }
+
+func (kr *fakeKeyRouter) RemoveNode(id string) error { return kr.err }
+
+func (kr *fakeKeyRouter) AbortRebalance() error { return kr.err }
+
+func TestRouterHandler_Key(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		router     *fakeKeyRouter
+		wantCode   int
+		wantBody   string
+		wantHeader string
+	}{
+		{
+			"proxied",
+			"one",
+			&fakeKeyRouter{res: &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Etag": {`"1"`}},
+				Body:       io.NopCloser(strings.NewReader("1")),
+			}},
+			http.StatusOK,
+			"1",
+			`"1"`,
+		},
+		{
+			"invalid key",
+			"a b",
+			&fakeKeyRouter{},
+			http.StatusBadRequest,
+			"forbidden symbol in key\n",
+			"",
+		},
+		{
+			"node down",
+			"one",
+			&fakeKeyRouter{err: router.ErrorNodeDown},
+			http.StatusServiceUnavailable,
+			"node is down\n",
+			"",
+		},
+		{
+			"node error",
+			"one",
+			&fakeKeyRouter{err: fmt.Errorf("%w 500", router.ErrorUnexpectedStatus)},
+			http.StatusBadGateway,
+			"unexpected node response 500\n",
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/key", nil)
+			r = mux.SetURLVars(r, map[string]string{"key": tt.key})
+			w := httptest.NewRecorder()
+
+			handler.NewRouter(tt.router).Key(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, tt.wantHeader, w.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestRouterHandler_Nodes(t *testing.T) {
+	rh := handler.NewRouter(&fakeKeyRouter{nodes: []router.Node{{ID: "n1", URL: "http://a", Healthy: true}}})
+	w := httptest.NewRecorder()
+
+	rh.Nodes(w, httptest.NewRequest(http.MethodGet, "/admin/router/nodes", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"rebalancing":false,"nodes":[{"id":"n1","url":"http://a","healthy":true}]}`, w.Body.String())
+
+	rh = handler.NewRouter(&fakeKeyRouter{rebalanceErr: router.ErrorNodeDown})
+	w = httptest.NewRecorder()
+
+	rh.Nodes(w, httptest.NewRequest(http.MethodGet, "/admin/router/nodes", nil))
+
+	assert.JSONEq(t, `{"rebalancing":true,"error":"node is down","nodes":null}`, w.Body.String())
+}
+
+func TestRouterHandler_ChangeNodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   string
+		body     string
+		err      error
+		wantCode int
+	}{
+		{"add", "add", "http://a", nil, http.StatusAccepted},
+		{"add without url", "add", "", nil, http.StatusBadRequest},
+		{"add invalid url", "add", "a", fmt.Errorf("invalid node url: %w", io.EOF), http.StatusBadRequest},
+		{"add existing", "add", "http://a", router.ErrorNodeExists, http.StatusConflict},
+		{"add while rebalancing", "add", "http://a", router.ErrorRebalancing, http.StatusConflict},
+		{"remove", "remove", "", nil, http.StatusAccepted},
+		{"remove unknown", "remove", "", router.ErrorUnknownNode, http.StatusNotFound},
+		{"remove last", "remove", "", router.ErrorLastNode, http.StatusConflict},
+		{"abort", "abort", "", nil, http.StatusAccepted},
+		{"abort not rebalancing", "abort", "", router.ErrorNotRebalancing, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rh := handler.NewRouter(&fakeKeyRouter{err: tt.err})
+			r := httptest.NewRequest(http.MethodPut, "/admin/router/nodes/n1", strings.NewReader(tt.body))
+			r = mux.SetURLVars(r, map[string]string{"id": "n1"})
+			w := httptest.NewRecorder()
+
+			switch tt.change {
+			case "add":
+				rh.AddNode(w, r)
+			case "remove":
+				rh.RemoveNode(w, r)
+			case "abort":
+				rh.AbortRebalance(w, r)
+			}
+
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
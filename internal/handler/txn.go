@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+const maxTxnOps = 100
+
+var (
+	ErrorInvalidTxn = fmt.Errorf("transaction must be a JSON list of 1 to %d operations", maxTxnOps)
+	ErrorInvalidOp  = errors.New(`op must be "put", "delete", "check" or "check_absent"`)
+)
+
+// txnOp is an operation of POST /v1/txn:
+// {"op": "put" | "delete" | "check" | "check_absent", "key": "...", "value": "..."}.
+type txnOp struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+var opTypes = map[string]storage.OpType{
+	"put":          storage.OpPut,
+	"delete":       storage.OpDelete,
+	"check":        storage.OpCheck,
+	"check_absent": storage.OpCheckAbsent,
+}
+
+// Txn applies a JSON list of operations atomically.
+func (dh *dataHandler) Txn(w http.ResponseWriter, r *http.Request) {
+	var req []txnOp
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req) == 0 || len(req) > maxTxnOps {
+		http.Error(w,
+			ErrorInvalidTxn.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	ops, err := parseOps(req)
+	if err != nil {
+		http.Error(w,
+			err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	err = dh.keyService.Apply(ops)
+	if errors.Is(err, storage.ErrorConditionFailed) {
+		http.Error(w,
+			err.Error(),
+			http.StatusPreconditionFailed)
+		return
+	}
+	if err != nil {
+		http.Error(w,
+			err.Error(),
+			errorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func parseOps(req []txnOp) ([]storage.Op, error) {
+	ops := make([]storage.Op, 0, len(req))
+	for i, o := range req {
+		t, ok := opTypes[o.Op]
+		if !ok {
+			return nil, storage.OpFailed(i, ErrorInvalidOp)
+		}
+		if err := CheckKey(o.Key); err != nil {
+			return nil, storage.OpFailed(i, err)
+		}
+		if t == storage.OpPut || t == storage.OpCheck {
+			if err := CheckValue(o.Value); err != nil {
+				return nil, storage.OpFailed(i, err)
+			}
+		}
+		ops = append(ops, storage.Op{Type: t, Key: o.Key, Value: o.Value})
+	}
+
+	return ops, nil
+}
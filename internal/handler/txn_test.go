@@ -0,0 +1,91 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+func TestDataHandler_Txn(t *testing.T) {
+	type want struct {
+		status int
+		ops    []storage.Op // ops passed to the key service
+		err    error        // error returned by the key service
+	}
+	tests := []struct {
+		name string
+		body string
+		want want
+	}{
+		{
+			"success txn",
+			`[{"op":"check","key":"from","value":"10"},{"op":"put","key":"from","value":"9"},` +
+				`{"op":"check_absent","key":"lock"},{"op":"delete","key":"to"}]`,
+			want{
+				status: http.StatusOK,
+				ops: []storage.Op{
+					{Type: storage.OpCheck, Key: "from", Value: "10"},
+					{Type: storage.OpPut, Key: "from", Value: "9"},
+					{Type: storage.OpCheckAbsent, Key: "lock"},
+					{Type: storage.OpDelete, Key: "to"},
+				},
+			},
+		},
+		{
+			"failed txn by condition",
+			`[{"op":"check_absent","key":"lock"}]`,
+			want{
+				status: http.StatusPreconditionFailed,
+				ops:    []storage.Op{{Type: storage.OpCheckAbsent, Key: "lock"}},
+				err:    storage.OpFailed(0, storage.ErrorConditionFailed),
+			},
+		},
+		{
+			"failed txn by empty list",
+			`[]`,
+			want{status: http.StatusBadRequest},
+		},
+		{
+			"failed txn by bad json",
+			`{"op":"put"}`,
+			want{status: http.StatusBadRequest},
+		},
+		{
+			"failed txn by unknown op",
+			`[{"op":"increment","key":"counter"}]`,
+			want{status: http.StatusBadRequest},
+		},
+		{
+			"failed txn by empty put value",
+			`[{"op":"put","key":"one"}]`,
+			want{status: http.StatusBadRequest},
+		},
+		{
+			"failed txn by forbidden key",
+			`[{"op":"delete","key":"a b"}]`,
+			want{status: http.StatusBadRequest},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := setupTest(t)
+			defer after(t)
+
+			if tt.want.ops != nil {
+				serviceMock.EXPECT().Apply(tt.want.ops).Return(tt.want.err)
+			}
+
+			res := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/txn", strings.NewReader(tt.body))
+
+			dlh.Txn(res, r)
+
+			if res.Code != tt.want.status {
+				t.Errorf("Txn() code = %d, want %d: %s", res.Code, tt.want.status, res.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/watch"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+var (
+	ErrorInvalidSequence   = errors.New("sequence must be a number")
+	ErrorStreamUnsupported = errors.New("streaming is not supported")
+)
+
+//go:generate mockery --name WatchHandler
+type WatchHandler interface {
+	Watch(http.ResponseWriter, *http.Request)
+}
+
+// Watcher subscribes to the changes of keys with the prefix after the sequence.
+type Watcher interface {
+	Subscribe(prefix string, after uint64) (*watch.Subscription, error)
+}
+
+type watchHandler struct {
+	watcher Watcher
+}
+
+// watchEvent is the data of a put or delete Server-Sent Event.
+type watchEvent struct {
+	Key     string `json:"key"`
+	Value   string `json:"value,omitempty"`
+	Expires string `json:"expires,omitempty"`
+}
+
+func NewWatch(watcher Watcher) WatchHandler {
+	return &watchHandler{watcher}
+}
+
+// Watch streams the changes of keys with the prefix as Server-Sent Events,
+// the event id is the sequence to resume from by Last-Event-ID or after.
+func (wh *watchHandler) Watch(w http.ResponseWriter, r *http.Request) {
+	after, err := getSequenceFromRequest(r)
+	if err != nil {
+		http.Error(w,
+			err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w,
+			ErrorStreamUnsupported.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	s, err := wh.watcher.Subscribe(r.URL.Query().Get("prefix"), after)
+	if errors.Is(err, watch.ErrorSequenceGone) {
+		http.Error(w,
+			err.Error(),
+			http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w,
+			err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	defer s.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-s.Events():
+			if !ok {
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", s.Err())
+				flusher.Flush()
+				return
+			}
+			writeEvent(w, e)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e transactionlogger.Event) {
+	name := "put"
+	if e.EventType == transactionlogger.EventDelete {
+		name = "delete"
+	}
+	data := watchEvent{Key: e.Key, Value: e.Value}
+	if e.Expires != 0 {
+		data.Expires = time.Unix(0, e.Expires).UTC().Format(time.RFC3339Nano)
+	}
+	b, _ := json.Marshal(data)
+
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Sequence, name, b)
+}
+
+// getSequenceFromRequest prefers Last-Event-ID of a reconnecting client to "after".
+func getSequenceFromRequest(r *http.Request) (uint64, error) {
+	s := r.Header.Get("Last-Event-ID")
+	if s == "" {
+		s = r.URL.Query().Get("after")
+	}
+	if s == "" {
+		return 0, nil
+	}
+
+	seq, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, ErrorInvalidSequence
+	}
+
+	return seq, nil
+}
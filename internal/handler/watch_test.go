@@ -0,0 +1,94 @@
+package handler_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/handler"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/watch"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestWatchHandler_Watch(t *testing.T) {
+	tLogger := transactionlogger.NewMockTransactionLogger(t)
+	tLogger.EXPECT().WritePut(mock.Anything, mock.Anything).Return(nil)
+	tLogger.EXPECT().WriteDelete(mock.Anything).Return(nil)
+	hub := watch.New(log.New(io.Discard, "", 0), tLogger, watch.Config{History: 2})
+	epoch := hub.Sequence()
+	_ = hub.WritePut("user:1", "one")
+	_ = hub.WritePut("order:1", "one")
+	_ = hub.WriteDelete("user:1")
+
+	tests := []struct {
+		name        string
+		target      string
+		lastEventID string
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			"resume by Last-Event-ID",
+			"/v1/watch?prefix=user:",
+			fmt.Sprint(epoch + 1),
+			http.StatusOK,
+			fmt.Sprintf("id: %d\nevent: delete\ndata: {\"key\":\"user:1\"}\n\n", epoch+3),
+		},
+		{
+			"resume by after",
+			fmt.Sprintf("/v1/watch?after=%d", epoch+1),
+			"",
+			http.StatusOK,
+			fmt.Sprintf("id: %d\nevent: put\ndata: {\"key\":\"order:1\",\"value\":\"one\"}\n\n", epoch+2) +
+				fmt.Sprintf("id: %d\nevent: delete\ndata: {\"key\":\"user:1\"}\n\n", epoch+3),
+		},
+		{
+			"new events only",
+			"/v1/watch",
+			"",
+			http.StatusOK,
+			"",
+		},
+		{
+			"gone sequence",
+			"/v1/watch",
+			"1000",
+			http.StatusGone,
+			"sequence is out of watch history: 1000\n",
+		},
+		{
+			"invalid sequence",
+			"/v1/watch?after=last",
+			"",
+			http.StatusBadRequest,
+			"sequence must be a number\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh := handler.NewWatch(hub)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			res := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil).WithContext(ctx)
+			if tt.lastEventID != "" {
+				r.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+
+			wh.Watch(res, r)
+
+			if res.Code != tt.wantCode {
+				t.Errorf("Watch() code = %d, want %d", res.Code, tt.wantCode)
+			}
+			if got := res.Body.String(); got != tt.wantBody {
+				t.Errorf("Watch() body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
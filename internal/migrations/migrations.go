@@ -0,0 +1,127 @@
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Dialect is the name of a directory with migrations for the database.
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// Migration is a SQL file "<version>_<name>.sql".
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Load returns the migrations of the dialect ordered by version.
+func Load(dialect Dialect) ([]Migration, error) {
+	names, err := fs.Glob(files, path.Join(string(dialect), "*.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("cant list migrations: %w", err)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no migrations for dialect %s", dialect)
+	}
+
+	migrations := make([]Migration, 0, len(names))
+	for _, name := range names {
+		base := strings.TrimSuffix(path.Base(name), ".sql")
+		v, title, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("bad migration name %s: %w", name, err)
+		}
+		b, err := files.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("cant read migration %s: %w", name, err)
+		}
+		migrations = append(migrations, Migration{version, title, string(b)})
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+
+	return migrations, nil
+}
+
+// Apply runs the migrations which are not in the schema_migrations table yet,
+// each one in its own transaction. It returns the applied migrations.
+func Apply(db *sql.DB, dialect Dialect) ([]Migration, error) {
+	migrations, err := Load(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("cant create schema_migrations table: %w", err)
+	}
+
+	current, err := Version(db)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []Migration{}
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err = apply(db, m); err != nil {
+			return applied, err
+		}
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
+
+// Version returns the version of the last applied migration, 0 if none.
+func Version(db *sql.DB) (int, error) {
+	var version sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("cant get schema version: %w", err)
+	}
+
+	return int(version.Int64), nil
+}
+
+func apply(db *sql.DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("cant begin migration %d: %w", m.Version, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err = tx.Exec(m.SQL); err != nil {
+		return fmt.Errorf("cant apply migration %d %s: %w", m.Version, m.Name, err)
+	}
+	_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+	if err != nil {
+		return fmt.Errorf("cant record migration %d: %w", m.Version, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("cant commit migration %d: %w", m.Version, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package migrations_test
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dimishpatriot/kv-storage/internal/migrations"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	for _, dialect := range []migrations.Dialect{migrations.Postgres, migrations.SQLite} {
+		t.Run(string(dialect), func(t *testing.T) {
+			db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+			require.NoError(t, err)
+			defer db.Close()
+			all, err := migrations.Load(dialect)
+			require.NoError(t, err)
+
+			applied, err := migrations.Apply(db, dialect)
+
+			require.NoError(t, err)
+			assert.Equal(t, all, applied)
+			version, err := migrations.Version(db)
+			require.NoError(t, err)
+			assert.Equal(t, all[len(all)-1].Version, version)
+			for _, table := range []string{"kv", "transactions"} {
+				_, err = db.Exec("SELECT * FROM " + table)
+				assert.NoError(t, err)
+			}
+
+			// nothing to apply the second time
+			applied, err = migrations.Apply(db, dialect)
+
+			require.NoError(t, err)
+			assert.Empty(t, applied)
+		})
+	}
+}
+
+func TestApplyOverLegacyTable(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE transactions (sequence BIGSERIAL PRIMARY KEY, event_type SMALLINT, key TEXT NOT NULL, value TEXT NOT NULL)`)
+	require.NoError(t, err)
+
+	_, err = migrations.Apply(db, migrations.Postgres)
+
+	assert.NoError(t, err)
+}
+
+func kvRows(t *testing.T, db *sql.DB) map[string]string {
+	t.Helper()
+
+	rows, err := db.Query(`SELECT key, value FROM kv`)
+	require.NoError(t, err)
+	defer rows.Close()
+	kv := map[string]string{}
+	for rows.Next() {
+		var k, v string
+		require.NoError(t, rows.Scan(&k, &v))
+		kv[k] = v
+	}
+	require.NoError(t, rows.Err())
+
+	return kv
+}
+
+func TestApplyBackfillsKV(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	fixture, err := os.ReadFile("testdata/pre_upgrade_postgres.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(fixture))
+	require.NoError(t, err)
+
+	_, err = migrations.Apply(db, migrations.Postgres)
+
+	require.NoError(t, err)
+	want := map[string]string{"one": "ONE", "three": "3", "four": "4"}
+	assert.Equal(t, want, kvRows(t, db))
+
+	// running it again keeps newer values
+	_, err = db.Exec(`UPDATE kv SET value = 'newer' WHERE key = 'one'`)
+	require.NoError(t, err)
+	all, err := migrations.Load(migrations.Postgres)
+	require.NoError(t, err)
+	for _, m := range all {
+		if m.Name == "backfill_kv" {
+			_, err = db.Exec(m.SQL)
+			require.NoError(t, err)
+		}
+	}
+	want["one"] = "newer"
+	assert.Equal(t, want, kvRows(t, db))
+}
+
+func TestLoadUnknownDialect(t *testing.T) {
+	_, err := migrations.Load("oracle")
+
+	assert.Error(t, err)
+}
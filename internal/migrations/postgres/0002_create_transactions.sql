@@ -0,0 +1,7 @@
+-- the table could be made by previous versions without migrations
+CREATE TABLE IF NOT EXISTS transactions (
+    sequence BIGSERIAL PRIMARY KEY,
+    event_type SMALLINT,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL
+);
@@ -0,0 +1,10 @@
+-- previous versions kept the values in the transactions table: fill kv with
+-- the latest put of every key (event_type 2), keys deleted last are skipped.
+-- keys already in kv are newer, so running it again changes nothing
+INSERT INTO kv (key, value)
+SELECT t.key, t.value
+FROM transactions t
+JOIN (SELECT MAX(sequence) AS sequence FROM transactions GROUP BY key) latest
+ON latest.sequence = t.sequence
+WHERE t.event_type = 2
+ON CONFLICT (key) DO NOTHING;
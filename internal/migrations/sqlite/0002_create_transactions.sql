@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS transactions (
+    sequence INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_type SMALLINT,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL
+);
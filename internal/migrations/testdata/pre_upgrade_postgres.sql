@@ -0,0 +1,16 @@
+-- the database of a version before migrations: no schema_migrations and kv,
+-- the values are in the transactions table
+CREATE TABLE transactions (
+    sequence BIGSERIAL PRIMARY KEY,
+    event_type SMALLINT,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL
+);
+INSERT INTO transactions (sequence, event_type, key, value) VALUES
+    (1, 2, 'one', '1'),
+    (2, 2, 'two', '2'),
+    (3, 2, 'one', 'ONE'),
+    (4, 1, 'two', ''),
+    (5, 2, 'three', '3'),
+    (6, 1, 'four', ''),
+    (7, 2, 'four', '4');
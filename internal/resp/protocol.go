@@ -0,0 +1,110 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxArgs    = 1 << 16 // of a command
+	maxBulkLen = 1 << 16 // keys and values are much shorter
+)
+
+var errorProtocol = errors.New("Protocol error")
+
+// readCommand reads a command sent as an array of bulk strings or inline,
+// as words separated by spaces. An empty inline command is nil.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errorProtocol)
+	}
+	args := make([]string, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		arg, err := readBulk(r)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+func readBulk(r *bufio.Reader) (string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(line, "$") {
+		return "", fmt.Errorf("%w: expected '$', got '%.1s'", errorProtocol, line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > maxBulkLen {
+		return "", fmt.Errorf("%w: invalid bulk length", errorProtocol)
+	}
+
+	b := make([]byte, n+2)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	if string(b[n:]) != "\r\n" {
+		return "", fmt.Errorf("%w: bulk string isn't terminated by CRLF", errorProtocol)
+	}
+
+	return string(b[:n]), nil
+}
+
+// readLine reads a line terminated by CRLF or LF without the terminator.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", fmt.Errorf("%w: too big line", errorProtocol)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r"), nil
+}
+
+// writer writes the replies, they are sent by Flush.
+type writer struct {
+	*bufio.Writer
+}
+
+func (w writer) simple(s string) {
+	_, _ = w.WriteString("+" + s + "\r\n")
+}
+
+func (w writer) error(s string) {
+	_, _ = w.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(s) + "\r\n")
+}
+
+func (w writer) int(n int64) {
+	_, _ = w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w writer) bulk(s string) {
+	_, _ = w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func (w writer) null() {
+	_, _ = w.WriteString("$-1\r\n")
+}
+
+func (w writer) array(n int) {
+	_, _ = w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
@@ -0,0 +1,475 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/handler"
+	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+const (
+	defaultScanCount = 10
+	maxScanCount     = 1000
+	// SCAN cursors kept, an older one is invalid
+	maxCursors = 10000
+)
+
+var (
+	errorSyntax      = errors.New("syntax error")
+	errorNotInteger  = errors.New("value is not an integer or out of range")
+	errorInvalidTTL  = errors.New("invalid expire time")
+	errorCursor      = errors.New("invalid cursor")
+	errorOddMSetArgs = errors.New("wrong number of arguments for 'mset' command")
+)
+
+// Server serves a subset of the Redis protocol (RESP2) by the key service:
+// GET, SET, DEL, EXISTS, EXPIRE, TTL, MGET, MSET, SCAN and PING, so redis-cli
+// and Redis clients can use the storage.
+type Server struct {
+	logger     *log.Logger
+	keyService keyservice.KeyService
+
+	mu      sync.Mutex
+	cursors map[uint64]string // SCAN cursor to the last returned key
+	issued  []uint64          // cursors in order of issue
+	cursor  uint64            // the last issued one
+}
+
+func New(logger *log.Logger, keyService keyservice.KeyService) *Server {
+	return &Server{
+		logger:     logger,
+		keyService: keyService,
+		cursors:    map[uint64]string{},
+	}
+}
+
+// Serve serves the connections accepted by l until it's closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return fmt.Errorf("cant accept connection: %w", err)
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := writer{bufio.NewWriter(conn)}
+	for {
+		args, err := readCommand(r)
+		if errors.Is(err, errorProtocol) {
+			w.error("ERR " + err.Error())
+			_ = w.Flush()
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.logger.Printf("cant read resp command from %s: %s", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := strings.EqualFold(args[0], "QUIT")
+		if quit {
+			w.simple("OK")
+		} else {
+			s.exec(w, args)
+		}
+		// pipelined commands are answered at once
+		if r.Buffered() == 0 || quit {
+			if err = w.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+type command struct {
+	run   func(s *Server, w writer, args []string) error
+	arity int // number of args with the name, -n for at least n
+}
+
+var commands = map[string]command{
+	"PING":   {(*Server).ping, -1},
+	"GET":    {(*Server).get, 2},
+	"SET":    {(*Server).set, -3},
+	"DEL":    {(*Server).del, -2},
+	"EXISTS": {(*Server).exists, -2},
+	"EXPIRE": {(*Server).expire, 3},
+	"TTL":    {(*Server).ttl, 2},
+	"MGET":   {(*Server).mget, -2},
+	"MSET":   {(*Server).mset, -3},
+	"SCAN":   {(*Server).scan, -2},
+}
+
+// exec runs the command, its error is the reply.
+func (s *Server) exec(w writer, args []string) {
+	name := strings.ToUpper(args[0])
+	c, ok := commands[name]
+	if !ok {
+		w.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return
+	}
+	if (c.arity > 0 && len(args) != c.arity) || (c.arity < 0 && len(args) < -c.arity) {
+		w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+		return
+	}
+
+	if err := c.run(s, w, args[1:]); err != nil {
+		w.error("ERR " + err.Error())
+	}
+}
+
+func (s *Server) ping(w writer, args []string) error {
+	switch len(args) {
+	case 0:
+		w.simple("PONG")
+	case 1:
+		w.bulk(args[0])
+	default:
+		return errors.New("wrong number of arguments for 'ping' command")
+	}
+
+	return nil
+}
+
+func (s *Server) get(w writer, args []string) error {
+	if err := handler.CheckKey(args[0]); err != nil {
+		return err
+	}
+
+	v, err := s.keyService.Get(args[0])
+	if errors.Is(err, storage.ErrorNoSuchKey) {
+		w.null()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w.bulk(v)
+
+	return nil
+}
+
+// set supports the EX, PX and NX options, NX can't be used with a ttl.
+func (s *Server) set(w writer, args []string) error {
+	key, value := args[0], args[1]
+	if err := handler.CheckKey(key); err != nil {
+		return err
+	}
+	if err := handler.CheckValue(value); err != nil {
+		return err
+	}
+
+	var ttl time.Duration
+	var nx bool
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "NX" && !nx:
+			nx = true
+		case (opt == "EX" || opt == "PX") && ttl == 0 && i+1 < len(args):
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return errorNotInteger
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			if n <= 0 || n > int64(1<<62)/int64(unit) {
+				return fmt.Errorf("%w in 'set' command", errorInvalidTTL)
+			}
+			ttl = time.Duration(n) * unit
+			i++
+		default:
+			return errorSyntax
+		}
+	}
+
+	var err error
+	switch {
+	case nx && ttl > 0:
+		return handler.ErrorConditionalTTL
+	case nx:
+		err = s.keyService.PutIfAbsent(key, value)
+	case ttl > 0:
+		err = s.keyService.PutWithTTL(key, value, ttl)
+	default:
+		err = s.keyService.Put(key, value)
+	}
+	if errors.Is(err, storage.ErrorConditionFailed) {
+		w.null()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w.simple("OK")
+
+	return nil
+}
+
+// del deletes the keys in one batch and replies the number of deleted ones.
+func (s *Server) del(w writer, args []string) error {
+	results, err := s.batch(storage.OpDelete, args)
+	if err != nil {
+		return err
+	}
+	w.int(found(results))
+
+	return nil
+}
+
+// exists replies the number of existing keys, a key is counted as many
+// times as it's passed.
+func (s *Server) exists(w writer, args []string) error {
+	results, err := s.batch(storage.OpGet, args)
+	if err != nil {
+		return err
+	}
+	w.int(found(results))
+
+	return nil
+}
+
+// expire replies 1 if the key has got the ttl, a ttl <= 0 deletes it.
+func (s *Server) expire(w writer, args []string) error {
+	key := args[0]
+	if err := handler.CheckKey(key); err != nil {
+		return err
+	}
+	seconds, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return errorNotInteger
+	}
+	if seconds > int64(1<<62)/int64(time.Second) {
+		return fmt.Errorf("%w in 'expire' command", errorInvalidTTL)
+	}
+
+	if seconds <= 0 {
+		err = s.keyService.Delete(key)
+	} else {
+		err = s.keyService.Expire(key, time.Duration(seconds)*time.Second)
+	}
+	if errors.Is(err, storage.ErrorNoSuchKey) {
+		w.int(0)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w.int(1)
+
+	return nil
+}
+
+// ttl replies the seconds the key lives, -1 if it never expires, -2 if
+// it doesn't exist.
+func (s *Server) ttl(w writer, args []string) error {
+	if err := handler.CheckKey(args[0]); err != nil {
+		return err
+	}
+
+	ttl, err := s.keyService.TTL(args[0])
+	switch {
+	case errors.Is(err, storage.ErrorNoSuchKey):
+		w.int(-2)
+	case err != nil:
+		return err
+	case ttl == 0:
+		w.int(-1)
+	default:
+		w.int(int64((ttl + time.Second/2) / time.Second))
+	}
+
+	return nil
+}
+
+func (s *Server) mget(w writer, args []string) error {
+	results, err := s.batch(storage.OpGet, args)
+	if err != nil {
+		return err
+	}
+
+	w.array(len(results))
+	for _, r := range results {
+		if r.Err != nil {
+			w.null()
+			continue
+		}
+		w.bulk(r.Value)
+	}
+
+	return nil
+}
+
+// mset puts all the keys atomically.
+func (s *Server) mset(w writer, args []string) error {
+	if len(args)%2 != 0 {
+		return errorOddMSetArgs
+	}
+
+	ops := make([]storage.Op, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		if err := handler.CheckKey(args[i]); err != nil {
+			return err
+		}
+		if err := handler.CheckValue(args[i+1]); err != nil {
+			return err
+		}
+		ops = append(ops, storage.Op{Type: storage.OpPut, Key: args[i], Value: args[i+1]})
+	}
+	if err := s.keyService.Apply(ops); err != nil {
+		return err
+	}
+	w.simple("OK")
+
+	return nil
+}
+
+// scan pages the keys in ascending order, MATCH filters them by a glob
+// pattern after up to COUNT keys are read, as Redis does.
+// The cursor is a number standing for the last key of the previous page.
+func (s *Server) scan(w writer, args []string) error {
+	after, err := s.cursorKey(args[0])
+	if err != nil {
+		return err
+	}
+
+	count, pattern := defaultScanCount, ""
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return errorSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+			if _, err = path.Match(pattern, ""); err != nil {
+				return errorSyntax
+			}
+		case "COUNT":
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil || count < 1 {
+				return errorSyntax
+			}
+			count = min(count, maxScanCount)
+		default:
+			return errorSyntax
+		}
+	}
+
+	keys, err := s.keyService.Scan(literalPrefix(pattern), after, count)
+	if err != nil {
+		return err
+	}
+
+	next := "0"
+	if len(keys) == count {
+		next = s.issueCursor(keys[len(keys)-1])
+	}
+	matched := []string{}
+	for _, k := range keys {
+		if ok, _ := path.Match(pattern, k); pattern == "" || ok {
+			matched = append(matched, k)
+		}
+	}
+
+	w.array(2)
+	w.bulk(next)
+	w.array(len(matched))
+	for _, k := range matched {
+		w.bulk(k)
+	}
+
+	return nil
+}
+
+// batch runs the operation for every key in one batch.
+func (s *Server) batch(opType storage.OpType, keys []string) ([]storage.Result, error) {
+	ops := make([]storage.Op, 0, len(keys))
+	for _, k := range keys {
+		if err := handler.CheckKey(k); err != nil {
+			return nil, err
+		}
+		ops = append(ops, storage.Op{Type: opType, Key: k})
+	}
+
+	return s.keyService.Batch(ops)
+}
+
+// cursorKey returns the key the cursor stands for, "" for 0.
+func (s *Server) cursorKey(cursor string) (string, error) {
+	n, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return "", errorCursor
+	}
+	if n == 0 {
+		return "", nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.cursors[n]
+	if !ok {
+		return "", errorCursor
+	}
+
+	return k, nil
+}
+
+// issueCursor returns a new cursor for the key, the oldest one is
+// forgotten if there are too many.
+func (s *Server) issueCursor(k string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cursor++
+	s.cursors[s.cursor] = k
+	s.issued = append(s.issued, s.cursor)
+	if len(s.issued) > maxCursors {
+		delete(s.cursors, s.issued[0])
+		s.issued = s.issued[1:]
+	}
+
+	return strconv.FormatUint(s.cursor, 10)
+}
+
+// literalPrefix returns the part of the glob pattern before the first
+// special character.
+func literalPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+
+	return pattern
+}
+
+// found counts the results of existing keys.
+func found(results []storage.Result) int64 {
+	var n int64
+	for _, r := range results {
+		if r.Err == nil {
+			n++
+		}
+	}
+
+	return n
+}
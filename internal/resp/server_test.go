@@ -0,0 +1,175 @@
+package resp_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/resp"
+	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = log.New(io.Discard, "", 0)
+
+// serve starts a server over local storage and returns a connection to it.
+func serve(t *testing.T) net.Conn {
+	t.Helper()
+
+	tLogger := transactionlogger.NewMockTransactionLogger(t)
+	tLogger.EXPECT().WritePut(mock.Anything, mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WritePutWithTTL(mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WriteDelete(mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WriteGroup(mock.Anything).Return(nil).Maybe()
+	s := resp.New(logger, keyservice.New(logger, localstorage.New(), tLogger))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() { _ = s.Serve(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	return conn
+}
+
+// encode encodes the command as redis-cli does.
+func encode(args ...string) string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+
+	return b.String()
+}
+
+// readReply reads one reply as is.
+func readReply(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	switch line[0] {
+	case '$':
+		var n int
+		fmt.Sscanf(line, "$%d", &n)
+		if n < 0 {
+			return line
+		}
+		b := make([]byte, n+2)
+		_, err = io.ReadFull(r, b)
+		require.NoError(t, err)
+		return line + string(b)
+	case '*':
+		var n int
+		fmt.Sscanf(line, "*%d", &n)
+		for i := 0; i < n; i++ {
+			line += readReply(t, r)
+		}
+		return line
+	default:
+		return line
+	}
+}
+
+func TestServer(t *testing.T) {
+	conn := serve(t)
+	r := bufio.NewReader(conn)
+
+	tests := []struct {
+		name    string
+		command []string
+		want    string
+	}{
+		{"ping", []string{"PING"}, "+PONG\r\n"},
+		{"ping message", []string{"ping", "hi"}, "$2\r\nhi\r\n"},
+		{"get absent", []string{"GET", "one"}, "$-1\r\n"},
+		{"set", []string{"SET", "one", "1"}, "+OK\r\n"},
+		{"get", []string{"GET", "one"}, "$1\r\n1\r\n"},
+		{"set nx existing", []string{"SET", "one", "x", "NX"}, "$-1\r\n"},
+		{"set nx absent", []string{"SET", "two", "2", "nx"}, "+OK\r\n"},
+		{"set nx with ttl", []string{"SET", "two", "2", "NX", "EX", "10"}, "-ERR ttl can't be used with conditional put\r\n"},
+		{"set ex", []string{"SET", "three", "3", "EX", "100"}, "+OK\r\n"},
+		{"set invalid ttl", []string{"SET", "three", "3", "PX", "0"}, "-ERR invalid expire time in 'set' command\r\n"},
+		{"set unknown option", []string{"SET", "three", "3", "XX"}, "-ERR syntax error\r\n"},
+		{"ttl", []string{"TTL", "three"}, ":100\r\n"},
+		{"ttl without expiration", []string{"TTL", "one"}, ":-1\r\n"},
+		{"ttl absent", []string{"TTL", "absent"}, ":-2\r\n"},
+		{"expire", []string{"EXPIRE", "one", "50"}, ":1\r\n"},
+		{"ttl after expire", []string{"TTL", "one"}, ":50\r\n"},
+		{"expire absent", []string{"EXPIRE", "absent", "50"}, ":0\r\n"},
+		{"expire not integer", []string{"EXPIRE", "one", "soon"}, "-ERR value is not an integer or out of range\r\n"},
+		{"exists", []string{"EXISTS", "one", "two", "absent", "one"}, ":3\r\n"},
+		{"mset", []string{"MSET", "a", "A", "b", "B"}, "+OK\r\n"},
+		{"mset odd args", []string{"MSET", "a", "A", "b"}, "-ERR wrong number of arguments for 'mset' command\r\n"},
+		{"mget", []string{"MGET", "a", "absent", "b"}, "*3\r\n$1\r\nA\r\n$-1\r\n$1\r\nB\r\n"},
+		{"scan", []string{"SCAN", "0", "COUNT", "3"}, "*2\r\n$1\r\n1\r\n*3\r\n$1\r\na\r\n$1\r\nb\r\n$3\r\none\r\n"},
+		{"scan next page", []string{"SCAN", "1", "COUNT", "3"}, "*2\r\n$1\r\n0\r\n*2\r\n$5\r\nthree\r\n$3\r\ntwo\r\n"},
+		{"scan match", []string{"SCAN", "0", "MATCH", "t*e?"}, "*2\r\n$1\r\n0\r\n*1\r\n$5\r\nthree\r\n"},
+		{"scan invalid cursor", []string{"SCAN", "42"}, "-ERR invalid cursor\r\n"},
+		{"del", []string{"DEL", "a", "b", "absent"}, ":2\r\n"},
+		{"expire with 0 deletes", []string{"EXPIRE", "one", "0"}, ":1\r\n"},
+		{"get deleted", []string{"GET", "one"}, "$-1\r\n"},
+		{"invalid key", []string{"GET", "a b"}, "-ERR forbidden symbol in key\r\n"},
+		{"empty value", []string{"SET", "one", ""}, "-ERR empty value\r\n"},
+		{"wrong number of args", []string{"GET"}, "-ERR wrong number of arguments for 'get' command\r\n"},
+		{"unknown command", []string{"HSET", "h", "f", "v"}, "-ERR unknown command 'HSET'\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := conn.Write([]byte(encode(tt.command...)))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, readReply(t, r))
+		})
+	}
+}
+
+func TestServer_InlineAndPipelined(t *testing.T) {
+	conn := serve(t)
+	r := bufio.NewReader(conn)
+
+	_, err := conn.Write([]byte("SET one 1\r\n\r\n" + encode("GET", "one") + "PING\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "+OK\r\n", readReply(t, r))
+	assert.Equal(t, "$1\r\n1\r\n", readReply(t, r))
+	assert.Equal(t, "+PONG\r\n", readReply(t, r))
+}
+
+func TestServer_ProtocolError(t *testing.T) {
+	conn := serve(t)
+	r := bufio.NewReader(conn)
+
+	_, err := conn.Write([]byte("*1\r\n+PING\r\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "-ERR Protocol error: expected '$', got '+'\r\n", readReply(t, r))
+	_, err = r.ReadByte()
+	assert.ErrorIs(t, err, io.EOF, "connection isn't closed")
+}
+
+func TestServer_Quit(t *testing.T) {
+	conn := serve(t)
+	r := bufio.NewReader(conn)
+
+	_, err := conn.Write([]byte(encode("QUIT")))
+	require.NoError(t, err)
+
+	assert.Equal(t, "+OK\r\n", readReply(t, r))
+	_, err = r.ReadByte()
+	assert.ErrorIs(t, err, io.EOF, "connection isn't closed")
+}
@@ -0,0 +1,188 @@
+package keyservice
+
+import (
+	"log"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/raft"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+// Consensus replicates the commands to a cluster, they are applied to the
+// storage once committed.
+//
+//go:generate mockery --name Consensus
+type Consensus interface {
+	Propose(raft.Command) ([]storage.Result, error)
+	// ReadBarrier returns when the storage reflects every committed change.
+	ReadBarrier() error
+}
+
+type consensusKeyService struct {
+	logger    *log.Logger
+	storage   storage.Storage
+	consensus Consensus
+}
+
+// NewConsensus returns a service which writes go through the consensus and
+// reads are linearizable. The storage is changed by the consensus only.
+func NewConsensus(
+	logger *log.Logger,
+	storage storage.Storage,
+	consensus Consensus,
+) KeyService {
+	return &consensusKeyService{
+		logger,
+		storage,
+		consensus,
+	}
+}
+
+// Put implements Service.
+func (s *consensusKeyService) Put(k, v string) error {
+	_, err := s.consensus.Propose(raft.Command{Type: raft.CommandPut, Key: k, Value: v})
+	if err == nil {
+		s.logger.Printf("put: {%s: %s}\n", k, v)
+	}
+
+	return err
+}
+
+// PutWithTTL implements Service.
+func (s *consensusKeyService) PutWithTTL(k, v string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return storage.ErrorInvalidTTL
+	}
+	_, err := s.consensus.Propose(raft.Command{
+		Type:    raft.CommandPutWithTTL,
+		Key:     k,
+		Value:   v,
+		Expires: time.Now().Add(ttl).UnixNano(),
+	})
+	if err == nil {
+		s.logger.Printf("put: {%s: %s} ttl: %s\n", k, v, ttl)
+	}
+
+	return err
+}
+
+// PutIfAbsent implements Service.
+func (s *consensusKeyService) PutIfAbsent(k, v string) error {
+	_, err := s.consensus.Propose(raft.Command{Type: raft.CommandPutIfAbsent, Key: k, Value: v})
+	if err == nil {
+		s.logger.Printf("put if absent: {%s: %s}\n", k, v)
+	}
+
+	return err
+}
+
+// CompareAndSwap implements Service.
+func (s *consensusKeyService) CompareAndSwap(k, expected, new string) error {
+	_, err := s.consensus.Propose(raft.Command{Type: raft.CommandCompareAndSwap, Key: k, Expected: expected, Value: new})
+	if err == nil {
+		s.logger.Printf("compare and swap: {%s: %s -> %s}\n", k, expected, new)
+	}
+
+	return err
+}
+
+// Delete implements Service.
+func (s *consensusKeyService) Delete(k string) error {
+	_, err := s.consensus.Propose(raft.Command{Type: raft.CommandDelete, Key: k})
+	if err == nil {
+		s.logger.Printf("delete: {%s}\n", k)
+	}
+
+	return err
+}
+
+// Get implements Service.
+func (s *consensusKeyService) Get(k string) (string, error) {
+	if err := s.consensus.ReadBarrier(); err != nil {
+		return "", err
+	}
+	v, err := s.storage.Get(k)
+	if err == nil {
+		s.logger.Printf("get: {%s: %s}\n", k, v)
+	}
+
+	return v, err
+}
+
+// GetWithTTL implements Service.
+func (s *consensusKeyService) GetWithTTL(k string) (string, time.Duration, error) {
+	if err := s.consensus.ReadBarrier(); err != nil {
+		return "", 0, err
+	}
+	v, ttl, err := getWithTTL(s.storage, k)
+	if err == nil {
+		s.logger.Printf("get: {%s: %s}\n", k, v)
+	}
+
+	return v, ttl, err
+}
+
+// Expire implements Service.
+func (s *consensusKeyService) Expire(k string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return storage.ErrorInvalidTTL
+	}
+	_, err := s.consensus.Propose(raft.Command{
+		Type:    raft.CommandExpire,
+		Key:     k,
+		Expires: time.Now().Add(ttl).UnixNano(),
+	})
+	if err == nil {
+		s.logger.Printf("expire: {%s} ttl: %s\n", k, ttl)
+	}
+
+	return err
+}
+
+// TTL implements Service.
+func (s *consensusKeyService) TTL(k string) (time.Duration, error) {
+	if err := s.consensus.ReadBarrier(); err != nil {
+		return 0, err
+	}
+
+	return ttl(s.storage, k)
+}
+
+// Scan implements Service.
+func (s *consensusKeyService) Scan(prefix, startAfter string, limit int) ([]string, error) {
+	if err := s.consensus.ReadBarrier(); err != nil {
+		return nil, err
+	}
+	keys, err := s.storage.Scan(prefix, startAfter, limit)
+	if err == nil {
+		s.logger.Printf("scan: {%s} after {%s}: %d keys\n", prefix, startAfter, len(keys))
+	}
+
+	return keys, err
+}
+
+// Apply implements Service.
+func (s *consensusKeyService) Apply(ops []storage.Op) error {
+	_, err := s.consensus.Propose(raft.Command{Type: raft.CommandApply, Ops: ops})
+	if err == nil {
+		s.logger.Printf("apply: %d operations\n", len(ops))
+	}
+
+	return err
+}
+
+// Batch implements Service. The gets of the batch are ordered with the
+// changes by the log, so they are linearizable too.
+func (s *consensusKeyService) Batch(ops []storage.Op) ([]storage.Result, error) {
+	results, err := s.consensus.Propose(raft.Command{Type: raft.CommandBatch, Ops: ops})
+	if err == nil {
+		s.logger.Printf("batch: %d operations\n", len(ops))
+	}
+
+	return results, err
+}
+
+// Begin implements Service.
+func (s *consensusKeyService) Begin() *Txn {
+	return &Txn{service: s}
+}
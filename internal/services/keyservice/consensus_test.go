@@ -0,0 +1,186 @@
+package keyservice_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
+	"github.com/dimishpatriot/kv-storage/internal/services/raft"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupConsensusTest(tb testing.TB) (keyservice.KeyService, *keyservice.MockConsensus) {
+	setupTest(tb)
+	consensusMock := keyservice.NewMockConsensus(tb)
+
+	return keyservice.NewConsensus(logger, storageMock, consensusMock), consensusMock
+}
+
+func TestConsensusKeyService_Write(t *testing.T) {
+	type test struct {
+		name  string
+		write func(keyservice.KeyService) error
+		want  raft.Command
+		err   error
+	}
+	tests := []test{
+		{
+			"put",
+			func(s keyservice.KeyService) error { return s.Put("one", "1") },
+			raft.Command{Type: raft.CommandPut, Key: "one", Value: "1"},
+			nil,
+		},
+		{
+			"put if absent",
+			func(s keyservice.KeyService) error { return s.PutIfAbsent("one", "1") },
+			raft.Command{Type: raft.CommandPutIfAbsent, Key: "one", Value: "1"},
+			storage.ErrorConditionFailed,
+		},
+		{
+			"compare and swap",
+			func(s keyservice.KeyService) error { return s.CompareAndSwap("one", "1", "2") },
+			raft.Command{Type: raft.CommandCompareAndSwap, Key: "one", Expected: "1", Value: "2"},
+			nil,
+		},
+		{
+			"delete",
+			func(s keyservice.KeyService) error { return s.Delete("one") },
+			raft.Command{Type: raft.CommandDelete, Key: "one"},
+			storage.ErrorNoSuchKey,
+		},
+		{
+			"txn",
+			func(s keyservice.KeyService) error {
+				txn := s.Begin()
+				txn.CheckAbsent("two")
+				txn.Put("two", "2")
+				return txn.Commit()
+			},
+			raft.Command{Type: raft.CommandApply, Ops: []storage.Op{
+				{Type: storage.OpCheckAbsent, Key: "two"},
+				{Type: storage.OpPut, Key: "two", Value: "2"},
+			}},
+			nil,
+		},
+		{
+			"not leader",
+			func(s keyservice.KeyService) error { return s.Put("one", "1") },
+			raft.Command{Type: raft.CommandPut, Key: "one", Value: "1"},
+			raft.ErrorNotLeader,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, consensusMock := setupConsensusTest(t)
+			consensusMock.
+				EXPECT().
+				Propose(tt.want).
+				Return(nil, tt.err).Times(1)
+
+			err := tt.write(s)
+
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestConsensusKeyService_PutWithTTL(t *testing.T) {
+	s, consensusMock := setupConsensusTest(t)
+	consensusMock.
+		EXPECT().
+		Propose(mock.MatchedBy(func(c raft.Command) bool {
+			expires := time.Unix(0, c.Expires)
+			return c.Type == raft.CommandPutWithTTL && c.Key == "one" &&
+				expires.After(time.Now()) && expires.Before(time.Now().Add(time.Minute))
+		})).
+		Return(nil, nil).Times(1)
+
+	assert.NoError(t, s.PutWithTTL("one", "1", time.Minute))
+	assert.ErrorIs(t, s.PutWithTTL("one", "1", 0), storage.ErrorInvalidTTL)
+}
+
+func TestConsensusKeyService_Expire(t *testing.T) {
+	s, consensusMock := setupConsensusTest(t)
+	consensusMock.
+		EXPECT().
+		Propose(mock.MatchedBy(func(c raft.Command) bool {
+			expires := time.Unix(0, c.Expires)
+			return c.Type == raft.CommandExpire && c.Key == "one" &&
+				expires.After(time.Now()) && expires.Before(time.Now().Add(time.Minute))
+		})).
+		Return(nil, nil).Times(1)
+
+	assert.NoError(t, s.Expire("one", time.Minute))
+	assert.ErrorIs(t, s.Expire("one", 0), storage.ErrorInvalidTTL)
+}
+
+func TestConsensusKeyService_Get(t *testing.T) {
+	type test struct {
+		name    string
+		barrier error
+		want    string
+		err     error
+	}
+	tests := []test{
+		{"read after barrier", nil, "1", nil},
+		{"not leader", raft.ErrorNotLeader, "", raft.ErrorNotLeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, consensusMock := setupConsensusTest(t)
+			consensusMock.
+				EXPECT().
+				ReadBarrier().
+				Return(tt.barrier).Times(1)
+			if tt.barrier == nil {
+				storageMock.
+					EXPECT().
+					Get("one").
+					Return("1", nil).Times(1)
+			}
+
+			got, err := s.Get("one")
+
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestConsensusKeyService_GetWithTTL(t *testing.T) {
+	s, consensusMock := setupConsensusTest(t)
+	consensusMock.
+		EXPECT().
+		ReadBarrier().
+		Return(nil).Times(1)
+	storageMock.
+		EXPECT().
+		Get("one").
+		Return("1", nil).Times(1)
+
+	got, ttl, err := s.GetWithTTL("one")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1", got)
+	assert.Zero(t, ttl)
+}
+
+func TestConsensusKeyService_Batch(t *testing.T) {
+	s, consensusMock := setupConsensusTest(t)
+	ops := []storage.Op{
+		{Type: storage.OpGet, Key: "one"},
+		{Type: storage.OpPut, Key: "two", Value: "2"},
+	}
+	results := []storage.Result{{Value: "1"}, {}}
+	consensusMock.
+		EXPECT().
+		Propose(raft.Command{Type: raft.CommandBatch, Ops: ops}).
+		Return(results, nil).Times(1)
+
+	got, err := s.Batch(ops)
+
+	assert.NoError(t, err)
+	assert.Equal(t, results, got)
+}
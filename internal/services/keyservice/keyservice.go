@@ -2,6 +2,7 @@ package keyservice
 
 import (
 	"log"
+	"time"
 
 	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
 	"github.com/dimishpatriot/kv-storage/internal/storage"
@@ -10,8 +11,26 @@ import (
 //go:generate mockery --name KeyService
 type KeyService interface {
 	Put(string, string) error
+	PutWithTTL(string, string, time.Duration) error
+	PutIfAbsent(string, string) error
+	CompareAndSwap(key, expected, new string) error
 	Get(string) (string, error)
+	// GetWithTTL returns the value and how long the key lives by one read,
+	// the TTL is 0 if the key never expires.
+	GetWithTTL(string) (string, time.Duration, error)
 	Delete(string) error
+	// Expire sets the ttl of an existing key, storages without expiration
+	// return storage.ErrorNotSupported.
+	Expire(string, time.Duration) error
+	// TTL returns how long the key lives, 0 if it never expires.
+	TTL(string) (time.Duration, error)
+	Scan(prefix, startAfter string, limit int) ([]string, error)
+	// Apply applies the operations atomically and logs them as one group.
+	Apply(ops []storage.Op) error
+	// Batch runs the operations one by one and logs the changes as one group.
+	Batch(ops []storage.Op) ([]storage.Result, error)
+	// Begin starts a transaction which is applied by Txn.Commit.
+	Begin() *Txn
 }
 
 type keyService struct {
@@ -37,7 +56,40 @@ func (s *keyService) Put(k, v string) error {
 	err := s.storage.Put(k, v)
 	if err == nil {
 		s.logger.Printf("put: {%s: %s}\n", k, v)
-		s.tLogger.WritePut(k, v)
+		err = s.tLogger.WritePut(k, v)
+	}
+
+	return err
+}
+
+// PutWithTTL implements Service.
+func (s *keyService) PutWithTTL(k, v string, ttl time.Duration) error {
+	err := s.storage.PutWithTTL(k, v, ttl)
+	if err == nil {
+		s.logger.Printf("put: {%s: %s} ttl: %s\n", k, v, ttl)
+		err = s.tLogger.WritePutWithTTL(k, v, time.Now().Add(ttl))
+	}
+
+	return err
+}
+
+// PutIfAbsent implements Service.
+func (s *keyService) PutIfAbsent(k, v string) error {
+	err := s.storage.PutIfAbsent(k, v)
+	if err == nil {
+		s.logger.Printf("put if absent: {%s: %s}\n", k, v)
+		err = s.tLogger.WritePut(k, v)
+	}
+
+	return err
+}
+
+// CompareAndSwap implements Service.
+func (s *keyService) CompareAndSwap(k, expected, new string) error {
+	err := s.storage.CompareAndSwap(k, expected, new)
+	if err == nil {
+		s.logger.Printf("compare and swap: {%s: %s -> %s}\n", k, expected, new)
+		err = s.tLogger.WritePut(k, new)
 	}
 
 	return err
@@ -48,7 +100,7 @@ func (s *keyService) Delete(k string) error {
 	err := s.storage.Delete(k)
 	if err == nil {
 		s.logger.Printf("delete: {%s}\n", k)
-		s.tLogger.WriteDelete(k)
+		err = s.tLogger.WriteDelete(k)
 	}
 
 	return err
@@ -63,3 +115,119 @@ func (s *keyService) Get(k string) (string, error) {
 
 	return v, err
 }
+
+// GetWithTTL implements Service.
+func (s *keyService) GetWithTTL(k string) (string, time.Duration, error) {
+	v, ttl, err := getWithTTL(s.storage, k)
+	if err == nil {
+		s.logger.Printf("get: {%s: %s}\n", k, v)
+	}
+
+	return v, ttl, err
+}
+
+// Expire implements Service. The key is logged as put with the ttl.
+func (s *keyService) Expire(k string, ttl time.Duration) error {
+	e, ok := s.storage.(storage.Expirer)
+	if !ok {
+		return storage.ErrorNotSupported
+	}
+	v, err := e.Expire(k, ttl)
+	if err == nil {
+		s.logger.Printf("expire: {%s} ttl: %s\n", k, ttl)
+		err = s.tLogger.WritePutWithTTL(k, v, time.Now().Add(ttl))
+	}
+
+	return err
+}
+
+// TTL implements Service.
+func (s *keyService) TTL(k string) (time.Duration, error) {
+	return ttl(s.storage, k)
+}
+
+// ttl returns the ttl of the key, keys of storages without expiration
+// never expire.
+func ttl(s storage.Storage, k string) (time.Duration, error) {
+	if e, ok := s.(storage.Expirer); ok {
+		return e.TTL(k)
+	}
+	_, err := s.Get(k)
+
+	return 0, err
+}
+
+// getWithTTL returns the value and the ttl of the key, keys of storages
+// without expiration never expire.
+func getWithTTL(s storage.Storage, k string) (string, time.Duration, error) {
+	if e, ok := s.(storage.Expirer); ok {
+		return e.GetWithTTL(k)
+	}
+	v, err := s.Get(k)
+
+	return v, 0, err
+}
+
+// Scan implements Service.
+func (s *keyService) Scan(prefix, startAfter string, limit int) ([]string, error) {
+	keys, err := s.storage.Scan(prefix, startAfter, limit)
+	if err == nil {
+		s.logger.Printf("scan: {%s} after {%s}: %d keys\n", prefix, startAfter, len(keys))
+	}
+
+	return keys, err
+}
+
+// Apply implements Service.
+func (s *keyService) Apply(ops []storage.Op) error {
+	err := s.storage.Apply(ops)
+	if err == nil {
+		s.logger.Printf("apply: %d operations\n", len(ops))
+		if events := opEvents(ops); len(events) > 0 {
+			err = s.tLogger.WriteGroup(events)
+		}
+	}
+
+	return err
+}
+
+// Batch implements Service.
+func (s *keyService) Batch(ops []storage.Op) ([]storage.Result, error) {
+	results, err := s.storage.Batch(ops)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Printf("batch: %d operations\n", len(ops))
+
+	done := []storage.Op{}
+	for i, op := range ops {
+		if results[i].Err == nil {
+			done = append(done, op)
+		}
+	}
+	if events := opEvents(done); len(events) > 0 {
+		err = s.tLogger.WriteGroup(events)
+	}
+
+	return results, err
+}
+
+// Begin implements Service.
+func (s *keyService) Begin() *Txn {
+	return &Txn{service: s}
+}
+
+// opEvents returns the log events of changing operations, checks change nothing.
+func opEvents(ops []storage.Op) []transactionlogger.Event {
+	events := []transactionlogger.Event{}
+	for _, op := range ops {
+		switch op.Type {
+		case storage.OpPut:
+			events = append(events, transactionlogger.Event{EventType: transactionlogger.EventPut, Key: op.Key, Value: op.Value})
+		case storage.OpDelete:
+			events = append(events, transactionlogger.Event{EventType: transactionlogger.EventDelete, Key: op.Key})
+		}
+	}
+
+	return events
+}
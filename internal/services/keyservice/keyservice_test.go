@@ -5,10 +5,12 @@ import (
 	"io"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
 	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
 	"github.com/dimishpatriot/kv-storage/internal/storage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -82,6 +84,7 @@ func TestKeyService_Put(t *testing.T) {
 				tLoggerMock.
 					EXPECT().
 					WritePut(tt.args.key, tt.args.value).
+					Return(nil).
 					Times(1)
 			}
 
@@ -92,6 +95,25 @@ func TestKeyService_Put(t *testing.T) {
 	}
 }
 
+func TestKeyService_PutLogFailure(t *testing.T) {
+	setupTest(t)
+	logErr := errors.New("disk is full")
+	storageMock.
+		EXPECT().
+		Put("one", "1").
+		Return(nil).
+		Times(1)
+	tLoggerMock.
+		EXPECT().
+		WritePut("one", "1").
+		Return(logErr).
+		Times(1)
+
+	err := srv.Put("one", "1")
+
+	assert.ErrorIs(t, err, logErr)
+}
+
 func TestKeyService_Get(t *testing.T) {
 	type args struct {
 		key string
@@ -185,6 +207,7 @@ func TestKeyService_Delete(t *testing.T) {
 				tLoggerMock.
 					EXPECT().
 					WriteDelete(mock.AnythingOfType("string")).
+					Return(nil).
 					Times(1)
 			}
 
@@ -194,3 +217,396 @@ func TestKeyService_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyService_PutWithTTL(t *testing.T) {
+	type args struct {
+		key   string
+		value string
+		ttl   time.Duration
+	}
+	type want struct {
+		err bool
+	}
+	type test struct {
+		name string
+		args args
+		want want
+	}
+	tests := []test{
+		{
+			"simple args",
+			args{key: "one", value: "1", ttl: time.Minute},
+			want{err: false},
+		},
+		{
+			"storage return error",
+			args{key: "one", value: "1", ttl: 0},
+			want{err: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			if tt.want.err {
+				storageMock.
+					EXPECT().
+					PutWithTTL(tt.args.key, tt.args.value, tt.args.ttl).
+					Return(storage.ErrorInvalidTTL).
+					Times(1)
+			} else {
+				storageMock.
+					EXPECT().
+					PutWithTTL(tt.args.key, tt.args.value, tt.args.ttl).
+					Return(nil).
+					Times(1)
+				tLoggerMock.
+					EXPECT().
+					WritePutWithTTL(tt.args.key, tt.args.value, mock.AnythingOfType("time.Time")).
+					Return(nil).
+					Times(1)
+			}
+
+			err := srv.PutWithTTL(tt.args.key, tt.args.value, tt.args.ttl)
+
+			assert.Equal(t, tt.want.err, err != nil)
+		})
+	}
+}
+
+func TestKeyService_Expire(t *testing.T) {
+	setupTest(t)
+	local := localstorage.New()
+	_ = local.Put("one", "1")
+	srv = keyservice.New(logger, local, tLoggerMock)
+	tLoggerMock.
+		EXPECT().
+		WritePutWithTTL("one", "1", mock.AnythingOfType("time.Time")).
+		Return(nil).
+		Times(1)
+
+	assert.NoError(t, srv.Expire("one", time.Minute))
+	assert.ErrorIs(t, srv.Expire("two", time.Minute), storage.ErrorNoSuchKey)
+
+	ttl, err := srv.TTL("one")
+	assert.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Minute, "ttl = %s", ttl)
+}
+
+func TestKeyService_ExpireNotSupported(t *testing.T) {
+	setupTest(t)
+	storageMock.EXPECT().Get("one").Return("1", nil).Times(1)
+
+	assert.ErrorIs(t, srv.Expire("one", time.Minute), storage.ErrorNotSupported)
+
+	// keys of storages without expiration never expire
+	ttl, err := srv.TTL("one")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), ttl)
+}
+
+func TestKeyService_PutIfAbsent(t *testing.T) {
+	type args struct {
+		key   string
+		value string
+	}
+	type want struct {
+		err bool
+	}
+	type test struct {
+		name string
+		args args
+		want want
+	}
+	tests := []test{
+		{
+			"absent key",
+			args{key: "one", value: "1"},
+			want{err: false},
+		},
+		{
+			"storage return error",
+			args{key: "one", value: "1"},
+			want{err: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			if tt.want.err {
+				storageMock.
+					EXPECT().
+					PutIfAbsent(tt.args.key, tt.args.value).
+					Return(storage.ErrorConditionFailed).
+					Times(1)
+			} else {
+				storageMock.
+					EXPECT().
+					PutIfAbsent(tt.args.key, tt.args.value).
+					Return(nil).
+					Times(1)
+				tLoggerMock.
+					EXPECT().
+					WritePut(tt.args.key, tt.args.value).
+					Return(nil).
+					Times(1)
+			}
+
+			err := srv.PutIfAbsent(tt.args.key, tt.args.value)
+
+			assert.Equal(t, tt.want.err, err != nil)
+		})
+	}
+}
+
+func TestKeyService_CompareAndSwap(t *testing.T) {
+	type args struct {
+		key      string
+		expected string
+		value    string
+	}
+	type want struct {
+		err bool
+	}
+	type test struct {
+		name string
+		args args
+		want want
+	}
+	tests := []test{
+		{
+			"expected value",
+			args{key: "one", expected: "1", value: "2"},
+			want{err: false},
+		},
+		{
+			"storage return error",
+			args{key: "one", expected: "1", value: "2"},
+			want{err: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			if tt.want.err {
+				storageMock.
+					EXPECT().
+					CompareAndSwap(tt.args.key, tt.args.expected, tt.args.value).
+					Return(storage.ErrorConditionFailed).
+					Times(1)
+			} else {
+				storageMock.
+					EXPECT().
+					CompareAndSwap(tt.args.key, tt.args.expected, tt.args.value).
+					Return(nil).
+					Times(1)
+				tLoggerMock.
+					EXPECT().
+					WritePut(tt.args.key, tt.args.value).
+					Return(nil).
+					Times(1)
+			}
+
+			err := srv.CompareAndSwap(tt.args.key, tt.args.expected, tt.args.value)
+
+			assert.Equal(t, tt.want.err, err != nil)
+		})
+	}
+}
+
+func TestKeyService_Scan(t *testing.T) {
+	type args struct {
+		prefix     string
+		startAfter string
+		limit      int
+	}
+	type want struct {
+		err  bool
+		keys []string
+	}
+	type test struct {
+		name string
+		args args
+		want want
+	}
+	tests := []test{
+		{
+			"existing keys",
+			args{prefix: "user:", startAfter: "user:1", limit: 10},
+			want{keys: []string{"user:2", "user:3"}, err: false},
+		},
+		{
+			"storage return error",
+			args{prefix: "user:", startAfter: "", limit: 10},
+			want{keys: nil, err: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			if tt.want.err {
+				storageMock.
+					EXPECT().
+					Scan(tt.args.prefix, tt.args.startAfter, tt.args.limit).
+					Return(nil, errors.New("")).
+					Times(1)
+			} else {
+				storageMock.
+					EXPECT().
+					Scan(tt.args.prefix, tt.args.startAfter, tt.args.limit).
+					Return(tt.want.keys, nil).
+					Times(1)
+			}
+
+			keys, err := srv.Scan(tt.args.prefix, tt.args.startAfter, tt.args.limit)
+
+			assert.Equal(t, tt.want.err, err != nil)
+			assert.Equal(t, tt.want.keys, keys)
+		})
+	}
+}
+
+func TestKeyService_Apply(t *testing.T) {
+	tests := []struct {
+		name       string
+		ops        []storage.Op
+		storageErr error
+		wantEvents []transactionlogger.Event
+	}{
+		{
+			"puts and deletes",
+			[]storage.Op{
+				{Type: storage.OpCheck, Key: "one", Value: "1"},
+				{Type: storage.OpPut, Key: "one", Value: "0"},
+				{Type: storage.OpDelete, Key: "two"},
+			},
+			nil,
+			[]transactionlogger.Event{
+				{EventType: transactionlogger.EventPut, Key: "one", Value: "0"},
+				{EventType: transactionlogger.EventDelete, Key: "two"},
+			},
+		},
+		{
+			"only checks",
+			[]storage.Op{{Type: storage.OpCheckAbsent, Key: "one"}},
+			nil,
+			nil,
+		},
+		{
+			"failed check",
+			[]storage.Op{{Type: storage.OpCheckAbsent, Key: "one"}, {Type: storage.OpPut, Key: "one", Value: "1"}},
+			storage.OpFailed(0, storage.ErrorConditionFailed),
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			storageMock.
+				EXPECT().
+				Apply(tt.ops).
+				Return(tt.storageErr).
+				Times(1)
+			if tt.wantEvents != nil {
+				tLoggerMock.
+					EXPECT().
+					WriteGroup(tt.wantEvents).
+					Return(nil).
+					Times(1)
+			}
+
+			err := srv.Apply(tt.ops)
+
+			assert.ErrorIs(t, err, tt.storageErr)
+		})
+	}
+}
+
+func TestKeyService_Begin(t *testing.T) {
+	setupTest(t)
+	ops := []storage.Op{
+		{Type: storage.OpCheck, Key: "from", Value: "10"},
+		{Type: storage.OpCheckAbsent, Key: "lock"},
+		{Type: storage.OpPut, Key: "from", Value: "9"},
+		{Type: storage.OpDelete, Key: "to"},
+	}
+	storageMock.
+		EXPECT().
+		Apply(ops).
+		Return(nil).
+		Times(1)
+	tLoggerMock.
+		EXPECT().
+		WriteGroup(mock.Anything).
+		Return(nil).
+		Times(1)
+
+	txn := srv.Begin()
+	txn.Check("from", "10")
+	txn.CheckAbsent("lock")
+	txn.Put("from", "9")
+	txn.Delete("to")
+
+	assert.NoError(t, txn.Commit())
+	assert.ErrorIs(t, txn.Commit(), keyservice.ErrorTxnDone)
+
+	aborted := srv.Begin()
+	aborted.Put("from", "0")
+	aborted.Abort()
+	assert.ErrorIs(t, aborted.Commit(), keyservice.ErrorTxnDone)
+}
+
+func TestKeyService_Batch(t *testing.T) {
+	tests := []struct {
+		name       string
+		results    []storage.Result
+		wantEvents []transactionlogger.Event
+	}{
+		{
+			"all done",
+			[]storage.Result{{Value: "1"}, {}, {}},
+			[]transactionlogger.Event{
+				{EventType: transactionlogger.EventPut, Key: "two", Value: "2"},
+				{EventType: transactionlogger.EventDelete, Key: "one"},
+			},
+		},
+		{
+			"failed delete is not logged",
+			[]storage.Result{{Value: "1"}, {}, {Err: storage.ErrorNoSuchKey}},
+			[]transactionlogger.Event{
+				{EventType: transactionlogger.EventPut, Key: "two", Value: "2"},
+			},
+		},
+		{
+			"nothing changed",
+			[]storage.Result{{Err: storage.ErrorNoSuchKey}, {Err: storage.ErrorInvalidTTL}, {Err: storage.ErrorNoSuchKey}},
+			nil,
+		},
+	}
+	ops := []storage.Op{
+		{Type: storage.OpGet, Key: "one"},
+		{Type: storage.OpPut, Key: "two", Value: "2"},
+		{Type: storage.OpDelete, Key: "one"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			storageMock.
+				EXPECT().
+				Batch(ops).
+				Return(tt.results, nil).
+				Times(1)
+			if tt.wantEvents != nil {
+				tLoggerMock.
+					EXPECT().
+					WriteGroup(tt.wantEvents).
+					Return(nil).
+					Times(1)
+			}
+
+			got, err := srv.Batch(ops)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.results, got)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Code generated by mockery v2.33.2. DO NOT EDIT.
+
+package keyservice
+
+import (
+	raft "github.com/dimishpatriot/kv-storage/internal/services/raft"
+	storage "github.com/dimishpatriot/kv-storage/internal/storage"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockConsensus is an autogenerated mock type for the Consensus type
+type MockConsensus struct {
+	mock.Mock
+}
+
+type MockConsensus_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockConsensus) EXPECT() *MockConsensus_Expecter {
+	return &MockConsensus_Expecter{mock: &_m.Mock}
+}
+
+// Propose provides a mock function with given fields: _a0
+func (_m *MockConsensus) Propose(_a0 raft.Command) ([]storage.Result, error) {
+	ret := _m.Called(_a0)
+
+	var r0 []storage.Result
+	var r1 error
+	if rf, ok := ret.Get(0).(func(raft.Command) ([]storage.Result, error)); ok {
+		return rf(_a0)
+	}
+	if rf, ok := ret.Get(0).(func(raft.Command) []storage.Result); ok {
+		r0 = rf(_a0)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.Result)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(raft.Command) error); ok {
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockConsensus_Propose_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Propose'
+type MockConsensus_Propose_Call struct {
+	*mock.Call
+}
+
+// Propose is a helper method to define mock.On call
+//   - _a0 raft.Command
+func (_e *MockConsensus_Expecter) Propose(_a0 interface{}) *MockConsensus_Propose_Call {
+	return &MockConsensus_Propose_Call{Call: _e.mock.On("Propose", _a0)}
+}
+
+func (_c *MockConsensus_Propose_Call) Run(run func(_a0 raft.Command)) *MockConsensus_Propose_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(raft.Command))
+	})
+	return _c
+}
+
+func (_c *MockConsensus_Propose_Call) Return(_a0 []storage.Result, _a1 error) *MockConsensus_Propose_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockConsensus_Propose_Call) RunAndReturn(run func(raft.Command) ([]storage.Result, error)) *MockConsensus_Propose_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ReadBarrier provides a mock function with given fields:
+func (_m *MockConsensus) ReadBarrier() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockConsensus_ReadBarrier_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ReadBarrier'
+type MockConsensus_ReadBarrier_Call struct {
+	*mock.Call
+}
+
+// ReadBarrier is a helper method to define mock.On call
+func (_e *MockConsensus_Expecter) ReadBarrier() *MockConsensus_ReadBarrier_Call {
+	return &MockConsensus_ReadBarrier_Call{Call: _e.mock.On("ReadBarrier")}
+}
+
+func (_c *MockConsensus_ReadBarrier_Call) Run(run func()) *MockConsensus_ReadBarrier_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockConsensus_ReadBarrier_Call) Return(_a0 error) *MockConsensus_ReadBarrier_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockConsensus_ReadBarrier_Call) RunAndReturn(run func() error) *MockConsensus_ReadBarrier_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewMockConsensus creates a new instance of MockConsensus. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockConsensus(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockConsensus {
+	mock := &MockConsensus{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -2,7 +2,12 @@
 
 package keyservice
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	time "time"
+
+	storage "github.com/dimishpatriot/kv-storage/internal/storage"
+	mock "github.com/stretchr/testify/mock"
+)
 
 // MockKeyService is an autogenerated mock type for the KeyService type
 type MockKeyService struct {
@@ -17,6 +22,189 @@ func (_m *MockKeyService) EXPECT() *MockKeyService_Expecter {
 	return &MockKeyService_Expecter{mock: &_m.Mock}
 }
 
+// Apply provides a mock function with given fields: ops
+func (_m *MockKeyService) Apply(ops []storage.Op) error {
+	ret := _m.Called(ops)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func([]storage.Op) error); ok {
+		r0 = rf(ops)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockKeyService_Apply_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Apply'
+type MockKeyService_Apply_Call struct {
+	*mock.Call
+}
+
+// Apply is a helper method to define mock.On call
+//   - ops []storage.Op
+func (_e *MockKeyService_Expecter) Apply(ops interface{}) *MockKeyService_Apply_Call {
+	return &MockKeyService_Apply_Call{Call: _e.mock.On("Apply", ops)}
+}
+
+func (_c *MockKeyService_Apply_Call) Run(run func(ops []storage.Op)) *MockKeyService_Apply_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].([]storage.Op))
+	})
+	return _c
+}
+
+func (_c *MockKeyService_Apply_Call) Return(_a0 error) *MockKeyService_Apply_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockKeyService_Apply_Call) RunAndReturn(run func([]storage.Op) error) *MockKeyService_Apply_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Batch provides a mock function with given fields: ops
+func (_m *MockKeyService) Batch(ops []storage.Op) ([]storage.Result, error) {
+	ret := _m.Called(ops)
+
+	var r0 []storage.Result
+	var r1 error
+	if rf, ok := ret.Get(0).(func([]storage.Op) ([]storage.Result, error)); ok {
+		return rf(ops)
+	}
+	if rf, ok := ret.Get(0).(func([]storage.Op) []storage.Result); ok {
+		r0 = rf(ops)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]storage.Result)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func([]storage.Op) error); ok {
+		r1 = rf(ops)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockKeyService_Batch_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Batch'
+type MockKeyService_Batch_Call struct {
+	*mock.Call
+}
+
+// Batch is a helper method to define mock.On call
+//   - ops []storage.Op
+func (_e *MockKeyService_Expecter) Batch(ops interface{}) *MockKeyService_Batch_Call {
+	return &MockKeyService_Batch_Call{Call: _e.mock.On("Batch", ops)}
+}
+
+func (_c *MockKeyService_Batch_Call) Run(run func(ops []storage.Op)) *MockKeyService_Batch_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].([]storage.Op))
+	})
+	return _c
+}
+
+func (_c *MockKeyService_Batch_Call) Return(_a0 []storage.Result, _a1 error) *MockKeyService_Batch_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockKeyService_Batch_Call) RunAndReturn(run func([]storage.Op) ([]storage.Result, error)) *MockKeyService_Batch_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Begin provides a mock function with given fields:
+func (_m *MockKeyService) Begin() *Txn {
+	ret := _m.Called()
+
+	var r0 *Txn
+	if rf, ok := ret.Get(0).(func() *Txn); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*Txn)
+		}
+	}
+
+	return r0
+}
+
+// MockKeyService_Begin_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Begin'
+type MockKeyService_Begin_Call struct {
+	*mock.Call
+}
+
+// Begin is a helper method to define mock.On call
+func (_e *MockKeyService_Expecter) Begin() *MockKeyService_Begin_Call {
+	return &MockKeyService_Begin_Call{Call: _e.mock.On("Begin")}
+}
+
+func (_c *MockKeyService_Begin_Call) Run(run func()) *MockKeyService_Begin_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockKeyService_Begin_Call) Return(_a0 *Txn) *MockKeyService_Begin_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockKeyService_Begin_Call) RunAndReturn(run func() *Txn) *MockKeyService_Begin_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// CompareAndSwap provides a mock function with given fields: key, expected, new
+func (_m *MockKeyService) CompareAndSwap(key string, expected string, new string) error {
+	ret := _m.Called(key, expected, new)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string) error); ok {
+		r0 = rf(key, expected, new)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockKeyService_CompareAndSwap_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CompareAndSwap'
+type MockKeyService_CompareAndSwap_Call struct {
+	*mock.Call
+}
+
+// CompareAndSwap is a helper method to define mock.On call
+//   - key string
+//   - expected string
+//   - new string
+func (_e *MockKeyService_Expecter) CompareAndSwap(key interface{}, expected interface{}, new interface{}) *MockKeyService_CompareAndSwap_Call {
+	return &MockKeyService_CompareAndSwap_Call{Call: _e.mock.On("CompareAndSwap", key, expected, new)}
+}
+
+func (_c *MockKeyService_CompareAndSwap_Call) Run(run func(key string, expected string, new string)) *MockKeyService_CompareAndSwap_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *MockKeyService_CompareAndSwap_Call) Return(_a0 error) *MockKeyService_CompareAndSwap_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockKeyService_CompareAndSwap_Call) RunAndReturn(run func(string, string, string) error) *MockKeyService_CompareAndSwap_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Delete provides a mock function with given fields: _a0
 func (_m *MockKeyService) Delete(_a0 string) error {
 	ret := _m.Called(_a0)
@@ -59,6 +247,49 @@ func (_c *MockKeyService_Delete_Call) RunAndReturn(run func(string) error) *Mock
 	return _c
 }
 
+// Expire provides a mock function with given fields: _a0, _a1
+func (_m *MockKeyService) Expire(_a0 string, _a1 time.Duration) error {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, time.Duration) error); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockKeyService_Expire_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Expire'
+type MockKeyService_Expire_Call struct {
+	*mock.Call
+}
+
+// Expire is a helper method to define mock.On call
+//   - _a0 string
+//   - _a1 time.Duration
+func (_e *MockKeyService_Expecter) Expire(_a0 interface{}, _a1 interface{}) *MockKeyService_Expire_Call {
+	return &MockKeyService_Expire_Call{Call: _e.mock.On("Expire", _a0, _a1)}
+}
+
+func (_c *MockKeyService_Expire_Call) Run(run func(_a0 string, _a1 time.Duration)) *MockKeyService_Expire_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(time.Duration))
+	})
+	return _c
+}
+
+func (_c *MockKeyService_Expire_Call) Return(_a0 error) *MockKeyService_Expire_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockKeyService_Expire_Call) RunAndReturn(run func(string, time.Duration) error) *MockKeyService_Expire_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Get provides a mock function with given fields: _a0
 func (_m *MockKeyService) Get(_a0 string) (string, error) {
 	ret := _m.Called(_a0)
@@ -111,6 +342,65 @@ func (_c *MockKeyService_Get_Call) RunAndReturn(run func(string) (string, error)
 	return _c
 }
 
+// GetWithTTL provides a mock function with given fields: _a0
+func (_m *MockKeyService) GetWithTTL(_a0 string) (string, time.Duration, error) {
+	ret := _m.Called(_a0)
+
+	var r0 string
+	var r1 time.Duration
+	var r2 error
+	if rf, ok := ret.Get(0).(func(string) (string, time.Duration, error)); ok {
+		return rf(_a0)
+	}
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) time.Duration); ok {
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Get(1).(time.Duration)
+	}
+
+	if rf, ok := ret.Get(2).(func(string) error); ok {
+		r2 = rf(_a0)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// MockKeyService_GetWithTTL_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetWithTTL'
+type MockKeyService_GetWithTTL_Call struct {
+	*mock.Call
+}
+
+// GetWithTTL is a helper method to define mock.On call
+//   - _a0 string
+func (_e *MockKeyService_Expecter) GetWithTTL(_a0 interface{}) *MockKeyService_GetWithTTL_Call {
+	return &MockKeyService_GetWithTTL_Call{Call: _e.mock.On("GetWithTTL", _a0)}
+}
+
+func (_c *MockKeyService_GetWithTTL_Call) Run(run func(_a0 string)) *MockKeyService_GetWithTTL_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *MockKeyService_GetWithTTL_Call) Return(_a0 string, _a1 time.Duration, _a2 error) *MockKeyService_GetWithTTL_Call {
+	_c.Call.Return(_a0, _a1, _a2)
+	return _c
+}
+
+func (_c *MockKeyService_GetWithTTL_Call) RunAndReturn(run func(string) (string, time.Duration, error)) *MockKeyService_GetWithTTL_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Put provides a mock function with given fields: _a0, _a1
 func (_m *MockKeyService) Put(_a0 string, _a1 string) error {
 	ret := _m.Called(_a0, _a1)
@@ -154,6 +444,201 @@ func (_c *MockKeyService_Put_Call) RunAndReturn(run func(string, string) error)
 	return _c
 }
 
+// PutIfAbsent provides a mock function with given fields: _a0, _a1
+func (_m *MockKeyService) PutIfAbsent(_a0 string, _a1 string) error {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockKeyService_PutIfAbsent_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PutIfAbsent'
+type MockKeyService_PutIfAbsent_Call struct {
+	*mock.Call
+}
+
+// PutIfAbsent is a helper method to define mock.On call
+//   - _a0 string
+//   - _a1 string
+func (_e *MockKeyService_Expecter) PutIfAbsent(_a0 interface{}, _a1 interface{}) *MockKeyService_PutIfAbsent_Call {
+	return &MockKeyService_PutIfAbsent_Call{Call: _e.mock.On("PutIfAbsent", _a0, _a1)}
+}
+
+func (_c *MockKeyService_PutIfAbsent_Call) Run(run func(_a0 string, _a1 string)) *MockKeyService_PutIfAbsent_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *MockKeyService_PutIfAbsent_Call) Return(_a0 error) *MockKeyService_PutIfAbsent_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockKeyService_PutIfAbsent_Call) RunAndReturn(run func(string, string) error) *MockKeyService_PutIfAbsent_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// PutWithTTL provides a mock function with given fields: _a0, _a1, _a2
+func (_m *MockKeyService) PutWithTTL(_a0 string, _a1 string, _a2 time.Duration) error {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, time.Duration) error); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockKeyService_PutWithTTL_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PutWithTTL'
+type MockKeyService_PutWithTTL_Call struct {
+	*mock.Call
+}
+
+// PutWithTTL is a helper method to define mock.On call
+//   - _a0 string
+//   - _a1 string
+//   - _a2 time.Duration
+func (_e *MockKeyService_Expecter) PutWithTTL(_a0 interface{}, _a1 interface{}, _a2 interface{}) *MockKeyService_PutWithTTL_Call {
+	return &MockKeyService_PutWithTTL_Call{Call: _e.mock.On("PutWithTTL", _a0, _a1, _a2)}
+}
+
+func (_c *MockKeyService_PutWithTTL_Call) Run(run func(_a0 string, _a1 string, _a2 time.Duration)) *MockKeyService_PutWithTTL_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string), args[2].(time.Duration))
+	})
+	return _c
+}
+
+func (_c *MockKeyService_PutWithTTL_Call) Return(_a0 error) *MockKeyService_PutWithTTL_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockKeyService_PutWithTTL_Call) RunAndReturn(run func(string, string, time.Duration) error) *MockKeyService_PutWithTTL_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Scan provides a mock function with given fields: prefix, startAfter, limit
+func (_m *MockKeyService) Scan(prefix string, startAfter string, limit int) ([]string, error) {
+	ret := _m.Called(prefix, startAfter, limit)
+
+	var r0 []string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string, int) ([]string, error)); ok {
+		return rf(prefix, startAfter, limit)
+	}
+	if rf, ok := ret.Get(0).(func(string, string, int) []string); ok {
+		r0 = rf(prefix, startAfter, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string, int) error); ok {
+		r1 = rf(prefix, startAfter, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockKeyService_Scan_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Scan'
+type MockKeyService_Scan_Call struct {
+	*mock.Call
+}
+
+// Scan is a helper method to define mock.On call
+//   - prefix string
+//   - startAfter string
+//   - limit int
+func (_e *MockKeyService_Expecter) Scan(prefix interface{}, startAfter interface{}, limit interface{}) *MockKeyService_Scan_Call {
+	return &MockKeyService_Scan_Call{Call: _e.mock.On("Scan", prefix, startAfter, limit)}
+}
+
+func (_c *MockKeyService_Scan_Call) Run(run func(prefix string, startAfter string, limit int)) *MockKeyService_Scan_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string), args[2].(int))
+	})
+	return _c
+}
+
+func (_c *MockKeyService_Scan_Call) Return(_a0 []string, _a1 error) *MockKeyService_Scan_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockKeyService_Scan_Call) RunAndReturn(run func(string, string, int) ([]string, error)) *MockKeyService_Scan_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// TTL provides a mock function with given fields: _a0
+func (_m *MockKeyService) TTL(_a0 string) (time.Duration, error) {
+	ret := _m.Called(_a0)
+
+	var r0 time.Duration
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (time.Duration, error)); ok {
+		return rf(_a0)
+	}
+	if rf, ok := ret.Get(0).(func(string) time.Duration); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Get(0).(time.Duration)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockKeyService_TTL_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'TTL'
+type MockKeyService_TTL_Call struct {
+	*mock.Call
+}
+
+// TTL is a helper method to define mock.On call
+//   - _a0 string
+func (_e *MockKeyService_Expecter) TTL(_a0 interface{}) *MockKeyService_TTL_Call {
+	return &MockKeyService_TTL_Call{Call: _e.mock.On("TTL", _a0)}
+}
+
+func (_c *MockKeyService_TTL_Call) Run(run func(_a0 string)) *MockKeyService_TTL_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *MockKeyService_TTL_Call) Return(_a0 time.Duration, _a1 error) *MockKeyService_TTL_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockKeyService_TTL_Call) RunAndReturn(run func(string) (time.Duration, error)) *MockKeyService_TTL_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewMockKeyService creates a new instance of MockKeyService. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewMockKeyService(t interface {
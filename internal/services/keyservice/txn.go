@@ -0,0 +1,51 @@
+package keyservice
+
+import (
+	"errors"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+var ErrorTxnDone = errors.New("transaction is already committed or aborted")
+
+// Txn stages operations and applies all of them at once on Commit.
+// Checks are evaluated at Commit, after the operations staged before them.
+type Txn struct {
+	service KeyService
+	ops     []storage.Op
+	done    bool
+}
+
+func (t *Txn) Put(k, v string) {
+	t.ops = append(t.ops, storage.Op{Type: storage.OpPut, Key: k, Value: v})
+}
+
+func (t *Txn) Delete(k string) {
+	t.ops = append(t.ops, storage.Op{Type: storage.OpDelete, Key: k})
+}
+
+// Check makes Commit fail if the key doesn't have the value.
+func (t *Txn) Check(k, v string) {
+	t.ops = append(t.ops, storage.Op{Type: storage.OpCheck, Key: k, Value: v})
+}
+
+// CheckAbsent makes Commit fail if the key exists.
+func (t *Txn) CheckAbsent(k string) {
+	t.ops = append(t.ops, storage.Op{Type: storage.OpCheckAbsent, Key: k})
+}
+
+// Commit applies the staged operations, on error none of them is applied.
+func (t *Txn) Commit() error {
+	if t.done {
+		return ErrorTxnDone
+	}
+	t.done = true
+
+	return t.service.Apply(t.ops)
+}
+
+// Abort drops the staged operations.
+func (t *Txn) Abort() {
+	t.done = true
+	t.ops = nil
+}
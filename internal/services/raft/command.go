@@ -0,0 +1,172 @@
+package raft
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+type CommandType byte
+
+const (
+	CommandNoop CommandType = iota // appended by a new leader to commit the entries of previous terms
+	CommandMembers
+	CommandPut
+	CommandPutWithTTL
+	CommandPutIfAbsent
+	CommandCompareAndSwap
+	CommandDelete
+	CommandApply
+	CommandBatch
+	CommandExpire
+	CommandDeleteExpired
+)
+
+// Command is a change of the storage or of the cluster members. Conditions
+// are checked when the command is applied as of the time it was proposed,
+// so every node gets the same result.
+type Command struct {
+	Type     CommandType       `json:"type"`
+	Time     int64             `json:"time,omitempty"` // unix time in nanoseconds of the leader when proposed
+	Key      string            `json:"key,omitempty"`
+	Value    string            `json:"value,omitempty"`
+	Expected string            `json:"expected,omitempty"` // for CommandCompareAndSwap
+	Expires  int64             `json:"expires,omitempty"`  // unix time in nanoseconds for CommandPutWithTTL and CommandExpire
+	Ops      []storage.Op      `json:"ops,omitempty"`      // for CommandApply and CommandBatch
+	Keys     []string          `json:"keys,omitempty"`     // for CommandDeleteExpired
+	Members  map[string]string `json:"members,omitempty"`  // for CommandMembers: ID to address
+}
+
+// apply applies the command to the storage as of the command time,
+// results are for CommandBatch only.
+func apply(s storage.Storage, c Command) ([]storage.Result, error) {
+	now := commandTime(c.Time)
+	if c.Type == CommandDeleteExpired {
+		if cs, ok := s.(storage.Clocked); ok {
+			for _, k := range c.Keys {
+				cs.DeleteExpired(k, now)
+			}
+		}
+		return nil, nil
+	}
+	s = at(s, now)
+
+	switch c.Type {
+	case CommandPut:
+		return nil, s.Put(c.Key, c.Value)
+	case CommandPutWithTTL:
+		ttl := time.Unix(0, c.Expires).Sub(now)
+		if ttl > 0 {
+			return nil, s.PutWithTTL(c.Key, c.Value, ttl)
+		}
+		// expired when proposed
+		if err := s.Delete(c.Key); !errors.Is(err, storage.ErrorNoSuchKey) {
+			return nil, err
+		}
+		return nil, nil
+	case CommandPutIfAbsent:
+		return nil, s.PutIfAbsent(c.Key, c.Value)
+	case CommandCompareAndSwap:
+		return nil, s.CompareAndSwap(c.Key, c.Expected, c.Value)
+	case CommandDelete:
+		return nil, s.Delete(c.Key)
+	case CommandApply:
+		return nil, s.Apply(c.Ops)
+	case CommandBatch:
+		return s.Batch(c.Ops)
+	case CommandExpire:
+		e, ok := s.(storage.Expirer)
+		if !ok {
+			return nil, storage.ErrorNotSupported
+		}
+		ttl := time.Unix(0, c.Expires).Sub(now)
+		if ttl <= 0 {
+			return nil, s.Delete(c.Key)
+		}
+		_, err := e.Expire(c.Key, ttl)
+		return nil, err
+	default:
+		return nil, nil
+	}
+}
+
+// commandTime returns the time of a command, the clock for the commands
+// logged before they had one.
+func commandTime(t int64) time.Time {
+	if t == 0 {
+		return time.Now()
+	}
+
+	return time.Unix(0, t)
+}
+
+// at returns the storage as of now if its keys can expire by it.
+func at(s storage.Storage, now time.Time) storage.Storage {
+	if c, ok := s.(storage.Clocked); ok {
+		return c.At(now)
+	}
+
+	return s
+}
+
+// Node is a TransactionLogger which changes are applied to the storage by
+// every member once committed, so the caller doesn't apply them itself.
+var _ transactionlogger.TransactionLogger = (*Node)(nil)
+
+// WritePut implements TransactionLogger.
+func (n *Node) WritePut(key, value string) error {
+	_, err := n.Propose(Command{Type: CommandPut, Key: key, Value: value})
+
+	return err
+}
+
+// WritePutWithTTL implements TransactionLogger.
+func (n *Node) WritePutWithTTL(key, value string, expires time.Time) error {
+	_, err := n.Propose(Command{Type: CommandPutWithTTL, Key: key, Value: value, Expires: expires.UnixNano()})
+
+	return err
+}
+
+// WriteDelete implements TransactionLogger.
+func (n *Node) WriteDelete(key string) error {
+	_, err := n.Propose(Command{Type: CommandDelete, Key: key})
+	if errors.Is(err, storage.ErrorNoSuchKey) {
+		return nil
+	}
+
+	return err
+}
+
+// WriteGroup implements TransactionLogger.
+func (n *Node) WriteGroup(events []transactionlogger.Event) error {
+	ops := make([]storage.Op, 0, len(events))
+	for _, e := range events {
+		switch e.EventType {
+		case transactionlogger.EventPut:
+			ops = append(ops, storage.Op{Type: storage.OpPut, Key: e.Key, Value: e.Value})
+		case transactionlogger.EventDelete:
+			ops = append(ops, storage.Op{Type: storage.OpDelete, Key: e.Key})
+		}
+	}
+	_, err := n.Propose(Command{Type: CommandApply, Ops: ops})
+
+	return err
+}
+
+// ReadEvents implements TransactionLogger. The storage is restored by the
+// node itself: it applies the committed entries of its log.
+func (n *Node) ReadEvents() (<-chan transactionlogger.Event, <-chan error) {
+	events := make(chan transactionlogger.Event)
+	errs := make(chan error)
+	close(events)
+	close(errs)
+
+	return events, errs
+}
+
+// Err implements TransactionLogger.
+func (n *Node) Err() <-chan error {
+	return n.errors
+}
@@ -0,0 +1,268 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/dimishpatriot/kv-storage/internal/fileutil"
+)
+
+// Persister keeps the state a node must not forget on restart: the term,
+// the vote in it, the last snapshot and the log after it.
+type Persister interface {
+	SaveState(term uint64, votedFor string) error
+	// Append adds the entries to the end of the log.
+	Append(entries []Entry) error
+	// TruncateFrom removes the entries from the index to the end of the log.
+	TruncateFrom(index uint64) error
+	// SaveSnapshot saves the snapshot and replaces the log with the
+	// entries after it.
+	SaveSnapshot(snapshot Snapshot, entries []Entry) error
+	Load() (term uint64, votedFor string, snapshot Snapshot, entries []Entry, err error)
+}
+
+// MemoryPersister keeps the state in memory, for tests.
+type MemoryPersister struct {
+	mu       sync.Mutex
+	term     uint64
+	votedFor string
+	snapshot Snapshot
+	entries  []Entry
+}
+
+func NewMemoryPersister() *MemoryPersister {
+	return &MemoryPersister{}
+}
+
+func (p *MemoryPersister) SaveState(term uint64, votedFor string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.term, p.votedFor = term, votedFor
+
+	return nil
+}
+
+func (p *MemoryPersister) Append(entries []Entry) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entries = append(p.entries, entries...)
+
+	return nil
+}
+
+func (p *MemoryPersister) TruncateFrom(index uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entries = p.entries[:index-1-p.snapshot.Index]
+
+	return nil
+}
+
+func (p *MemoryPersister) SaveSnapshot(snapshot Snapshot, entries []Entry) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.snapshot, p.entries = snapshot, append([]Entry{}, entries...)
+
+	return nil
+}
+
+func (p *MemoryPersister) Load() (uint64, string, Snapshot, []Entry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.term, p.votedFor, p.snapshot, append([]Entry{}, p.entries...), nil
+}
+
+// FilePersister keeps the state in the dir: the term and the vote in the
+// state file, the last snapshot in the snapshot file and the log entries
+// after it as JSON lines in the log file.
+type FilePersister struct {
+	dir           string
+	mu            sync.Mutex
+	file          *os.File // log
+	snapshotIndex uint64   // the log starts after it
+}
+
+type persistentState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"voted_for"`
+}
+
+func NewFilePersister(dir string) (*FilePersister, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cant create raft dir: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, "log"), os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("cant open raft log: %w", err)
+	}
+
+	return &FilePersister{dir: dir, file: file}, nil
+}
+
+func (p *FilePersister) SaveState(term uint64, votedFor string) error {
+	b, _ := json.Marshal(persistentState{term, votedFor})
+
+	return fileutil.WriteFileAtomic(filepath.Join(p.dir, "state"), b)
+}
+
+func (p *FilePersister) Append(entries []Entry) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b := []byte{}
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("cant encode raft entry: %w", err)
+		}
+		b = append(append(b, line...), '\n')
+	}
+	if _, err := p.file.Write(b); err != nil {
+		return fmt.Errorf("cant write raft log: %w", err)
+	}
+
+	return p.file.Sync()
+}
+
+// TruncateFrom rewrites the log, it's rare: only a new leader overwrites
+// the uncommitted entries of a previous one.
+func (p *FilePersister) TruncateFrom(index uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entries, _, err := p.readLog()
+	if err != nil {
+		return err
+	}
+
+	return p.rewriteLog(entries[:index-1-p.snapshotIndex])
+}
+
+// SaveSnapshot writes the snapshot before the log, so the entries it
+// replaces are skipped on load if the log isn't rewritten by a crash.
+func (p *FilePersister) SaveSnapshot(snapshot Snapshot, entries []Entry) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("cant encode raft snapshot: %w", err)
+	}
+	if err = fileutil.WriteFileAtomic(filepath.Join(p.dir, "snapshot"), b); err != nil {
+		return fmt.Errorf("cant write raft snapshot: %w", err)
+	}
+	p.snapshotIndex = snapshot.Index
+
+	return p.rewriteLog(entries)
+}
+
+func (p *FilePersister) Load() (uint64, string, Snapshot, []Entry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var state persistentState
+	if err := readJSON(filepath.Join(p.dir, "state"), &state); err != nil {
+		return 0, "", Snapshot{}, nil, fmt.Errorf("cant read raft state: %w", err)
+	}
+	var snapshot Snapshot
+	if err := readJSON(filepath.Join(p.dir, "snapshot"), &snapshot); err != nil {
+		return 0, "", Snapshot{}, nil, fmt.Errorf("cant read raft snapshot: %w", err)
+	}
+	p.snapshotIndex = snapshot.Index
+
+	entries, offset, err := p.readLog()
+	if err != nil {
+		return 0, "", Snapshot{}, nil, err
+	}
+	// new entries must not be appended to a torn line
+	if err = p.file.Truncate(offset); err != nil {
+		return 0, "", Snapshot{}, nil, fmt.Errorf("cant truncate raft log: %w", err)
+	}
+
+	return state.Term, state.VotedFor, snapshot, entries, nil
+}
+
+// readJSON decodes the file into v, a missing file leaves v as is.
+func readJSON(name string, v any) error {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// readLog reads the entries after the snapshot and returns the offset
+// after the last one, a line torn by a crash at the end is dropped.
+func (p *FilePersister) readLog() ([]Entry, int64, error) {
+	file, err := os.Open(p.file.Name())
+	if err != nil {
+		return nil, 0, fmt.Errorf("cant open raft log: %w", err)
+	}
+	defer file.Close()
+
+	entries := []Entry{}
+	offset := int64(0)
+	r := bufio.NewReaderSize(file, 64<<10)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a line without the newline is torn even if it's decoded
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("cant read raft log: %w", err)
+		}
+		var e Entry
+		if len(line) > maxEntrySize || json.Unmarshal(line, &e) != nil {
+			break
+		}
+		offset += int64(len(line))
+		// the log isn't rewritten yet after the snapshot
+		if e.Index <= p.snapshotIndex {
+			continue
+		}
+		if e.Index != p.snapshotIndex+uint64(len(entries))+1 {
+			return nil, 0, fmt.Errorf("raft log entry %d out of order", e.Index)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, offset, nil
+}
+
+// rewriteLog replaces the log with the entries.
+func (p *FilePersister) rewriteLog(entries []Entry) error {
+	b := []byte{}
+	for _, e := range entries {
+		line, _ := json.Marshal(e)
+		b = append(append(b, line...), '\n')
+	}
+
+	name := p.file.Name()
+	p.file.Close()
+	err := fileutil.WriteFileAtomic(name, b)
+	if err != nil {
+		return err
+	}
+	p.file, err = os.OpenFile(name, os.O_RDWR|os.O_APPEND, 0o755)
+	if err != nil {
+		return fmt.Errorf("cant open raft log: %w", err)
+	}
+
+	return nil
+}
+
+func (p *FilePersister) Close() error {
+	return p.file.Close()
+}
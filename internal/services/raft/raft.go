@@ -0,0 +1,989 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/snapshot"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+type State int
+
+const (
+	Follower State = iota
+	Candidate
+	Leader
+)
+
+func (s State) String() string {
+	switch s {
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	default:
+		return "follower"
+	}
+}
+
+const (
+	DefaultHeartbeatInterval = 50 * time.Millisecond
+	DefaultElectionTimeout   = 500 * time.Millisecond
+	DefaultProposeTimeout    = 5 * time.Second
+
+	maxAppendEntries = 500     // per request
+	maxEntrySize     = 8 << 20 // of an encoded entry
+	sweepLimit       = 1000    // expired keys deleted per sweep
+)
+
+var (
+	ErrorNotLeader      = errors.New("node is not the leader")
+	ErrorNoLeader       = errors.New("cluster has no leader")
+	ErrorLeadershipLost = errors.New("leadership is lost, the change may be applied or not")
+	ErrorTimeout        = errors.New("change is not applied in time")
+	ErrorStopped        = errors.New("node is stopped")
+	ErrorConfigChange   = errors.New("previous members change is not committed yet")
+	ErrorUnknownMember  = errors.New("no such member")
+
+	ErrorSnapshotUnsupported = errors.New("storage can't be saved to a snapshot")
+)
+
+// Retryable reports whether a request failed by err may succeed after a
+// leader change.
+func Retryable(err error) bool {
+	return errors.Is(err, ErrorNotLeader) ||
+		errors.Is(err, ErrorNoLeader) ||
+		errors.Is(err, ErrorLeadershipLost) ||
+		errors.Is(err, ErrorTimeout) ||
+		errors.Is(err, ErrorStopped)
+}
+
+// Entry is an entry of the replicated log.
+type Entry struct {
+	Term    uint64  `json:"term"`
+	Index   uint64  `json:"index"`
+	Command Command `json:"command"`
+}
+
+// Snapshot is the storage after the entry Index of the term Term is
+// applied, it replaces the log up to the entry.
+type Snapshot struct {
+	Index   uint64            `json:"index"`
+	Term    uint64            `json:"term"`
+	Members map[string]string `json:"members"`
+	Time    int64             `json:"time,omitempty"` // of the command of the entry Index
+	Data    []byte            `json:"data"`           // items in the snapshot package format
+}
+
+type Config struct {
+	ID string
+	// Members are the initial cluster members: ID to base URL. A node
+	// joining a running cluster starts with none and learns them from the
+	// leader after it's added.
+	Members           map[string]string
+	HeartbeatInterval time.Duration
+	// ElectionTimeout is the min time without a leader before a follower
+	// starts an election, the actual one is random up to twice longer.
+	ElectionTimeout time.Duration
+	ProposeTimeout  time.Duration
+	// SnapshotEntries is the number of applied entries after which the log
+	// is compacted into a snapshot of the storage, 0 disables compaction.
+	SnapshotEntries uint64
+}
+
+type proposal struct {
+	term uint64
+	done chan applyResult
+}
+
+type applyResult struct {
+	results []storage.Result
+	err     error
+}
+
+type reader struct {
+	index uint64
+	done  chan struct{}
+}
+
+// Node is a member of a Raft cluster. Changes are proposed to the leader,
+// which replicates them to the followers, and every node applies the
+// committed ones to its storage in the log order.
+type Node struct {
+	logger    *log.Logger
+	config    Config
+	storage   storage.Storage
+	snapshots snapshot.Storage // the storage if it can be saved to a snapshot
+	transport Transport
+	persister Persister
+
+	mu              sync.Mutex
+	state           State
+	term            uint64
+	votedFor        string
+	leader          string
+	entries         []Entry  // after the snapshot, entries[0] has its index and term
+	snapshot        Snapshot // the last one
+	members         map[string]string
+	commitIndex     uint64
+	lastApplied     uint64
+	lastContact     time.Time // with the leader or a candidate the vote is given to
+	electionTimeout time.Duration
+	termStart       uint64 // index of the first entry of the leader term
+	nextIndex       map[string]uint64
+	matchIndex      map[string]uint64
+	inflight        map[string]bool
+	proposals       map[uint64]*proposal
+	readers         []reader
+	applied         *sync.Cond
+	stopped         bool
+
+	run    sync.Once
+	done   chan struct{}
+	errors chan error
+}
+
+func New(logger *log.Logger, config Config, storage storage.Storage, transport Transport, persister Persister) (*Node, error) {
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if config.ElectionTimeout <= 0 {
+		config.ElectionTimeout = DefaultElectionTimeout
+	}
+	if config.ProposeTimeout <= 0 {
+		config.ProposeTimeout = DefaultProposeTimeout
+	}
+
+	term, votedFor, s, entries, err := persister.Load()
+	if err != nil {
+		return nil, fmt.Errorf("cant load raft state: %w", err)
+	}
+	snapshots, ok := storage.(snapshot.Storage)
+	if !ok && (config.SnapshotEntries > 0 || s.Index > 0) {
+		return nil, ErrorSnapshotUnsupported
+	}
+
+	n := &Node{
+		logger:      logger,
+		config:      config,
+		storage:     storage,
+		snapshots:   snapshots,
+		transport:   transport,
+		persister:   persister,
+		term:        term,
+		votedFor:    votedFor,
+		entries:     append([]Entry{{Term: s.Term, Index: s.Index}}, entries...),
+		snapshot:    s,
+		commitIndex: s.Index, // the applier loads the snapshot first
+		lastContact: time.Now(),
+		nextIndex:   map[string]uint64{},
+		matchIndex:  map[string]uint64{},
+		inflight:    map[string]bool{},
+		proposals:   map[uint64]*proposal{},
+		done:        make(chan struct{}),
+		errors:      make(chan error, 1),
+	}
+	n.applied = sync.NewCond(&n.mu)
+	n.resetMembers()
+	n.resetElectionTimeout()
+
+	return n, nil
+}
+
+// Run starts the node: the election timer, heartbeats and the applier.
+func (n *Node) Run() {
+	n.run.Do(func() {
+		go n.runTicker()
+		go n.runApplier()
+	})
+}
+
+// RunSweeper starts a background goroutine which, while the node is the
+// leader, proposes to delete the keys expired every interval. The storage
+// of a member isn't changed but by the log, so they are dropped by every
+// member alike. Call the returned function to stop it.
+func (n *Node) RunSweeper(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-n.done:
+				return
+			case now := <-ticker.C:
+				n.sweep(now)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// sweep proposes to delete up to sweepLimit keys expired as of now, a key
+// is deleted only if it's still expired when the command is applied.
+func (n *Node) sweep(now time.Time) {
+	s, ok := n.storage.(storage.Clocked)
+	if state, _ := n.State(); !ok || state != Leader {
+		return
+	}
+	keys := s.Expired(now, sweepLimit)
+	if len(keys) == 0 {
+		return
+	}
+	if _, err := n.Propose(Command{Type: CommandDeleteExpired, Keys: keys}); err != nil {
+		n.logger.Printf("raft: cant delete expired keys: %s", err)
+	}
+}
+
+// Stop stops the node, pending proposals and reads fail.
+func (n *Node) Stop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.stopped {
+		return
+	}
+	n.stopped = true
+	close(n.done)
+	n.applied.Broadcast()
+}
+
+// State returns the role of the node and its term.
+func (n *Node) State() (State, uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.state, n.term
+}
+
+// Leader returns the address of the leader known to the node, empty if
+// there is none, and if the node is the leader itself.
+func (n *Node) Leader() (string, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.members[n.leader], n.state == Leader
+}
+
+// Members returns the current cluster members: ID to address.
+func (n *Node) Members() map[string]string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return clone(n.members)
+}
+
+// Propose replicates the command and returns the result of its apply
+// once it's committed. Only the leader accepts proposals.
+func (n *Node) Propose(c Command) ([]storage.Result, error) {
+	n.mu.Lock()
+	if n.stopped {
+		n.mu.Unlock()
+		return nil, ErrorStopped
+	}
+	if n.state != Leader {
+		n.mu.Unlock()
+		return nil, ErrorNotLeader
+	}
+	e, err := n.appendEntry(c)
+	if err != nil {
+		n.mu.Unlock()
+		return nil, err
+	}
+	p := &proposal{term: e.Term, done: make(chan applyResult, 1)}
+	n.proposals[e.Index] = p
+	n.mu.Unlock()
+
+	n.broadcast()
+
+	select {
+	case r := <-p.done:
+		return r.results, r.err
+	case <-time.After(n.config.ProposeTimeout):
+		n.mu.Lock()
+		delete(n.proposals, e.Index)
+		n.mu.Unlock()
+		return nil, ErrorTimeout
+	case <-n.done:
+		return nil, ErrorStopped
+	}
+}
+
+// AddMember adds the node to the cluster, one change at a time.
+func (n *Node) AddMember(id, addr string) error {
+	return n.changeMembers(func(members map[string]string) error {
+		members[id] = addr
+		return nil
+	})
+}
+
+// RemoveMember removes the node from the cluster, a removed leader steps
+// down once the change is committed.
+func (n *Node) RemoveMember(id string) error {
+	return n.changeMembers(func(members map[string]string) error {
+		if _, ok := members[id]; !ok {
+			return ErrorUnknownMember
+		}
+		delete(members, id)
+		return nil
+	})
+}
+
+func (n *Node) changeMembers(change func(map[string]string) error) error {
+	n.mu.Lock()
+	// a change takes effect once appended, so the next one must wait for
+	// its commit: the majorities of the old and the new members overlap
+	// only for a single server change
+	pending := n.configIndex() > n.commitIndex
+	members := clone(n.members)
+	n.mu.Unlock()
+
+	if pending {
+		return ErrorConfigChange
+	}
+	if err := change(members); err != nil {
+		return err
+	}
+	_, err := n.Propose(Command{Type: CommandMembers, Members: members})
+
+	return err
+}
+
+// ReadBarrier returns when the storage of the leader reflects every change
+// committed before the call, so a read after it is linearizable.
+func (n *Node) ReadBarrier() error {
+	n.mu.Lock()
+	if n.state != Leader {
+		n.mu.Unlock()
+		return ErrorNotLeader
+	}
+	// the commit index of the previous terms is known once the first entry
+	// of the leader term is committed
+	index := max(n.commitIndex, n.termStart)
+	term := n.term
+	n.mu.Unlock()
+
+	// another leader may have been elected without this one knowing it
+	if err := n.confirmLeadership(term); err != nil {
+		return err
+	}
+
+	return n.waitApplied(index)
+}
+
+// confirmLeadership checks that a majority still follows the leader.
+func (n *Node) confirmLeadership(term uint64) error {
+	n.mu.Lock()
+	if n.state != Leader || n.term != term {
+		n.mu.Unlock()
+		return ErrorNotLeader
+	}
+	quorum := n.quorum()
+	acks := 0
+	if _, ok := n.members[n.config.ID]; ok {
+		acks++
+	}
+	peers := n.peers()
+	requests := make(map[string]AppendEntriesRequest, len(peers))
+	for id := range peers {
+		requests[id] = n.heartbeat(id)
+	}
+	n.mu.Unlock()
+
+	if acks >= quorum {
+		return nil
+	}
+
+	results := make(chan bool, len(peers))
+	for id, addr := range peers {
+		go func(addr string, req AppendEntriesRequest) {
+			resp, err := n.transport.AppendEntries(addr, req)
+			if err == nil && resp.Term > term {
+				n.mu.Lock()
+				n.becomeFollower(resp.Term)
+				n.mu.Unlock()
+			}
+			results <- err == nil && resp.Term == term
+		}(addr, requests[id])
+	}
+
+	timeout := time.After(n.config.ProposeTimeout)
+	for i := 0; i < len(peers); i++ {
+		select {
+		case ok := <-results:
+			if ok {
+				acks++
+			}
+			if acks >= quorum {
+				return nil
+			}
+		case <-timeout:
+			return ErrorTimeout
+		case <-n.done:
+			return ErrorStopped
+		}
+	}
+
+	return ErrorNotLeader
+}
+
+func (n *Node) waitApplied(index uint64) error {
+	n.mu.Lock()
+	if n.lastApplied >= index {
+		n.mu.Unlock()
+		return nil
+	}
+	r := reader{index, make(chan struct{})}
+	n.readers = append(n.readers, r)
+	n.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-time.After(n.config.ProposeTimeout):
+		return ErrorTimeout
+	case <-n.done:
+		return ErrorStopped
+	}
+}
+
+func (n *Node) runTicker() {
+	ticker := time.NewTicker(n.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-ticker.C:
+		}
+
+		n.mu.Lock()
+		state := n.state
+		_, member := n.members[n.config.ID]
+		timedOut := time.Since(n.lastContact) >= n.electionTimeout
+		n.mu.Unlock()
+
+		switch {
+		case state == Leader:
+			n.broadcast()
+		case member && timedOut:
+			n.startElection()
+		}
+	}
+}
+
+// runApplier applies the committed entries or a snapshot to the storage,
+// completes the proposals and reads waiting for them and compacts the log.
+// Only the applier changes the storage.
+func (n *Node) runApplier() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for {
+		for !n.stopped && n.lastApplied >= n.commitIndex {
+			n.applied.Wait()
+		}
+		if n.stopped {
+			return
+		}
+		if n.lastApplied < n.snapshotIndex() {
+			n.restoreSnapshot()
+			continue
+		}
+		base := n.snapshotIndex()
+		entries := append([]Entry{}, n.entries[n.lastApplied+1-base:n.commitIndex+1-base]...)
+		n.mu.Unlock()
+
+		results := make([]applyResult, len(entries))
+		for i, e := range entries {
+			results[i].results, results[i].err = apply(n.storage, e.Command)
+		}
+
+		n.mu.Lock()
+		for i, e := range entries {
+			n.lastApplied = e.Index
+			p, ok := n.proposals[e.Index]
+			if !ok {
+				continue
+			}
+			delete(n.proposals, e.Index)
+			if p.term != e.Term {
+				results[i] = applyResult{err: ErrorLeadershipLost}
+			}
+			p.done <- results[i]
+		}
+		n.releaseReaders()
+
+		if n.config.SnapshotEntries > 0 && n.lastApplied-n.snapshotIndex() >= n.config.SnapshotEntries {
+			n.takeSnapshot()
+		}
+	}
+}
+
+// releaseReaders completes the reads waiting for the applied entries, it
+// holds the lock.
+func (n *Node) releaseReaders() {
+	pending := n.readers[:0]
+	for _, r := range n.readers {
+		if r.index <= n.lastApplied {
+			close(r.done)
+			continue
+		}
+		pending = append(pending, r)
+	}
+	n.readers = pending
+}
+
+// restoreSnapshot loads the last snapshot into the storage, it's called
+// by the applier holding the lock and releases it while loading.
+func (n *Node) restoreSnapshot() {
+	s := n.snapshot
+	n.mu.Unlock()
+	_, items, err := snapshot.Decode(s.Data)
+	if err == nil {
+		n.snapshotsAt(s.Time).Load(items)
+	}
+	n.mu.Lock()
+
+	if err != nil {
+		n.fail(fmt.Errorf("cant load raft snapshot %d: %w", s.Index, err))
+		n.stopped = true
+		close(n.done)
+		return
+	}
+	n.logger.Printf("raft: snapshot %d loaded: %d items", s.Index, len(items))
+	n.lastApplied = max(n.lastApplied, s.Index)
+	// the result of a change in the snapshot is unknown
+	for index, p := range n.proposals {
+		if index <= s.Index {
+			p.done <- applyResult{err: ErrorLeadershipLost}
+			delete(n.proposals, index)
+		}
+	}
+	n.releaseReaders()
+}
+
+// snapshotsAt returns the storage to save or load a snapshot as of the
+// command time t.
+func (n *Node) snapshotsAt(t int64) snapshot.Storage {
+	if s, ok := at(n.storage, commandTime(t)).(snapshot.Storage); ok {
+		return s
+	}
+
+	return n.snapshots
+}
+
+// takeSnapshot saves the storage with the entries applied so far and drops
+// them from the log. It's called by the applier holding the lock and
+// releases it while the storage is saved.
+func (n *Node) takeSnapshot() {
+	last := n.entry(n.lastApplied)
+	s := Snapshot{
+		Index:   last.Index,
+		Term:    last.Term,
+		Members: n.membersAt(n.lastApplied),
+		Time:    last.Command.Time,
+	}
+	n.mu.Unlock()
+	// as of the last entry, so expired keys are the same on every member
+	s.Data = snapshot.Encode(s.Index, n.snapshotsAt(s.Time).Items())
+	n.mu.Lock()
+
+	// a snapshot of the leader may be installed meanwhile
+	if s.Index <= n.snapshotIndex() {
+		return
+	}
+	entries := n.entries[s.Index-n.snapshotIndex()+1:]
+	if err := n.persister.SaveSnapshot(s, entries); err != nil {
+		n.fail(fmt.Errorf("cant persist raft snapshot: %w", err))
+		return
+	}
+	n.entries = append([]Entry{{Term: s.Term, Index: s.Index}}, entries...)
+	n.snapshot = s
+	n.logger.Printf("raft: log compacted up to %d", s.Index)
+}
+
+func (n *Node) startElection() {
+	n.mu.Lock()
+	n.state = Candidate
+	n.term++
+	n.votedFor = n.config.ID
+	n.leader = ""
+	n.lastContact = time.Now()
+	n.resetElectionTimeout()
+	if err := n.saveState(); err != nil {
+		n.mu.Unlock()
+		return
+	}
+	n.logger.Printf("raft: start election for term %d", n.term)
+
+	term := n.term
+	req := RequestVoteRequest{
+		Term:         term,
+		CandidateID:  n.config.ID,
+		LastLogIndex: n.lastIndex(),
+		LastLogTerm:  n.lastTerm(),
+	}
+	votes := 1
+	if votes >= n.quorum() {
+		n.becomeLeader()
+		n.mu.Unlock()
+		return
+	}
+	peers := n.peers()
+	n.mu.Unlock()
+
+	for _, addr := range peers {
+		go func(addr string) {
+			resp, err := n.transport.RequestVote(addr, req)
+			if err != nil {
+				return
+			}
+
+			n.mu.Lock()
+			defer n.mu.Unlock()
+
+			if resp.Term > n.term {
+				n.becomeFollower(resp.Term)
+				return
+			}
+			if n.state != Candidate || n.term != term || !resp.VoteGranted {
+				return
+			}
+			votes++
+			if votes == n.quorum() {
+				n.becomeLeader()
+				go n.broadcast()
+			}
+		}(addr)
+	}
+}
+
+// becomeLeader makes the node the leader, it holds the lock.
+func (n *Node) becomeLeader() {
+	n.logger.Printf("raft: %s is the leader of term %d", n.config.ID, n.term)
+
+	n.state = Leader
+	n.leader = n.config.ID
+	n.nextIndex = map[string]uint64{}
+	n.matchIndex = map[string]uint64{}
+	n.inflight = map[string]bool{}
+	// entries of the previous terms are committed with the first one of
+	// this term
+	if e, err := n.appendEntry(Command{Type: CommandNoop}); err == nil {
+		n.termStart = e.Index
+	}
+}
+
+// becomeFollower makes the node a follower in the term, it holds the lock.
+func (n *Node) becomeFollower(term uint64) {
+	if term > n.term {
+		n.term = term
+		n.votedFor = ""
+		_ = n.saveState()
+	}
+	if n.state == Leader {
+		n.logger.Printf("raft: %s steps down in term %d", n.config.ID, n.term)
+		// the committed ones are completed by the applier
+		for index, p := range n.proposals {
+			if index <= n.commitIndex {
+				continue
+			}
+			p.done <- applyResult{err: ErrorLeadershipLost}
+			delete(n.proposals, index)
+		}
+		n.leader = ""
+	}
+	n.state = Follower
+}
+
+// appendEntry appends the command to the leader log, it holds the lock.
+func (n *Node) appendEntry(c Command) (Entry, error) {
+	c.Time = time.Now().UnixNano()
+	e := Entry{Term: n.term, Index: n.lastIndex() + 1, Command: c}
+	if err := n.persister.Append([]Entry{e}); err != nil {
+		n.fail(fmt.Errorf("cant persist raft entry: %w", err))
+		return e, err
+	}
+	n.entries = append(n.entries, e)
+	if c.Type == CommandMembers {
+		n.members = clone(c.Members)
+	}
+	n.advanceCommit()
+
+	return e, nil
+}
+
+// broadcast sends the new entries or a heartbeat to every peer which has
+// no request in flight.
+func (n *Node) broadcast() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.state != Leader {
+		return
+	}
+	for id, addr := range n.peers() {
+		if n.inflight[id] {
+			continue
+		}
+		if _, ok := n.nextIndex[id]; !ok {
+			n.nextIndex[id] = n.lastIndex() + 1
+		}
+		n.inflight[id] = true
+		go n.replicate(id, addr)
+	}
+}
+
+// replicate sends the entries to the peer until it's up to date.
+func (n *Node) replicate(id, addr string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer func() { n.inflight[id] = false }()
+
+	for {
+		if n.state != Leader {
+			return
+		}
+		// the entries the peer lacks are compacted
+		if n.nextIndex[id] <= n.snapshotIndex() {
+			if !n.sendSnapshot(id, addr) {
+				return
+			}
+			continue
+		}
+		term := n.term
+		req := n.heartbeat(id)
+		base, last := n.snapshotIndex(), n.lastIndex()
+		if next := req.PrevLogIndex + 1; next <= last {
+			req.Entries = append([]Entry{}, n.entries[next-base:min(last+1, next+maxAppendEntries)-base]...)
+		}
+		n.mu.Unlock()
+
+		resp, err := n.transport.AppendEntries(addr, req)
+
+		n.mu.Lock()
+		if err != nil || n.state != Leader || n.term != term {
+			return
+		}
+		if resp.Term > n.term {
+			n.becomeFollower(resp.Term)
+			return
+		}
+		if !resp.Success {
+			n.nextIndex[id] = max(1, min(resp.ConflictIndex, req.PrevLogIndex))
+			continue
+		}
+
+		n.matchIndex[id] = max(n.matchIndex[id], req.PrevLogIndex+uint64(len(req.Entries)))
+		n.nextIndex[id] = n.matchIndex[id] + 1
+		n.advanceCommit()
+		if n.nextIndex[id] > n.lastIndex() {
+			return
+		}
+	}
+}
+
+// sendSnapshot sends the last snapshot to the peer, it holds the lock and
+// releases it while the request is sent. It returns false if the peer
+// isn't caught up by the snapshot.
+func (n *Node) sendSnapshot(id, addr string) bool {
+	term := n.term
+	req := InstallSnapshotRequest{Term: term, LeaderID: n.config.ID, Snapshot: n.snapshot}
+	n.mu.Unlock()
+
+	resp, err := n.transport.InstallSnapshot(addr, req)
+
+	n.mu.Lock()
+	if err != nil || n.state != Leader || n.term != term {
+		return false
+	}
+	if resp.Term > n.term {
+		n.becomeFollower(resp.Term)
+		return false
+	}
+	n.matchIndex[id] = max(n.matchIndex[id], req.Snapshot.Index)
+	n.nextIndex[id] = n.matchIndex[id] + 1
+	n.advanceCommit()
+
+	return true
+}
+
+// heartbeat returns an AppendEntries request without entries, it holds the lock.
+func (n *Node) heartbeat(id string) AppendEntriesRequest {
+	prev := min(n.nextIndex[id], n.lastIndex()+1)
+	if prev > 0 {
+		prev--
+	}
+	prev = max(prev, n.snapshotIndex())
+
+	return AppendEntriesRequest{
+		Term:         n.term,
+		LeaderID:     n.config.ID,
+		PrevLogIndex: prev,
+		PrevLogTerm:  n.entry(prev).Term,
+		LeaderCommit: n.commitIndex,
+	}
+}
+
+// advanceCommit commits the entries of the leader term stored by a
+// majority, it holds the lock.
+func (n *Node) advanceCommit() {
+	if n.state != Leader {
+		return
+	}
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		if n.entry(index).Term != n.term {
+			return
+		}
+		votes := 0
+		for id := range n.members {
+			if id == n.config.ID || n.matchIndex[id] >= index {
+				votes++
+			}
+		}
+		if votes >= n.quorum() {
+			n.commit(index)
+			return
+		}
+	}
+}
+
+// commit sets the commit index, it holds the lock.
+func (n *Node) commit(index uint64) {
+	if index <= n.commitIndex {
+		return
+	}
+	n.commitIndex = index
+	n.applied.Broadcast()
+
+	_, member := n.members[n.config.ID]
+	if n.state == Leader && !member && n.configIndex() <= n.commitIndex {
+		n.becomeFollower(n.term)
+	}
+}
+
+// resetMembers sets the members by the last config entry of the log.
+func (n *Node) resetMembers() {
+	n.members = n.membersAt(n.lastIndex())
+}
+
+// membersAt returns the members by the last config entry up to the index,
+// the ones of the snapshot if the entry is compacted.
+func (n *Node) membersAt(index uint64) map[string]string {
+	for i := index; i > n.snapshotIndex(); i-- {
+		if e := n.entry(i); e.Command.Type == CommandMembers {
+			return clone(e.Command.Members)
+		}
+	}
+	if n.snapshot.Index > 0 {
+		return clone(n.snapshot.Members)
+	}
+
+	return clone(n.config.Members)
+}
+
+// configIndex returns the index of the last config entry, 0 if there is
+// none or it's compacted, so committed.
+func (n *Node) configIndex() uint64 {
+	for i := n.lastIndex(); i > n.snapshotIndex(); i-- {
+		if n.entry(i).Command.Type == CommandMembers {
+			return i
+		}
+	}
+
+	return 0
+}
+
+func (n *Node) peers() map[string]string {
+	peers := make(map[string]string, len(n.members))
+	for id, addr := range n.members {
+		if id != n.config.ID {
+			peers[id] = addr
+		}
+	}
+
+	return peers
+}
+
+func (n *Node) quorum() int {
+	return len(n.members)/2 + 1
+}
+
+// snapshotIndex returns the index of the last snapshot, the log starts after it.
+func (n *Node) snapshotIndex() uint64 {
+	return n.entries[0].Index
+}
+
+func (n *Node) lastIndex() uint64 {
+	return n.snapshotIndex() + uint64(len(n.entries)-1)
+}
+
+func (n *Node) lastTerm() uint64 {
+	return n.entries[len(n.entries)-1].Term
+}
+
+// entry returns the entry of the index, the snapshot one holds only the term.
+func (n *Node) entry(index uint64) Entry {
+	return n.entries[index-n.snapshotIndex()]
+}
+
+func (n *Node) resetElectionTimeout() {
+	n.electionTimeout = n.config.ElectionTimeout + time.Duration(rand.Int63n(int64(n.config.ElectionTimeout)))
+}
+
+func (n *Node) saveState() error {
+	if err := n.persister.SaveState(n.term, n.votedFor); err != nil {
+		n.fail(fmt.Errorf("cant persist raft state: %w", err))
+		return err
+	}
+
+	return nil
+}
+
+// fail reports the error, the node can't go on safely.
+func (n *Node) fail(err error) {
+	select {
+	case n.errors <- err:
+	default:
+	}
+}
+
+func clone(m map[string]string) map[string]string {
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+
+	return result
+}
+
+// ParseMembers parses members as comma separated id=address pairs.
+func ParseMembers(s string) (map[string]string, error) {
+	members := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		id, addr, ok := strings.Cut(pair, "=")
+		if !ok || id == "" || addr == "" {
+			return nil, fmt.Errorf("invalid member %q, id=address is expected", pair)
+		}
+		members[id] = addr
+	}
+
+	return members, nil
+}
@@ -0,0 +1,610 @@
+package raft_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/raft"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = log.New(io.Discard, "", 0)
+
+type cluster struct {
+	t               *testing.T
+	network         *raft.MemoryNetwork
+	nodes           map[string]*raft.Node
+	storages        map[string]storage.Storage
+	persisters      map[string]*raft.MemoryPersister
+	snapshotEntries uint64
+}
+
+func newCluster(t *testing.T, size int) *cluster {
+	t.Helper()
+
+	return newCompactingCluster(t, size, 0)
+}
+
+// newCompactingCluster starts nodes which compact their logs after the
+// snapshotEntries applied entries.
+func newCompactingCluster(t *testing.T, size int, snapshotEntries uint64) *cluster {
+	t.Helper()
+
+	c := &cluster{
+		t:               t,
+		network:         raft.NewMemoryNetwork(),
+		nodes:           map[string]*raft.Node{},
+		storages:        map[string]storage.Storage{},
+		persisters:      map[string]*raft.MemoryPersister{},
+		snapshotEntries: snapshotEntries,
+	}
+	members := map[string]string{}
+	for i := 1; i <= size; i++ {
+		id := fmt.Sprintf("n%d", i)
+		members[id] = id
+	}
+	for id := range members {
+		c.start(id, members)
+	}
+
+	return c
+}
+
+func (c *cluster) start(id string, members map[string]string) *raft.Node {
+	ls := localstorage.New()
+	p := raft.NewMemoryPersister()
+	n, err := raft.New(logger, raft.Config{
+		ID:                id,
+		Members:           members,
+		HeartbeatInterval: 5 * time.Millisecond,
+		ElectionTimeout:   50 * time.Millisecond,
+		ProposeTimeout:    time.Second,
+		SnapshotEntries:   c.snapshotEntries,
+	}, ls, c.network.Transport(id), p)
+	require.NoError(c.t, err)
+	c.network.Add(id, n)
+	c.nodes[id] = n
+	c.storages[id] = ls
+	c.persisters[id] = p
+	n.Run()
+	c.t.Cleanup(n.Stop)
+
+	return n
+}
+
+// leader waits for a single leader among the reachable nodes.
+func (c *cluster) leader(except ...string) (string, *raft.Node) {
+	c.t.Helper()
+
+	for i := 0; i < 200; i++ {
+		for id, n := range c.nodes {
+			if contains(except, id) {
+				continue
+			}
+			if state, _ := n.State(); state == raft.Leader {
+				return id, n
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.t.Fatal("no leader elected")
+
+	return "", nil
+}
+
+// eventually waits for the value of the key on every node but the excepted.
+func (c *cluster) eventually(key, value string, except ...string) {
+	c.t.Helper()
+
+	for id, s := range c.storages {
+		if contains(except, id) {
+			continue
+		}
+		assert.Eventually(c.t, func() bool {
+			v, err := s.Get(key)
+			return err == nil && v == value
+		}, time.Second, 5*time.Millisecond, "node %s", id)
+	}
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestCluster_Replicate(t *testing.T) {
+	c := newCluster(t, 3)
+	_, leader := c.leader()
+
+	_, err := leader.Propose(raft.Command{Type: raft.CommandPut, Key: "one", Value: "1"})
+	require.NoError(t, err)
+	_, err = leader.Propose(raft.Command{Type: raft.CommandCompareAndSwap, Key: "one", Expected: "1", Value: "2"})
+	require.NoError(t, err)
+	_, err = leader.Propose(raft.Command{Type: raft.CommandPutIfAbsent, Key: "one", Value: "3"})
+	assert.ErrorIs(t, err, storage.ErrorConditionFailed)
+	results, err := leader.Propose(raft.Command{Type: raft.CommandBatch, Ops: []storage.Op{
+		{Type: storage.OpGet, Key: "one"},
+		{Type: storage.OpDelete, Key: "missing"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "2", results[0].Value)
+	assert.ErrorIs(t, results[1].Err, storage.ErrorNoSuchKey)
+	_, err = leader.Propose(raft.Command{Type: raft.CommandExpire, Key: "missing", Expires: time.Now().Add(time.Hour).UnixNano()})
+	assert.ErrorIs(t, err, storage.ErrorNoSuchKey)
+
+	c.eventually("one", "2")
+}
+
+func TestCluster_NotLeader(t *testing.T) {
+	c := newCluster(t, 3)
+	leaderID, _ := c.leader()
+
+	for id, n := range c.nodes {
+		if id == leaderID {
+			continue
+		}
+		_, err := n.Propose(raft.Command{Type: raft.CommandPut, Key: "one", Value: "1"})
+		assert.ErrorIs(t, err, raft.ErrorNotLeader)
+		assert.ErrorIs(t, n.ReadBarrier(), raft.ErrorNotLeader)
+		assert.Eventually(t, func() bool {
+			addr, isLeader := n.Leader()
+			return addr == leaderID && !isLeader
+		}, time.Second, 5*time.Millisecond)
+	}
+}
+
+func TestCluster_Failover(t *testing.T) {
+	c := newCluster(t, 3)
+	oldID, old := c.leader()
+	_, err := old.Propose(raft.Command{Type: raft.CommandPut, Key: "one", Value: "1"})
+	require.NoError(t, err)
+
+	c.network.Isolate(oldID, true)
+	// the isolated leader can't commit nor serve linearizable reads
+	_, err = old.Propose(raft.Command{Type: raft.CommandPut, Key: "lost", Value: "x"})
+	assert.Error(t, err)
+	assert.Error(t, old.ReadBarrier())
+
+	newID, leader := c.leader(oldID)
+	assert.NotEqual(t, oldID, newID)
+	require.NoError(t, leader.ReadBarrier())
+	v, err := c.storages[newID].Get("one")
+	require.NoError(t, err)
+	assert.Equal(t, "1", v)
+	_, err = leader.Propose(raft.Command{Type: raft.CommandPut, Key: "two", Value: "2"})
+	require.NoError(t, err)
+
+	// the old leader catches up and drops its uncommitted entry
+	c.network.Isolate(oldID, false)
+	c.eventually("two", "2")
+	_, err = c.storages[oldID].Get("lost")
+	assert.ErrorIs(t, err, storage.ErrorNoSuchKey)
+	assert.Eventually(t, func() bool {
+		state, _ := old.State()
+		return state == raft.Follower
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestCluster_Members(t *testing.T) {
+	c := newCluster(t, 3)
+	leaderID, leader := c.leader()
+	_, err := leader.Propose(raft.Command{Type: raft.CommandPut, Key: "one", Value: "1"})
+	require.NoError(t, err)
+
+	// a joining node starts with no members and waits to be added
+	c.start("n4", nil)
+	require.NoError(t, leader.AddMember("n4", "n4"))
+	c.eventually("one", "1")
+	assert.Len(t, c.nodes["n4"].Members(), 4)
+
+	err = leader.RemoveMember("n9")
+	assert.ErrorIs(t, err, raft.ErrorUnknownMember)
+
+	// the removed leader steps down and the others elect a new one
+	require.NoError(t, leader.RemoveMember(leaderID))
+	c.network.Isolate(leaderID, true)
+	newID, leader := c.leader(leaderID)
+	assert.NotEqual(t, leaderID, newID)
+	assert.Len(t, leader.Members(), 3)
+
+	_, err = leader.Propose(raft.Command{Type: raft.CommandPut, Key: "two", Value: "2"})
+	require.NoError(t, err)
+	c.eventually("two", "2", leaderID)
+}
+
+func TestCluster_Compaction(t *testing.T) {
+	c := newCompactingCluster(t, 3, 5)
+	leaderID, leader := c.leader()
+	var laggingID string
+	for id := range c.nodes {
+		if id != leaderID {
+			laggingID = id
+			break
+		}
+	}
+	c.network.Isolate(laggingID, true)
+
+	for i := 0; i < 20; i++ {
+		_, err := leader.Propose(raft.Command{Type: raft.CommandPut, Key: fmt.Sprintf("key-%d", i), Value: "v"})
+		require.NoError(t, err)
+	}
+	_, err := leader.Propose(raft.Command{Type: raft.CommandDelete, Key: "key-0"})
+	require.NoError(t, err)
+
+	// the noop of the term, the puts and the delete
+	assert.Eventually(t, func() bool {
+		_, _, snapshot, entries, err := c.persisters[leaderID].Load()
+		return err == nil && len(entries) < 5 && snapshot.Index+uint64(len(entries)) == 22
+	}, time.Second, 5*time.Millisecond)
+	_, _, snapshot, _, err := c.persisters[leaderID].Load()
+	require.NoError(t, err)
+	assert.Len(t, snapshot.Members, 3)
+
+	// the lagging follower gets the snapshot in place of the compacted entries
+	c.network.Isolate(laggingID, false)
+	c.eventually("key-19", "v")
+	assert.Eventually(t, func() bool {
+		_, err := c.storages[laggingID].Get("key-0")
+		return errors.Is(err, storage.ErrorNoSuchKey)
+	}, time.Second, 5*time.Millisecond)
+
+	// and follows the leader log after it
+	_, err = leader.Propose(raft.Command{Type: raft.CommandPut, Key: "after", Value: "1"})
+	require.NoError(t, err)
+	c.eventually("after", "1")
+}
+
+func TestCluster_CompactionJoin(t *testing.T) {
+	c := newCompactingCluster(t, 3, 5)
+	_, leader := c.leader()
+	for i := 0; i < 12; i++ {
+		_, err := leader.Propose(raft.Command{Type: raft.CommandPut, Key: fmt.Sprintf("key-%d", i), Value: "v"})
+		require.NoError(t, err)
+	}
+
+	// a new member starts from the snapshot, the entries before it are gone
+	c.start("n4", nil)
+	require.NoError(t, leader.AddMember("n4", "n4"))
+	c.eventually("key-0", "v")
+	assert.Len(t, c.nodes["n4"].Members(), 4)
+}
+
+func TestNode_Restart(t *testing.T) {
+	dir := t.TempDir()
+	members := map[string]string{"n1": "n1"}
+	start := func() (*raft.Node, storage.Storage, *raft.FilePersister) {
+		p, err := raft.NewFilePersister(dir)
+		require.NoError(t, err)
+		ls := localstorage.New()
+		n, err := raft.New(logger, raft.Config{
+			ID:                "n1",
+			Members:           members,
+			HeartbeatInterval: 5 * time.Millisecond,
+			ElectionTimeout:   20 * time.Millisecond,
+		}, ls, raft.NewMemoryNetwork().Transport("n1"), p)
+		require.NoError(t, err)
+		n.Run()
+
+		return n, ls, p
+	}
+
+	n, _, p := start()
+	require.Eventually(t, func() bool {
+		_, err := n.Propose(raft.Command{Type: raft.CommandPut, Key: "one", Value: "1"})
+		return err == nil
+	}, time.Second, 5*time.Millisecond)
+	_, err := n.Propose(raft.Command{Type: raft.CommandDelete, Key: "missing"})
+	assert.ErrorIs(t, err, storage.ErrorNoSuchKey)
+	n.Stop()
+	require.NoError(t, p.Close())
+
+	// the committed entries are applied again from the log
+	n, ls, p := start()
+	defer p.Close()
+	defer n.Stop()
+	assert.Eventually(t, func() bool {
+		v, err := ls.Get("one")
+		return err == nil && v == "1"
+	}, time.Second, 5*time.Millisecond)
+	_, term := n.State()
+	assert.Greater(t, term, uint64(1))
+}
+
+func TestNode_RestartFromSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	start := func() (*raft.Node, storage.Storage, *raft.FilePersister) {
+		p, err := raft.NewFilePersister(dir)
+		require.NoError(t, err)
+		ls := localstorage.New()
+		n, err := raft.New(logger, raft.Config{
+			ID:                "n1",
+			Members:           map[string]string{"n1": "n1"},
+			HeartbeatInterval: 5 * time.Millisecond,
+			ElectionTimeout:   20 * time.Millisecond,
+			SnapshotEntries:   3,
+		}, ls, raft.NewMemoryNetwork().Transport("n1"), p)
+		require.NoError(t, err)
+		n.Run()
+
+		return n, ls, p
+	}
+
+	n, _, p := start()
+	require.Eventually(t, func() bool {
+		state, _ := n.State()
+		return state == raft.Leader
+	}, time.Second, 5*time.Millisecond)
+	for i := 0; i < 10; i++ {
+		_, err := n.Propose(raft.Command{Type: raft.CommandPut, Key: fmt.Sprintf("key-%d", i), Value: "v"})
+		require.NoError(t, err)
+	}
+	n.Stop()
+	require.NoError(t, p.Close())
+	b, err := os.ReadFile(filepath.Join(dir, "log"))
+	require.NoError(t, err)
+	assert.Less(t, bytes.Count(b, []byte("\n")), 3, "the log is compacted")
+
+	// the storage is loaded from the snapshot and the entries after it
+	n, ls, p := start()
+	defer p.Close()
+	defer n.Stop()
+	for i := 0; i < 10; i++ {
+		assert.Eventually(t, func() bool {
+			v, err := ls.Get(fmt.Sprintf("key-%d", i))
+			return err == nil && v == "v"
+		}, time.Second, 5*time.Millisecond)
+	}
+}
+
+func TestNode_ApplyAsProposed(t *testing.T) {
+	// proposed an hour ago: the key lived a minute and was swapped before
+	// it expired, so it never expires
+	proposed := time.Now().Add(-time.Hour)
+	at := func(d time.Duration) int64 { return proposed.Add(d).UnixNano() }
+	p := raft.NewMemoryPersister()
+	require.NoError(t, p.SaveState(1, "n1"))
+	require.NoError(t, p.Append([]raft.Entry{
+		{Term: 1, Index: 1, Command: raft.Command{
+			Type: raft.CommandPutWithTTL, Key: "key", Value: "old", Expires: at(time.Minute), Time: at(0),
+		}},
+		{Term: 1, Index: 2, Command: raft.Command{
+			Type: raft.CommandCompareAndSwap, Key: "key", Expected: "old", Value: "new", Time: at(time.Second),
+		}},
+		{Term: 1, Index: 3, Command: raft.Command{
+			Type: raft.CommandPutWithTTL, Key: "expired", Value: "v", Expires: at(time.Minute), Time: at(0),
+		}},
+		{Term: 1, Index: 4, Command: raft.Command{
+			Type: raft.CommandPutIfAbsent, Key: "expired", Value: "absent", Time: at(2 * time.Minute),
+		}},
+	}))
+
+	for _, ls := range []storage.Storage{localstorage.New(), localstorage.NewSharded(4, localstorage.Limits{})} {
+		n, err := raft.New(logger, raft.Config{
+			ID:                "n1",
+			Members:           map[string]string{"n1": "n1"},
+			HeartbeatInterval: 5 * time.Millisecond,
+			ElectionTimeout:   20 * time.Millisecond,
+		}, ls, raft.NewMemoryNetwork().Transport("n1"), p)
+		require.NoError(t, err)
+		n.Run()
+
+		require.Eventually(t, func() bool {
+			v, err := ls.Get("expired")
+			return err == nil && v == "absent"
+		}, time.Second, 5*time.Millisecond)
+		v, err := ls.Get("key")
+		assert.NoError(t, err)
+		assert.Equal(t, "new", v)
+		n.Stop()
+	}
+}
+
+func TestCluster_Sweep(t *testing.T) {
+	c := newCluster(t, 3)
+	_, leader := c.leader()
+	expires := time.Now().Add(50 * time.Millisecond).UnixNano()
+	for _, k := range []string{"a", "b", "c"} {
+		_, err := leader.Propose(raft.Command{Type: raft.CommandPutWithTTL, Key: k, Value: "v", Expires: expires})
+		require.NoError(t, err)
+	}
+	c.eventually("c", "v")
+
+	for _, n := range c.nodes {
+		stop := n.RunSweeper(10 * time.Millisecond)
+		defer stop()
+	}
+	// the expired keys are dropped by the log on every member
+	for id, s := range c.storages {
+		assert.Eventually(t, func() bool {
+			return len(s.(storage.Clocked).Expired(time.Now(), 10)) == 0
+		}, time.Second, 5*time.Millisecond, "node %s", id)
+	}
+}
+
+func TestNode_DeleteExpiredPutAgain(t *testing.T) {
+	proposed := time.Now().Add(-time.Hour)
+	at := func(d time.Duration) int64 { return proposed.Add(d).UnixNano() }
+	p := raft.NewMemoryPersister()
+	require.NoError(t, p.SaveState(1, "n1"))
+	require.NoError(t, p.Append([]raft.Entry{
+		{Term: 1, Index: 1, Command: raft.Command{
+			Type: raft.CommandPutWithTTL, Key: "again", Value: "old", Expires: at(time.Minute), Time: at(0),
+		}},
+		{Term: 1, Index: 2, Command: raft.Command{
+			Type: raft.CommandPutWithTTL, Key: "later", Value: "v", Expires: at(time.Hour + time.Minute), Time: at(0),
+		}},
+		{Term: 1, Index: 3, Command: raft.Command{
+			Type: raft.CommandPut, Key: "again", Value: "new", Time: at(2 * time.Minute),
+		}},
+		// found expired before the put, applied after it
+		{Term: 1, Index: 4, Command: raft.Command{
+			Type: raft.CommandDeleteExpired, Keys: []string{"again", "later"}, Time: at(3 * time.Minute),
+		}},
+	}))
+
+	ls := localstorage.New()
+	n, err := raft.New(logger, raft.Config{
+		ID:                "n1",
+		Members:           map[string]string{"n1": "n1"},
+		HeartbeatInterval: 5 * time.Millisecond,
+		ElectionTimeout:   20 * time.Millisecond,
+	}, ls, raft.NewMemoryNetwork().Transport("n1"), p)
+	require.NoError(t, err)
+	n.Run()
+	defer n.Stop()
+
+	require.Eventually(t, func() bool {
+		v, err := ls.Get("again")
+		return err == nil && v == "new"
+	}, time.Second, 5*time.Millisecond)
+	// "later" isn't expired as of the command, so it's kept until it expires
+	assert.Equal(t, []string{"later"}, ls.(storage.Clocked).Expired(time.Now().Add(2*time.Hour), 10))
+}
+
+func TestFilePersister_TruncateFrom(t *testing.T) {
+	p, err := raft.NewFilePersister(t.TempDir())
+	require.NoError(t, err)
+	defer p.Close()
+
+	entries := []raft.Entry{
+		{Term: 1, Index: 1, Command: raft.Command{Type: raft.CommandNoop}},
+		{Term: 1, Index: 2, Command: raft.Command{Type: raft.CommandPut, Key: "one", Value: "1"}},
+		{Term: 1, Index: 3, Command: raft.Command{Type: raft.CommandDelete, Key: "one"}},
+	}
+	require.NoError(t, p.Append(entries))
+	require.NoError(t, p.SaveState(2, "n2"))
+	require.NoError(t, p.TruncateFrom(3))
+	replaced := raft.Entry{Term: 2, Index: 3, Command: raft.Command{Type: raft.CommandNoop}}
+	require.NoError(t, p.Append([]raft.Entry{replaced}))
+
+	term, votedFor, _, got, err := p.Load()
+
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), term)
+	assert.Equal(t, "n2", votedFor)
+	assert.Equal(t, append(entries[:2:2], replaced), got)
+}
+
+func TestFilePersister_SaveSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	p, err := raft.NewFilePersister(dir)
+	require.NoError(t, err)
+	entries := []raft.Entry{}
+	for i := uint64(1); i <= 4; i++ {
+		entries = append(entries, raft.Entry{Term: 1, Index: i, Command: raft.Command{Type: raft.CommandPut, Key: "k", Value: fmt.Sprint(i)}})
+	}
+	require.NoError(t, p.Append(entries))
+	old, err := os.ReadFile(filepath.Join(dir, "log"))
+	require.NoError(t, err)
+	snapshot := raft.Snapshot{Index: 2, Term: 1, Members: map[string]string{"n1": "n1"}, Data: []byte("items")}
+
+	require.NoError(t, p.SaveSnapshot(snapshot, entries[2:]))
+	require.NoError(t, p.TruncateFrom(4))
+	require.NoError(t, p.Close())
+
+	p, err = raft.NewFilePersister(dir)
+	require.NoError(t, err)
+	_, _, gotSnapshot, got, err := p.Load()
+	require.NoError(t, err)
+	assert.Equal(t, snapshot, gotSnapshot)
+	assert.Equal(t, entries[2:3], got)
+	require.NoError(t, p.Close())
+
+	// a crash after the snapshot is saved leaves the log as it was
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "log"), old, 0o644))
+	p, err = raft.NewFilePersister(dir)
+	require.NoError(t, err)
+	defer p.Close()
+	_, _, _, got, err = p.Load()
+	require.NoError(t, err)
+	assert.Equal(t, entries[2:], got)
+}
+
+func TestFilePersister_TornTail(t *testing.T) {
+	entries := []raft.Entry{
+		{Term: 1, Index: 1, Command: raft.Command{Type: raft.CommandNoop}},
+		{Term: 1, Index: 2, Command: raft.Command{Type: raft.CommandPut, Key: "one", Value: "1"}},
+	}
+	next := raft.Entry{Term: 1, Index: 3, Command: raft.Command{Type: raft.CommandDelete, Key: "one"}}
+
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{"torn line", `{"term":1,"index":3,"comm`},
+		{"line without newline", `{"term":1,"index":3,"command":{"type":"noop"}}`},
+		{"garbage", "\x00\x00\x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			p, err := raft.NewFilePersister(dir)
+			require.NoError(t, err)
+			require.NoError(t, p.Append(entries))
+			require.NoError(t, p.Close())
+			f, err := os.OpenFile(filepath.Join(dir, "log"), os.O_WRONLY|os.O_APPEND, 0o644)
+			require.NoError(t, err)
+			_, err = f.WriteString(tt.tail)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			// the restarted node drops the tail and appends after the last entry
+			p, err = raft.NewFilePersister(dir)
+			require.NoError(t, err)
+			_, _, _, got, err := p.Load()
+			require.NoError(t, err)
+			assert.Equal(t, entries, got)
+			require.NoError(t, p.Append([]raft.Entry{next}))
+			require.NoError(t, p.Close())
+
+			p, err = raft.NewFilePersister(dir)
+			require.NoError(t, err)
+			defer p.Close()
+			_, _, _, got, err = p.Load()
+			require.NoError(t, err)
+			assert.Equal(t, append(entries[:2:2], next), got)
+		})
+	}
+}
+
+func TestParseMembers(t *testing.T) {
+	tests := []struct {
+		name    string
+		members string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"none", "", map[string]string{}, false},
+		{
+			"several",
+			"n1=http://host1:8080, n2=http://host2:8080",
+			map[string]string{"n1": "http://host1:8080", "n2": "http://host2:8080"},
+			false,
+		},
+		{"no address", "n1=", nil, true},
+		{"no id", "http://host1:8080", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := raft.ParseMembers(tt.members)
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package raft
+
+import (
+	"fmt"
+	"time"
+)
+
+type RequestVoteRequest struct {
+	Term         uint64 `json:"term"`
+	CandidateID  string `json:"candidate_id"`
+	LastLogIndex uint64 `json:"last_log_index"`
+	LastLogTerm  uint64 `json:"last_log_term"`
+}
+
+type RequestVoteResponse struct {
+	Term        uint64 `json:"term"`
+	VoteGranted bool   `json:"vote_granted"`
+}
+
+type AppendEntriesRequest struct {
+	Term         uint64  `json:"term"`
+	LeaderID     string  `json:"leader_id"`
+	PrevLogIndex uint64  `json:"prev_log_index"`
+	PrevLogTerm  uint64  `json:"prev_log_term"`
+	Entries      []Entry `json:"entries,omitempty"`
+	LeaderCommit uint64  `json:"leader_commit"`
+}
+
+type AppendEntriesResponse struct {
+	Term    uint64 `json:"term"`
+	Success bool   `json:"success"`
+	// ConflictIndex is where the leader goes on from when the logs don't match
+	ConflictIndex uint64 `json:"conflict_index,omitempty"`
+}
+
+type InstallSnapshotRequest struct {
+	Term     uint64   `json:"term"`
+	LeaderID string   `json:"leader_id"`
+	Snapshot Snapshot `json:"snapshot"`
+}
+
+type InstallSnapshotResponse struct {
+	Term uint64 `json:"term"`
+}
+
+// HandleRequestVote handles a vote request of a candidate.
+func (n *Node) HandleRequestVote(req RequestVoteRequest) RequestVoteResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term < n.term {
+		return RequestVoteResponse{Term: n.term}
+	}
+	// a node which hears from its leader ignores candidates, so a removed
+	// member or a member back from a partition doesn't disrupt the cluster
+	if n.state == Leader || (n.leader != "" && time.Since(n.lastContact) < n.config.ElectionTimeout) {
+		return RequestVoteResponse{Term: n.term}
+	}
+	if req.Term > n.term {
+		n.becomeFollower(req.Term)
+	}
+
+	upToDate := req.LastLogTerm > n.lastTerm() ||
+		(req.LastLogTerm == n.lastTerm() && req.LastLogIndex >= n.lastIndex())
+	if !upToDate || (n.votedFor != "" && n.votedFor != req.CandidateID) {
+		return RequestVoteResponse{Term: n.term}
+	}
+
+	n.votedFor = req.CandidateID
+	if err := n.saveState(); err != nil {
+		return RequestVoteResponse{Term: n.term}
+	}
+	n.lastContact = time.Now()
+
+	return RequestVoteResponse{Term: n.term, VoteGranted: true}
+}
+
+// HandleAppendEntries handles the entries or a heartbeat of the leader.
+func (n *Node) HandleAppendEntries(req AppendEntriesRequest) AppendEntriesResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term < n.term {
+		return AppendEntriesResponse{Term: n.term}
+	}
+	if req.Term > n.term || n.state != Follower {
+		n.becomeFollower(req.Term)
+	}
+	n.leader = req.LeaderID
+	n.lastContact = time.Now()
+
+	if req.PrevLogIndex > n.lastIndex() {
+		return AppendEntriesResponse{Term: n.term, ConflictIndex: n.lastIndex() + 1}
+	}
+	last := req.PrevLogIndex + uint64(len(req.Entries))
+	if base := n.snapshotIndex(); req.PrevLogIndex < base {
+		// the entries up to the snapshot are committed, so they match
+		req.Entries = req.Entries[min(base-req.PrevLogIndex, uint64(len(req.Entries))):]
+		req.PrevLogIndex, req.PrevLogTerm = base, n.entries[0].Term
+	}
+	if term := n.entry(req.PrevLogIndex).Term; term != req.PrevLogTerm {
+		// skip the whole conflicting term at once
+		index := req.PrevLogIndex
+		for index > n.commitIndex+1 && n.entry(index-1).Term == term {
+			index--
+		}
+		return AppendEntriesResponse{Term: n.term, ConflictIndex: index}
+	}
+
+	for i, e := range req.Entries {
+		if e.Index <= n.lastIndex() {
+			if n.entry(e.Index).Term == e.Term {
+				continue
+			}
+			if err := n.persister.TruncateFrom(e.Index); err != nil {
+				n.fail(err)
+				return AppendEntriesResponse{Term: n.term}
+			}
+			n.entries = n.entries[:e.Index-n.snapshotIndex()]
+			n.resetMembers()
+		}
+		if err := n.persister.Append(req.Entries[i:]); err != nil {
+			n.fail(err)
+			return AppendEntriesResponse{Term: n.term}
+		}
+		n.entries = append(n.entries, req.Entries[i:]...)
+		n.resetMembers()
+		break
+	}
+
+	n.commit(min(req.LeaderCommit, last))
+
+	return AppendEntriesResponse{Term: n.term, Success: true}
+}
+
+// HandleInstallSnapshot handles the snapshot the leader sends in place of
+// the compacted entries the node lacks, the applier loads it.
+func (n *Node) HandleInstallSnapshot(req InstallSnapshotRequest) InstallSnapshotResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term < n.term {
+		return InstallSnapshotResponse{Term: n.term}
+	}
+	if req.Term > n.term || n.state != Follower {
+		n.becomeFollower(req.Term)
+	}
+	n.leader = req.LeaderID
+	n.lastContact = time.Now()
+
+	s := req.Snapshot
+	if s.Index <= n.commitIndex {
+		return InstallSnapshotResponse{Term: n.term}
+	}
+	if n.snapshots == nil {
+		n.fail(ErrorSnapshotUnsupported)
+		return InstallSnapshotResponse{Term: n.term}
+	}
+	// the entries after the snapshot are kept if the log matches it
+	entries := []Entry{}
+	if s.Index <= n.lastIndex() && n.entry(s.Index).Term == s.Term {
+		entries = n.entries[s.Index-n.snapshotIndex()+1:]
+	}
+	if err := n.persister.SaveSnapshot(s, entries); err != nil {
+		n.fail(fmt.Errorf("cant persist raft snapshot: %w", err))
+		return InstallSnapshotResponse{Term: n.term}
+	}
+	n.entries = append([]Entry{{Term: s.Term, Index: s.Index}}, entries...)
+	n.snapshot = s
+	n.resetMembers()
+	n.commit(s.Index)
+
+	return InstallSnapshotResponse{Term: n.term}
+}
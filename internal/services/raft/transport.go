@@ -0,0 +1,156 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	VotePath     = "/raft/vote"
+	AppendPath   = "/raft/append"
+	SnapshotPath = "/raft/snapshot"
+
+	DefaultTransportTimeout = time.Second
+)
+
+var ErrorUnreachable = errors.New("node is unreachable")
+
+// Transport delivers the requests of a node to its peers by their addresses.
+type Transport interface {
+	RequestVote(addr string, req RequestVoteRequest) (RequestVoteResponse, error)
+	AppendEntries(addr string, req AppendEntriesRequest) (AppendEntriesResponse, error)
+	InstallSnapshot(addr string, req InstallSnapshotRequest) (InstallSnapshotResponse, error)
+}
+
+// MemoryNetwork connects in-process nodes, for tests. A node can be
+// isolated from the others to simulate a crash or a partition.
+type MemoryNetwork struct {
+	mu       sync.RWMutex
+	nodes    map[string]*Node
+	isolated map[string]bool
+}
+
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{
+		nodes:    map[string]*Node{},
+		isolated: map[string]bool{},
+	}
+}
+
+// Add makes the node reachable at the address.
+func (m *MemoryNetwork) Add(addr string, n *Node) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodes[addr] = n
+}
+
+// Isolate drops the requests from and to the address.
+func (m *MemoryNetwork) Isolate(addr string, isolated bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.isolated[addr] = isolated
+}
+
+// Transport returns the transport of the node at the address.
+func (m *MemoryNetwork) Transport(addr string) Transport {
+	return &memoryTransport{m, addr}
+}
+
+func (m *MemoryNetwork) node(from, to string) (*Node, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n, ok := m.nodes[to]
+	if !ok || m.isolated[from] || m.isolated[to] {
+		return nil, ErrorUnreachable
+	}
+
+	return n, nil
+}
+
+type memoryTransport struct {
+	network *MemoryNetwork
+	from    string
+}
+
+func (t *memoryTransport) RequestVote(addr string, req RequestVoteRequest) (RequestVoteResponse, error) {
+	n, err := t.network.node(t.from, addr)
+	if err != nil {
+		return RequestVoteResponse{}, err
+	}
+
+	return n.HandleRequestVote(req), nil
+}
+
+func (t *memoryTransport) AppendEntries(addr string, req AppendEntriesRequest) (AppendEntriesResponse, error) {
+	n, err := t.network.node(t.from, addr)
+	if err != nil {
+		return AppendEntriesResponse{}, err
+	}
+
+	return n.HandleAppendEntries(req), nil
+}
+
+func (t *memoryTransport) InstallSnapshot(addr string, req InstallSnapshotRequest) (InstallSnapshotResponse, error) {
+	n, err := t.network.node(t.from, addr)
+	if err != nil {
+		return InstallSnapshotResponse{}, err
+	}
+
+	return n.HandleInstallSnapshot(req), nil
+}
+
+// HTTPTransport posts the requests as JSON to VotePath, AppendPath and
+// SnapshotPath of the peer base URL.
+type HTTPTransport struct {
+	client *http.Client
+}
+
+func NewHTTPTransport(timeout time.Duration) *HTTPTransport {
+	if timeout <= 0 {
+		timeout = DefaultTransportTimeout
+	}
+
+	return &HTTPTransport{client: &http.Client{Timeout: timeout}}
+}
+
+func (t *HTTPTransport) RequestVote(addr string, req RequestVoteRequest) (RequestVoteResponse, error) {
+	var resp RequestVoteResponse
+	return resp, t.post(addr+VotePath, req, &resp)
+}
+
+func (t *HTTPTransport) AppendEntries(addr string, req AppendEntriesRequest) (AppendEntriesResponse, error) {
+	var resp AppendEntriesResponse
+	return resp, t.post(addr+AppendPath, req, &resp)
+}
+
+func (t *HTTPTransport) InstallSnapshot(addr string, req InstallSnapshotRequest) (InstallSnapshotResponse, error) {
+	var resp InstallSnapshotResponse
+	return resp, t.post(addr+SnapshotPath, req, &resp)
+}
+
+func (t *HTTPTransport) post(url string, req, resp any) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("cant encode raft request: %w", err)
+	}
+	res, err := t.client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrorUnreachable, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", ErrorUnreachable, res.Status)
+	}
+	if err = json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return fmt.Errorf("cant decode raft response: %w", err)
+	}
+
+	return nil
+}
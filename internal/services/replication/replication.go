@@ -0,0 +1,265 @@
+package replication
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/snapshot"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+const (
+	DefaultInterval = 500 * time.Millisecond
+	DefaultBatch    = 1000
+
+	EventsPath   = "/replication/events"
+	SnapshotPath = "/replication/snapshot"
+	EpochHeader  = "X-Log-Epoch" // of the leader log a snapshot continues with
+
+	clientTimeout = 30 * time.Second
+)
+
+var (
+	ErrorSequenceGone     = errors.New("leader has no changes after the sequence")
+	ErrorUnexpectedStatus = errors.New("unexpected leader response")
+)
+
+// metrics of the follower, published at /debug/vars
+var (
+	appliedSequence = new(expvar.Int)
+	leaderSequence  = new(expvar.Int)
+	lagEvents       = new(expvar.Int)
+	lagSeconds      = new(expvar.Float)
+)
+
+func init() {
+	m := expvar.NewMap("replication")
+	m.Set("applied_sequence", appliedSequence)
+	m.Set("leader_sequence", leaderSequence)
+	m.Set("lag_events", lagEvents)
+	m.Set("lag_seconds", lagSeconds) // since the follower was up to date
+}
+
+// EventsResponse is the response of EventsPath: the records after the
+// requested sequence and the last sequence of the leader. The sequences
+// are comparable within the same epoch of the leader log only.
+type EventsResponse struct {
+	Epoch    uint64                      `json:"epoch"`
+	Sequence uint64                      `json:"sequence"`
+	Records  [][]transactionlogger.Event `json:"records"`
+}
+
+type Config struct {
+	Leader   string        // base URL of the leader
+	Interval time.Duration // how often an up to date follower polls the leader
+	Batch    int           // max number of events in one poll
+	Client   *http.Client
+}
+
+// Storage is a storage which content can be replaced by a snapshot.
+type Storage interface {
+	storage.Storage
+	Load([]storage.Item)
+}
+
+// Follower keeps its storage a copy of the leader one by applying the
+// leader log records after the last applied sequence. When the leader has
+// dropped some of them or its log epoch has changed, the follower starts
+// over from a leader snapshot.
+type Follower struct {
+	logger  *log.Logger
+	config  Config
+	storage Storage
+	applied atomic.Uint64
+	epoch   uint64 // of the leader log the applied sequence belongs to
+
+	upToDate time.Time // when the follower was up to date the last time
+}
+
+func New(logger *log.Logger, config Config, storage Storage) *Follower {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.Batch <= 0 {
+		config.Batch = DefaultBatch
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: clientTimeout}
+	}
+
+	return &Follower{
+		logger:   logger,
+		config:   config,
+		storage:  storage,
+		upToDate: time.Now(),
+	}
+}
+
+// Applied returns the sequence of the last applied leader event.
+func (f *Follower) Applied() uint64 {
+	return f.applied.Load()
+}
+
+// Sync applies the next records of the leader log and reports if the
+// follower is up to date.
+func (f *Follower) Sync() (bool, error) {
+	res, err := f.fetchEvents(f.applied.Load())
+	if errors.Is(err, ErrorSequenceGone) {
+		return false, f.restore()
+	}
+	if err != nil {
+		return false, err
+	}
+	if res.Epoch != f.epoch {
+		// nothing applied yet belongs to any epoch
+		if f.applied.Load() != 0 {
+			return false, f.restore()
+		}
+		f.epoch = res.Epoch
+	}
+
+	for _, r := range res.Records {
+		if err = f.apply(r); err != nil {
+			return false, fmt.Errorf("cant apply event %d: %w", r[0].Sequence, err)
+		}
+		f.applied.Store(r[len(r)-1].Sequence)
+	}
+	applied := f.applied.Load()
+	if applied >= res.Sequence {
+		f.upToDate = time.Now()
+	}
+	f.setMetrics(res.Sequence)
+
+	return applied >= res.Sequence, nil
+}
+
+// Run starts a background goroutine which syncs the follower. Call the
+// returned function to stop it.
+func (f *Follower) Run() (stop func()) {
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			upToDate, err := f.Sync()
+			if err != nil {
+				f.logger.Printf("replication failure: %s", err)
+			}
+			wait := f.config.Interval
+			if err == nil && !upToDate {
+				wait = 0
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// apply applies the record, the events of a group all at once.
+func (f *Follower) apply(record []transactionlogger.Event) error {
+	if len(record) == 1 {
+		return transactionlogger.Replay(f.storage, record[0])
+	}
+
+	ops := make([]storage.Op, 0, len(record))
+	for _, e := range record {
+		switch e.EventType {
+		case transactionlogger.EventPut:
+			ops = append(ops, storage.Op{Type: storage.OpPut, Key: e.Key, Value: e.Value})
+		case transactionlogger.EventDelete:
+			ops = append(ops, storage.Op{Type: storage.OpDelete, Key: e.Key})
+		}
+	}
+
+	return f.storage.Apply(ops)
+}
+
+// restore replaces the storage content by a leader snapshot.
+func (f *Follower) restore() error {
+	f.logger.Printf("replication from %d is impossible, load leader snapshot...", f.applied.Load())
+
+	b, header, err := f.get(SnapshotPath, nil)
+	if err != nil {
+		return err
+	}
+	epoch, err := strconv.ParseUint(header.Get(EpochHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("cant parse leader log epoch: %w", err)
+	}
+	sequence, items, err := snapshot.Decode(b)
+	if err != nil {
+		return fmt.Errorf("cant decode leader snapshot: %w", err)
+	}
+
+	f.storage.Load(items)
+	f.applied.Store(sequence)
+	f.epoch = epoch
+	f.logger.Printf("leader snapshot %d of epoch %d loaded: %d items", sequence, epoch, len(items))
+
+	return nil
+}
+
+func (f *Follower) fetchEvents(after uint64) (EventsResponse, error) {
+	var res EventsResponse
+	b, _, err := f.get(EventsPath, url.Values{
+		"after": {strconv.FormatUint(after, 10)},
+		"limit": {strconv.Itoa(f.config.Batch)},
+	})
+	if err != nil {
+		return res, err
+	}
+	if err = json.Unmarshal(b, &res); err != nil {
+		return res, fmt.Errorf("cant decode leader events: %w", err)
+	}
+
+	return res, nil
+}
+
+func (f *Follower) get(path string, query url.Values) ([]byte, http.Header, error) {
+	u := f.config.Leader + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	res, err := f.config.Client.Get(u)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cant reach leader: %w", err)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cant read leader response: %w", err)
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		return b, res.Header, nil
+	case http.StatusGone:
+		return nil, nil, ErrorSequenceGone
+	default:
+		return nil, nil, fmt.Errorf("%w: %s %s", ErrorUnexpectedStatus, res.Status, b)
+	}
+}
+
+func (f *Follower) setMetrics(leader uint64) {
+	applied := f.applied.Load()
+	appliedSequence.Set(int64(applied))
+	leaderSequence.Set(int64(leader))
+	lagEvents.Set(int64(leader - min(leader, applied)))
+	lagSeconds.Set(time.Since(f.upToDate).Seconds())
+}
@@ -0,0 +1,160 @@
+package replication_test
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/handler"
+	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
+	"github.com/dimishpatriot/kv-storage/internal/services/replication"
+	"github.com/dimishpatriot/kv-storage/internal/services/snapshot"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger/filelogger"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = log.New(io.Discard, "", 0)
+
+type leader struct {
+	storage     *localstorage.LocalStorage
+	keyService  keyservice.KeyService
+	snapshotter *snapshot.Snapshotter
+	server      *httptest.Server
+	handler     atomic.Pointer[http.ServeMux]
+}
+
+func newLeader(t *testing.T) *leader {
+	t.Helper()
+
+	l := &leader{}
+	l.start(t)
+	l.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.handler.Load().ServeHTTP(w, r)
+	}))
+	t.Cleanup(l.server.Close)
+
+	return l
+}
+
+// start starts the leader over with an empty log, like after a crash
+// which lost all the events, at the same URL.
+func (l *leader) start(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	tl, err := filelogger.New(logger, filelogger.Config{
+		Filename:    filepath.Join(dir, "transaction.log"),
+		SegmentSize: 1,
+		Sync:        filelogger.SyncModeAlways,
+	})
+	require.NoError(t, err)
+	tl.Run()
+	fl := tl.(*filelogger.FileTransactionLogger)
+
+	ls := localstorage.New().(*localstorage.LocalStorage)
+	s, err := snapshot.New(logger, snapshot.Config{Dir: filepath.Join(dir, "snapshots"), Keep: 1}, ls, fl)
+	require.NoError(t, err)
+
+	rh := handler.NewReplication(fl, s)
+	mux := http.NewServeMux()
+	mux.HandleFunc(replication.EventsPath, rh.Events)
+	mux.HandleFunc(replication.SnapshotPath, rh.Snapshot)
+
+	l.storage, l.keyService, l.snapshotter = ls, keyservice.New(logger, ls, tl), s
+	l.handler.Store(mux)
+}
+
+func newFollower(l *leader) (*replication.Follower, *localstorage.LocalStorage) {
+	ls := localstorage.New().(*localstorage.LocalStorage)
+	return replication.New(logger, replication.Config{Leader: l.server.URL, Batch: 2}, ls), ls
+}
+
+// values skips expiration times, they are a bit off after replay
+func values(ls *localstorage.LocalStorage) map[string]string {
+	result := map[string]string{}
+	for _, item := range ls.Items() {
+		result[item.Key] = item.Value
+	}
+
+	return result
+}
+
+func syncUp(t *testing.T, f *replication.Follower) {
+	t.Helper()
+
+	for i := 0; i < 100; i++ {
+		upToDate, err := f.Sync()
+		require.NoError(t, err)
+		if upToDate {
+			return
+		}
+	}
+	t.Fatal("follower is not up to date")
+}
+
+func TestFollower_Sync(t *testing.T) {
+	l := newLeader(t)
+	require.NoError(t, l.keyService.Put("one", "1"))
+	require.NoError(t, l.keyService.PutWithTTL("session", "s", time.Hour))
+	require.NoError(t, l.keyService.Apply([]storage.Op{
+		{Type: storage.OpPut, Key: "two", Value: "2"},
+		{Type: storage.OpDelete, Key: "one"},
+	}))
+	f, fs := newFollower(l)
+
+	syncUp(t, f)
+
+	assert.Equal(t, values(l.storage), values(fs))
+	assert.Equal(t, uint64(4), f.Applied())
+
+	require.NoError(t, l.keyService.Put("three", "3"))
+	syncUp(t, f)
+
+	assert.Equal(t, values(l.storage), values(fs))
+}
+
+func TestFollower_SyncFromSnapshot(t *testing.T) {
+	l := newLeader(t)
+	for _, k := range []string{"one", "two", "three"} {
+		require.NoError(t, l.keyService.Put(k, k))
+	}
+	require.NoError(t, l.keyService.Delete("two"))
+	// the log before the snapshot is dropped
+	_, err := l.snapshotter.Take()
+	require.NoError(t, err)
+	require.NoError(t, l.keyService.Put("four", "4"))
+	f, fs := newFollower(l)
+	_ = fs.Put("stale", "value")
+
+	syncUp(t, f)
+
+	assert.Equal(t, values(l.storage), values(fs))
+	assert.Equal(t, uint64(5), f.Applied())
+}
+
+func TestFollower_SyncAfterLeaderLostEvents(t *testing.T) {
+	l := newLeader(t)
+	for _, k := range []string{"one", "two", "three"} {
+		require.NoError(t, l.keyService.Put(k, k))
+	}
+	f, fs := newFollower(l)
+	syncUp(t, f)
+
+	// the new events get the sequences of the lost ones
+	l.start(t)
+	for _, k := range []string{"four", "five", "six", "seven"} {
+		require.NoError(t, l.keyService.Put(k, k))
+	}
+	syncUp(t, f)
+
+	assert.Equal(t, values(l.storage), values(fs))
+	assert.Equal(t, uint64(4), f.Applied())
+}
@@ -0,0 +1,115 @@
+package router
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// Ring maps keys to nodes by consistent hashing: every node has replicas
+// virtual nodes on the ring and a key belongs to the first virtual node
+// after its hash, so adding or removing a node moves only its own keys.
+// A ring is never changed, With and Without return a new one.
+type Ring struct {
+	replicas int
+	hashes   []uint32 // sorted
+	owners   map[uint32]string
+	nodes    []string // sorted
+}
+
+func NewRing(replicas int, nodes ...string) *Ring {
+	r := &Ring{replicas: max(replicas, 1), owners: map[uint32]string{}}
+	for _, n := range nodes {
+		r.add(n)
+	}
+	r.sort()
+
+	return r
+}
+
+// Owner returns the node of the key, empty if the ring has no nodes.
+func (r *Ring) Owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+
+	return r.owners[r.hashes[i]]
+}
+
+// Nodes returns the nodes in ascending order.
+func (r *Ring) Nodes() []string {
+	return append([]string(nil), r.nodes...)
+}
+
+func (r *Ring) Has(node string) bool {
+	i := sort.SearchStrings(r.nodes, node)
+	return i < len(r.nodes) && r.nodes[i] == node
+}
+
+// With returns the ring with the node added.
+func (r *Ring) With(node string) *Ring {
+	if r.Has(node) {
+		return r
+	}
+
+	return NewRing(r.replicas, append(r.Nodes(), node)...)
+}
+
+// Without returns the ring with the node removed.
+func (r *Ring) Without(node string) *Ring {
+	nodes := make([]string, 0, len(r.nodes))
+	for _, n := range r.nodes {
+		if n != node {
+			nodes = append(nodes, n)
+		}
+	}
+
+	return NewRing(r.replicas, nodes...)
+}
+
+func (r *Ring) add(node string) {
+	if r.Has(node) {
+		return
+	}
+	r.nodes = append(r.nodes, node)
+	sort.Strings(r.nodes)
+
+	for i := 0; i < r.replicas; i++ {
+		h := hash(node + "#" + strconv.Itoa(i))
+		// a collision keeps the virtual node of the smaller ID, so the
+		// owner doesn't depend on the order the nodes are added in
+		if owner, ok := r.owners[h]; ok {
+			if owner < node {
+				continue
+			}
+		} else {
+			r.hashes = append(r.hashes, h)
+		}
+		r.owners[h] = node
+	}
+}
+
+func (r *Ring) sort() {
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// hash is FNV-1a with the murmur3 finalizer: FNV alone spreads the similar
+// names of virtual nodes unevenly.
+func hash(s string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+
+	return x
+}
@@ -0,0 +1,540 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultReplicas       = 128
+	DefaultHealthInterval = time.Second
+
+	clientTimeout = 30 * time.Second
+	stripes       = 256
+	scanLimit     = 1000    // max limit of a node scan
+	ttlHeader     = "X-TTL" // time left to an expiring key in a node response
+)
+
+var (
+	ErrorNoNodes          = errors.New("router has no nodes")
+	ErrorNodeDown         = errors.New("node is down")
+	ErrorUnknownNode      = errors.New("no such node")
+	ErrorNodeExists       = errors.New("node already exists")
+	ErrorLastNode         = errors.New("the last node can't be removed")
+	ErrorRebalancing      = errors.New("previous nodes change is not rebalanced yet")
+	ErrorNotRebalancing   = errors.New("nodes are not being rebalanced")
+	ErrorUnexpectedStatus = errors.New("unexpected node response")
+)
+
+// metrics of the router, published at /debug/vars
+var (
+	movedKeys = new(expvar.Int)
+	downNodes = new(expvar.Int)
+)
+
+func init() {
+	m := expvar.NewMap("router")
+	m.Set("moved_keys", movedKeys)
+	m.Set("down_nodes", downNodes)
+}
+
+type Config struct {
+	Nodes          map[string]string // ID to base URL
+	Replicas       int               // virtual nodes of a node on the ring
+	HealthInterval time.Duration     // how often the nodes are checked
+	Client         *http.Client
+}
+
+// Node is a node of the router.
+type Node struct {
+	ID      string `json:"id"`
+	URL     string `json:"url"`
+	Healthy bool   `json:"healthy"`
+	Leaving bool   `json:"leaving,omitempty"` // removed, its keys are being moved
+}
+
+// Router forwards key requests to the nodes which own the keys by the
+// consistent hash ring. After a node is added or removed the keys which
+// changed the owner are moved in background: a request for such a key
+// moves it first, so the key is always served by its new owner.
+type Router struct {
+	logger *log.Logger
+	config Config
+	locks  [stripes]sync.Mutex // of the keys being moved
+
+	mu       sync.RWMutex
+	nodes    map[string]string // ID to base URL, of the previous ring too
+	ring     *Ring
+	previous *Ring         // before the change being rebalanced, nil if none
+	abort    chan struct{} // of the rebalance, nil if none
+	lastErr  error         // the rebalance retries after, nil if none
+	down     map[string]bool
+}
+
+func New(logger *log.Logger, config Config) (*Router, error) {
+	if len(config.Nodes) == 0 {
+		return nil, ErrorNoNodes
+	}
+	if config.Replicas <= 0 {
+		config.Replicas = DefaultReplicas
+	}
+	if config.HealthInterval <= 0 {
+		config.HealthInterval = DefaultHealthInterval
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: clientTimeout}
+	}
+
+	nodes, ids := map[string]string{}, []string{}
+	for id, u := range config.Nodes {
+		if _, err := url.ParseRequestURI(u); err != nil {
+			return nil, fmt.Errorf("invalid url of node %s: %w", id, err)
+		}
+		nodes[id] = strings.TrimSuffix(u, "/")
+		ids = append(ids, id)
+	}
+
+	return &Router{
+		logger: logger,
+		config: config,
+		nodes:  nodes,
+		ring:   NewRing(config.Replicas, ids...),
+		down:   map[string]bool{},
+	}, nil
+}
+
+// Do sends the request of the key to its owner and returns the response.
+// The request URL is resolved against the node base URL.
+func (r *Router) Do(key string, req *http.Request) (*http.Response, error) {
+	r.mu.RLock()
+	owner, previous := r.ring.Owner(key), ""
+	if r.previous != nil {
+		previous = r.previous.Owner(key)
+	}
+	ownerURL, previousURL := r.nodes[owner], r.nodes[previous]
+	down := r.down[owner] || (previous != owner && r.down[previous])
+	r.mu.RUnlock()
+
+	if owner == "" {
+		return nil, ErrorNoNodes
+	}
+	if down {
+		return nil, ErrorNodeDown
+	}
+	if previous == "" || previous == owner {
+		return r.send(ownerURL, req)
+	}
+
+	// the key may be not moved yet
+	lock := r.lock(key)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := r.move(key, previousURL, ownerURL); err != nil {
+		return nil, err
+	}
+
+	return r.send(ownerURL, req)
+}
+
+// Nodes returns the nodes in ascending order of IDs.
+func (r *Router) Nodes() []Node {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	nodes := make([]Node, 0, len(r.nodes))
+	for id, u := range r.nodes {
+		nodes = append(nodes, Node{ID: id, URL: u, Healthy: !r.down[id], Leaving: !r.ring.Has(id)})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	return nodes
+}
+
+// Rebalancing reports if the keys of the last nodes change are being moved.
+func (r *Router) Rebalancing() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.previous != nil
+}
+
+// AddNode adds the node to the ring and moves its keys from the other
+// nodes in background.
+func (r *Router) AddNode(id, addr string) error {
+	if _, err := url.ParseRequestURI(addr); err != nil {
+		return fmt.Errorf("invalid node url: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.previous != nil {
+		return ErrorRebalancing
+	}
+	if _, ok := r.nodes[id]; ok {
+		return ErrorNodeExists
+	}
+
+	sources := r.ring.Nodes()
+	r.nodes[id] = strings.TrimSuffix(addr, "/")
+	r.previous, r.ring = r.ring, r.ring.With(id)
+	r.abort = make(chan struct{})
+	go r.rebalance(sources, r.abort)
+	r.logger.Printf("node %s added, rebalancing", id)
+
+	return nil
+}
+
+// RemoveNode removes the node from the ring and moves its keys to the
+// other nodes in background, the node is forgotten after that.
+func (r *Router) RemoveNode(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.previous != nil {
+		return ErrorRebalancing
+	}
+	if _, ok := r.nodes[id]; !ok {
+		return ErrorUnknownNode
+	}
+	if len(r.nodes) == 1 {
+		return ErrorLastNode
+	}
+
+	r.previous, r.ring = r.ring, r.ring.Without(id)
+	r.abort = make(chan struct{})
+	go r.rebalance([]string{id}, r.abort)
+	r.logger.Printf("node %s removed, rebalancing", id)
+
+	return nil
+}
+
+// rebalance moves the keys of the sources which changed the owner,
+// it retries until all of them are moved or it's aborted.
+func (r *Router) rebalance(sources []string, abort chan struct{}) {
+	for {
+		err := r.moveKeys(sources)
+		if err == nil {
+			break
+		}
+		r.logger.Printf("cant rebalance: %s", err)
+		r.mu.Lock()
+		if r.abort == abort {
+			r.lastErr = err
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-abort:
+			return
+		case <-time.After(r.config.HealthInterval):
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.abort != abort {
+		return
+	}
+	r.endRebalance()
+	r.logger.Println("nodes rebalanced")
+}
+
+// AbortRebalance stops moving the keys of the last nodes change, the keys
+// not moved yet are left on their previous owners, a removed node is
+// forgotten. It's the way to remove a node which is down for good.
+func (r *Router) AbortRebalance() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.previous == nil {
+		return ErrorNotRebalancing
+	}
+
+	close(r.abort)
+	r.endRebalance()
+	r.logger.Println("rebalance aborted")
+
+	return nil
+}
+
+// RebalanceError returns the error the rebalance retries after, nil if
+// there is none.
+func (r *Router) RebalanceError() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lastErr
+}
+
+// endRebalance forgets the removed nodes, it's called with r.mu locked.
+func (r *Router) endRebalance() {
+	for id := range r.nodes {
+		if !r.ring.Has(id) {
+			delete(r.nodes, id)
+			delete(r.down, id)
+		}
+	}
+	r.previous, r.abort, r.lastErr = nil, nil, nil
+	r.setMetrics()
+}
+
+func (r *Router) moveKeys(sources []string) error {
+	for _, src := range sources {
+		r.mu.RLock()
+		srcURL := r.nodes[src]
+		r.mu.RUnlock()
+
+		after := ""
+		for {
+			page, err := r.scan(srcURL, after)
+			if err != nil {
+				return fmt.Errorf("cant scan node %s: %w", src, err)
+			}
+
+			for _, key := range page.Keys {
+				r.mu.RLock()
+				owner := r.ring.Owner(key)
+				ownerURL := r.nodes[owner]
+				r.mu.RUnlock()
+				if owner == src {
+					continue
+				}
+
+				lock := r.lock(key)
+				lock.Lock()
+				err = r.move(key, srcURL, ownerURL)
+				lock.Unlock()
+				if err != nil {
+					return fmt.Errorf("cant move %s from node %s to %s: %w", key, src, owner, err)
+				}
+			}
+
+			if page.Next == "" {
+				break
+			}
+			after = page.Next
+		}
+	}
+
+	return nil
+}
+
+// move puts the key with the time it has left to the node it belongs to
+// now, unless it has the key already, and deletes it from the previous one.
+func (r *Router) move(key, from, to string) error {
+	path := "/v1/" + url.PathEscape(key)
+
+	res, err := r.call(http.MethodGet, from+path, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return err
+	}
+	if res.code == http.StatusNotFound {
+		return nil
+	}
+
+	if ttl := res.header.Get(ttlHeader); ttl != "" {
+		err = r.putWithTTL(to+path, res.body, ttl)
+	} else {
+		err = r.putIfAbsent(to+path, res.body)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err = r.call(http.MethodDelete, from+path, http.StatusOK, http.StatusNotFound); err != nil {
+		return err
+	}
+	movedKeys.Add(1)
+
+	return nil
+}
+
+func (r *Router) putIfAbsent(u, value string) error {
+	put, err := http.NewRequest(http.MethodPut, u, strings.NewReader(value))
+	if err != nil {
+		return fmt.Errorf("cant make request: %w", err)
+	}
+	put.Header.Set("If-None-Match", "*")
+	_, err = r.check(put, http.StatusCreated, http.StatusPreconditionFailed)
+
+	return err
+}
+
+// putWithTTL puts the value unless the node has the key, a node doesn't take
+// a ttl with a conditional put. it's called with the key locked, so the
+// router doesn't put the key in between.
+func (r *Router) putWithTTL(u, value, ttl string) error {
+	res, err := r.call(http.MethodGet, u, http.StatusOK, http.StatusNotFound)
+	if err != nil || res.code == http.StatusOK {
+		return err
+	}
+
+	put, err := http.NewRequest(http.MethodPut, u+"?"+url.Values{"ttl": {ttl}}.Encode(), strings.NewReader(value))
+	if err != nil {
+		return fmt.Errorf("cant make request: %w", err)
+	}
+	_, err = r.check(put, http.StatusCreated)
+
+	return err
+}
+
+type scanPage struct {
+	Keys []string `json:"keys"`
+	Next string   `json:"next"`
+}
+
+func (r *Router) scan(base, after string) (scanPage, error) {
+	q := url.Values{"limit": {fmt.Sprint(scanLimit)}}
+	if after != "" {
+		q.Set("after", after)
+	}
+	res, err := r.call(http.MethodGet, base+"/v1?"+q.Encode(), http.StatusOK)
+	if err != nil {
+		return scanPage{}, err
+	}
+
+	var page scanPage
+	if err = json.Unmarshal([]byte(res.body), &page); err != nil {
+		return scanPage{}, fmt.Errorf("cant decode keys: %w", err)
+	}
+
+	return page, nil
+}
+
+// CheckHealth checks every node once, a node which doesn't serve the keys
+// is down until the next successful check.
+func (r *Router) CheckHealth() {
+	r.mu.RLock()
+	nodes := make(map[string]string, len(r.nodes))
+	for id, u := range r.nodes {
+		nodes[id] = u
+	}
+	r.mu.RUnlock()
+
+	for id, u := range nodes {
+		_, err := r.call(http.MethodGet, u+"/v1?limit=1", http.StatusOK)
+
+		r.mu.Lock()
+		if _, ok := r.nodes[id]; ok && (err != nil) != r.down[id] {
+			if err != nil {
+				r.logger.Printf("node %s is down: %s", id, err)
+				r.down[id] = true
+			} else {
+				r.logger.Printf("node %s is up", id)
+				delete(r.down, id)
+			}
+			r.setMetrics()
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Run starts a background goroutine which checks the nodes. Call the
+// returned function to stop it, it can be called more than once.
+func (r *Router) Run() (stop func()) {
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(r.config.HealthInterval)
+		defer ticker.Stop()
+
+		for {
+			r.CheckHealth()
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// send sends the request to the node.
+func (r *Router) send(base string, req *http.Request) (*http.Response, error) {
+	out, err := http.NewRequestWithContext(req.Context(), req.Method, base+req.URL.RequestURI(), req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cant make request: %w", err)
+	}
+	out.Header = req.Header.Clone()
+	out.ContentLength = req.ContentLength
+
+	res, err := r.config.Client.Do(out)
+	if err != nil {
+		return nil, fmt.Errorf("cant send request: %w", err)
+	}
+
+	return res, nil
+}
+
+type response struct {
+	code   int
+	header http.Header
+	body   string
+}
+
+func (r *Router) call(method, u string, codes ...int) (response, error) {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return response{}, fmt.Errorf("cant make request: %w", err)
+	}
+
+	return r.check(req, codes...)
+}
+
+// check sends the request and returns the response if it has one of the codes.
+func (r *Router) check(req *http.Request, codes ...int) (response, error) {
+	res, err := r.config.Client.Do(req)
+	if err != nil {
+		return response{}, fmt.Errorf("cant send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return response{}, fmt.Errorf("cant read response: %w", err)
+	}
+	for _, c := range codes {
+		if res.StatusCode == c {
+			return response{res.StatusCode, res.Header, string(b)}, nil
+		}
+	}
+
+	return response{}, fmt.Errorf("%w %s: %s", ErrorUnexpectedStatus, res.Status, b)
+}
+
+func (r *Router) lock(key string) *sync.Mutex {
+	return &r.locks[hash(key)%stripes]
+}
+
+// setMetrics is called with r.mu locked.
+func (r *Router) setMetrics() {
+	downNodes.Set(int64(len(r.down)))
+}
+
+// ParseNodes parses "id=url" pairs separated by commas.
+func ParseNodes(s string) (map[string]string, error) {
+	nodes := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		id, addr, ok := strings.Cut(pair, "=")
+		if !ok || id == "" || addr == "" {
+			return nil, fmt.Errorf("invalid node %q, id=url is expected", pair)
+		}
+		nodes[id] = addr
+	}
+
+	return nodes, nil
+}
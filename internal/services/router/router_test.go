@@ -0,0 +1,337 @@
+package router_test
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/handler"
+	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
+	"github.com/dimishpatriot/kv-storage/internal/services/router"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = log.New(io.Discard, "", 0)
+
+type node struct {
+	storage *localstorage.LocalStorage
+	server  *httptest.Server
+}
+
+// newNode starts a node serving the key API over local storage.
+func newNode(t *testing.T) *node {
+	t.Helper()
+
+	tLogger := transactionlogger.NewMockTransactionLogger(t)
+	tLogger.EXPECT().WritePut(mock.Anything, mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WritePutWithTTL(mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WriteDelete(mock.Anything).Return(nil).Maybe()
+	ls := localstorage.New().(*localstorage.LocalStorage)
+	h := handler.New(keyservice.New(logger, ls, tLogger))
+
+	r := mux.NewRouter()
+	r.HandleFunc("/v1", h.Scan).Methods("GET")
+	r.HandleFunc("/v1/{key}", h.Put).Methods("PUT")
+	r.HandleFunc("/v1/{key}", h.Get).Methods("GET")
+	r.HandleFunc("/v1/{key}", h.Delete).Methods("DELETE")
+	s := httptest.NewServer(r)
+	t.Cleanup(s.Close)
+
+	return &node{ls, s}
+}
+
+func (n *node) keys() map[string]bool {
+	keys := map[string]bool{}
+	for _, item := range n.storage.Items() {
+		keys[item.Key] = true
+	}
+	return keys
+}
+
+func do(t *testing.T, r *router.Router, method, key, body string) (int, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, "/v1/"+key, strings.NewReader(body))
+	res, err := r.Do(key, req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	return res.StatusCode, string(b)
+}
+
+func TestRing(t *testing.T) {
+	ring := router.NewRing(router.DefaultReplicas, "n1", "n2", "n3")
+	bigger := ring.With("n4")
+	assert.Equal(t, []string{"n1", "n2", "n3", "n4"}, bigger.Nodes())
+	assert.Equal(t, ring.Nodes(), bigger.Without("n4").Nodes())
+
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		owner := bigger.Owner(key)
+		counts[owner]++
+		if ring.Owner(key) != owner {
+			assert.Equal(t, "n4", owner, "key %s moved between old nodes", key)
+		}
+	}
+	for n, c := range counts {
+		assert.InDelta(t, 2500, c, 750, "keys of %s", n)
+	}
+
+	assert.Equal(t, "", router.NewRing(1).Owner("key"))
+}
+
+func TestRouter_Do(t *testing.T) {
+	nodes := []*node{newNode(t), newNode(t)}
+	r, err := router.New(logger, router.Config{Nodes: map[string]string{
+		"n1": nodes[0].server.URL,
+		"n2": nodes[1].server.URL + "/",
+	}})
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		code, _ := do(t, r, http.MethodPut, fmt.Sprintf("key-%d", i), "v")
+		require.Equal(t, http.StatusCreated, code)
+	}
+	code, body := do(t, r, http.MethodGet, "key-1", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "v", body)
+	code, _ = do(t, r, http.MethodDelete, "key-1", "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = do(t, r, http.MethodGet, "key-1", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	assert.Len(t, nodes[0].keys(), 19-len(nodes[1].keys()))
+	assert.NotEmpty(t, nodes[0].keys())
+	assert.NotEmpty(t, nodes[1].keys())
+
+	// the keys of a down node aren't served until it's up
+	nodes[1].server.Close()
+	r.CheckHealth()
+	assert.Equal(t, []router.Node{
+		{ID: "n1", URL: nodes[0].server.URL, Healthy: true},
+		{ID: "n2", URL: nodes[1].server.URL, Healthy: false},
+	}, r.Nodes())
+	for k := range nodes[1].keys() {
+		_, err = r.Do(k, httptest.NewRequest(http.MethodGet, "/v1/"+k, nil))
+		assert.ErrorIs(t, err, router.ErrorNodeDown)
+	}
+	for k := range nodes[0].keys() {
+		code, _ = do(t, r, http.MethodGet, k, "")
+		assert.Equal(t, http.StatusOK, code)
+	}
+}
+
+func TestRouter_Rebalance(t *testing.T) {
+	nodes := map[string]*node{"n1": newNode(t), "n2": newNode(t), "n3": newNode(t)}
+	r, err := router.New(logger, router.Config{
+		Nodes:          map[string]string{"n1": nodes["n1"].server.URL, "n2": nodes["n2"].server.URL},
+		HealthInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	const n = 300
+	for i := 0; i < n; i++ {
+		code, _ := do(t, r, http.MethodPut, fmt.Sprintf("key-%03d", i), fmt.Sprint(i))
+		require.Equal(t, http.StatusCreated, code)
+	}
+
+	// every key is on its owner only and is served as before
+	check := func(ids ...string) {
+		t.Helper()
+		require.Eventually(t, func() bool { return !r.Rebalancing() }, 5*time.Second, 10*time.Millisecond)
+
+		ring := router.NewRing(router.DefaultReplicas, ids...)
+		total := 0
+		for _, id := range ids {
+			for k := range nodes[id].keys() {
+				assert.Equal(t, id, ring.Owner(k), "key %s", k)
+			}
+			total += len(nodes[id].keys())
+		}
+		assert.Equal(t, n, total)
+		for i := 0; i < n; i++ {
+			code, body := do(t, r, http.MethodGet, fmt.Sprintf("key-%03d", i), "")
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, fmt.Sprint(i), body)
+		}
+	}
+
+	require.NoError(t, r.AddNode("n3", nodes["n3"].server.URL))
+	assert.ErrorIs(t, r.AddNode("n3", nodes["n3"].server.URL), router.ErrorRebalancing)
+	check("n1", "n2", "n3")
+	assert.NotEmpty(t, nodes["n3"].keys())
+
+	assert.ErrorIs(t, r.AddNode("n3", nodes["n3"].server.URL), router.ErrorNodeExists)
+	assert.ErrorIs(t, r.RemoveNode("n4"), router.ErrorUnknownNode)
+
+	require.NoError(t, r.RemoveNode("n1"))
+	check("n2", "n3")
+	assert.Empty(t, nodes["n1"].keys())
+	assert.Len(t, r.Nodes(), 2)
+
+	require.NoError(t, r.RemoveNode("n2"))
+	check("n3")
+	assert.ErrorIs(t, r.RemoveNode("n3"), router.ErrorLastNode)
+}
+
+func TestRouter_DoWhileRebalancing(t *testing.T) {
+	n1, n2 := newNode(t), newNode(t)
+	ring := router.NewRing(router.DefaultReplicas, "n1", "n2")
+
+	// keys of n2 put to n1 only, as if they weren't moved yet
+	moved := []string{}
+	for i := 0; len(moved) < 3; i++ {
+		k := fmt.Sprintf("key-%d", i)
+		if ring.Owner(k) == "n2" {
+			require.NoError(t, n1.storage.Put(k, "old"))
+			moved = append(moved, k)
+		}
+	}
+	// n1 fails the scans, so only the requests move the keys
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/v1" {
+			http.Error(w, "", http.StatusServiceUnavailable)
+			return
+		}
+		n1.server.Config.Handler.ServeHTTP(w, req)
+	}))
+	t.Cleanup(slow.Close)
+	r, err := router.New(logger, router.Config{Nodes: map[string]string{"n1": slow.URL}, HealthInterval: time.Hour})
+	require.NoError(t, err)
+	require.NoError(t, r.AddNode("n2", n2.server.URL))
+	require.True(t, r.Rebalancing())
+
+	code, body := do(t, r, http.MethodGet, moved[0], "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "old", body)
+	code, _ = do(t, r, http.MethodDelete, moved[1], "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = do(t, r, http.MethodPut, moved[2], "new")
+	assert.Equal(t, http.StatusCreated, code)
+
+	assert.Equal(t, map[string]bool{moved[0]: true, moved[2]: true}, n2.keys())
+	assert.Empty(t, n1.keys())
+	v, err := n2.storage.Get(moved[2])
+	require.NoError(t, err)
+	assert.Equal(t, "new", v)
+	_, err = n2.storage.Get(moved[1])
+	assert.ErrorIs(t, err, storage.ErrorNoSuchKey)
+}
+
+func TestRouter_RebalanceTTL(t *testing.T) {
+	n1, n2 := newNode(t), newNode(t)
+	ring := router.NewRing(router.DefaultReplicas, "n1", "n2")
+
+	// keys of n2 on n1, one of them already on n2
+	moved := []string{}
+	for i := 0; len(moved) < 3; i++ {
+		k := fmt.Sprintf("key-%d", i)
+		if ring.Owner(k) == "n2" {
+			require.NoError(t, n1.storage.PutWithTTL(k, "old", time.Hour))
+			moved = append(moved, k)
+		}
+	}
+	require.NoError(t, n1.storage.Put(moved[1], "never expires"))
+	require.NoError(t, n2.storage.Put(moved[2], "new"))
+
+	r, err := router.New(logger, router.Config{Nodes: map[string]string{"n1": n1.server.URL}, HealthInterval: time.Hour})
+	require.NoError(t, err)
+	require.NoError(t, r.AddNode("n2", n2.server.URL))
+	require.Eventually(t, func() bool { return !r.Rebalancing() }, 5*time.Second, 10*time.Millisecond)
+
+	assert.Empty(t, n1.keys())
+	tests := []struct {
+		key   string
+		value string
+		ttl   bool
+	}{
+		{moved[0], "old", true},
+		{moved[1], "never expires", false},
+		{moved[2], "new", false},
+	}
+	for _, tt := range tests {
+		v, err := n2.storage.Get(tt.key)
+		require.NoError(t, err)
+		assert.Equal(t, tt.value, v)
+		ttl, err := n2.storage.TTL(tt.key)
+		require.NoError(t, err)
+		if tt.ttl {
+			assert.InDelta(t, time.Hour, ttl, float64(time.Minute), "key %s", tt.key)
+		} else {
+			assert.Zero(t, ttl, "key %s", tt.key)
+		}
+	}
+}
+
+func TestRouter_AbortRebalance(t *testing.T) {
+	n1, n2, n3 := newNode(t), newNode(t), newNode(t)
+	r, err := router.New(logger, router.Config{
+		Nodes:          map[string]string{"n1": n1.server.URL, "n2": n2.server.URL},
+		HealthInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		code, _ := do(t, r, http.MethodPut, fmt.Sprintf("key-%d", i), "v")
+		require.Equal(t, http.StatusCreated, code)
+	}
+
+	// the keys of a dead node can't be moved, the rebalance retries
+	n2.server.Close()
+	require.NoError(t, r.RemoveNode("n2"))
+	require.Eventually(t, func() bool { return r.RebalanceError() != nil }, time.Second, 5*time.Millisecond)
+	assert.True(t, r.Rebalancing())
+	assert.ErrorIs(t, r.AddNode("n3", n3.server.URL), router.ErrorRebalancing)
+
+	require.NoError(t, r.AbortRebalance())
+	assert.False(t, r.Rebalancing())
+	assert.NoError(t, r.RebalanceError())
+	assert.Equal(t, []router.Node{{ID: "n1", URL: n1.server.URL, Healthy: true}}, r.Nodes())
+	assert.ErrorIs(t, r.AbortRebalance(), router.ErrorNotRebalancing)
+	for k := range n1.keys() {
+		code, _ := do(t, r, http.MethodGet, k, "")
+		assert.Equal(t, http.StatusOK, code)
+	}
+
+	require.NoError(t, r.AddNode("n3", n3.server.URL))
+	require.Eventually(t, func() bool { return !r.Rebalancing() }, 5*time.Second, 10*time.Millisecond)
+	assert.NotEmpty(t, n3.keys())
+}
+
+func TestRouter_RunStopTwice(t *testing.T) {
+	r, err := router.New(logger, router.Config{Nodes: map[string]string{"n1": newNode(t).server.URL}})
+	require.NoError(t, err)
+
+	stop := r.Run()
+	stop()
+	assert.NotPanics(t, stop)
+}
+
+func TestParseNodes(t *testing.T) {
+	nodes, err := router.ParseNodes("n1=http://a:8081, n2=http://b:8082,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"n1": "http://a:8081", "n2": "http://b:8082"}, nodes)
+
+	_, err = router.ParseNodes("n1")
+	assert.Error(t, err)
+
+	_, err = router.New(logger, router.Config{})
+	assert.ErrorIs(t, err, router.ErrorNoNodes)
+	_, err = router.New(logger, router.Config{Nodes: nodes})
+	assert.NoError(t, err)
+	_, err = router.New(logger, router.Config{Nodes: map[string]string{"n1": "not a url"}})
+	assert.Error(t, err)
+}
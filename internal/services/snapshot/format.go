@@ -0,0 +1,107 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+// Snapshot file layout:
+//
+//	magic "KVSS" | version byte | sequence uint64 | item count uvarint |
+//	items | CRC32 uint32 of everything before it
+//	item: key length uvarint | key | value length uvarint | value | expires varint
+//
+// All fixed size integers are little endian.
+const (
+	magic         = "KVSS"
+	formatVersion = 1
+	headerSize    = len(magic) + 1 + 8
+	checksumSize  = 4
+)
+
+var (
+	ErrorCorruptedSnapshot = errors.New("corrupted snapshot")
+	ErrorUnknownVersion    = errors.New("unknown snapshot format version")
+)
+
+// Encode returns a snapshot of the items with the sequence of the last
+// event in them.
+func Encode(sequence uint64, items []storage.Item) []byte {
+	size := headerSize + binary.MaxVarintLen64 + checksumSize
+	for _, item := range items {
+		size += 3*binary.MaxVarintLen64 + len(item.Key) + len(item.Value)
+	}
+
+	b := make([]byte, 0, size)
+	b = append(b, magic...)
+	b = append(b, formatVersion)
+	b = binary.LittleEndian.AppendUint64(b, sequence)
+	b = binary.AppendUvarint(b, uint64(len(items)))
+	for _, item := range items {
+		b = binary.AppendUvarint(b, uint64(len(item.Key)))
+		b = append(b, item.Key...)
+		b = binary.AppendUvarint(b, uint64(len(item.Value)))
+		b = append(b, item.Value...)
+		b = binary.AppendVarint(b, item.Expires)
+	}
+
+	return binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(b))
+}
+
+// Decode returns the sequence and the items of a snapshot.
+func Decode(b []byte) (uint64, []storage.Item, error) {
+	if len(b) < headerSize+checksumSize || string(b[:len(magic)]) != magic {
+		return 0, nil, fmt.Errorf("%w: bad header", ErrorCorruptedSnapshot)
+	}
+	if b[len(magic)] != formatVersion {
+		return 0, nil, fmt.Errorf("%w: %d", ErrorUnknownVersion, b[len(magic)])
+	}
+	body := b[:len(b)-checksumSize]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(b[len(body):]) {
+		return 0, nil, fmt.Errorf("%w: checksum mismatch", ErrorCorruptedSnapshot)
+	}
+
+	sequence := binary.LittleEndian.Uint64(body[len(magic)+1:])
+	r := bytes.NewReader(body[headerSize:])
+	count, err := binary.ReadUvarint(r)
+	if err != nil || count > uint64(r.Len()) {
+		return 0, nil, fmt.Errorf("%w: bad item count", ErrorCorruptedSnapshot)
+	}
+
+	items := make([]storage.Item, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var item storage.Item
+		if item.Key, err = readString(r); err != nil {
+			return 0, nil, fmt.Errorf("%w: cant read key: %w", ErrorCorruptedSnapshot, err)
+		}
+		if item.Value, err = readString(r); err != nil {
+			return 0, nil, fmt.Errorf("%w: cant read value: %w", ErrorCorruptedSnapshot, err)
+		}
+		if item.Expires, err = binary.ReadVarint(r); err != nil {
+			return 0, nil, fmt.Errorf("%w: cant read expiration: %w", ErrorCorruptedSnapshot, err)
+		}
+		items = append(items, item)
+	}
+
+	return sequence, items, nil
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if size > uint64(r.Len()) {
+		return "", io.ErrUnexpectedEOF
+	}
+	b := make([]byte, size)
+	_, _ = r.Read(b)
+
+	return string(b), nil
+}
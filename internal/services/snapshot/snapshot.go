@@ -0,0 +1,242 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/fileutil"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+const (
+	DefaultDir  = "snapshots"
+	DefaultKeep = 2
+
+	filePrefix    = "snapshot-"
+	checkInterval = time.Second // how often Run checks the triggers
+)
+
+type Config struct {
+	Dir      string
+	Interval time.Duration // take a snapshot this often, 0 disables the trigger
+	Events   uint64        // take a snapshot after this many events, 0 disables the trigger
+	Keep     int           // number of snapshots to keep, older ones are fallbacks
+}
+
+// Storage is a storage which content can be saved to and loaded from a snapshot.
+type Storage interface {
+	Items() []storage.Item
+	Load([]storage.Item)
+}
+
+// Log is a transaction log which events before a snapshot can be dropped.
+type Log interface {
+	LastSequence() uint64
+	// AdvanceSequence makes sequences of new events greater than seq.
+	AdvanceSequence(seq uint64)
+	// KeepDeletesAfter stops compaction from dropping deletes after seq.
+	KeepDeletesAfter(seq uint64)
+	// TruncateBefore drops events up to seq.
+	TruncateBefore(seq uint64) error
+}
+
+// Snapshotter saves point-in-time copies of the storage with the sequence
+// of the last event in them, so on start only later events are replayed.
+type Snapshotter struct {
+	logger  *log.Logger
+	config  Config
+	storage Storage
+	log     Log
+
+	mu           sync.Mutex // serializes Take
+	lastSequence uint64     // of the last snapshot
+	lastTime     time.Time
+}
+
+func New(logger *log.Logger, config Config, storage Storage, log Log) (*Snapshotter, error) {
+	if config.Dir == "" {
+		config.Dir = DefaultDir
+	}
+	if config.Keep <= 0 {
+		config.Keep = DefaultKeep
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cant create snapshot dir: %w", err)
+	}
+
+	return &Snapshotter{
+		logger:   logger,
+		config:   config,
+		storage:  storage,
+		log:      log,
+		lastTime: time.Now(),
+	}, nil
+}
+
+// Restore loads the newest valid snapshot into the storage and returns its
+// sequence, or 0 if there is no snapshot. Damaged snapshots are skipped.
+func (s *Snapshotter) Restore() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sequences, err := s.list()
+	if err != nil {
+		return 0, err
+	}
+	if len(sequences) == 0 {
+		return 0, nil
+	}
+	// an older snapshot may be needed if the newest one gets damaged
+	s.log.KeepDeletesAfter(sequences[0])
+
+	for i := len(sequences) - 1; i >= 0; i-- {
+		b, err := os.ReadFile(s.fileName(sequences[i]))
+		if err != nil {
+			s.logger.Printf("cant read snapshot %d: %s", sequences[i], err)
+			continue
+		}
+		sequence, items, err := Decode(b)
+		if err != nil {
+			s.logger.Printf("cant decode snapshot %d: %s", sequences[i], err)
+			continue
+		}
+
+		s.storage.Load(items)
+		// the log may lose unsynced events which are in the snapshot
+		s.log.AdvanceSequence(sequence)
+		s.lastSequence = sequence
+		s.logger.Printf("snapshot %d loaded: %d items", sequence, len(items))
+		return sequence, nil
+	}
+
+	return 0, errors.New("no valid snapshot")
+}
+
+// Take saves a snapshot of the storage, removes snapshots over Config.Keep
+// and truncates the log before the oldest kept one. It returns the snapshot
+// sequence.
+func (s *Snapshotter) Take() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// every event up to the sequence is already applied to the storage,
+	// later ones may be applied too, replaying them is harmless
+	sequence := s.log.LastSequence()
+
+	sequences, err := s.list()
+	if err != nil {
+		return 0, err
+	}
+	sequences = slices.DeleteFunc(sequences, func(seq uint64) bool { return seq >= sequence })
+	sequences = append(sequences, sequence)
+	obsolete := sequences[:max(0, len(sequences)-s.config.Keep)]
+	oldest := sequences[len(obsolete)]
+	s.log.KeepDeletesAfter(oldest)
+
+	items := s.storage.Items()
+	if err = fileutil.WriteFileAtomic(s.fileName(sequence), Encode(sequence, items)); err != nil {
+		return 0, fmt.Errorf("cant write snapshot: %w", err)
+	}
+	s.lastSequence, s.lastTime = sequence, time.Now()
+	s.logger.Printf("snapshot %d taken: %d items", sequence, len(items))
+
+	for _, seq := range obsolete {
+		if err = os.Remove(s.fileName(seq)); err != nil {
+			return 0, fmt.Errorf("cant remove old snapshot: %w", err)
+		}
+	}
+	if err = s.log.TruncateBefore(oldest); err != nil {
+		return 0, fmt.Errorf("cant truncate log: %w", err)
+	}
+
+	return sequence, nil
+}
+
+// Export returns a snapshot of the storage without saving it,
+// so a replica can start from it.
+func (s *Snapshotter) Export() (uint64, []byte) {
+	// as in Take, the sequence is read before the items
+	sequence := s.log.LastSequence()
+
+	return sequence, Encode(sequence, s.storage.Items())
+}
+
+// Run starts a background goroutine which takes snapshots by the Config
+// triggers. Call the returned function to stop it.
+func (s *Snapshotter) Run() (stop func()) {
+	ticker := time.NewTicker(checkInterval)
+	done := make(chan struct{})
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !s.isDue() {
+					continue
+				}
+				if _, err := s.Take(); err != nil {
+					s.logger.Printf("snapshot failure: %s", err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func (s *Snapshotter) isDue() bool {
+	s.mu.Lock()
+	lastSequence, lastTime := s.lastSequence, s.lastTime
+	s.mu.Unlock()
+
+	sequence := s.log.LastSequence()
+	if sequence == lastSequence {
+		return false
+	}
+
+	return (s.config.Interval > 0 && time.Since(lastTime) >= s.config.Interval) ||
+		(s.config.Events > 0 && sequence-lastSequence >= s.config.Events)
+}
+
+func (s *Snapshotter) fileName(sequence uint64) string {
+	return filepath.Join(s.config.Dir, fmt.Sprintf("%s%020d", filePrefix, sequence))
+}
+
+func (s *Snapshotter) list() ([]uint64, error) {
+	return List(s.config.Dir)
+}
+
+// List returns sequences of the snapshot files in the dir in ascending order.
+func List(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cant read snapshot dir: %w", err)
+	}
+
+	sequences := []uint64{}
+	for _, e := range entries {
+		name, ok := strings.CutPrefix(e.Name(), filePrefix)
+		if !ok {
+			continue
+		}
+		if seq, err := strconv.ParseUint(name, 10, 64); err == nil {
+			sequences = append(sequences, seq)
+		}
+	}
+	slices.Sort(sequences)
+
+	return sequences, nil
+}
@@ -0,0 +1,139 @@
+package snapshot_test
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/snapshot"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = log.New(io.Discard, "", 0)
+
+type fakeLog struct {
+	sequence         uint64
+	keepDeletesAfter uint64
+	truncatedBefore  uint64
+}
+
+func (l *fakeLog) LastSequence() uint64 { return l.sequence }
+
+func (l *fakeLog) AdvanceSequence(seq uint64) { l.sequence = max(l.sequence, seq) }
+
+func (l *fakeLog) KeepDeletesAfter(seq uint64) { l.keepDeletesAfter = seq }
+
+func (l *fakeLog) TruncateBefore(seq uint64) error {
+	l.truncatedBefore = seq
+	return nil
+}
+
+func newSnapshotter(t *testing.T, dir string, l *fakeLog) (*snapshot.Snapshotter, *localstorage.LocalStorage) {
+	t.Helper()
+
+	ls := localstorage.New().(*localstorage.LocalStorage)
+	s, err := snapshot.New(logger, snapshot.Config{Dir: dir}, ls, l)
+	require.NoError(t, err)
+
+	return s, ls
+}
+
+func TestSnapshotter_TakeRestore(t *testing.T) {
+	dir := t.TempDir()
+	s, ls := newSnapshotter(t, dir, &fakeLog{sequence: 5})
+	_ = ls.Put("one", "ONE")
+	_ = ls.PutWithTTL("session", "token", time.Hour)
+
+	seq, err := s.Take()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), seq)
+
+	l := &fakeLog{sequence: 3}
+	restored, restoredStorage := newSnapshotter(t, dir, l)
+	seq, err = restored.Restore()
+
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), seq)
+	assert.Equal(t, uint64(5), l.sequence)
+	assert.Equal(t, ls.Items(), restoredStorage.Items())
+}
+
+func TestSnapshotter_RestoreWithoutSnapshot(t *testing.T) {
+	s, _ := newSnapshotter(t, t.TempDir(), &fakeLog{})
+
+	seq, err := s.Restore()
+
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), seq)
+}
+
+func TestSnapshotter_TakeRemovesOldSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	l := &fakeLog{}
+	s, _ := newSnapshotter(t, dir, l)
+
+	for _, seq := range []uint64{1, 2, 3} {
+		l.sequence = seq
+		_, err := s.Take()
+		require.NoError(t, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, snapshot.DefaultKeep)
+	assert.Equal(t, uint64(2), l.keepDeletesAfter)
+	assert.Equal(t, uint64(2), l.truncatedBefore)
+}
+
+func TestSnapshotter_RestoreDamaged(t *testing.T) {
+	dir := t.TempDir()
+	l := &fakeLog{}
+	s, ls := newSnapshotter(t, dir, l)
+
+	_ = ls.Put("one", "1")
+	l.sequence = 1
+	_, err := s.Take()
+	require.NoError(t, err)
+	_ = ls.Put("one", "ONE")
+	l.sequence = 2
+	_, err = s.Take()
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	newest := filepath.Join(dir, entries[len(entries)-1].Name())
+	b, err := os.ReadFile(newest)
+	require.NoError(t, err)
+	b[len(b)/2] ^= 0xff
+	require.NoError(t, os.WriteFile(newest, b, 0o755))
+
+	restored, restoredStorage := newSnapshotter(t, dir, &fakeLog{})
+	seq, err := restored.Restore()
+
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), seq)
+	assert.Equal(t, []storage.Item{{Key: "one", Value: "1"}}, restoredStorage.Items())
+}
+
+func TestSnapshotter_Export(t *testing.T) {
+	dir := t.TempDir()
+	s, ls := newSnapshotter(t, dir, &fakeLog{sequence: 7})
+	_ = ls.Put("one", "ONE")
+
+	seq, b := s.Export()
+	gotSeq, items, err := snapshot.Decode(b)
+
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), seq)
+	assert.Equal(t, seq, gotSeq)
+	assert.Equal(t, ls.Items(), items)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
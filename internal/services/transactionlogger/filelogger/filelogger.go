@@ -2,186 +2,701 @@ package filelogger
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
 )
 
 const (
-	readPattern  = "%d\t%d\t%s\t%s"
-	writePattern = "%d\t%d\t%s\t%s\n"
+	DefaultSegmentSize        = 4 << 20
+	DefaultCompactionInterval = time.Minute
 )
 
+type Config struct {
+	Filename           string
+	SegmentSize        int64         // the active segment is sealed when it grows bigger
+	CompactionInterval time.Duration // how often sealed segments are compacted
+	Sync               SyncMode
+	SyncInterval       time.Duration // for SyncModeInterval
+}
+
 type FileTransactionLogger struct {
-	events       chan<- transactionlogger.Event
+	requests     chan<- request
+	stopped      <-chan struct{} // closed when the writer stops on error or Close
 	errors       <-chan error
-	lastSequence uint64
-	file         *os.File
+	closing      chan struct{} // closed by Close
+	closeOnce    sync.Once
+	closeErr     error           // of the writer, read after stopped is closed
+	compactor    <-chan struct{} // closed when compaction stops
+	lastSequence atomic.Uint64
+	epoch        uint64   // see Epoch
+	file         *os.File // active segment
+	size         int64    // of the active segment
 	logger       *log.Logger
+	config       Config
+
+	mu             sync.Mutex // guards segments, sealedSequence, nextID and compacted
+	segments       []uint64   // live segments in replay order, the last one is active
+	sealedSequence uint64     // the last sequence in sealed segments
+	nextID         uint64
+	compacted      uint64 // segment made by the last compaction
+
+	compactMu        sync.Mutex // serializes changes of sealed segments
+	keepDeletesAfter atomic.Uint64
+	horizon          atomic.Uint64 // the last sequence of dropped changes
+
+	cursorMu sync.Mutex // guards cursor
+	cursor   cursor     // where the last ReadRecordsAfter stopped
 }
 
 func New(
 	logger *log.Logger,
-	filename string,
+	config Config,
 ) (transactionlogger.TransactionLogger, error) {
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o755)
-	if err != nil {
-		return nil, fmt.Errorf("cant open log file: %w", err)
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = DefaultSegmentSize
+	}
+	if config.CompactionInterval <= 0 {
+		config.CompactionInterval = DefaultCompactionInterval
+	}
+	if config.SyncInterval <= 0 {
+		config.SyncInterval = DefaultSyncInterval
+	}
+	ftl := FileTransactionLogger{logger: logger, config: config, epoch: uint64(time.Now().UnixNano())}
+	ftl.keepDeletesAfter.Store(math.MaxUint64)
+
+	if err := ftl.open(); err != nil {
+		if ftl.file != nil {
+			ftl.file.Close()
+		}
+		return nil, fmt.Errorf("cant open log: %w", err)
 	}
-	ftl := FileTransactionLogger{logger: logger, file: file}
 
 	return &ftl, nil
 }
 
-func (l *FileTransactionLogger) Run() {
-	l.logger.Println("dataLogger run...")
+func (l *FileTransactionLogger) open() error {
+	filename := l.config.Filename
+	if err := l.migrateLegacyLog(); err != nil {
+		return fmt.Errorf("cant migrate log file: %w", err)
+	}
 
-	events := make(chan transactionlogger.Event, 16)
-	l.events = events
-	errors := make(chan error, 1)
-	l.errors = errors
+	ids, sequence, err := readManifest(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		ids, err = listSegments(filename)
+	}
+	if err != nil {
+		return fmt.Errorf("cant read manifest: %w", err)
+	}
+	if err = removeGarbage(filename, ids); err != nil {
+		return err
+	}
 
-	go func() {
-		defer l.file.Close()
+	l.segments = ids
+	l.sealedSequence = sequence
+	l.lastSequence.Store(sequence)
+	l.nextID = 1
+	if len(ids) > 0 {
+		l.nextID = slices.Max(ids) + 1
+	}
 
-		for e := range events {
-			l.lastSequence++
-			_, err := fmt.Fprintf(l.file, writePattern, l.lastSequence, e.EventType, e.Key, e.Value)
-			if err != nil {
-				errors <- err
-				return
-			}
-			if e.EventType == transactionlogger.EventDelete {
-				if err = l.clearNotActualData(e.Key); err != nil {
-					errors <- err
-					return
-				}
-			}
-		}
-	}()
-}
+	if len(ids) == 0 {
+		err = l.createSegment()
+	} else {
+		err = l.openActiveSegment()
+	}
+	if err != nil {
+		return err
+	}
+	// previous compactions might drop anything in the sealed segments
+	l.horizon.Store(l.sealedSequence)
 
-func (l *FileTransactionLogger) clearNotActualData(key string) error {
-	l.logger.Println("clear not actual data...")
+	return writeManifest(filename, l.segments, l.sealedSequence)
+}
 
-	tempFileName := "temp.log"
-	tempFile, err := os.OpenFile(tempFileName, os.O_WRONLY|os.O_CREATE, 0o755)
+// migrateLegacyLog turns the single file log of previous versions
+// into the first segment.
+func (l *FileTransactionLogger) migrateLegacyLog() error {
+	filename := l.config.Filename
+	if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	ids, err := listSegments(filename)
 	if err != nil {
-		return fmt.Errorf("cant create temp log file: %w", err)
+		return fmt.Errorf("cant list segments: %w", err)
 	}
-	defer tempFile.Close()
-
-	_, _ = l.file.Seek(0, 0) // seek to start!
-	if err = l.copyData(key, tempFile); err != nil {
-		return fmt.Errorf("cant copy data: %w", err)
+	if len(ids) > 0 {
+		return fmt.Errorf("both log file %s and its segments exist", filename)
 	}
 
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND, 0o755)
+	if err != nil {
+		return fmt.Errorf("cant open log file: %w", err)
+	}
+	l.file = file
+	err = l.prepareFile()
 	l.file.Close()
-	if err = l.swapFiles(l.file.Name(), tempFileName); err != nil {
-		return fmt.Errorf("cant swap log files: %w", err)
+	l.file = nil
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(filename, segmentName(filename, 1))
+}
+
+func (l *FileTransactionLogger) openActiveSegment() error {
+	file, err := os.OpenFile(segmentName(l.config.Filename, l.segments[len(l.segments)-1]), os.O_RDWR|os.O_APPEND, 0o755)
+	if err != nil {
+		return fmt.Errorf("cant open active segment: %w", err)
+	}
+	l.file = file
+	if err = l.prepareFile(); err != nil {
+		return err
 	}
 
-	l.file, err = os.OpenFile(l.file.Name(), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o755)
+	info, err := l.file.Stat()
 	if err != nil {
-		return fmt.Errorf("cant open new log file: %w", err)
+		return fmt.Errorf("cant stat active segment: %w", err)
 	}
-	_, _ = l.file.Seek(0, 2) // seek to end!
+	l.size = info.Size()
+
+	h := make([]byte, headerSize)
+	if _, err = l.file.ReadAt(h, 0); err != nil {
+		return fmt.Errorf("cant read active segment header: %w", err)
+	}
+	if h[len(magic)] < formatVersion {
+		return l.sealOldSegment()
+	}
+
 	return nil
 }
 
-func (l *FileTransactionLogger) swapFiles(logFileName string, tempFileName string) error {
-	l.logger.Println("swap log files...")
+// sealOldSegment starts a new active segment instead of one with an older
+// format version, so records of the current version are never appended to it.
+func (l *FileTransactionLogger) sealOldSegment() error {
+	id := l.segments[len(l.segments)-1]
+	err := l.readSegment(id, true, func(e transactionlogger.Event) error {
+		l.sealedSequence = max(l.sealedSequence, e.Sequence)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = l.file.Sync(); err != nil {
+		return fmt.Errorf("cant sync segment: %w", err)
+	}
+	l.file.Close()
+	l.lastSequence.Store(l.sealedSequence)
+
+	return l.createSegment()
+}
 
-	if err := os.Remove(logFileName); err != nil {
-		return fmt.Errorf("cant remove old log file: %w", err)
+// createSegment makes a new empty active segment,
+// the caller writes the manifest.
+func (l *FileTransactionLogger) createSegment() error {
+	file, err := os.OpenFile(segmentName(l.config.Filename, l.nextID), os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return fmt.Errorf("cant create segment: %w", err)
 	}
-	if err := os.Rename(tempFileName, logFileName); err != nil {
-		return fmt.Errorf("cant rename temp log file: %w", err)
+	if _, err = file.Write(header()); err != nil {
+		file.Close()
+		return fmt.Errorf("cant write segment header: %w", err)
 	}
+
+	l.file = file
+	l.size = int64(headerSize)
+	l.segments = append(l.segments, l.nextID)
+	l.nextID++
+
 	return nil
 }
 
-func (l *FileTransactionLogger) copyData(key string, tempFile *os.File) error {
-	l.logger.Println("coping log data...")
+// prepareFile writes the header to a new log and migrates a legacy text log.
+// The file position is left right after the header.
+func (l *FileTransactionLogger) prepareFile() error {
+	h := make([]byte, headerSize)
+	n, err := io.ReadFull(l.file, h)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("cant read log header: %w", err)
+	}
+
+	// new log or the header write was torn
+	if bytes.HasPrefix(header(), h[:n]) && n < headerSize {
+		if err = l.file.Truncate(0); err != nil {
+			return fmt.Errorf("cant truncate log file: %w", err)
+		}
+		if _, err = l.file.Write(header()); err != nil {
+			return fmt.Errorf("cant write log header: %w", err)
+		}
+		_, err = l.file.Seek(int64(headerSize), io.SeekStart)
+		return err
+	}
+
+	isBinary, err := checkHeader(h[:n])
+	if err != nil {
+		return err
+	}
+	if isBinary {
+		return nil
+	}
+
+	return l.migrateTextLog()
+}
+
+// migrateTextLog rewrites the legacy text log in the binary format.
+func (l *FileTransactionLogger) migrateTextLog() error {
+	l.logger.Println("migrate text log...")
 
-	var err error
-	var e transactionlogger.Event
+	tempFileName := l.file.Name() + ".migrate"
+	tempFile, err := os.OpenFile(tempFileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return fmt.Errorf("cant create temp log file: %w", err)
+	}
+	defer tempFile.Close()
+
+	w := bufio.NewWriter(tempFile)
+	_, _ = w.Write(header())
 
+	_, _ = l.file.Seek(0, io.SeekStart) // seek to start!
 	scanner := bufio.NewScanner(l.file)
+	count := 0
 	for scanner.Scan() {
-		line := scanner.Text()
+		if scanner.Text() == "" {
+			continue
+		}
+		e, err := parseTextLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("cant migrate line %d: %w", count+1, err)
+		}
+		if _, err = w.Write(encodeRecord(e)); err != nil {
+			return fmt.Errorf("cant save to temp file: %w", err)
+		}
+		count++
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("text log read failure: %w", err)
+	}
+	if err = w.Flush(); err != nil {
+		return fmt.Errorf("cant save to temp file: %w", err)
+	}
+	if err = tempFile.Sync(); err != nil {
+		return fmt.Errorf("cant sync temp file: %w", err)
+	}
+
+	l.file.Close()
+	if err = os.Rename(tempFileName, l.file.Name()); err != nil {
+		return fmt.Errorf("cant rename temp log file: %w", err)
+	}
+	l.file, err = os.OpenFile(l.file.Name(), os.O_RDWR|os.O_APPEND, 0o755)
+	if err != nil {
+		return fmt.Errorf("cant open migrated log file: %w", err)
+	}
+	l.logger.Printf("%d events migrated", count)
+
+	_, err = l.file.Seek(int64(headerSize), io.SeekStart)
+	return err
+}
+
+func (l *FileTransactionLogger) Run() {
+	l.logger.Println("dataLogger run...")
+
+	requests := make(chan request, maxBatchSize)
+	l.requests = requests
+	errors := make(chan error, 1)
+	l.errors = errors
+	done := make(chan struct{})
+	l.stopped = done
+	l.closing = make(chan struct{})
+	compactor := make(chan struct{})
+	l.compactor = compactor
 
-		_, err = fmt.Sscanf(line, readPattern, &e.Sequence, &e.EventType, &e.Key, &e.Value)
-		if err != nil && !errors.Is(err, io.EOF) {
-			return fmt.Errorf("input parse error: %w", err)
+	go l.runWriter(requests, errors, done)
+	go func() {
+		defer close(compactor)
+		l.runCompaction(done)
+	}()
+}
+
+// Close writes the events already sent, flushes the log to disk and stops
+// the writer and compaction. It returns the error the writer stopped on,
+// writes after Close fail with ErrorStopped.
+func (l *FileTransactionLogger) Close() error {
+	if l.closing == nil {
+		// not run, an offline tool may have appended to it
+		err := l.file.Sync()
+		if cerr := l.file.Close(); err == nil {
+			err = cerr
 		}
-		if e.Key != key {
-			_, err = fmt.Fprintf(tempFile, writePattern, e.Sequence, e.EventType, e.Key, e.Value)
-			if err != nil {
-				return fmt.Errorf("cant save to temp file: %w", err)
+		return err
+	}
+
+	l.closeOnce.Do(func() { close(l.closing) })
+	<-l.stopped
+	<-l.compactor
+
+	return l.closeErr
+}
+
+// write appends the events as one record.
+func (l *FileTransactionLogger) write(events ...transactionlogger.Event) error {
+	last := l.lastSequence.Add(uint64(len(events)))
+	for i := range events {
+		events[i].Sequence = last - uint64(len(events)-1-i)
+	}
+	record := encodeRecord(events...)
+	if _, err := l.file.Write(record); err != nil {
+		return err
+	}
+
+	l.size += int64(len(record))
+	if l.size >= l.config.SegmentSize {
+		return l.rotate()
+	}
+
+	return nil
+}
+
+// rotate seals the active segment and starts a new one.
+func (l *FileTransactionLogger) rotate() error {
+	l.logger.Println("rotate log segment...")
+
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("cant sync segment: %w", err)
+	}
+	l.file.Close()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.createSegment(); err != nil {
+		return err
+	}
+	l.sealedSequence = l.lastSequence.Load()
+
+	return writeManifest(l.config.Filename, l.segments, l.sealedSequence)
+}
+
+func (l *FileTransactionLogger) runCompaction(done <-chan struct{}) {
+	ticker := time.NewTicker(l.config.CompactionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := l.compact(); err != nil {
+				l.logger.Printf("compaction failed: %s", err)
 			}
 		}
 	}
+}
+
+// compact merges the sealed segments into one which keeps only the latest
+// event of every key. Deletes and expired puts are dropped: the sealed
+// segments are the oldest ones, so they can't hide anything, except for
+// the deletes kept for snapshots by KeepDeletesAfter.
+// The new segment replaces the sealed ones by the manifest update,
+// the sealed segment files are removed after it.
+func (l *FileTransactionLogger) compact() error {
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+
+	l.mu.Lock()
+	sealed := slices.Clone(l.segments[:len(l.segments)-1])
+	nothingToDo := len(sealed) == 0 || (len(sealed) == 1 && sealed[0] == l.compacted)
+	l.mu.Unlock()
+	if nothingToDo {
+		return nil
+	}
+	l.logger.Printf("compact %d log segments...", len(sealed))
+
+	latest := map[string]transactionlogger.Event{}
+	for _, id := range sealed {
+		err := l.readSegment(id, false, func(e transactionlogger.Event) error {
+			latest[e.Key] = e
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	now, keepDeletesAfter := time.Now().UnixNano(), l.keepDeletesAfter.Load()
+	events := make([]transactionlogger.Event, 0, len(latest))
+	var dropped uint64
+	for _, e := range latest {
+		isActualPut := e.EventType == transactionlogger.EventPut && (e.Expires == 0 || e.Expires > now)
+		isKeptDelete := e.EventType == transactionlogger.EventDelete && e.Sequence > keepDeletesAfter
+		if isActualPut || isKeptDelete {
+			events = append(events, e)
+		} else {
+			dropped = max(dropped, e.Sequence)
+		}
+	}
+	slices.SortFunc(events, func(a, b transactionlogger.Event) int {
+		return cmp.Compare(a.Sequence, b.Sequence)
+	})
+
+	l.mu.Lock()
+	id := l.nextID
+	l.nextID++
+	l.mu.Unlock()
+
+	compacted := []uint64{}
+	if len(events) > 0 {
+		if err := l.writeSegment(id, events); err != nil {
+			_ = os.Remove(segmentName(l.config.Filename, id))
+			return err
+		}
+		compacted = append(compacted, id)
+	}
+
+	l.mu.Lock()
+	segments := append(compacted, l.segments[len(sealed):]...)
+	err := writeManifest(l.config.Filename, segments, l.sealedSequence)
+	if err == nil {
+		l.segments = segments
+		l.compacted = id
+	}
+	l.mu.Unlock()
+	if err != nil {
+		_ = os.Remove(segmentName(l.config.Filename, id))
+		return err
+	}
+	l.raiseHorizon(dropped)
+
+	for _, id := range sealed {
+		if err = os.Remove(segmentName(l.config.Filename, id)); err != nil {
+			return fmt.Errorf("cant remove compacted segment: %w", err)
+		}
+	}
+	l.logger.Printf("%d log segments compacted to %d events", len(sealed), len(events))
+
 	return nil
 }
 
+// writeSegment writes a sealed segment with the events.
+func (l *FileTransactionLogger) writeSegment(id uint64, events []transactionlogger.Event) error {
+	file, err := os.OpenFile(segmentName(l.config.Filename, id), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return fmt.Errorf("cant create segment: %w", err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	_, _ = w.Write(header())
+	for _, e := range events {
+		_, _ = w.Write(encodeRecord(e))
+	}
+	if err = w.Flush(); err != nil {
+		return fmt.Errorf("cant write segment: %w", err)
+	}
+	if err = file.Sync(); err != nil {
+		return fmt.Errorf("cant sync segment: %w", err)
+	}
+
+	return nil
+}
+
+// ReadEvents reads all segments of the log. A record torn by a crash at
+// the end of the active segment is cut off, any other damaged record
+// is an error.
 func (l *FileTransactionLogger) ReadEvents() (<-chan transactionlogger.Event, <-chan error) {
 	l.logger.Println("read events...")
 
-	scanner := bufio.NewScanner(l.file)
 	outEvent := make(chan transactionlogger.Event)
 	outError := make(chan error, 1)
 
 	go func() {
-		var e transactionlogger.Event
 		defer close(outEvent)
 		defer close(outError)
 
-		for scanner.Scan() {
-			line := scanner.Text()
+		l.mu.Lock()
+		ids := slices.Clone(l.segments)
+		l.mu.Unlock()
 
-			_, err := fmt.Sscanf(line, readPattern, &e.Sequence, &e.EventType, &e.Key, &e.Value)
-			if err != nil && !errors.Is(err, io.EOF) {
-				outError <- fmt.Errorf("input parse error: %w", err)
+		var last uint64
+		for i, id := range ids {
+			err := l.readSegment(id, i == len(ids)-1, func(e transactionlogger.Event) error {
+				if last >= e.Sequence {
+					return ErrorOutOfSequence
+				}
+				last = e.Sequence
+				outEvent <- e
+				return nil
+			})
+			if err != nil {
+				outError <- err
 				return
 			}
+		}
+		l.AdvanceSequence(last)
+	}()
 
-			if l.lastSequence >= e.Sequence {
-				outError <- fmt.Errorf("transaction numbers out of sequence")
-				return
-			}
+	return outEvent, outError
+}
+
+// readSegment passes every record of the segment to fn.
+func (l *FileTransactionLogger) readSegment(
+	id uint64,
+	isActive bool,
+	fn func(transactionlogger.Event) error,
+) error {
+	name := segmentName(l.config.Filename, id)
+	s, err := openSegment(name)
+	if err != nil {
+		return fmt.Errorf("transaction log read failure in %s: %w", name, err)
+	}
+	defer s.Close()
+
+	for {
+		events, isTail, err := s.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		isTorn := errors.Is(err, ErrorTruncatedRecord) || (errors.Is(err, ErrorCorruptedRecord) && isTail)
+		if isTorn && isActive {
+			return l.cutTail(s.offset)
+		}
+		if err != nil {
+			return fmt.Errorf("transaction log read failure in %s at offset %d: %w", name, s.offset, err)
+		}
 
-			l.lastSequence = e.Sequence
-			outEvent <- e
+		for _, e := range events {
+			if err = fn(e); err != nil {
+				return err
+			}
 		}
+	}
+}
+
+// cutTail removes the torn record at offset of the active segment.
+func (l *FileTransactionLogger) cutTail(offset int64) error {
+	l.logger.Printf("cut torn record at offset %d", offset)
+
+	if err := l.file.Truncate(offset); err != nil {
+		return fmt.Errorf("cant cut torn record: %w", err)
+	}
+	l.size = offset
 
-		if err := scanner.Err(); err != nil {
-			outError <- fmt.Errorf("transaction log read failure: %w", err)
+	return nil
+}
+
+// LastSequence returns the sequence of the last written event.
+func (l *FileTransactionLogger) LastSequence() uint64 {
+	return l.lastSequence.Load()
+}
+
+// AdvanceSequence makes sequences of new events greater than seq.
+func (l *FileTransactionLogger) AdvanceSequence(seq uint64) {
+	for last := l.lastSequence.Load(); last < seq; last = l.lastSequence.Load() {
+		if l.lastSequence.CompareAndSwap(last, seq) {
 			return
 		}
-	}()
+	}
+}
 
-	return outEvent, outError
+// KeepDeletesAfter stops compaction from dropping deletes after seq:
+// a snapshot of seq may still have the deleted keys.
+func (l *FileTransactionLogger) KeepDeletesAfter(seq uint64) {
+	l.keepDeletesAfter.Store(seq)
+}
+
+// TruncateBefore removes the sealed segments which have no events after seq,
+// as they are covered by a snapshot of seq. Deletes after seq are kept.
+func (l *FileTransactionLogger) TruncateBefore(seq uint64) error {
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+	l.KeepDeletesAfter(seq)
+
+	l.mu.Lock()
+	sealed := slices.Clone(l.segments[:len(l.segments)-1])
+	l.mu.Unlock()
+
+	covered := 0
+	var truncated uint64
+	for _, id := range sealed {
+		var last uint64
+		err := l.readSegment(id, false, func(e transactionlogger.Event) error {
+			last = e.Sequence
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if last > seq {
+			break
+		}
+		covered++
+		truncated = max(truncated, last)
+	}
+	if covered == 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	segments := slices.Clone(l.segments[covered:])
+	err := writeManifest(l.config.Filename, segments, l.sealedSequence)
+	if err == nil {
+		l.segments = segments
+	}
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	l.raiseHorizon(truncated)
+
+	for _, id := range sealed[:covered] {
+		if err = os.Remove(segmentName(l.config.Filename, id)); err != nil {
+			return fmt.Errorf("cant remove truncated segment: %w", err)
+		}
+	}
+	l.logger.Printf("%d log segments truncated before sequence %d", covered, seq)
+
+	return nil
 }
 
-func (l *FileTransactionLogger) WritePut(key, value string) {
+func (l *FileTransactionLogger) WritePut(key, value string) error {
 	l.logger.Printf("write put: {%s: %s}", key, value)
 
-	l.events <- transactionlogger.Event{
+	return l.send(transactionlogger.Event{
 		EventType: transactionlogger.EventPut, Key: key, Value: value,
-	}
+	})
 }
 
-func (l *FileTransactionLogger) WriteDelete(key string) {
+func (l *FileTransactionLogger) WritePutWithTTL(key, value string, expires time.Time) error {
+	l.logger.Printf("write put: {%s: %s} expires: %s", key, value, expires)
+
+	return l.send(transactionlogger.Event{
+		EventType: transactionlogger.EventPut, Key: key, Value: value, Expires: expires.UnixNano(),
+	})
+}
+
+func (l *FileTransactionLogger) WriteDelete(key string) error {
 	l.logger.Printf("write delete {%s}", key)
 
-	l.events <- transactionlogger.Event{
+	return l.send(transactionlogger.Event{
 		EventType: transactionlogger.EventDelete, Key: key,
-	}
+	})
+}
+
+// WriteGroup writes the events as one record, so replay applies all or none of them.
+func (l *FileTransactionLogger) WriteGroup(events []transactionlogger.Event) error {
+	l.logger.Printf("write group of %d events", len(events))
+
+	return l.send(events...)
 }
 
 func (l *FileTransactionLogger) Err() <-chan error {
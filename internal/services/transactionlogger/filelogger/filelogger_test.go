@@ -1,3 +1,284 @@
 package filelogger_test
 
-// TODO
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger/filelogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = log.New(io.Discard, "", log.Lshortfile|log.Ltime|log.Lmicroseconds|log.Ldate)
+
+func readAll(t *testing.T, filename string) ([]transactionlogger.Event, error) {
+	t.Helper()
+
+	l, err := filelogger.New(logger, filelogger.Config{Filename: filename})
+	require.NoError(t, err)
+
+	result := []transactionlogger.Event{}
+	events, errs := l.ReadEvents()
+	for e := range events {
+		result = append(result, e)
+	}
+
+	return result, <-errs
+}
+
+// waitEvents waits until the running logger has written n events to the file.
+func waitEvents(t *testing.T, filename string, n int) []transactionlogger.Event {
+	t.Helper()
+
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		if events, err := readAll(t, filename); err == nil && len(events) == n {
+			return events
+		}
+	}
+	t.Fatalf("log has no %d events", n)
+	return nil
+}
+
+func writeEvents(t *testing.T, filename string) {
+	t.Helper()
+
+	l, err := filelogger.New(logger, filelogger.Config{Filename: filename})
+	require.NoError(t, err)
+	l.Run()
+	l.WritePut("one", "ONE")
+	l.WritePut("spaces", "value with spaces")
+	l.WritePut("lines", "line 1\nline 2\ttab\r\n")
+	l.WritePutWithTTL("session", "token", time.Unix(0, 1700000000000000000))
+	waitEvents(t, filename, 4)
+}
+
+func TestFileTransactionLogger_ReadEvents(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transaction.log")
+	writeEvents(t, filename)
+
+	events, err := readAll(t, filename)
+
+	require.NoError(t, err)
+	assert.Equal(t, []transactionlogger.Event{
+		{Sequence: 1, EventType: transactionlogger.EventPut, Key: "one", Value: "ONE"},
+		{Sequence: 2, EventType: transactionlogger.EventPut, Key: "spaces", Value: "value with spaces"},
+		{Sequence: 3, EventType: transactionlogger.EventPut, Key: "lines", Value: "line 1\nline 2\ttab\r\n"},
+		{Sequence: 4, EventType: transactionlogger.EventPut, Key: "session", Value: "token", Expires: 1700000000000000000},
+	}, events)
+}
+
+func TestFileTransactionLogger_WriteDelete(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transaction.log")
+	writeEvents(t, filename)
+
+	l, err := filelogger.New(logger, filelogger.Config{Filename: filename})
+	require.NoError(t, err)
+	events, _ := l.ReadEvents()
+	for range events {
+	}
+	l.Run()
+	l.WriteDelete("spaces")
+
+	events2 := waitEvents(t, filename, 5)
+
+	assert.Equal(t,
+		transactionlogger.Event{Sequence: 5, EventType: transactionlogger.EventDelete, Key: "spaces"},
+		events2[4],
+	)
+}
+
+func TestFileTransactionLogger_ReadEventsTornTail(t *testing.T) {
+	tests := []struct {
+		name string
+		tail []byte
+	}{
+		{"torn record header", []byte{20, 0, 0}},
+		{"torn record payload", []byte{20, 0, 0, 0, 1, 2, 3, 4, 1, 2}},
+		{"torn record with bad checksum", []byte{3, 0, 0, 0, 1, 2, 3, 4, 5, 2, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "transaction.log")
+			writeEvents(t, filename)
+			info, err := os.Stat(filename + ".000001")
+			require.NoError(t, err)
+
+			f, err := os.OpenFile(filename+".000001", os.O_WRONLY|os.O_APPEND, 0o755)
+			require.NoError(t, err)
+			_, _ = f.Write(tt.tail)
+			f.Close()
+
+			events, err := readAll(t, filename)
+
+			assert.NoError(t, err)
+			assert.Len(t, events, 4)
+			info2, err := os.Stat(filename + ".000001")
+			require.NoError(t, err)
+			assert.Equal(t, info.Size(), info2.Size())
+		})
+	}
+}
+
+func TestFileTransactionLogger_ReadEventsCorrupted(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transaction.log")
+	writeEvents(t, filename)
+
+	b, err := os.ReadFile(filename + ".000001")
+	require.NoError(t, err)
+	b[len(b)/2] ^= 0xff
+	require.NoError(t, os.WriteFile(filename+".000001", b, 0o755))
+
+	_, err = readAll(t, filename)
+
+	assert.ErrorIs(t, err, filelogger.ErrorCorruptedRecord)
+}
+
+func TestFileTransactionLogger_MigrateTextLog(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transaction.log")
+	text := strings.Join([]string{
+		"1\t2\tone\tONE",
+		"2\t2\ttwo\tTWO\t0",
+		"3\t2\tsession\ttoken\t1700000000000000000",
+		"4\t1\ttwo\t",
+		"",
+	}, "\n")
+	require.NoError(t, os.WriteFile(filename, []byte(text), 0o755))
+
+	events, err := readAll(t, filename)
+
+	require.NoError(t, err)
+	assert.Equal(t, []transactionlogger.Event{
+		{Sequence: 1, EventType: transactionlogger.EventPut, Key: "one", Value: "ONE"},
+		{Sequence: 2, EventType: transactionlogger.EventPut, Key: "two", Value: "TWO"},
+		{Sequence: 3, EventType: transactionlogger.EventPut, Key: "session", Value: "token", Expires: 1700000000000000000},
+		{Sequence: 4, EventType: transactionlogger.EventDelete, Key: "two"},
+	}, events)
+
+	b, err := os.ReadFile(filename + ".000001")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(b), "KVTL"))
+	assert.NoFileExists(t, filename)
+}
+
+func TestFileTransactionLogger_UnknownVersion(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transaction.log")
+	require.NoError(t, os.WriteFile(filename, []byte("KVTL\x09"), 0o755))
+
+	_, err := filelogger.New(logger, filelogger.Config{Filename: filename})
+
+	assert.True(t, errors.Is(err, filelogger.ErrorUnknownVersion))
+}
+
+func TestFileTransactionLogger_SyncModeAlways(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transaction.log")
+	l, err := filelogger.New(logger, filelogger.Config{Filename: filename, Sync: filelogger.SyncModeAlways})
+	require.NoError(t, err)
+	l.Run()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			assert.NoError(t, l.WritePut(key, "value"))
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	// every write has returned, so all of them are in the file
+	events, err := readAll(t, filename)
+	require.NoError(t, err)
+	assert.Len(t, events, 50)
+}
+
+func TestFileTransactionLogger_Close(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transaction.log")
+	l, err := filelogger.New(logger, filelogger.Config{Filename: filename, SyncInterval: time.Hour})
+	require.NoError(t, err)
+	l.Run()
+
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, l.WritePut(strconv.Itoa(i), "value"))
+	}
+	require.NoError(t, l.(*filelogger.FileTransactionLogger).Close())
+	require.NoError(t, l.(*filelogger.FileTransactionLogger).Close())
+	assert.ErrorIs(t, l.WritePut("late", "value"), filelogger.ErrorStopped)
+
+	// the writes sent before Close are in the file
+	events, err := readAll(t, filename)
+	require.NoError(t, err)
+	assert.Len(t, events, 1000)
+}
+
+func TestParseSyncMode(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    filelogger.SyncMode
+		wantErr error
+	}{
+		{"none", filelogger.SyncModeNone, nil},
+		{"interval", filelogger.SyncModeInterval, nil},
+		{"always", filelogger.SyncModeAlways, nil},
+		{"sometimes", 0, filelogger.ErrorUnknownSyncMode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := filelogger.ParseSyncMode(tt.s)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFileTransactionLogger_WriteGroup(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transaction.log")
+	l, err := filelogger.New(logger, filelogger.Config{Filename: filename, Sync: filelogger.SyncModeAlways})
+	require.NoError(t, err)
+	l.Run()
+	require.NoError(t, l.WritePut("one", "1"))
+	require.NoError(t, l.WriteGroup([]transactionlogger.Event{
+		{EventType: transactionlogger.EventPut, Key: "one", Value: "0"},
+		{EventType: transactionlogger.EventPut, Key: "two", Value: "1"},
+	}))
+
+	events, err := readAll(t, filename)
+	require.NoError(t, err)
+	assert.Equal(t, []transactionlogger.Event{
+		{Sequence: 1, EventType: transactionlogger.EventPut, Key: "one", Value: "1"},
+		{Sequence: 2, EventType: transactionlogger.EventPut, Key: "one", Value: "0"},
+		{Sequence: 3, EventType: transactionlogger.EventPut, Key: "two", Value: "1"},
+	}, events)
+
+	// a torn group is dropped as a whole
+	info, err := os.Stat(filename + ".000001")
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(filename+".000001", info.Size()-1))
+
+	events, err = readAll(t, filename)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestFileTransactionLogger_WriteGroupTooLarge(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transaction.log")
+	l, err := filelogger.New(logger, filelogger.Config{Filename: filename, Sync: filelogger.SyncModeAlways})
+	require.NoError(t, err)
+	l.Run()
+
+	err = l.WriteGroup([]transactionlogger.Event{
+		{EventType: transactionlogger.EventPut, Key: "big", Value: strings.Repeat("v", 1<<20)},
+	})
+
+	assert.ErrorIs(t, err, filelogger.ErrorRecordTooLarge)
+	assert.NoError(t, l.WritePut("small", "v"))
+}
@@ -0,0 +1,197 @@
+package filelogger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+)
+
+// Binary log layout:
+//
+//	header: magic "KVTL" | version byte
+//	record: payload length uint32 | payload CRC32 uint32 | payload
+//	payload: one or more events written atomically (exactly one in version 1)
+//	event: sequence uvarint | event type byte | expires varint |
+//	       key length uvarint | key | value length uvarint | value
+//
+// All fixed size integers are little endian.
+const (
+	magic            = "KVTL"
+	formatVersion    = 2
+	minFormatVersion = 1
+	headerSize       = len(magic) + 1
+
+	recordHeaderSize = 8
+	maxRecordSize    = 1 << 20
+)
+
+// legacy text format
+const (
+	// lines written before expiration support have no last field,
+	// Sscanf stops on them with io.EOF
+	readPattern = "%d\t%d\t%s\t%s\t%d"
+)
+
+var (
+	ErrorTruncatedRecord = errors.New("truncated record")
+	ErrorCorruptedRecord = errors.New("corrupted record")
+	ErrorUnknownVersion  = errors.New("unknown log format version")
+	ErrorRecordTooLarge  = fmt.Errorf("events take more than %d bytes", maxRecordSize)
+)
+
+func header() []byte {
+	return append([]byte(magic), formatVersion)
+}
+
+// checkHeader returns false if b is not a binary log header.
+func checkHeader(b []byte) (bool, error) {
+	if len(b) < headerSize || string(b[:len(magic)]) != magic {
+		return false, nil
+	}
+	if v := b[len(magic)]; v < minFormatVersion || v > formatVersion {
+		return true, fmt.Errorf("%w: %d", ErrorUnknownVersion, b[len(magic)])
+	}
+
+	return true, nil
+}
+
+// payloadSize returns the upper bound of the encoded events size.
+func payloadSize(events []transactionlogger.Event) int {
+	size := 0
+	for _, e := range events {
+		size += 4*binary.MaxVarintLen64 + 1 + len(e.Key) + len(e.Value)
+	}
+
+	return size
+}
+
+// encodeRecord makes one record of the events, so they are read all or none.
+func encodeRecord(events ...transactionlogger.Event) []byte {
+	payload := make([]byte, 0, payloadSize(events))
+	for _, e := range events {
+		payload = binary.AppendUvarint(payload, e.Sequence)
+		payload = append(payload, byte(e.EventType))
+		payload = binary.AppendVarint(payload, e.Expires)
+		payload = binary.AppendUvarint(payload, uint64(len(e.Key)))
+		payload = append(payload, e.Key...)
+		payload = binary.AppendUvarint(payload, uint64(len(e.Value)))
+		payload = append(payload, e.Value...)
+	}
+
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+
+	return append(record, payload...)
+}
+
+// readRecord returns io.EOF if there are no more records,
+// ErrorTruncatedRecord if the input ends in the middle of a record
+// and ErrorCorruptedRecord if the record checksum doesn't match.
+func readRecord(r *bufio.Reader) ([]transactionlogger.Event, int, error) {
+	var e []transactionlogger.Event
+
+	h := make([]byte, recordHeaderSize)
+	n, err := io.ReadFull(r, h)
+	if errors.Is(err, io.EOF) {
+		return e, 0, io.EOF
+	}
+	if err != nil {
+		return e, n, ErrorTruncatedRecord
+	}
+
+	size := binary.LittleEndian.Uint32(h[0:4])
+	if size > maxRecordSize {
+		return e, n, fmt.Errorf("%w: record size %d", ErrorCorruptedRecord, size)
+	}
+	payload := make([]byte, size)
+	m, err := io.ReadFull(r, payload)
+	n += m
+	if err != nil {
+		return e, n, ErrorTruncatedRecord
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(h[4:8]) {
+		return e, n, fmt.Errorf("%w: checksum mismatch", ErrorCorruptedRecord)
+	}
+
+	e, err = decodePayload(payload)
+	if err != nil {
+		return e, n, fmt.Errorf("%w: %w", ErrorCorruptedRecord, err)
+	}
+
+	return e, n, nil
+}
+
+func decodePayload(payload []byte) ([]transactionlogger.Event, error) {
+	r := bytes.NewReader(payload)
+	events := []transactionlogger.Event{}
+	for r.Len() > 0 {
+		e, err := decodeEvent(r)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if len(events) == 0 {
+		return nil, errors.New("empty record")
+	}
+
+	return events, nil
+}
+
+func decodeEvent(r *bytes.Reader) (transactionlogger.Event, error) {
+	var e transactionlogger.Event
+
+	var err error
+	if e.Sequence, err = binary.ReadUvarint(r); err != nil {
+		return e, fmt.Errorf("cant read sequence: %w", err)
+	}
+	t, err := r.ReadByte()
+	if err != nil {
+		return e, fmt.Errorf("cant read event type: %w", err)
+	}
+	e.EventType = transactionlogger.EventType(t)
+	if e.Expires, err = binary.ReadVarint(r); err != nil {
+		return e, fmt.Errorf("cant read expiration: %w", err)
+	}
+	if e.Key, err = readString(r); err != nil {
+		return e, fmt.Errorf("cant read key: %w", err)
+	}
+	if e.Value, err = readString(r); err != nil {
+		return e, fmt.Errorf("cant read value: %w", err)
+	}
+
+	return e, nil
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if size > uint64(r.Len()) {
+		return "", io.ErrUnexpectedEOF
+	}
+	b := make([]byte, size)
+	_, _ = r.Read(b)
+
+	return string(b), nil
+}
+
+// parseTextLine parses a line of the legacy text log.
+func parseTextLine(line string) (transactionlogger.Event, error) {
+	var e transactionlogger.Event
+
+	_, err := fmt.Sscanf(line, readPattern, &e.Sequence, &e.EventType, &e.Key, &e.Value, &e.Expires)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return e, fmt.Errorf("input parse error: %w", err)
+	}
+
+	return e, nil
+}
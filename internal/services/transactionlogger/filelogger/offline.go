@@ -0,0 +1,112 @@
+package filelogger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+)
+
+// The methods below are for the tools working on a log which isn't run.
+
+var (
+	ErrorOutOfSequence = errors.New("transaction numbers out of sequence")
+	ErrorTornTail      = errors.New("torn record at the end of the log")
+)
+
+// Position is where a record starts in the log.
+type Position struct {
+	Segment string
+	Offset  int64
+}
+
+// Walk passes every record of the log with its position to fn and checks
+// the sequences grow the same way ReadEvents does. Unlike ReadEvents it
+// doesn't cut a record torn by a crash at the end of the active segment,
+// it stops on it with ErrorTornTail.
+func (l *FileTransactionLogger) Walk(fn func(events []transactionlogger.Event, pos Position) error) error {
+	l.mu.Lock()
+	ids := slices.Clone(l.segments)
+	l.mu.Unlock()
+
+	var last uint64
+	for i, id := range ids {
+		name := segmentName(l.config.Filename, id)
+		s, err := openSegment(name)
+		if err != nil {
+			return fmt.Errorf("transaction log read failure in %s: %w", name, err)
+		}
+
+		for err == nil {
+			pos := Position{name, s.offset}
+			var (
+				events []transactionlogger.Event
+				isTail bool
+			)
+			events, isTail, err = s.next()
+			isTorn := errors.Is(err, ErrorTruncatedRecord) || (errors.Is(err, ErrorCorruptedRecord) && isTail)
+			switch {
+			case errors.Is(err, io.EOF):
+			case isTorn && i == len(ids)-1:
+				err = fmt.Errorf("%w in %s at offset %d: %w", ErrorTornTail, name, pos.Offset, err)
+			case err != nil:
+				err = fmt.Errorf("transaction log read failure in %s at offset %d: %w", name, pos.Offset, err)
+			default:
+				for _, e := range events {
+					if last >= e.Sequence {
+						err = fmt.Errorf("transaction log read failure in %s at offset %d: %w: %d after %d",
+							name, pos.Offset, ErrorOutOfSequence, e.Sequence, last)
+						break
+					}
+					last = e.Sequence
+				}
+				if err == nil {
+					err = fn(events, pos)
+				}
+			}
+		}
+		s.Close()
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+	}
+	l.AdvanceSequence(last)
+
+	return nil
+}
+
+// Append writes the events as one record keeping their sequences, which
+// have to be consecutive and greater than the last one in the log.
+func (l *FileTransactionLogger) Append(events []transactionlogger.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	first, last := events[0].Sequence, l.LastSequence()
+	if first <= last {
+		return fmt.Errorf("%w: %d after %d", ErrorOutOfSequence, first, last)
+	}
+	for i, e := range events {
+		if e.Sequence != first+uint64(i) {
+			return fmt.Errorf("%w: %d in a record from %d", ErrorOutOfSequence, e.Sequence, first)
+		}
+	}
+
+	l.AdvanceSequence(first - 1)
+	return l.write(slices.Clone(events)...)
+}
+
+// CompactAll seals the active segment and compacts all the segments into
+// one, dropping deletes up to keepDeletesAfter as compaction does. The log
+// has to be read first, so the sequence of new events is known.
+func (l *FileTransactionLogger) CompactAll(keepDeletesAfter uint64) error {
+	if l.size > int64(headerSize) {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	l.KeepDeletesAfter(keepDeletesAfter)
+
+	return l.compact()
+}
@@ -0,0 +1,95 @@
+package filelogger
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func put(seq uint64, key, value string) transactionlogger.Event {
+	return transactionlogger.Event{Sequence: seq, EventType: transactionlogger.EventPut, Key: key, Value: value}
+}
+
+func walk(l *FileTransactionLogger) ([][]transactionlogger.Event, []Position, error) {
+	records, positions := [][]transactionlogger.Event{}, []Position{}
+	err := l.Walk(func(events []transactionlogger.Event, pos Position) error {
+		records = append(records, events)
+		positions = append(positions, pos)
+		return nil
+	})
+
+	return records, positions, err
+}
+
+func TestFileTransactionLogger_Walk(t *testing.T) {
+	tests := []struct {
+		name        string
+		records     [][]transactionlogger.Event
+		tail        []byte
+		wantRecords int
+		wantErr     error
+	}{
+		{"valid", [][]transactionlogger.Event{{put(1, "a", "1")}, {put(2, "b", "2"), put(3, "c", "3")}}, nil, 2, nil},
+		{"out of sequence", [][]transactionlogger.Event{{put(1, "a", "1")}, {put(3, "b", "2")}, {put(2, "c", "3")}}, nil, 2, ErrorOutOfSequence},
+		{"torn tail", [][]transactionlogger.Event{{put(1, "a", "1")}}, []byte{20, 0, 0}, 1, ErrorTornTail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{Filename: filepath.Join(t.TempDir(), "transaction.log")}
+			l := newTestLogger(t, config)
+			for _, r := range tt.records {
+				_, err := l.file.Write(encodeRecord(r...))
+				require.NoError(t, err)
+			}
+			_, err := l.file.Write(tt.tail)
+			require.NoError(t, err)
+
+			records, positions, err := walk(newTestLogger(t, config))
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Len(t, records, tt.wantRecords)
+			if len(positions) > 0 {
+				assert.Equal(t, Position{segmentName(config.Filename, 1), int64(headerSize)}, positions[0])
+			}
+		})
+	}
+}
+
+func TestFileTransactionLogger_Append(t *testing.T) {
+	config := Config{Filename: filepath.Join(t.TempDir(), "transaction.log"), SegmentSize: 30}
+	l := newTestLogger(t, config)
+
+	require.NoError(t, l.Append([]transactionlogger.Event{put(3, "a", "1")}))
+	require.NoError(t, l.Append([]transactionlogger.Event{put(5, "b", "2"), put(6, "c", "3")}))
+	assert.ErrorIs(t, l.Append([]transactionlogger.Event{put(6, "d", "4")}), ErrorOutOfSequence)
+	assert.ErrorIs(t, l.Append([]transactionlogger.Event{put(7, "d", "4"), put(9, "e", "5")}), ErrorOutOfSequence)
+
+	events := readEvents(t, config)
+	assert.Equal(t, []transactionlogger.Event{put(3, "a", "1"), put(5, "b", "2"), put(6, "c", "3")}, events)
+}
+
+func TestFileTransactionLogger_CompactAll(t *testing.T) {
+	config := Config{Filename: filepath.Join(t.TempDir(), "transaction.log")}
+	l := newTestLogger(t, config)
+	for _, e := range []transactionlogger.Event{
+		{EventType: transactionlogger.EventPut, Key: "a", Value: "1"},
+		{EventType: transactionlogger.EventPut, Key: "b", Value: "1"},
+		{EventType: transactionlogger.EventPut, Key: "a", Value: "2"},
+		{EventType: transactionlogger.EventDelete, Key: "b"},
+		{EventType: transactionlogger.EventPut, Key: "c", Value: "1"},
+		{EventType: transactionlogger.EventDelete, Key: "c"},
+	} {
+		require.NoError(t, l.write(e))
+	}
+
+	require.NoError(t, l.CompactAll(5))
+
+	assert.Len(t, l.segments, 2)
+	assert.Equal(t, []transactionlogger.Event{
+		put(3, "a", "2"),
+		{Sequence: 6, EventType: transactionlogger.EventDelete, Key: "c"},
+	}, readEvents(t, config))
+}
@@ -0,0 +1,214 @@
+package filelogger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dimishpatriot/kv-storage/internal/fileutil"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+)
+
+// The log is a list of segment files "<filename>.<id>". The manifest file
+// "<filename>.manifest" keeps the ids of live segments in replay order,
+// it is replaced atomically, so any segment file missing from it is garbage
+// left by a crash and is removed on start.
+// The manifest also keeps the last sequence of the sealed segments, so the
+// sequence never goes back after they are compacted or truncated.
+
+const manifestSequencePrefix = "sequence "
+
+func segmentName(filename string, id uint64) string {
+	return fmt.Sprintf("%s.%06d", filename, id)
+}
+
+// parseSegmentName returns the id of the segment of the log with the name,
+// false if it's another file.
+func parseSegmentName(filename, name string) (uint64, bool) {
+	suffix, ok := strings.CutPrefix(name, filename+".")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(suffix, 10, 64)
+	if err != nil || segmentName(filename, id) != name {
+		return 0, false
+	}
+
+	return id, true
+}
+
+func manifestName(filename string) string {
+	return filename + ".manifest"
+}
+
+func readManifest(filename string) (ids []uint64, sequence uint64, err error) {
+	file, err := os.Open(manifestName(filename))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	ids = []uint64{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, manifestSequencePrefix) {
+			sequence, err = strconv.ParseUint(strings.TrimPrefix(line, manifestSequencePrefix), 10, 64)
+			if err != nil {
+				return nil, 0, fmt.Errorf("manifest parse error: %w", err)
+			}
+			continue
+		}
+
+		id, err := strconv.ParseUint(line, 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("manifest parse error: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("manifest read failure: %w", err)
+	}
+
+	return ids, sequence, nil
+}
+
+func writeManifest(filename string, ids []uint64, sequence uint64) error {
+	var sb strings.Builder
+	sb.WriteString(manifestSequencePrefix + strconv.FormatUint(sequence, 10) + "\n")
+	for _, id := range ids {
+		sb.WriteString(strconv.FormatUint(id, 10))
+		sb.WriteByte('\n')
+	}
+
+	return fileutil.WriteFileAtomic(manifestName(filename), []byte(sb.String()))
+}
+
+// listSegments returns ids of all segment files of the log in ascending order.
+func listSegments(filename string) ([]uint64, error) {
+	paths, err := filepath.Glob(filename + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []uint64{}
+	for _, p := range paths {
+		if id, ok := parseSegmentName(filename, p); ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+// removeGarbage removes segment and temp files which are not in the manifest,
+// other files named after the log are left alone.
+func removeGarbage(filename string, ids []uint64) error {
+	paths, err := filepath.Glob(filename + ".*")
+	if err != nil {
+		return err
+	}
+
+	live := map[string]bool{}
+	for _, id := range ids {
+		live[segmentName(filename, id)] = true
+	}
+	for _, p := range paths {
+		if isLogFile(filename, p) && !live[p] {
+			if err = os.Remove(p); err != nil {
+				return fmt.Errorf("cant remove garbage file: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isLogFile reports if the file is a segment of the log or a temp file
+// this package makes for it.
+func isLogFile(filename, name string) bool {
+	if name == manifestName(filename)+".tmp" || name == filename+".migrate" {
+		return true
+	}
+	name = strings.TrimSuffix(name, ".migrate")
+	_, ok := parseSegmentName(filename, name)
+
+	return ok
+}
+
+// segmentReader reads records of one segment.
+type segmentReader struct {
+	file   *os.File
+	reader *bufio.Reader
+	size   int64
+	offset int64
+}
+
+func openSegment(name string) (*segmentReader, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("cant open segment: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cant stat segment: %w", err)
+	}
+
+	h := make([]byte, headerSize)
+	n, err := io.ReadFull(file, h)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		file.Close()
+		return nil, fmt.Errorf("cant read segment header: %w", err)
+	}
+	if isBinary, err := checkHeader(h[:n]); !isBinary || err != nil {
+		file.Close()
+		if err == nil {
+			err = fmt.Errorf("%w: bad segment header", ErrorCorruptedRecord)
+		}
+		return nil, err
+	}
+
+	return &segmentReader{
+		file:   file,
+		reader: bufio.NewReader(file),
+		size:   info.Size(),
+		offset: int64(headerSize),
+	}, nil
+}
+
+// next returns events of the next record or io.EOF. On error offset stays
+// at the damaged record and isTail reports that it is the last one in the
+// segment, so it may be torn by a crash.
+func (s *segmentReader) next() (events []transactionlogger.Event, isTail bool, err error) {
+	events, n, err := readRecord(s.reader)
+	isTail = s.offset+int64(n) >= s.size
+	if err == nil {
+		s.offset += int64(n)
+	}
+
+	return events, isTail, err
+}
+
+// seek moves to the record at the offset.
+func (s *segmentReader) seek(offset int64) error {
+	if _, err := s.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	s.reader.Reset(s.file)
+	s.offset = offset
+
+	return nil
+}
+
+func (s *segmentReader) Close() error {
+	return s.file.Close()
+}
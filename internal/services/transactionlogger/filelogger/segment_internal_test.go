@@ -0,0 +1,178 @@
+package filelogger
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testLogger = log.New(io.Discard, "", 0)
+
+func newTestLogger(t *testing.T, config Config) *FileTransactionLogger {
+	t.Helper()
+
+	l, err := New(testLogger, config)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.(*FileTransactionLogger).file.Close() })
+
+	return l.(*FileTransactionLogger)
+}
+
+func readEvents(t *testing.T, config Config) []transactionlogger.Event {
+	t.Helper()
+
+	result := []transactionlogger.Event{}
+	events, errs := newTestLogger(t, config).ReadEvents()
+	for e := range events {
+		result = append(result, e)
+	}
+	require.NoError(t, <-errs)
+
+	return result
+}
+
+func TestFileTransactionLogger_rotate(t *testing.T) {
+	config := Config{Filename: filepath.Join(t.TempDir(), "transaction.log"), SegmentSize: 30}
+	l := newTestLogger(t, config)
+
+	for _, v := range []string{"1", "2", "3", "4"} {
+		require.NoError(t, l.write(transactionlogger.Event{EventType: transactionlogger.EventPut, Key: "key", Value: v}))
+	}
+
+	assert.Len(t, l.segments, 3)
+	ids, _, err := readManifest(config.Filename)
+	require.NoError(t, err)
+	assert.Equal(t, l.segments, ids)
+	assert.Len(t, readEvents(t, config), 4)
+}
+
+func TestFileTransactionLogger_compact(t *testing.T) {
+	config := Config{Filename: filepath.Join(t.TempDir(), "transaction.log"), SegmentSize: 1}
+	l := newTestLogger(t, config)
+
+	past, future := time.Now().Add(-time.Hour).UnixNano(), time.Now().Add(time.Hour).UnixNano()
+	for _, e := range []transactionlogger.Event{
+		{EventType: transactionlogger.EventPut, Key: "one", Value: "1"},
+		{EventType: transactionlogger.EventPut, Key: "two", Value: "2"},
+		{EventType: transactionlogger.EventPut, Key: "one", Value: "ONE"},
+		{EventType: transactionlogger.EventDelete, Key: "two"},
+		{EventType: transactionlogger.EventPut, Key: "expired", Value: "e", Expires: past},
+		{EventType: transactionlogger.EventPut, Key: "session", Value: "s", Expires: future},
+	} {
+		require.NoError(t, l.write(e))
+	}
+	sealed := l.segments[:len(l.segments)-1]
+
+	require.NoError(t, l.compact())
+
+	assert.Len(t, l.segments, 2)
+	for _, id := range sealed {
+		assert.NoFileExists(t, segmentName(config.Filename, id))
+	}
+	assert.Equal(t, []transactionlogger.Event{
+		{Sequence: 3, EventType: transactionlogger.EventPut, Key: "one", Value: "ONE"},
+		{Sequence: 6, EventType: transactionlogger.EventPut, Key: "session", Value: "s", Expires: future},
+	}, readEvents(t, config))
+
+	// nothing new to compact
+	segments := l.segments
+	require.NoError(t, l.compact())
+	assert.Equal(t, segments, l.segments)
+}
+
+func TestFileTransactionLogger_compactEverythingDeleted(t *testing.T) {
+	config := Config{Filename: filepath.Join(t.TempDir(), "transaction.log"), SegmentSize: 1}
+	l := newTestLogger(t, config)
+
+	require.NoError(t, l.write(transactionlogger.Event{EventType: transactionlogger.EventPut, Key: "one", Value: "1"}))
+	require.NoError(t, l.write(transactionlogger.Event{EventType: transactionlogger.EventDelete, Key: "one"}))
+
+	require.NoError(t, l.compact())
+
+	assert.Len(t, l.segments, 1)
+	assert.Empty(t, readEvents(t, config))
+}
+
+func TestFileTransactionLogger_openRemovesGarbage(t *testing.T) {
+	config := Config{Filename: filepath.Join(t.TempDir(), "transaction.log"), SegmentSize: 1}
+	l := newTestLogger(t, config)
+	require.NoError(t, l.write(transactionlogger.Event{EventType: transactionlogger.EventPut, Key: "one", Value: "1"}))
+
+	// a crash during compaction leaves its segment out of the manifest
+	garbage := []string{segmentName(config.Filename, 100), manifestName(config.Filename) + ".tmp"}
+	require.NoError(t, l.writeSegment(100, []transactionlogger.Event{
+		{Sequence: 1, EventType: transactionlogger.EventPut, Key: "one", Value: "garbage"},
+	}))
+	require.NoError(t, os.WriteFile(garbage[1], []byte("100\n"), 0o755))
+
+	// files of the user named after the log
+	other := []string{config.Filename + ".bak", config.Filename + ".old", config.Filename + ".1", config.Filename + ".000001.bak"}
+	for _, name := range other {
+		require.NoError(t, os.WriteFile(name, []byte("keep"), 0o755))
+	}
+
+	events := readEvents(t, config)
+
+	assert.Equal(t, []transactionlogger.Event{
+		{Sequence: 1, EventType: transactionlogger.EventPut, Key: "one", Value: "1"},
+	}, events)
+	for _, name := range garbage {
+		assert.NoFileExists(t, name)
+	}
+	for _, name := range other {
+		assert.FileExists(t, name)
+	}
+}
+
+func TestFileTransactionLogger_openWithoutManifest(t *testing.T) {
+	config := Config{Filename: filepath.Join(t.TempDir(), "transaction.log"), SegmentSize: 1}
+	l := newTestLogger(t, config)
+	require.NoError(t, l.write(transactionlogger.Event{EventType: transactionlogger.EventPut, Key: "one", Value: "1"}))
+	require.NoError(t, l.write(transactionlogger.Event{EventType: transactionlogger.EventPut, Key: "two", Value: "2"}))
+	require.NoError(t, os.Remove(manifestName(config.Filename)))
+
+	assert.Len(t, readEvents(t, config), 2)
+}
+
+func TestFileTransactionLogger_TruncateBefore(t *testing.T) {
+	config := Config{Filename: filepath.Join(t.TempDir(), "transaction.log"), SegmentSize: 1}
+	l := newTestLogger(t, config)
+	for _, e := range []transactionlogger.Event{
+		{EventType: transactionlogger.EventPut, Key: "one", Value: "1"},
+		{EventType: transactionlogger.EventPut, Key: "two", Value: "2"},
+		{EventType: transactionlogger.EventDelete, Key: "one"},
+	} {
+		require.NoError(t, l.write(e))
+	}
+
+	require.NoError(t, l.TruncateBefore(2))
+	require.NoError(t, l.compact())
+
+	assert.Equal(t, []transactionlogger.Event{
+		{Sequence: 3, EventType: transactionlogger.EventDelete, Key: "one"},
+	}, readEvents(t, config))
+	assert.Equal(t, uint64(3), newTestLogger(t, config).LastSequence())
+}
+
+func TestFileTransactionLogger_openSealsOldVersion(t *testing.T) {
+	config := Config{Filename: filepath.Join(t.TempDir(), "transaction.log")}
+	record := encodeRecord(transactionlogger.Event{Sequence: 1, EventType: transactionlogger.EventPut, Key: "one", Value: "1"})
+	require.NoError(t, os.WriteFile(segmentName(config.Filename, 1), append([]byte(magic+"\x01"), record...), 0o755))
+
+	l := newTestLogger(t, config)
+	require.NoError(t, l.write(transactionlogger.Event{EventType: transactionlogger.EventPut, Key: "two", Value: "2"}))
+
+	assert.Equal(t, []uint64{1, 2}, l.segments)
+	assert.Equal(t, uint64(1), l.sealedSequence)
+	assert.Equal(t, []transactionlogger.Event{
+		{Sequence: 1, EventType: transactionlogger.EventPut, Key: "one", Value: "1"},
+		{Sequence: 2, EventType: transactionlogger.EventPut, Key: "two", Value: "2"},
+	}, readEvents(t, config))
+}
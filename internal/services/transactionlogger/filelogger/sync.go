@@ -0,0 +1,184 @@
+package filelogger
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+)
+
+// SyncMode sets when the log is flushed to disk with fsync.
+type SyncMode int
+
+const (
+	// SyncModeNone leaves flushing to the OS, a crash may lose recent events.
+	SyncModeNone SyncMode = iota
+	// SyncModeInterval flushes every Config.SyncInterval,
+	// a crash may lose events of the last interval.
+	SyncModeInterval
+	// SyncModeAlways flushes before Write methods return. Concurrent writes
+	// are grouped into one fsync.
+	SyncModeAlways
+)
+
+const (
+	DefaultSyncInterval = 100 * time.Millisecond
+
+	maxBatchSize = 256
+)
+
+var (
+	ErrorUnknownSyncMode = errors.New("unknown sync mode")
+	ErrorStopped         = errors.New("log writer stopped")
+)
+
+// ParseSyncMode parses "none", "interval" or "always".
+func ParseSyncMode(s string) (SyncMode, error) {
+	switch s {
+	case "none":
+		return SyncModeNone, nil
+	case "interval":
+		return SyncModeInterval, nil
+	case "always":
+		return SyncModeAlways, nil
+	}
+
+	return 0, fmt.Errorf("%w: %s", ErrorUnknownSyncMode, s)
+}
+
+// request is a group of events to write in one record, done gets the write
+// result if the writer waits for it.
+type request struct {
+	events []transactionlogger.Event
+	done   chan error
+}
+
+// runWriter writes requests in batches: all requests waiting in the channel
+// are written together and share one fsync.
+func (l *FileTransactionLogger) runWriter(requests <-chan request, errors chan<- error, done chan<- struct{}) {
+	defer close(done)
+	defer l.file.Close()
+
+	var tick <-chan time.Time
+	if l.config.Sync == SyncModeInterval {
+		ticker := time.NewTicker(l.config.SyncInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	dirty := false
+	batch := make([]request, 0, maxBatchSize)
+	for {
+		var err error
+		select {
+		case r := <-requests:
+			batch = append(batch[:0], r)
+			batch = collect(batch, requests)
+			err = l.writeBatch(batch)
+			dirty = true
+		case <-tick:
+			if dirty {
+				err = l.file.Sync()
+				dirty = false
+			}
+		case <-l.closing:
+			// the requests sent before Close are waiting in the channel
+			for batch = collect(batch[:0], requests); len(batch) > 0 && err == nil; batch = collect(batch[:0], requests) {
+				err = l.writeBatch(batch)
+			}
+			if err == nil {
+				if err = l.file.Sync(); err != nil {
+					err = fmt.Errorf("cant sync segment: %w", err)
+				}
+			}
+			l.closeErr = err
+			return
+		}
+		if err != nil {
+			l.closeErr = err
+			errors <- err
+			return
+		}
+	}
+}
+
+// collect appends requests which are already waiting in the channel.
+func collect(batch []request, requests <-chan request) []request {
+	for len(batch) < cap(batch) {
+		select {
+		case r := <-requests:
+			batch = append(batch, r)
+		default:
+			return batch
+		}
+	}
+
+	return batch
+}
+
+func (l *FileTransactionLogger) writeBatch(batch []request) error {
+	var err error
+	for _, r := range batch {
+		if err = l.write(r.events...); err != nil {
+			break
+		}
+	}
+	if err == nil && l.config.Sync == SyncModeAlways {
+		if err = l.file.Sync(); err != nil {
+			err = fmt.Errorf("cant sync segment: %w", err)
+		}
+	}
+
+	for _, r := range batch {
+		if r.done != nil {
+			r.done <- err
+		}
+	}
+
+	return err
+}
+
+// send passes the events to the writer and in SyncModeAlways waits
+// until they are on disk.
+func (l *FileTransactionLogger) send(events ...transactionlogger.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	// the reader rejects larger records as corrupted
+	if payloadSize(events) > maxRecordSize {
+		return ErrorRecordTooLarge
+	}
+	r := request{events: events}
+	if l.config.Sync == SyncModeAlways {
+		r.done = make(chan error, 1)
+	}
+
+	// a stopped writer doesn't read the channel, but it may have room
+	select {
+	case <-l.stopped:
+		return ErrorStopped
+	default:
+	}
+	select {
+	case l.requests <- r:
+	case <-l.stopped:
+		return ErrorStopped
+	}
+	if r.done == nil {
+		return nil
+	}
+
+	select {
+	case err := <-r.done:
+		return err
+	case <-l.stopped:
+		// the writer may have answered right before it stopped
+		select {
+		case err := <-r.done:
+			return err
+		default:
+			return ErrorStopped
+		}
+	}
+}
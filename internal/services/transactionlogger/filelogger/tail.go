@@ -0,0 +1,130 @@
+package filelogger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+)
+
+var ErrorSequenceGone = errors.New("changes after the sequence are dropped from the log")
+
+// cursor is a position of a record boundary in a segment.
+type cursor struct {
+	id       uint64
+	offset   int64
+	sequence uint64 // of the last event before the offset
+}
+
+// Epoch identifies the log since it was opened. A crash may lose the
+// events after the last sync and their sequences go to new events, so
+// a reader of another epoch has to start over from a snapshot.
+func (l *FileTransactionLogger) Epoch() uint64 {
+	return l.epoch
+}
+
+// ReadRecordsAfter returns the records with events after the sequence,
+// up to limit events unless the first record is bigger. A reader which has
+// applied the events up to after and applies the records in order gets
+// every change. If compaction or truncation has dropped some of them it's
+// ErrorSequenceGone, and the reader has to start over from a snapshot.
+func (l *FileTransactionLogger) ReadRecordsAfter(after uint64, limit int) ([][]transactionlogger.Event, error) {
+	if after < l.horizon.Load() || after > l.LastSequence() {
+		return nil, fmt.Errorf("%w: %d", ErrorSequenceGone, after)
+	}
+
+	l.mu.Lock()
+	ids := slices.Clone(l.segments)
+	l.mu.Unlock()
+
+	// readers usually come back for the records after the previous ones
+	l.cursorMu.Lock()
+	start := l.cursor
+	l.cursorMu.Unlock()
+	first := slices.Index(ids, start.id)
+	if first < 0 || start.sequence > after {
+		first, start = 0, cursor{}
+	}
+
+	records := [][]transactionlogger.Event{}
+	n, full := 0, false
+	for _, id := range ids[first:] {
+		var offset int64
+		if id == start.id {
+			offset = start.offset
+		}
+		pos, err := l.readRecordsFrom(id, offset, func(events []transactionlogger.Event) bool {
+			if events[len(events)-1].Sequence <= after {
+				return true
+			}
+			if n > 0 && n+len(events) > limit {
+				full = true
+				return false
+			}
+			records = append(records, events)
+			n += len(events)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(records) > 0 {
+			last := records[len(records)-1]
+			l.cursorMu.Lock()
+			l.cursor = cursor{id, pos, last[len(last)-1].Sequence}
+			l.cursorMu.Unlock()
+		}
+		if full || n >= limit {
+			break
+		}
+	}
+
+	return records, nil
+}
+
+// readRecordsFrom passes the records of the segment after the offset to fn
+// until it returns false, and returns the offset after the last passed one.
+// The record being appended to the end of the active segment is left
+// for the next read.
+func (l *FileTransactionLogger) readRecordsFrom(
+	id uint64,
+	offset int64,
+	fn func([]transactionlogger.Event) bool,
+) (int64, error) {
+	name := segmentName(l.config.Filename, id)
+	s, err := openSegment(name)
+	if err != nil {
+		return 0, fmt.Errorf("transaction log read failure in %s: %w", name, err)
+	}
+	defer s.Close()
+	if offset > s.offset {
+		if err = s.seek(offset); err != nil {
+			return 0, fmt.Errorf("transaction log read failure in %s: %w", name, err)
+		}
+	}
+
+	for {
+		pos := s.offset
+		events, isTail, err := s.next()
+		if errors.Is(err, io.EOF) || (isTail && errors.Is(err, ErrorTruncatedRecord)) {
+			return pos, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("transaction log read failure in %s at offset %d: %w", name, s.offset, err)
+		}
+		if !fn(events) {
+			return pos, nil
+		}
+	}
+}
+
+// raiseHorizon moves the horizon of dropped changes up to seq.
+func (l *FileTransactionLogger) raiseHorizon(seq uint64) {
+	for last := l.horizon.Load(); last < seq; last = l.horizon.Load() {
+		if l.horizon.CompareAndSwap(last, seq) {
+			return
+		}
+	}
+}
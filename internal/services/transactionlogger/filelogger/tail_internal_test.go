@@ -0,0 +1,87 @@
+package filelogger
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTransactionLogger_ReadRecordsAfter(t *testing.T) {
+	config := Config{Filename: filepath.Join(t.TempDir(), "transaction.log"), SegmentSize: 60}
+	l := newTestLogger(t, config)
+	require.NoError(t, l.write(transactionlogger.Event{EventType: transactionlogger.EventPut, Key: "one", Value: "1"}))
+	require.NoError(t, l.write(
+		transactionlogger.Event{EventType: transactionlogger.EventPut, Key: "two", Value: "2"},
+		transactionlogger.Event{EventType: transactionlogger.EventDelete, Key: "one"},
+	))
+	require.NoError(t, l.write(transactionlogger.Event{EventType: transactionlogger.EventPut, Key: "three", Value: "3"}))
+	require.Greater(t, len(l.segments), 1)
+
+	sequences := func(records [][]transactionlogger.Event) [][]uint64 {
+		result := [][]uint64{}
+		for _, r := range records {
+			seqs := []uint64{}
+			for _, e := range r {
+				seqs = append(seqs, e.Sequence)
+			}
+			result = append(result, seqs)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name  string
+		after uint64
+		limit int
+		want  [][]uint64
+	}{
+		{"all", 0, 10, [][]uint64{{1}, {2, 3}, {4}}},
+		{"limit", 0, 2, [][]uint64{{1}}},
+		{"record over limit", 1, 1, [][]uint64{{2, 3}}},
+		{"from cursor", 3, 10, [][]uint64{{4}}},
+		{"before cursor", 1, 10, [][]uint64{{2, 3}, {4}}},
+		{"nothing new", 4, 10, [][]uint64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := l.ReadRecordsAfter(tt.after, tt.limit)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, sequences(got))
+		})
+	}
+
+	_, err := l.ReadRecordsAfter(5, 10)
+	assert.ErrorIs(t, err, ErrorSequenceGone)
+}
+
+func TestFileTransactionLogger_ReadRecordsAfterDropped(t *testing.T) {
+	config := Config{Filename: filepath.Join(t.TempDir(), "transaction.log"), SegmentSize: 1}
+	l := newTestLogger(t, config)
+	for _, e := range []transactionlogger.Event{
+		{EventType: transactionlogger.EventPut, Key: "one", Value: "1"},
+		{EventType: transactionlogger.EventPut, Key: "two", Value: "2"},
+		{EventType: transactionlogger.EventDelete, Key: "one"},
+		{EventType: transactionlogger.EventPut, Key: "two", Value: "TWO"},
+	} {
+		require.NoError(t, l.write(e))
+	}
+
+	// the delete is dropped, a reader after 2 would keep "one"
+	require.NoError(t, l.compact())
+
+	_, err := l.ReadRecordsAfter(2, 10)
+	assert.ErrorIs(t, err, ErrorSequenceGone)
+	got, err := l.ReadRecordsAfter(3, 10)
+	require.NoError(t, err)
+	assert.Equal(t, [][]transactionlogger.Event{
+		{{Sequence: 4, EventType: transactionlogger.EventPut, Key: "two", Value: "TWO"}},
+	}, got)
+
+	// after restart the dropped changes are unknown
+	_, err = newTestLogger(t, config).ReadRecordsAfter(3, 10)
+	assert.ErrorIs(t, err, ErrorSequenceGone)
+}
@@ -1,19 +1,27 @@
 package transactionlogger
 
+import "time"
+
 //go:generate mockery --name TransactionLogger
 type TransactionLogger interface {
 	Err() <-chan error
 	ReadEvents() (<-chan Event, <-chan error)
 	Run()
-	WriteDelete(key string)
-	WritePut(key, value string)
+	// Write methods return an error if the event can't be logged,
+	// a durable logger returns only after the event is persisted.
+	WriteDelete(key string) error
+	WritePut(key, value string) error
+	WritePutWithTTL(key, value string, expires time.Time) error
+	// WriteGroup writes the events atomically: replay gets all or none of them.
+	WriteGroup(events []Event) error
 }
 
 type Event struct {
-	Sequence  uint64
-	EventType EventType
-	Key       string
-	Value     string
+	Sequence  uint64    `json:"sequence"`
+	EventType EventType `json:"type"`
+	Key       string    `json:"key"`
+	Value     string    `json:"value,omitempty"`
+	Expires   int64     `json:"expires,omitempty"` // unix time in nanoseconds, 0 if the key never expires
 }
 
 type EventType byte
@@ -2,7 +2,11 @@
 
 package transactionlogger
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	time "time"
+
+	mock "github.com/stretchr/testify/mock"
+)
 
 // MockTransactionLogger is an autogenerated mock type for the TransactionLogger type
 type MockTransactionLogger struct {
@@ -148,8 +152,17 @@ func (_c *MockTransactionLogger_Run_Call) RunAndReturn(run func()) *MockTransact
 }
 
 // WriteDelete provides a mock function with given fields: key
-func (_m *MockTransactionLogger) WriteDelete(key string) {
-	_m.Called(key)
+func (_m *MockTransactionLogger) WriteDelete(key string) error {
+	ret := _m.Called(key)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(key)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
 }
 
 // MockTransactionLogger_WriteDelete_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'WriteDelete'
@@ -170,19 +183,70 @@ func (_c *MockTransactionLogger_WriteDelete_Call) Run(run func(key string)) *Moc
 	return _c
 }
 
-func (_c *MockTransactionLogger_WriteDelete_Call) Return() *MockTransactionLogger_WriteDelete_Call {
-	_c.Call.Return()
+func (_c *MockTransactionLogger_WriteDelete_Call) Return(_a0 error) *MockTransactionLogger_WriteDelete_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockTransactionLogger_WriteDelete_Call) RunAndReturn(run func(string) error) *MockTransactionLogger_WriteDelete_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// WriteGroup provides a mock function with given fields: events
+func (_m *MockTransactionLogger) WriteGroup(events []Event) error {
+	ret := _m.Called(events)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func([]Event) error); ok {
+		r0 = rf(events)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockTransactionLogger_WriteGroup_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'WriteGroup'
+type MockTransactionLogger_WriteGroup_Call struct {
+	*mock.Call
+}
+
+// WriteGroup is a helper method to define mock.On call
+//   - events []Event
+func (_e *MockTransactionLogger_Expecter) WriteGroup(events interface{}) *MockTransactionLogger_WriteGroup_Call {
+	return &MockTransactionLogger_WriteGroup_Call{Call: _e.mock.On("WriteGroup", events)}
+}
+
+func (_c *MockTransactionLogger_WriteGroup_Call) Run(run func(events []Event)) *MockTransactionLogger_WriteGroup_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].([]Event))
+	})
+	return _c
+}
+
+func (_c *MockTransactionLogger_WriteGroup_Call) Return(_a0 error) *MockTransactionLogger_WriteGroup_Call {
+	_c.Call.Return(_a0)
 	return _c
 }
 
-func (_c *MockTransactionLogger_WriteDelete_Call) RunAndReturn(run func(string)) *MockTransactionLogger_WriteDelete_Call {
+func (_c *MockTransactionLogger_WriteGroup_Call) RunAndReturn(run func([]Event) error) *MockTransactionLogger_WriteGroup_Call {
 	_c.Call.Return(run)
 	return _c
 }
 
 // WritePut provides a mock function with given fields: key, value
-func (_m *MockTransactionLogger) WritePut(key string, value string) {
-	_m.Called(key, value)
+func (_m *MockTransactionLogger) WritePut(key string, value string) error {
+	ret := _m.Called(key, value)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(key, value)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
 }
 
 // MockTransactionLogger_WritePut_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'WritePut'
@@ -204,12 +268,56 @@ func (_c *MockTransactionLogger_WritePut_Call) Run(run func(key string, value st
 	return _c
 }
 
-func (_c *MockTransactionLogger_WritePut_Call) Return() *MockTransactionLogger_WritePut_Call {
-	_c.Call.Return()
+func (_c *MockTransactionLogger_WritePut_Call) Return(_a0 error) *MockTransactionLogger_WritePut_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockTransactionLogger_WritePut_Call) RunAndReturn(run func(string, string) error) *MockTransactionLogger_WritePut_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// WritePutWithTTL provides a mock function with given fields: key, value, expires
+func (_m *MockTransactionLogger) WritePutWithTTL(key string, value string, expires time.Time) error {
+	ret := _m.Called(key, value, expires)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, time.Time) error); ok {
+		r0 = rf(key, value, expires)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockTransactionLogger_WritePutWithTTL_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'WritePutWithTTL'
+type MockTransactionLogger_WritePutWithTTL_Call struct {
+	*mock.Call
+}
+
+// WritePutWithTTL is a helper method to define mock.On call
+//   - key string
+//   - value string
+//   - expires time.Time
+func (_e *MockTransactionLogger_Expecter) WritePutWithTTL(key interface{}, value interface{}, expires interface{}) *MockTransactionLogger_WritePutWithTTL_Call {
+	return &MockTransactionLogger_WritePutWithTTL_Call{Call: _e.mock.On("WritePutWithTTL", key, value, expires)}
+}
+
+func (_c *MockTransactionLogger_WritePutWithTTL_Call) Run(run func(key string, value string, expires time.Time)) *MockTransactionLogger_WritePutWithTTL_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string), args[2].(time.Time))
+	})
+	return _c
+}
+
+func (_c *MockTransactionLogger_WritePutWithTTL_Call) Return(_a0 error) *MockTransactionLogger_WritePutWithTTL_Call {
+	_c.Call.Return(_a0)
 	return _c
 }
 
-func (_c *MockTransactionLogger_WritePut_Call) RunAndReturn(run func(string, string)) *MockTransactionLogger_WritePut_Call {
+func (_c *MockTransactionLogger_WritePutWithTTL_Call) RunAndReturn(run func(string, string, time.Time) error) *MockTransactionLogger_WritePutWithTTL_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -4,19 +4,22 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"time"
 
 	_ "github.com/lib/pq"
 
 	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
-	"github.com/dimishpatriot/kv-storage/internal/storage/postgresstorage"
 )
 
+// DefaultTableName is the table of the append-only event log.
+const DefaultTableName = "transactions"
+
 type PostgresTransactionLogger struct {
-	events  chan<- transactionlogger.Event
-	errors  <-chan error
-	db      *sql.DB
-	logger  *log.Logger
-	storage *postgresstorage.PostgresStorage
+	events chan<- []transactionlogger.Event // a group is inserted in one transaction
+	errors <-chan error
+	db     *sql.DB
+	logger *log.Logger
+	table  string
 }
 
 type PostgresDBParams struct {
@@ -31,28 +34,135 @@ func New(
 	logger *log.Logger,
 	dbParams PostgresDBParams,
 ) (transactionlogger.TransactionLogger, *sql.DB, error) {
+	db, err := Connect(dbParams)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return NewWithDB(logger, db, DefaultTableName), db, nil
+}
+
+// NewWithDB makes a logger which appends events to the table of db,
+// the table is made by the migrations.
+func NewWithDB(logger *log.Logger, db *sql.DB, table string) *PostgresTransactionLogger {
+	return &PostgresTransactionLogger{
+		logger: logger,
+		db:     db,
+		table:  table,
+	}
+}
+
+// append inserts the events in one transaction, sequences are assigned by the table.
+func (l *PostgresTransactionLogger) append(events []transactionlogger.Event) error {
+	q := fmt.Sprintf(`
+	INSERT INTO %s 
+	(event_type, key, value) 
+	VALUES ($1, $2, $3)
+	`, l.table)
+
+	tx, err := l.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, e := range events {
+		if _, err = tx.Exec(q, e.EventType, e.Key, e.Value); err != nil {
+			return fmt.Errorf("failed to insert event: %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit events: %w", err)
+	}
+
+	return nil
+}
+
+func (l *PostgresTransactionLogger) readAll() ([]transactionlogger.Event, error) {
+	q := fmt.Sprintf(`
+	SELECT sequence, event_type, key, value FROM %s 
+	ORDER BY sequence
+	`, l.table)
+	result := []transactionlogger.Event{}
+
+	rows, err := l.db.Query(q)
+	if err != nil {
+		return nil, fmt.Errorf("get all events error: %w", err)
+	}
+	defer rows.Close()
+
+	e := transactionlogger.Event{}
+	for rows.Next() {
+		err = rows.Scan(&e.Sequence, &e.EventType, &e.Key, &e.Value)
+		if err != nil {
+			return nil, fmt.Errorf("error reading row: %w", err)
+		}
+		result = append(result, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("fail to read transaction log: %w", err)
+	}
+
+	return result, nil
+}
+
+// LastSequence returns the sequence of the last event, 0 if there is none.
+func (l *PostgresTransactionLogger) LastSequence() (uint64, error) {
+	q := fmt.Sprintf(`
+	SELECT COALESCE(MAX(sequence), 0) FROM %s
+	`, l.table)
+
+	var seq uint64
+	if err := l.db.QueryRow(q).Scan(&seq); err != nil {
+		return 0, fmt.Errorf("failed to get last sequence: %w", err)
+	}
+
+	return seq, nil
+}
+
+// KeysChangedAfter returns the keys of up to limit events after the sequence,
+// logged by any instance, and the sequence of the last of them.
+func (l *PostgresTransactionLogger) KeysChangedAfter(after uint64, limit int) ([]string, uint64, error) {
+	q := fmt.Sprintf(`
+	SELECT sequence, key FROM %s
+	WHERE sequence>$1
+	ORDER BY sequence
+	LIMIT $2
+	`, l.table)
+
+	rows, err := l.db.Query(q, after, limit)
+	if err != nil {
+		return nil, after, fmt.Errorf("get changed keys error: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var k string
+		if err = rows.Scan(&after, &k); err != nil {
+			return nil, after, fmt.Errorf("error reading row: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, after, fmt.Errorf("fail to read changed keys: %w", err)
+	}
+
+	return keys, after, nil
+}
+
+// Connect opens the database and checks the connection.
+func Connect(dbParams PostgresDBParams) (*sql.DB, error) {
 	connString := fmt.Sprintf(
 		"postgres://%s:%s@%s/%s?sslmode=%s",
 		dbParams.User, dbParams.Password, dbParams.Host, dbParams.DBName, dbParams.SSLMode,
 	)
 	db, err := getDBConnection(connString)
 	if err != nil {
-		return nil, nil, fmt.Errorf("cant get db: %w", err)
+		return nil, fmt.Errorf("cant get db: %w", err)
 	}
-	storage := postgresstorage.New(db, "transactions")
 
-	if exists := storage.VerifyTableExists(); !exists {
-		err = storage.CreateTable()
-		if err != nil {
-			return nil, nil, fmt.Errorf("can't create table: %w", err)
-		}
-	}
-
-	return &PostgresTransactionLogger{
-		logger:  logger,
-		db:      db,
-		storage: storage,
-	}, db, nil
+	return db, nil
 }
 
 func getDBConnection(connStr string) (*sql.DB, error) {
@@ -71,24 +181,16 @@ func (l *PostgresTransactionLogger) Run() {
 
 	l.logger.Println("dataLogger run...")
 
-	events := make(chan transactionlogger.Event, 16)
+	events := make(chan []transactionlogger.Event, 16)
 	l.events = events
 	errors := make(chan error, 1)
 	l.errors = errors
 
 	go func() {
-		for event := range events {
-			switch event.EventType {
-			case transactionlogger.EventPut:
-				if err = l.storage.Put(event.Key, event.Value); err != nil {
-					errors <- err
-					return
-				}
-			case transactionlogger.EventDelete:
-				if err = l.storage.Delete(event.Key); err != nil {
-					errors <- err
-					return
-				}
+		for group := range events {
+			if err = l.append(group); err != nil {
+				errors <- err
+				return
 			}
 		}
 	}()
@@ -104,7 +206,7 @@ func (l *PostgresTransactionLogger) ReadEvents() (<-chan transactionlogger.Event
 		defer close(outEvent)
 		defer close(outError)
 
-		res, err := l.storage.GetAll()
+		res, err := l.readAll()
 		if err != nil {
 			outError <- err
 		}
@@ -116,20 +218,44 @@ func (l *PostgresTransactionLogger) ReadEvents() (<-chan transactionlogger.Event
 	return outEvent, outError
 }
 
-func (l *PostgresTransactionLogger) WritePut(key, value string) {
+func (l *PostgresTransactionLogger) WritePut(key, value string) error {
 	l.logger.Printf("write put: {%s: %s}", key, value)
 
-	l.events <- transactionlogger.Event{
+	l.events <- []transactionlogger.Event{{
 		EventType: transactionlogger.EventPut, Key: key, Value: value,
-	}
+	}}
+
+	return nil
 }
 
-func (l *PostgresTransactionLogger) WriteDelete(key string) {
+func (l *PostgresTransactionLogger) WritePutWithTTL(key, value string, expires time.Time) error {
+	l.logger.Printf("write put: {%s: %s} expires: %s", key, value, expires)
+
+	l.events <- []transactionlogger.Event{{
+		EventType: transactionlogger.EventPut, Key: key, Value: value, Expires: expires.UnixNano(),
+	}}
+
+	return nil
+}
+
+func (l *PostgresTransactionLogger) WriteDelete(key string) error {
 	l.logger.Printf("write delete {%s}", key)
 
-	l.events <- transactionlogger.Event{
+	l.events <- []transactionlogger.Event{{
 		EventType: transactionlogger.EventDelete, Key: key,
+	}}
+
+	return nil
+}
+
+func (l *PostgresTransactionLogger) WriteGroup(events []transactionlogger.Event) error {
+	l.logger.Printf("write group of %d events", len(events))
+
+	if len(events) > 0 {
+		l.events <- events
 	}
+
+	return nil
 }
 
 func (l *PostgresTransactionLogger) Err() <-chan error {
@@ -1,3 +1,92 @@
 package postgreslogger_test
 
-// TODO
+import (
+	"database/sql"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/migrations"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger/postgreslogger"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = log.New(io.Discard, "", 0)
+
+func readAll(t *testing.T, l transactionlogger.TransactionLogger) []transactionlogger.Event {
+	t.Helper()
+
+	result := []transactionlogger.Event{}
+	events, errs := l.ReadEvents()
+	for e := range events {
+		result = append(result, e)
+	}
+	require.NoError(t, <-errs)
+
+	return result
+}
+
+func TestPostgresTransactionLogger_AppendOnly(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = migrations.Apply(db, migrations.SQLite)
+	require.NoError(t, err)
+
+	l := postgreslogger.NewWithDB(logger, db, postgreslogger.DefaultTableName)
+	l.Run()
+	require.NoError(t, l.WritePut("one", "1"))
+	require.NoError(t, l.WritePut("one", "ONE"))
+	require.NoError(t, l.WriteDelete("one"))
+
+	want := []transactionlogger.Event{
+		{Sequence: 1, EventType: transactionlogger.EventPut, Key: "one", Value: "1"},
+		{Sequence: 2, EventType: transactionlogger.EventPut, Key: "one", Value: "ONE"},
+		{Sequence: 3, EventType: transactionlogger.EventDelete, Key: "one"},
+	}
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual(want, readAll(t, l))
+	}, time.Second, time.Millisecond)
+}
+
+func TestPostgresTransactionLogger_KeysChangedAfter(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = migrations.Apply(db, migrations.SQLite)
+	require.NoError(t, err)
+
+	l := postgreslogger.NewWithDB(logger, db, postgreslogger.DefaultTableName)
+	seq, err := l.LastSequence()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), seq)
+
+	l.Run()
+	require.NoError(t, l.WritePut("a", "1"))
+	require.NoError(t, l.WriteDelete("b"))
+	require.NoError(t, l.WritePut("c", "3"))
+	assert.Eventually(t, func() bool {
+		seq, _ = l.LastSequence()
+		return seq == 3
+	}, time.Second, time.Millisecond)
+
+	keys, last, err := l.KeysChangedAfter(1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, keys)
+	assert.Equal(t, uint64(2), last)
+
+	keys, last, err = l.KeysChangedAfter(last, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, keys)
+	assert.Equal(t, uint64(3), last)
+
+	keys, last, err = l.KeysChangedAfter(last, 10)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	assert.Equal(t, uint64(3), last)
+}
@@ -0,0 +1,58 @@
+package transactionlogger
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+// Replay applies the logged event to the storage. It can be applied again:
+// a delete of an absent key is fine, a put which has expired since
+// it was logged deletes the key.
+func Replay(s storage.Storage, e Event) error {
+	var err error
+	switch e.EventType {
+	case EventDelete:
+		err = s.Delete(e.Key)
+	case EventPut:
+		err = replayPut(s, e)
+	}
+	if errors.Is(err, storage.ErrorNoSuchKey) {
+		return nil
+	}
+
+	return err
+}
+
+func replayPut(s storage.Storage, e Event) error {
+	if e.Expires == 0 {
+		return s.Put(e.Key, e.Value)
+	}
+
+	ttl := time.Until(time.Unix(0, e.Expires))
+	if ttl > 0 {
+		return s.PutWithTTL(e.Key, e.Value, ttl)
+	}
+
+	return s.Delete(e.Key)
+}
+
+// ReplayAfter applies the logged events after the sequence to the storage,
+// the events of a snapshot taken at the sequence are skipped.
+func ReplayAfter(l TransactionLogger, s storage.Storage, after uint64) error {
+	events, errs := l.ReadEvents()
+
+	for e := range events {
+		if e.Sequence <= after {
+			continue
+		}
+		// the snapshot may be taken after the event was applied
+		if err := Replay(s, e); err != nil {
+			return fmt.Errorf("cant restore event %d: %w", e.Sequence, err)
+		}
+	}
+
+	return <-errs
+}
@@ -0,0 +1,222 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+)
+
+const (
+	DefaultHistory = 10000
+	DefaultBuffer  = 256
+
+	// an event sequence is the epoch of the hub in the high bits
+	// and the number of the event in the process in the low ones
+	counterBits = 40
+	counterMask = 1<<counterBits - 1
+)
+
+var (
+	ErrorSequenceGone = errors.New("sequence is out of watch history")
+	ErrorSlowConsumer = errors.New("subscriber is too slow")
+	ErrorClosed       = errors.New("subscription is closed")
+)
+
+type Config struct {
+	History int // number of the latest events a subscriber can resume from
+	Buffer  int // number of events waiting for a subscriber before it's dropped
+}
+
+// Hub is a transaction logger which passes the events written by the
+// wrapped logger to the subscribers.
+// The events get their own sequence numbers with a random epoch of the
+// process, so a sequence of the previous run is never taken for a new one.
+type Hub struct {
+	transactionlogger.TransactionLogger
+	logger *log.Logger
+	config Config
+	epoch  uint64 // shifted to the high bits
+
+	mu          sync.Mutex
+	count       uint64                    // of the published events
+	history     []transactionlogger.Event // ring buffer
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription receives the events of keys with the prefix.
+type Subscription struct {
+	hub    *Hub
+	prefix string
+	events chan transactionlogger.Event
+	err    error // why the events are closed, set under hub.mu
+}
+
+func New(logger *log.Logger, tLogger transactionlogger.TransactionLogger, config Config) *Hub {
+	if config.History <= 0 {
+		config.History = DefaultHistory
+	}
+	if config.Buffer <= 0 {
+		config.Buffer = DefaultBuffer
+	}
+
+	return &Hub{
+		TransactionLogger: tLogger,
+		logger:            logger,
+		config:            config,
+		epoch:             uint64(rand.Int63n(1<<(64-counterBits)-1)+1) << counterBits,
+		history:           make([]transactionlogger.Event, 0, config.History),
+		subscribers:       map[*Subscription]struct{}{},
+	}
+}
+
+// WriteDelete implements TransactionLogger, the event is published
+// only if it's logged.
+func (h *Hub) WriteDelete(key string) error {
+	if err := h.TransactionLogger.WriteDelete(key); err != nil {
+		return err
+	}
+	h.publish(transactionlogger.Event{EventType: transactionlogger.EventDelete, Key: key})
+
+	return nil
+}
+
+// WritePut implements TransactionLogger.
+func (h *Hub) WritePut(key, value string) error {
+	if err := h.TransactionLogger.WritePut(key, value); err != nil {
+		return err
+	}
+	h.publish(transactionlogger.Event{EventType: transactionlogger.EventPut, Key: key, Value: value})
+
+	return nil
+}
+
+// WritePutWithTTL implements TransactionLogger.
+func (h *Hub) WritePutWithTTL(key, value string, expires time.Time) error {
+	if err := h.TransactionLogger.WritePutWithTTL(key, value, expires); err != nil {
+		return err
+	}
+	h.publish(transactionlogger.Event{
+		EventType: transactionlogger.EventPut,
+		Key:       key,
+		Value:     value,
+		Expires:   expires.UnixNano(),
+	})
+
+	return nil
+}
+
+// WriteGroup implements TransactionLogger.
+func (h *Hub) WriteGroup(events []transactionlogger.Event) error {
+	if err := h.TransactionLogger.WriteGroup(events); err != nil {
+		return err
+	}
+	h.publish(events...)
+
+	return nil
+}
+
+// Subscribe returns a subscription to the events of keys with the prefix
+// after the sequence, 0 means the new events only. A sequence of another
+// epoch is gone: the events after it may have been lost on restart.
+func (h *Hub) Subscribe(prefix string, after uint64) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	missed := []transactionlogger.Event{}
+	if after > 0 {
+		n := after & counterMask
+		oldest := h.count - uint64(len(h.history)) + 1
+		if after&^counterMask != h.epoch || n > h.count || n+1 < oldest {
+			return nil, fmt.Errorf("%w: %d", ErrorSequenceGone, after)
+		}
+		for n++; n <= h.count; n++ {
+			e := h.history[(n-1)%uint64(h.config.History)]
+			if strings.HasPrefix(e.Key, prefix) {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	s := &Subscription{
+		hub:    h,
+		prefix: prefix,
+		events: make(chan transactionlogger.Event, h.config.Buffer+len(missed)),
+	}
+	for _, e := range missed {
+		s.events <- e
+	}
+	h.subscribers[s] = struct{}{}
+
+	return s, nil
+}
+
+// Sequence returns the sequence of the last event, to resume from it.
+func (h *Hub) Sequence() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.epoch | h.count
+}
+
+func (h *Hub) publish(events ...transactionlogger.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, e := range events {
+		h.count++
+		e.Sequence = h.epoch | h.count
+		if len(h.history) < h.config.History {
+			h.history = append(h.history, transactionlogger.Event{})
+		}
+		h.history[(h.count-1)%uint64(h.config.History)] = e
+
+		for s := range h.subscribers {
+			if !strings.HasPrefix(e.Key, s.prefix) {
+				continue
+			}
+			select {
+			case s.events <- e:
+			default:
+				h.logger.Printf("watch of {%s} dropped: %d events behind\n", s.prefix, len(s.events))
+				h.remove(s, ErrorSlowConsumer)
+			}
+		}
+	}
+}
+
+// remove must be called under h.mu.
+func (h *Hub) remove(s *Subscription, err error) {
+	if _, ok := h.subscribers[s]; !ok {
+		return
+	}
+	delete(h.subscribers, s)
+	s.err = err
+	close(s.events)
+}
+
+// Events returns the events channel, it's closed when the subscription
+// is dropped or closed.
+func (s *Subscription) Events() <-chan transactionlogger.Event {
+	return s.events
+}
+
+// Err returns why the events channel is closed.
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	return s.err
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.remove(s, ErrorClosed)
+}
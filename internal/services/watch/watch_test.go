@@ -0,0 +1,143 @@
+package watch_test
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/watch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = log.New(io.Discard, "", 0)
+
+func newHub(t *testing.T, config watch.Config) *watch.Hub {
+	tLogger := transactionlogger.NewMockTransactionLogger(t)
+	tLogger.EXPECT().WritePut(mock.Anything, mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WriteDelete(mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WritePutWithTTL(mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WriteGroup(mock.Anything).Return(nil).Maybe()
+
+	return watch.New(logger, tLogger, config)
+}
+
+func receive(t *testing.T, s *watch.Subscription, n int) []transactionlogger.Event {
+	events := []transactionlogger.Event{}
+	for i := 0; i < n; i++ {
+		select {
+		case e, ok := <-s.Events():
+			require.True(t, ok, "events are closed: %v", s.Err())
+			events = append(events, e)
+		case <-time.After(time.Second):
+			t.Fatalf("got %d events, want %d", len(events), n)
+		}
+	}
+
+	return events
+}
+
+func TestHub_Subscribe(t *testing.T) {
+	h := newHub(t, watch.Config{})
+	epoch := h.Sequence()
+	s, err := h.Subscribe("user:", 0)
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, h.WritePut("user:1", "one"))
+	require.NoError(t, h.WritePut("order:1", "one"))
+	require.NoError(t, h.WriteGroup([]transactionlogger.Event{
+		{EventType: transactionlogger.EventDelete, Key: "user:1"},
+		{EventType: transactionlogger.EventPut, Key: "user:2", Value: "two"},
+	}))
+
+	assert.Equal(t, []transactionlogger.Event{
+		{Sequence: epoch + 1, EventType: transactionlogger.EventPut, Key: "user:1", Value: "one"},
+		{Sequence: epoch + 3, EventType: transactionlogger.EventDelete, Key: "user:1"},
+		{Sequence: epoch + 4, EventType: transactionlogger.EventPut, Key: "user:2", Value: "two"},
+	}, receive(t, s, 3))
+}
+
+func TestHub_Resume(t *testing.T) {
+	h := newHub(t, watch.Config{History: 3})
+	epoch := h.Sequence()
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, h.WritePut(k, "v"))
+	}
+
+	tests := []struct {
+		name     string
+		after    uint64
+		wantKeys []string
+		wantErr  error
+	}{
+		{"in history", epoch + 3, []string{"d", "e"}, nil},
+		{"oldest in history", epoch + 2, []string{"c", "d", "e"}, nil},
+		{"last", epoch + 5, []string{}, nil},
+		{"out of history", epoch + 1, nil, watch.ErrorSequenceGone},
+		{"unknown", epoch + 6, nil, watch.ErrorSequenceGone},
+		{"previous run", 3, nil, watch.ErrorSequenceGone},
+		{"other epoch", newHub(t, watch.Config{}).Sequence() + 3, nil, watch.ErrorSequenceGone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := h.Subscribe("", tt.after)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+			defer s.Close()
+			keys := []string{}
+			for _, e := range receive(t, s, len(tt.wantKeys)) {
+				keys = append(keys, e.Key)
+			}
+			assert.Equal(t, tt.wantKeys, keys)
+		})
+	}
+}
+
+func TestHub_DropSlowConsumer(t *testing.T) {
+	h := newHub(t, watch.Config{Buffer: 2})
+	slow, err := h.Subscribe("", 0)
+	require.NoError(t, err)
+	fast, err := h.Subscribe("", 0)
+	require.NoError(t, err)
+	defer fast.Close()
+
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, h.WritePut(k, "v"))
+		receive(t, fast, 1)
+	}
+
+	assert.Len(t, receive(t, slow, 2), 2)
+	_, ok := <-slow.Events()
+	assert.False(t, ok)
+	assert.ErrorIs(t, slow.Err(), watch.ErrorSlowConsumer)
+}
+
+func TestHub_PublishLoggedOnly(t *testing.T) {
+	errWrite := errors.New("disk is full")
+	tLogger := transactionlogger.NewMockTransactionLogger(t)
+	tLogger.EXPECT().WritePut("failed", mock.Anything).Return(errWrite)
+	tLogger.EXPECT().WriteGroup(mock.Anything).Return(errWrite)
+	tLogger.EXPECT().WritePut("logged", mock.Anything).Return(nil)
+	h := watch.New(logger, tLogger, watch.Config{})
+	epoch := h.Sequence()
+	s, err := h.Subscribe("", 0)
+	require.NoError(t, err)
+	defer s.Close()
+
+	assert.ErrorIs(t, h.WritePut("failed", "v"), errWrite)
+	assert.ErrorIs(t, h.WriteGroup([]transactionlogger.Event{{EventType: transactionlogger.EventDelete, Key: "failed"}}), errWrite)
+	require.NoError(t, h.WritePut("logged", "v"))
+
+	assert.Equal(t, []transactionlogger.Event{
+		{Sequence: epoch + 1, EventType: transactionlogger.EventPut, Key: "logged", Value: "v"},
+	}, receive(t, s, 1))
+	assert.Equal(t, epoch+1, h.Sequence())
+}
@@ -1,12 +1,102 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 //go:generate mockery --name Storage
 type Storage interface {
 	Put(string, string) error
+	PutWithTTL(string, string, time.Duration) error
+	PutIfAbsent(string, string) error
+	CompareAndSwap(key, expected, new string) error
 	Get(string) (string, error)
 	Delete(string) error
+	// Scan returns up to limit (all if limit <= 0) keys with the prefix
+	// in ascending order, starting after the startAfter key.
+	Scan(prefix, startAfter string, limit int) ([]string, error)
+	// Apply applies all operations in order or none of them. A failed check
+	// returns ErrorConditionFailed wrapped with the operation index.
+	Apply(ops []Op) error
+	// Batch applies puts, deletes and gets one by one, not atomically.
+	// A result has ErrorNoSuchKey for a get or delete of an absent key,
+	// the error is returned only if the storage fails.
+	Batch(ops []Op) ([]Result, error)
 }
 
-var ErrorNoSuchKey = errors.New("no such key")
+// Expirer is a storage whose keys can expire, Storage.PutWithTTL of the
+// others returns ErrorNotSupported.
+type Expirer interface {
+	// Expire sets the ttl of an existing key and returns its value.
+	Expire(key string, ttl time.Duration) (string, error)
+	// TTL returns how long the key lives, 0 if it never expires.
+	TTL(key string) (time.Duration, error)
+	// GetWithTTL returns the value and the TTL of the key at once.
+	GetWithTTL(key string) (string, time.Duration, error)
+}
+
+// Clocked is a storage whose keys can expire by a given time instead of
+// the clock, so the replicas applying the same changes agree on them.
+type Clocked interface {
+	// At returns the storage whose operations check and set expiry as of now,
+	// it's an Expirer too.
+	At(now time.Time) Storage
+	// Expired returns up to limit keys expired as of now, they are kept
+	// until deleted by DeleteExpired.
+	Expired(now time.Time, limit int) []string
+	// DeleteExpired deletes the key only if it's expired as of now, so
+	// a key put again after it has expired is kept.
+	DeleteExpired(key string, now time.Time)
+}
+
+type OpType byte
+
+const (
+	_ OpType = iota
+	// OpPut puts Value, the key never expires after it.
+	OpPut
+	// OpDelete deletes the key, an absent key is not an error.
+	OpDelete
+	// OpCheck fails if the key doesn't have Value.
+	OpCheck
+	// OpCheckAbsent fails if the key exists.
+	OpCheckAbsent
+	// OpGet gets the value, in batches only.
+	OpGet
+)
+
+// Op is an operation of a transaction or a batch.
+type Op struct {
+	Type  OpType
+	Key   string
+	Value string
+}
+
+// Result is the result of a batch operation, Value is set for OpGet.
+type Result struct {
+	Value string
+	Err   error
+}
+
+// Item is a stored key with its value, Expires is unix nanoseconds or 0
+// if the key never expires.
+type Item struct {
+	Key     string
+	Value   string
+	Expires int64
+}
+
+var (
+	ErrorNoSuchKey       = errors.New("no such key")
+	ErrorConditionFailed = errors.New("condition failed")
+	ErrorInvalidTTL      = errors.New("ttl must be positive")
+	ErrorNotSupported    = errors.New("operation not supported by storage")
+	ErrorUnknownOp       = errors.New("unknown operation")
+)
+
+// OpFailed reports that the operation i of a transaction has failed.
+func OpFailed(i int, err error) error {
+	return fmt.Errorf("operation %d: %w", i, err)
+}
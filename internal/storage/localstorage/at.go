@@ -0,0 +1,193 @@
+package localstorage
+
+import (
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+// At implements storage.Clocked.
+func (ls *LocalStorage) At(now time.Time) storage.Storage {
+	return &localAt{ls, now}
+}
+
+// At implements storage.Clocked.
+func (ss *ShardedStorage) At(now time.Time) storage.Storage {
+	return &shardedAt{ss, now}
+}
+
+// Expired implements storage.Clocked.
+func (ls *LocalStorage) Expired(now time.Time, limit int) []string {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	return ls.appendExpired(nil, now, limit)
+}
+
+// appendExpired appends up to limit keys expired as of now to keys,
+// it must be called with the lock held.
+func (ls *LocalStorage) appendExpired(keys []string, now time.Time, limit int) []string {
+	for k := range ls.expires {
+		if len(keys) >= limit {
+			break
+		}
+		if ls.isExpired(k, now) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// DeleteExpired implements storage.Clocked.
+func (ls *LocalStorage) DeleteExpired(k string, now time.Time) {
+	ls.Lock()
+	defer ls.Unlock()
+	if ls.isExpired(k, now) {
+		ls.remove(k)
+	}
+}
+
+// Expired implements storage.Clocked.
+func (ss *ShardedStorage) Expired(now time.Time, limit int) []string {
+	var keys []string
+	for _, s := range ss.shards {
+		s.RLock()
+		keys = s.appendExpired(keys, now, limit)
+		s.RUnlock()
+	}
+
+	return keys
+}
+
+// DeleteExpired implements storage.Clocked.
+func (ss *ShardedStorage) DeleteExpired(k string, now time.Time) {
+	ss.shard(k).DeleteExpired(k, now)
+}
+
+// localAt is the local storage as of the time now.
+type localAt struct {
+	ls  *LocalStorage
+	now time.Time
+}
+
+func (a *localAt) Put(k string, v string) error {
+	return a.ls.Put(k, v)
+}
+
+func (a *localAt) PutWithTTL(k string, v string, ttl time.Duration) error {
+	return a.ls.putWithTTL(k, v, ttl, a.now)
+}
+
+func (a *localAt) Expire(k string, ttl time.Duration) (string, error) {
+	return a.ls.expire(k, ttl, a.now)
+}
+
+func (a *localAt) TTL(k string) (time.Duration, error) {
+	return a.ls.ttl(k, a.now)
+}
+
+func (a *localAt) PutIfAbsent(k string, v string) error {
+	return a.ls.putIfAbsent(k, v, a.now)
+}
+
+func (a *localAt) CompareAndSwap(k, expected, new string) error {
+	return a.ls.compareAndSwap(k, expected, new, a.now)
+}
+
+func (a *localAt) Get(k string) (string, error) {
+	return a.ls.get(k, a.now)
+}
+
+func (a *localAt) GetWithTTL(k string) (string, time.Duration, error) {
+	return a.ls.getWithTTL(k, a.now)
+}
+
+func (a *localAt) Delete(k string) error {
+	return a.ls.delete(k, a.now)
+}
+
+func (a *localAt) Scan(prefix, startAfter string, limit int) ([]string, error) {
+	return a.ls.scan(prefix, startAfter, limit, a.now)
+}
+
+func (a *localAt) Apply(ops []storage.Op) error {
+	return a.ls.apply(ops, a.now)
+}
+
+func (a *localAt) Batch(ops []storage.Op) ([]storage.Result, error) {
+	return a.ls.batch(ops, a.now)
+}
+
+func (a *localAt) Items() []storage.Item {
+	return a.ls.items(a.now)
+}
+
+func (a *localAt) Load(items []storage.Item) {
+	a.ls.Lock()
+	defer a.ls.unlock()
+
+	a.ls.load(items, a.now)
+}
+
+// shardedAt is the sharded storage as of the time now.
+type shardedAt struct {
+	ss  *ShardedStorage
+	now time.Time
+}
+
+func (a *shardedAt) Put(k string, v string) error {
+	return a.ss.Put(k, v)
+}
+
+func (a *shardedAt) PutWithTTL(k string, v string, ttl time.Duration) error {
+	return a.ss.shard(k).putWithTTL(k, v, ttl, a.now)
+}
+
+func (a *shardedAt) Expire(k string, ttl time.Duration) (string, error) {
+	return a.ss.shard(k).expire(k, ttl, a.now)
+}
+
+func (a *shardedAt) TTL(k string) (time.Duration, error) {
+	return a.ss.shard(k).ttl(k, a.now)
+}
+
+func (a *shardedAt) PutIfAbsent(k string, v string) error {
+	return a.ss.shard(k).putIfAbsent(k, v, a.now)
+}
+
+func (a *shardedAt) CompareAndSwap(k, expected, new string) error {
+	return a.ss.shard(k).compareAndSwap(k, expected, new, a.now)
+}
+
+func (a *shardedAt) Get(k string) (string, error) {
+	return a.ss.shard(k).get(k, a.now)
+}
+
+func (a *shardedAt) GetWithTTL(k string) (string, time.Duration, error) {
+	return a.ss.shard(k).getWithTTL(k, a.now)
+}
+
+func (a *shardedAt) Delete(k string) error {
+	return a.ss.shard(k).delete(k, a.now)
+}
+
+func (a *shardedAt) Scan(prefix, startAfter string, limit int) ([]string, error) {
+	return a.ss.scan(prefix, startAfter, limit, a.now)
+}
+
+func (a *shardedAt) Apply(ops []storage.Op) error {
+	return a.ss.apply(ops, a.now)
+}
+
+func (a *shardedAt) Batch(ops []storage.Op) ([]storage.Result, error) {
+	return a.ss.batch(ops, a.now)
+}
+
+func (a *shardedAt) Items() []storage.Item {
+	return a.ss.items(a.now)
+}
+
+func (a *shardedAt) Load(items []storage.Item) {
+	a.ss.load(items, a.now)
+}
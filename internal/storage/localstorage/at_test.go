@@ -0,0 +1,51 @@
+package localstorage_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
+)
+
+// TestAt checks that the expiry is checked and set as of the given time,
+// not by the clock.
+func TestAt(t *testing.T) {
+	storages := map[string]storage.Storage{
+		"single":  localstorage.New(),
+		"sharded": localstorage.NewSharded(4, localstorage.Limits{}),
+	}
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			past := time.Now().Add(-time.Hour)
+			before := s.(storage.Clocked).At(past)
+			after := s.(storage.Clocked).At(past.Add(2 * time.Minute))
+
+			if err := before.PutWithTTL("key", "value", time.Minute); err != nil {
+				t.Fatalf("put with ttl: %s", err)
+			}
+			if ttl, err := before.(storage.Expirer).TTL("key"); err != nil || ttl != time.Minute {
+				t.Errorf("ttl got=%v %v, want=%v", ttl, err, time.Minute)
+			}
+			if _, err := s.Get("key"); !errors.Is(err, storage.ErrorNoSuchKey) {
+				t.Errorf("get by the clock got=%v, want=%v", err, storage.ErrorNoSuchKey)
+			}
+			if err := before.CompareAndSwap("key", "value", "new"); err != nil {
+				t.Errorf("compare and swap before expiry: %s", err)
+			}
+
+			if err := before.PutWithTTL("expiring", "value", time.Minute); err != nil {
+				t.Fatalf("put with ttl: %s", err)
+			}
+			if err := after.PutIfAbsent("expiring", "absent"); err != nil {
+				t.Errorf("put if absent after expiry: %s", err)
+			}
+			items := after.(interface{ Items() []storage.Item }).Items()
+			want := []storage.Item{{Key: "expiring", Value: "absent"}, {Key: "key", Value: "new"}}
+			if len(items) != len(want) || items[0] != want[0] || items[1] != want[1] {
+				t.Errorf("items got=%v, want=%v", items, want)
+			}
+		})
+	}
+}
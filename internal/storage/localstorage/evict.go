@@ -0,0 +1,224 @@
+package localstorage
+
+import (
+	"container/heap"
+	"container/list"
+	"expvar"
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// evictions of all local storages, published at /debug/vars
+var evictions = new(expvar.Int)
+
+func init() {
+	m := expvar.NewMap("localstorage")
+	m.Set("evictions", evictions)
+}
+
+// Limits bound a local storage, the keys picked by the evictor are removed
+// while it's over any of them. Zero limits are no limits.
+type Limits struct {
+	MaxBytes int64 // of keys and values
+	MaxKeys  int
+	Evictor  func() Evictor // NewLRU if not set
+}
+
+func (l Limits) enabled() bool {
+	return l.MaxBytes > 0 || l.MaxKeys > 0
+}
+
+// Evictor picks the keys to evict. It's called with the storage lock held,
+// Accessed with the read lock only, so concurrently.
+type Evictor interface {
+	Added(k string)
+	Accessed(k string)
+	Removed(k string)
+	Victim() (string, bool)
+}
+
+// ParseEvictor returns the evictor constructor by name: lru, lfu or random.
+func ParseEvictor(name string) (func() Evictor, error) {
+	switch name {
+	case "lru":
+		return NewLRU, nil
+	case "lfu":
+		return NewLFU, nil
+	case "random":
+		return NewRandom, nil
+	default:
+		return nil, fmt.Errorf("invalid eviction policy: %s", name)
+	}
+}
+
+// lru evicts the least recently used key.
+type lru struct {
+	mu    sync.Mutex
+	order *list.List // front is the most recent
+	keys  map[string]*list.Element
+}
+
+func NewLRU() Evictor {
+	return &lru{order: list.New(), keys: map[string]*list.Element{}}
+}
+
+func (e *lru) Added(k string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.keys[k] = e.order.PushFront(k)
+}
+
+func (e *lru) Accessed(k string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if el, ok := e.keys[k]; ok {
+		e.order.MoveToFront(el)
+	}
+}
+
+func (e *lru) Removed(k string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if el, ok := e.keys[k]; ok {
+		e.order.Remove(el)
+		delete(e.keys, k)
+	}
+}
+
+func (e *lru) Victim() (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if el := e.order.Back(); el != nil {
+		return el.Value.(string), true
+	}
+
+	return "", false
+}
+
+// lfu evicts the least frequently used key, the least recently used of them.
+type lfu struct {
+	mu    sync.Mutex
+	clock uint64
+	items lfuHeap
+	keys  map[string]*lfuItem
+}
+
+type lfuItem struct {
+	key   string
+	count uint64
+	used  uint64 // clock of the last access
+	index int
+}
+
+type lfuHeap []*lfuItem
+
+func (h lfuHeap) Len() int { return len(h) }
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].used < h[j].used
+}
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *lfuHeap) Push(x any) {
+	item := x.(*lfuItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+func (h *lfuHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+func NewLFU() Evictor {
+	return &lfu{keys: map[string]*lfuItem{}}
+}
+
+func (e *lfu) Added(k string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.clock++
+	item := &lfuItem{key: k, count: 1, used: e.clock}
+	e.keys[k] = item
+	heap.Push(&e.items, item)
+}
+
+func (e *lfu) Accessed(k string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if item, ok := e.keys[k]; ok {
+		e.clock++
+		item.count++
+		item.used = e.clock
+		heap.Fix(&e.items, item.index)
+	}
+}
+
+func (e *lfu) Removed(k string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if item, ok := e.keys[k]; ok {
+		heap.Remove(&e.items, item.index)
+		delete(e.keys, k)
+	}
+}
+
+func (e *lfu) Victim() (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.items) == 0 {
+		return "", false
+	}
+
+	return e.items[0].key, true
+}
+
+// random evicts a random key.
+type random struct {
+	mu    sync.Mutex
+	keys  []string
+	index map[string]int
+}
+
+func NewRandom() Evictor {
+	return &random{index: map[string]int{}}
+}
+
+func (e *random) Added(k string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.index[k] = len(e.keys)
+	e.keys = append(e.keys, k)
+}
+
+func (e *random) Accessed(string) {}
+
+func (e *random) Removed(k string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	i, ok := e.index[k]
+	if !ok {
+		return
+	}
+	last := e.keys[len(e.keys)-1]
+	e.keys[i] = last
+	e.index[last] = i
+	e.keys = e.keys[:len(e.keys)-1]
+	delete(e.index, k)
+}
+
+func (e *random) Victim() (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.keys) == 0 {
+		return "", false
+	}
+
+	return e.keys[rand.Intn(len(e.keys))], true
+}
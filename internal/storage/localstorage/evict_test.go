@@ -0,0 +1,276 @@
+package localstorage_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
+)
+
+func TestEvictors(t *testing.T) {
+	tests := []struct {
+		name    string
+		evictor func() localstorage.Evictor
+		want    []string // victims in order
+	}{
+		// a, b, c added, a accessed twice, b once
+		{"lru", localstorage.NewLRU, []string{"c", "b", "a"}},
+		{"lfu", localstorage.NewLFU, []string{"c", "b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.evictor()
+			for _, k := range []string{"a", "b", "c"} {
+				e.Added(k)
+			}
+			e.Accessed("a")
+			e.Accessed("b")
+			e.Accessed("a")
+
+			got := []string{}
+			for {
+				k, ok := e.Victim()
+				if !ok {
+					break
+				}
+				got = append(got, k)
+				e.Removed(k)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("victims = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvictorLFUPrefersLessFrequent(t *testing.T) {
+	e := localstorage.NewLFU()
+	e.Added("often")
+	e.Accessed("often")
+	e.Added("recent")
+
+	// recent is used later but less often
+	if k, _ := e.Victim(); k != "recent" {
+		t.Errorf("victim = %s, want recent", k)
+	}
+}
+
+func TestEvictorRandom(t *testing.T) {
+	e := localstorage.NewRandom()
+	for _, k := range []string{"a", "b", "c"} {
+		e.Added(k)
+	}
+	e.Removed("b")
+
+	for i := 0; i < 20; i++ {
+		if k, _ := e.Victim(); k != "a" && k != "c" {
+			t.Fatalf("victim = %s, want a or c", k)
+		}
+	}
+}
+
+func TestParseEvictor(t *testing.T) {
+	for _, name := range []string{"lru", "lfu", "random"} {
+		if _, err := localstorage.ParseEvictor(name); err != nil {
+			t.Errorf("ParseEvictor(%s) error = %v", name, err)
+		}
+	}
+	if _, err := localstorage.ParseEvictor("fifo"); err == nil {
+		t.Error("ParseEvictor(fifo) error = nil")
+	}
+}
+
+func TestBounded(t *testing.T) {
+	tests := []struct {
+		name        string
+		limits      localstorage.Limits
+		run         func(s storage.Storage)
+		wantKeys    []string
+		wantEvicted []string
+	}{
+		{
+			"max keys",
+			localstorage.Limits{MaxKeys: 2},
+			func(s storage.Storage) {
+				_ = s.Put("a", "1")
+				_ = s.Put("b", "2")
+				_, _ = s.Get("a")
+				_ = s.Put("c", "3")
+			},
+			[]string{"a", "c"},
+			[]string{"b"},
+		},
+		{
+			"max bytes",
+			localstorage.Limits{MaxBytes: 10},
+			func(s storage.Storage) {
+				_ = s.Put("a", "1234")
+				_ = s.Put("b", "1234")
+				// a grows over the limit
+				_ = s.Put("a", "123456")
+			},
+			[]string{"a"},
+			[]string{"b"},
+		},
+		{
+			"deleted keys free the budget",
+			localstorage.Limits{MaxBytes: 10},
+			func(s storage.Storage) {
+				_ = s.Put("a", "1234")
+				_ = s.Delete("a")
+				_ = s.Put("b", "1234")
+				_ = s.Put("c", "1234")
+			},
+			[]string{"b", "c"},
+			nil,
+		},
+		{
+			"transaction",
+			localstorage.Limits{MaxKeys: 2, Evictor: localstorage.NewLFU},
+			func(s storage.Storage) {
+				_ = s.Put("a", "1")
+				_, _ = s.Get("a")
+				_ = s.Apply([]storage.Op{
+					{Type: storage.OpPut, Key: "b", Value: "2"},
+					{Type: storage.OpPut, Key: "c", Value: "3"},
+				})
+			},
+			[]string{"a", "c"},
+			[]string{"b"},
+		},
+		{
+			"load",
+			localstorage.Limits{MaxKeys: 1},
+			func(s storage.Storage) {
+				s.(*localstorage.LocalStorage).Load([]storage.Item{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}})
+			},
+			[]string{"b"},
+			[]string{"a"},
+		},
+		{
+			"a single key over the limit stays",
+			localstorage.Limits{MaxBytes: 2},
+			func(s storage.Storage) {
+				_ = s.Put("a", "1234")
+			},
+			[]string{"a"},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := localstorage.NewBounded(tt.limits).(*localstorage.LocalStorage)
+			var evicted []string
+			s.OnEvict(func(k string) { evicted = append(evicted, k) })
+
+			tt.run(s)
+
+			keys, _ := s.Scan("", "", 0)
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("keys = %v, want %v", keys, tt.wantKeys)
+			}
+			if !reflect.DeepEqual(evicted, tt.wantEvicted) {
+				t.Errorf("evicted = %v, want %v", evicted, tt.wantEvicted)
+			}
+		})
+	}
+}
+
+func TestBoundedSharded(t *testing.T) {
+	s := localstorage.NewSharded(4, localstorage.Limits{MaxKeys: 40}).(*localstorage.ShardedStorage)
+	evicted := 0
+	s.OnEvict(func(string) { evicted++ })
+
+	for i := 0; i < 1000; i++ {
+		_ = s.Put(string(rune('a'+i%26))+string(rune('a'+i/26)), "v")
+	}
+
+	keys, _ := s.Scan("", "", 0)
+	if len(keys) > 40 || len(keys)+evicted != 1000 {
+		t.Errorf("keys = %d, evicted = %d, want at most 40 keys of 1000", len(keys), evicted)
+	}
+	for _, k := range keys {
+		if _, err := s.Get(k); errors.Is(err, storage.ErrorNoSuchKey) {
+			t.Errorf("key %s is scanned but not found", k)
+		}
+	}
+	if !slices.IsSorted(keys) {
+		t.Error("keys are not sorted")
+	}
+}
+
+// TestEvictReportedLocked checks that a put of an evicted key racing the
+// eviction is done after the eviction is reported, so it's logged later.
+func TestEvictReportedLocked(t *testing.T) {
+	storages := map[string]storage.Storage{
+		"single":  localstorage.NewBounded(localstorage.Limits{MaxKeys: 1}),
+		"sharded": localstorage.NewSharded(1, localstorage.Limits{MaxKeys: 1}),
+	}
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			log := []string{}
+			record := func(s string) {
+				mu.Lock()
+				defer mu.Unlock()
+				log = append(log, s)
+			}
+			put := make(chan struct{})
+			var raced atomic.Bool
+			s.(interface{ OnEvict(func(string)) }).OnEvict(func(k string) {
+				if raced.CompareAndSwap(false, true) {
+					go func() {
+						_ = s.Put(k, "again")
+						record("put " + k)
+						close(put)
+					}()
+					time.Sleep(20 * time.Millisecond)
+				}
+				record("delete " + k)
+			})
+
+			_ = s.Put("a", "1")
+			// the sharded storage evicts on unlock of the touched shards
+			_ = s.Apply([]storage.Op{{Type: storage.OpPut, Key: "b", Value: "2"}})
+			<-put
+
+			mu.Lock()
+			defer mu.Unlock()
+			deleted, putA := slices.Index(log, "delete a"), slices.Index(log, "put a")
+			if deleted < 0 || putA < deleted {
+				t.Errorf("log = %v, want the delete of a before its put", log)
+			}
+		})
+	}
+}
+
+// TestBoundedShardedEvictApply checks the evictions of operations on
+// several shards.
+func TestBoundedShardedEvictApply(t *testing.T) {
+	s := localstorage.NewSharded(4, localstorage.Limits{MaxKeys: 4}).(*localstorage.ShardedStorage)
+	evicted := 0
+	s.OnEvict(func(string) { evicted++ })
+
+	for i := 0; i < 10; i++ {
+		ops := []storage.Op{}
+		for j := 0; j < 8; j++ {
+			ops = append(ops, storage.Op{Type: storage.OpPut, Key: fmt.Sprintf("key-%d-%d", i, j), Value: "v"})
+		}
+		if err := s.Apply(ops); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+	}
+	s.Load([]storage.Item{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}, {Key: "c", Value: "3"}, {Key: "d", Value: "4"}, {Key: "e", Value: "5"}})
+
+	if evicted == 0 {
+		t.Error("no key is evicted")
+	}
+}
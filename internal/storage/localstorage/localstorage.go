@@ -1,50 +1,524 @@
 package localstorage
 
 import (
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/dimishpatriot/kv-storage/internal/storage"
+	"github.com/google/btree"
 )
 
-type data = map[string]string
+// btreeDegree is the degree of the key index, a node keeps up to
+// 2*degree-1 keys.
+const btreeDegree = 32
+
+type (
+	data    = map[string]string
+	expires = map[string]time.Time
+)
 
 type LocalStorage struct {
 	sync.RWMutex
-	data data
+	data    data
+	expires expires
+	keys    *btree.BTreeG[string] // keys of data in order for Scan
+
+	limits  Limits
+	evictor Evictor // nil without limits
+	size    int64   // of keys and values
+	onEvict func(key string)
 }
 
 func New() storage.Storage {
+	return NewBounded(Limits{})
+}
+
+// NewBounded returns a storage which evicts keys to stay within the limits.
+func NewBounded(limits Limits) storage.Storage {
 	data := make(map[string]string)
+	expires := make(map[string]time.Time)
+	if limits.enabled() && limits.Evictor == nil {
+		limits.Evictor = NewLRU
+	}
+	ls := &LocalStorage{data: data, expires: expires, keys: newKeys(), limits: limits}
+	ls.resetEvictor()
 
-	return &LocalStorage{data: data}
+	return ls
 }
 
 func (ls *LocalStorage) Put(k string, v string) error {
 	ls.Lock()
-	ls.data[k] = v
-	ls.Unlock()
+	ls.set(k, v)
+	delete(ls.expires, k)
+	ls.unlock()
 
 	return nil
 }
 
-func (ls *LocalStorage) Get(k string) (string, error) {
-	ls.RLock()
+func (ls *LocalStorage) PutWithTTL(k string, v string, ttl time.Duration) error {
+	return ls.putWithTTL(k, v, ttl, time.Now())
+}
+
+func (ls *LocalStorage) putWithTTL(k string, v string, ttl time.Duration, now time.Time) error {
+	if ttl <= 0 {
+		return storage.ErrorInvalidTTL
+	}
+
+	ls.Lock()
+	ls.set(k, v)
+	ls.expires[k] = now.Add(ttl)
+	ls.unlock()
+
+	return nil
+}
+
+func (ls *LocalStorage) Expire(k string, ttl time.Duration) (string, error) {
+	return ls.expire(k, ttl, time.Now())
+}
+
+func (ls *LocalStorage) expire(k string, ttl time.Duration, now time.Time) (string, error) {
+	if ttl <= 0 {
+		return "", storage.ErrorInvalidTTL
+	}
+
+	ls.Lock()
+	defer ls.Unlock()
 	v, ok := ls.data[k]
-	ls.RUnlock()
-	if !ok {
+	if !ok || ls.isExpired(k, now) {
 		return "", storage.ErrorNoSuchKey
 	}
+	ls.expires[k] = now.Add(ttl)
 
 	return v, nil
 }
 
+func (ls *LocalStorage) TTL(k string) (time.Duration, error) {
+	return ls.ttl(k, time.Now())
+}
+
+func (ls *LocalStorage) ttl(k string, now time.Time) (time.Duration, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+	if _, ok := ls.data[k]; !ok || ls.isExpired(k, now) {
+		return 0, storage.ErrorNoSuchKey
+	}
+	if t, ok := ls.expires[k]; ok {
+		return t.Sub(now), nil
+	}
+
+	return 0, nil
+}
+
+func (ls *LocalStorage) PutIfAbsent(k string, v string) error {
+	return ls.putIfAbsent(k, v, time.Now())
+}
+
+func (ls *LocalStorage) putIfAbsent(k string, v string, now time.Time) error {
+	ls.Lock()
+	defer ls.unlock()
+	if _, ok := ls.data[k]; ok && !ls.isExpired(k, now) {
+		return storage.ErrorConditionFailed
+	}
+	ls.set(k, v)
+	delete(ls.expires, k)
+
+	return nil
+}
+
+func (ls *LocalStorage) CompareAndSwap(k, expected, new string) error {
+	return ls.compareAndSwap(k, expected, new, time.Now())
+}
+
+func (ls *LocalStorage) compareAndSwap(k, expected, new string, now time.Time) error {
+	ls.Lock()
+	defer ls.unlock()
+	v, ok := ls.data[k]
+	if !ok || ls.isExpired(k, now) {
+		return storage.ErrorNoSuchKey
+	}
+	if v != expected {
+		return storage.ErrorConditionFailed
+	}
+	ls.set(k, new)
+	delete(ls.expires, k)
+
+	return nil
+}
+
+func (ls *LocalStorage) Get(k string) (string, error) {
+	return ls.get(k, time.Now())
+}
+
+func (ls *LocalStorage) get(k string, now time.Time) (string, error) {
+	v, _, err := ls.getWithTTL(k, now)
+
+	return v, err
+}
+
+func (ls *LocalStorage) GetWithTTL(k string) (string, time.Duration, error) {
+	return ls.getWithTTL(k, time.Now())
+}
+
+func (ls *LocalStorage) getWithTTL(k string, now time.Time) (string, time.Duration, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+	v, ok := ls.data[k]
+	if !ok || ls.isExpired(k, now) {
+		return "", 0, storage.ErrorNoSuchKey
+	}
+	if ls.evictor != nil {
+		ls.evictor.Accessed(k)
+	}
+	if t, ok := ls.expires[k]; ok {
+		return v, t.Sub(now), nil
+	}
+
+	return v, 0, nil
+}
+
 func (ls *LocalStorage) Delete(k string) error {
+	return ls.delete(k, time.Now())
+}
+
+func (ls *LocalStorage) delete(k string, now time.Time) error {
 	ls.Lock()
 	defer ls.Unlock()
-	if _, ok := ls.data[k]; !ok {
+	if _, ok := ls.data[k]; !ok || ls.isExpired(k, now) {
 		return storage.ErrorNoSuchKey
 	}
-	delete(ls.data, k)
+	ls.remove(k)
+
+	return nil
+}
+
+func (ls *LocalStorage) Scan(prefix, startAfter string, limit int) ([]string, error) {
+	return ls.scan(prefix, startAfter, limit, time.Now())
+}
+
+func (ls *LocalStorage) scan(prefix, startAfter string, limit int, now time.Time) ([]string, error) {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	from := prefix
+	if startAfter != "" && startAfter >= prefix {
+		from = startAfter
+	}
+
+	keys := []string{}
+	ls.keys.AscendGreaterOrEqual(from, func(k string) bool {
+		if k == startAfter {
+			return true
+		}
+		if !strings.HasPrefix(k, prefix) {
+			return false
+		}
+		if !ls.isExpired(k, now) {
+			keys = append(keys, k)
+		}
+		return limit <= 0 || len(keys) < limit
+	})
+
+	return keys, nil
+}
+
+// Apply checks and stages the operations on a copy of the touched keys
+// and changes the storage only if all of them succeed.
+func (ls *LocalStorage) Apply(ops []storage.Op) error {
+	return ls.apply(ops, time.Now())
+}
+
+func (ls *LocalStorage) apply(ops []storage.Op, now time.Time) error {
+	ls.Lock()
+	defer ls.unlock()
+
+	return applyOps(ops, func(string) *LocalStorage { return ls }, now)
+}
+
+// applyOps applies the operations to the storages the keys belong to,
+// the locks of which must be held.
+func applyOps(ops []storage.Op, shardOf func(k string) *LocalStorage, now time.Time) error {
+	staged := map[string]*string{} // nil value means deleted
+	current := func(k string) (string, bool) {
+		if v, ok := staged[k]; ok {
+			if v == nil {
+				return "", false
+			}
+			return *v, true
+		}
+		ls := shardOf(k)
+		v, ok := ls.data[k]
+		return v, ok && !ls.isExpired(k, now)
+	}
+
+	for i, op := range ops {
+		switch op.Type {
+		case storage.OpPut:
+			v := op.Value
+			staged[op.Key] = &v
+		case storage.OpDelete:
+			staged[op.Key] = nil
+		case storage.OpCheck:
+			if v, ok := current(op.Key); !ok || v != op.Value {
+				return storage.OpFailed(i, storage.ErrorConditionFailed)
+			}
+		case storage.OpCheckAbsent:
+			if _, ok := current(op.Key); ok {
+				return storage.OpFailed(i, storage.ErrorConditionFailed)
+			}
+		default:
+			return storage.OpFailed(i, storage.ErrorUnknownOp)
+		}
+	}
+
+	// in the order of the operations, so the evictor sees it
+	for _, op := range ops {
+		ls := shardOf(op.Key)
+		switch op.Type {
+		case storage.OpPut:
+			ls.set(op.Key, op.Value)
+			delete(ls.expires, op.Key)
+		case storage.OpDelete:
+			ls.remove(op.Key)
+		}
+	}
 
 	return nil
 }
+
+func (ls *LocalStorage) Batch(ops []storage.Op) ([]storage.Result, error) {
+	return ls.batch(ops, time.Now())
+}
+
+func (ls *LocalStorage) batch(ops []storage.Op, now time.Time) ([]storage.Result, error) {
+	ls.Lock()
+	defer ls.unlock()
+
+	return batchOps(ops, func(string) *LocalStorage { return ls }, now), nil
+}
+
+// batchOps runs the operations one by one on the storages the keys belong
+// to, the locks of which must be held.
+func batchOps(ops []storage.Op, shardOf func(k string) *LocalStorage, now time.Time) []storage.Result {
+	results := make([]storage.Result, len(ops))
+	for i, op := range ops {
+		ls := shardOf(op.Key)
+		_, exists := ls.data[op.Key]
+		exists = exists && !ls.isExpired(op.Key, now)
+
+		switch op.Type {
+		case storage.OpPut:
+			ls.set(op.Key, op.Value)
+			delete(ls.expires, op.Key)
+		case storage.OpDelete:
+			if !exists {
+				results[i].Err = storage.ErrorNoSuchKey
+				continue
+			}
+			ls.remove(op.Key)
+		case storage.OpGet:
+			if !exists {
+				results[i].Err = storage.ErrorNoSuchKey
+				continue
+			}
+			results[i].Value = ls.data[op.Key]
+			if ls.evictor != nil {
+				ls.evictor.Accessed(op.Key)
+			}
+		default:
+			results[i].Err = storage.ErrorUnknownOp
+		}
+	}
+
+	return results
+}
+
+// Items returns all not expired items in key order.
+func (ls *LocalStorage) Items() []storage.Item {
+	return ls.items(time.Now())
+}
+
+func (ls *LocalStorage) items(now time.Time) []storage.Item {
+	ls.RLock()
+	defer ls.RUnlock()
+
+	return ls.appendItems(make([]storage.Item, 0, len(ls.data)), now)
+}
+
+// appendItems appends the not expired items in key order to items,
+// it must be called with the lock held.
+func (ls *LocalStorage) appendItems(items []storage.Item, now time.Time) []storage.Item {
+	ls.keys.Ascend(func(k string) bool {
+		if ls.isExpired(k, now) {
+			return true
+		}
+		item := storage.Item{Key: k, Value: ls.data[k]}
+		if t, ok := ls.expires[k]; ok {
+			item.Expires = t.UnixNano()
+		}
+		items = append(items, item)
+		return true
+	})
+
+	return items
+}
+
+// Load replaces the content of the storage with items, expired ones are skipped.
+func (ls *LocalStorage) Load(items []storage.Item) {
+	ls.Lock()
+	defer ls.unlock()
+
+	ls.load(items, time.Now())
+}
+
+// load must be called with the lock held.
+func (ls *LocalStorage) load(items []storage.Item, now time.Time) {
+	ls.data = make(data, len(items))
+	ls.expires = make(expires)
+	ls.keys = newKeys()
+	ls.size = 0
+	ls.resetEvictor()
+	for _, item := range items {
+		if item.Expires != 0 && !now.Before(time.Unix(0, item.Expires)) {
+			continue
+		}
+		ls.set(item.Key, item.Value)
+		if item.Expires != 0 {
+			ls.expires[item.Key] = time.Unix(0, item.Expires)
+		}
+	}
+}
+
+// RunSweeper starts a background goroutine which removes expired keys every
+// interval and reports each removed key to onExpire. Call the returned
+// function to stop it. onExpire is called with the lock held, so a put of
+// the key racing the sweeper is logged after the expiration and wins on
+// replay, it must not call the storage.
+func (ls *LocalStorage) RunSweeper(interval time.Duration, onExpire func(key string)) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				ls.deleteExpired(now, onExpire)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// deleteExpired removes the expired keys and reports them to onExpire
+// before the lock is released.
+func (ls *LocalStorage) deleteExpired(now time.Time, onExpire func(key string)) {
+	ls.Lock()
+	defer ls.Unlock()
+
+	for k := range ls.expires {
+		if ls.isExpired(k, now) {
+			ls.remove(k)
+			onExpire(k)
+		}
+	}
+}
+
+// OnEvict sets the function evicted keys are reported to. onEvict is
+// called with the lock held, so a put of the key racing the eviction is
+// logged after it and wins on replay, it must not call the storage.
+func (ls *LocalStorage) OnEvict(onEvict func(key string)) {
+	ls.Lock()
+	defer ls.Unlock()
+	ls.onEvict = onEvict
+}
+
+// unlock evicts the keys over the limits, reports them and releases
+// the lock.
+func (ls *LocalStorage) unlock() {
+	for _, k := range ls.evict() {
+		if ls.onEvict != nil {
+			ls.onEvict(k)
+		}
+	}
+	ls.Unlock()
+}
+
+// evict must be called with the lock held. The last key is kept even if
+// it's over the limits alone.
+func (ls *LocalStorage) evict() []string {
+	if ls.evictor == nil {
+		return nil
+	}
+
+	var keys []string
+	for len(ls.data) > 1 && ls.overLimits() {
+		k, ok := ls.evictor.Victim()
+		if !ok {
+			break
+		}
+		ls.remove(k)
+		keys = append(keys, k)
+	}
+	evictions.Add(int64(len(keys)))
+
+	return keys
+}
+
+func (ls *LocalStorage) overLimits() bool {
+	return (ls.limits.MaxKeys > 0 && len(ls.data) > ls.limits.MaxKeys) ||
+		(ls.limits.MaxBytes > 0 && ls.size > ls.limits.MaxBytes)
+}
+
+func (ls *LocalStorage) resetEvictor() {
+	if ls.limits.enabled() {
+		ls.evictor = ls.limits.Evictor()
+	}
+}
+
+// set must be called with the lock held.
+func (ls *LocalStorage) set(k, v string) {
+	old, ok := ls.data[k]
+	if ok {
+		ls.size -= int64(len(old))
+		if ls.evictor != nil {
+			ls.evictor.Accessed(k)
+		}
+	} else {
+		ls.keys.ReplaceOrInsert(k)
+		ls.size += int64(len(k))
+		if ls.evictor != nil {
+			ls.evictor.Added(k)
+		}
+	}
+	ls.data[k] = v
+	ls.size += int64(len(v))
+}
+
+// remove must be called with the lock held.
+func (ls *LocalStorage) remove(k string) {
+	if v, ok := ls.data[k]; ok {
+		ls.keys.Delete(k)
+		ls.size -= int64(len(k) + len(v))
+		if ls.evictor != nil {
+			ls.evictor.Removed(k)
+		}
+	}
+	delete(ls.data, k)
+	delete(ls.expires, k)
+}
+
+// isExpired must be called with the lock held.
+func (ls *LocalStorage) isExpired(k string, now time.Time) bool {
+	t, ok := ls.expires[k]
+	return ok && !now.Before(t)
+}
+
+func newKeys() *btree.BTreeG[string] {
+	return btree.NewOrderedG[string](btreeDegree)
+}
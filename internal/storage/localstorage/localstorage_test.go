@@ -2,7 +2,9 @@ package localstorage_test
 
 import (
 	"errors"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/dimishpatriot/kv-storage/internal/storage"
 	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
@@ -143,3 +145,485 @@ func TestDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestPutWithTTL(t *testing.T) {
+	type args struct {
+		key   string
+		value string
+		ttl   time.Duration
+	}
+	type want struct {
+		err      error
+		getErr   error
+		getValue string
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			"not expired key",
+			args{key: "session", value: "token", ttl: time.Hour},
+			want{err: nil, getErr: nil, getValue: "token"},
+		},
+		{
+			"expired key",
+			args{key: "one", value: "NEW ONE", ttl: time.Nanosecond},
+			want{err: nil, getErr: storage.ErrorNoSuchKey, getValue: ""},
+		},
+		{
+			"zero ttl",
+			args{key: "one", value: "NEW ONE", ttl: 0},
+			want{err: storage.ErrorInvalidTTL, getErr: nil, getValue: "ONE"},
+		},
+		{
+			"negative ttl",
+			args{key: "absent", value: "value", ttl: -time.Second},
+			want{err: storage.ErrorInvalidTTL, getErr: storage.ErrorNoSuchKey, getValue: ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+
+			err := store.PutWithTTL(tt.args.key, tt.args.value, tt.args.ttl)
+			if !errors.Is(err, tt.want.err) {
+				t.Errorf("PutWithTTL() error = %v, wantErr %v", err, tt.want.err)
+			}
+			time.Sleep(time.Millisecond)
+
+			got, err := store.Get(tt.args.key)
+			if !errors.Is(err, tt.want.getErr) {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.want.getErr)
+			}
+			if got != tt.want.getValue {
+				t.Errorf("Get() = %s, want %s", got, tt.want.getValue)
+			}
+		})
+	}
+}
+
+func TestPutResetsTTL(t *testing.T) {
+	setupTest(t)
+
+	_ = store.PutWithTTL("one", "ONE", time.Millisecond)
+	_ = store.Put("one", "ONE")
+	time.Sleep(2 * time.Millisecond)
+
+	if got, err := store.Get("one"); err != nil || got != "ONE" {
+		t.Errorf("Get() = %s, %v, want ONE", got, err)
+	}
+}
+
+func TestExpireTTL(t *testing.T) {
+	tests := []struct {
+		name      string
+		key       string
+		ttl       time.Duration
+		wantErr   error
+		wantValue string
+		wantTTL   time.Duration // at most
+	}{
+		{"existing key", "one", time.Hour, nil, "ONE", time.Hour},
+		{"absent key", "absent", time.Hour, storage.ErrorNoSuchKey, "", 0},
+		{"invalid ttl", "one", 0, storage.ErrorInvalidTTL, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+
+			v, err := store.Expire(tt.key, tt.ttl)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expire() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if v != tt.wantValue {
+				t.Errorf("Expire() = %s, want %s", v, tt.wantValue)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if ttl, _ := store.TTL(tt.key); ttl <= 0 || ttl > tt.wantTTL {
+				t.Errorf("TTL() = %s, want up to %s", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestTTL(t *testing.T) {
+	setupTest(t)
+	_ = store.PutWithTTL("expired", "value", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if ttl, err := store.TTL("one"); err != nil || ttl != 0 {
+		t.Errorf("TTL() = %s, %v, want 0 for a key which never expires", ttl, err)
+	}
+	if _, err := store.TTL("expired"); !errors.Is(err, storage.ErrorNoSuchKey) {
+		t.Errorf("TTL() error = %v, want %v", err, storage.ErrorNoSuchKey)
+	}
+}
+
+func TestGetWithTTL(t *testing.T) {
+	setupTest(t)
+	_ = store.PutWithTTL("session", "token", time.Hour)
+	_ = store.PutWithTTL("expired", "value", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if v, ttl, err := store.GetWithTTL("one"); err != nil || v != "ONE" || ttl != 0 {
+		t.Errorf("GetWithTTL() = %s, %s, %v, want ONE, 0", v, ttl, err)
+	}
+	if v, ttl, err := store.GetWithTTL("session"); err != nil || v != "token" || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("GetWithTTL() = %s, %s, %v, want token up to %s", v, ttl, err, time.Hour)
+	}
+	if _, _, err := store.GetWithTTL("expired"); !errors.Is(err, storage.ErrorNoSuchKey) {
+		t.Errorf("GetWithTTL() error = %v, want %v", err, storage.ErrorNoSuchKey)
+	}
+}
+
+func TestRunSweeper(t *testing.T) {
+	setupTest(t)
+
+	_ = store.PutWithTTL("short", "value", time.Millisecond)
+	_ = store.PutWithTTL("long", "value", time.Hour)
+
+	expired := make(chan string, 2)
+	stop := store.RunSweeper(time.Millisecond, func(k string) { expired <- k })
+	defer stop()
+
+	select {
+	case k := <-expired:
+		if k != "short" {
+			t.Errorf("expired key = %s, want short", k)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("sweeper did not report expired key")
+	}
+
+	if _, err := store.Get("long"); err != nil {
+		t.Errorf("Get() error = %v, want nil", err)
+	}
+	if _, err := store.Get("one"); err != nil {
+		t.Errorf("Get() error = %v, want nil", err)
+	}
+}
+
+func TestRunSweeper_ReportsUnderLock(t *testing.T) {
+	setupTest(t)
+	_ = store.PutWithTTL("short", "value", time.Millisecond)
+
+	// a put of the key waits until the expiration is reported
+	locked := make(chan bool, 1)
+	stop := store.RunSweeper(time.Millisecond, func(string) {
+		unlocked := store.TryLock()
+		if unlocked {
+			store.Unlock()
+		}
+		locked <- !unlocked
+	})
+	defer stop()
+
+	select {
+	case l := <-locked:
+		if !l {
+			t.Error("onExpire called without the lock held")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("sweeper did not report expired key")
+	}
+}
+
+func TestPutIfAbsent(t *testing.T) {
+	type args struct {
+		key   string
+		value string
+	}
+	type want struct {
+		err   error
+		value string
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			"absent key",
+			args{key: "absent", value: "new"},
+			want{err: nil, value: "new"},
+		},
+		{
+			"existing key",
+			args{key: "one", value: "NEW ONE"},
+			want{err: storage.ErrorConditionFailed, value: "ONE"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+
+			err := store.PutIfAbsent(tt.args.key, tt.args.value)
+			if !errors.Is(err, tt.want.err) {
+				t.Errorf("PutIfAbsent() error = %v, wantErr %v", err, tt.want.err)
+			}
+			if got, _ := store.Get(tt.args.key); got != tt.want.value {
+				t.Errorf("Get() = %s, want %s", got, tt.want.value)
+			}
+		})
+	}
+}
+
+func TestPutIfAbsentExpired(t *testing.T) {
+	setupTest(t)
+
+	_ = store.PutWithTTL("one", "ONE", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if err := store.PutIfAbsent("one", "NEW ONE"); err != nil {
+		t.Errorf("PutIfAbsent() error = %v, wantErr nil", err)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	type args struct {
+		key      string
+		expected string
+		value    string
+	}
+	type want struct {
+		err   error
+		value string
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			"expected value",
+			args{key: "one", expected: "ONE", value: "NEW ONE"},
+			want{err: nil, value: "NEW ONE"},
+		},
+		{
+			"unexpected value",
+			args{key: "one", expected: "TWO", value: "NEW ONE"},
+			want{err: storage.ErrorConditionFailed, value: "ONE"},
+		},
+		{
+			"absent key",
+			args{key: "absent", expected: "ONE", value: "NEW ONE"},
+			want{err: storage.ErrorNoSuchKey, value: ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+
+			err := store.CompareAndSwap(tt.args.key, tt.args.expected, tt.args.value)
+			if !errors.Is(err, tt.want.err) {
+				t.Errorf("CompareAndSwap() error = %v, wantErr %v", err, tt.want.err)
+			}
+			if got, _ := store.Get(tt.args.key); got != tt.want.value {
+				t.Errorf("Get() = %s, want %s", got, tt.want.value)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	type args struct {
+		prefix     string
+		startAfter string
+		limit      int
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{
+			"all keys",
+			args{prefix: "", startAfter: "", limit: 0},
+			[]string{"0123456789", "one", "user:1", "user:2", "user:3", "users"},
+		},
+		{
+			"prefix",
+			args{prefix: "user:", startAfter: "", limit: 0},
+			[]string{"user:1", "user:2", "user:3"},
+		},
+		{
+			"prefix with limit",
+			args{prefix: "user:", startAfter: "", limit: 2},
+			[]string{"user:1", "user:2"},
+		},
+		{
+			"prefix after key",
+			args{prefix: "user:", startAfter: "user:2", limit: 2},
+			[]string{"user:3"},
+		},
+		{
+			"prefix after absent key",
+			args{prefix: "user", startAfter: "user:10", limit: 0},
+			[]string{"user:2", "user:3", "users"},
+		},
+		{
+			"after key before prefix",
+			args{prefix: "user:", startAfter: "one", limit: 0},
+			[]string{"user:1", "user:2", "user:3"},
+		},
+		{
+			"absent prefix",
+			args{prefix: "absent", startAfter: "", limit: 0},
+			[]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			for _, k := range []string{"user:3", "users", "user:1", "user:2"} {
+				_ = store.Put(k, "value")
+			}
+			_ = store.PutWithTTL("user:0", "expired", time.Nanosecond)
+			_ = store.Put("user:4", "deleted")
+			_ = store.Delete("user:4")
+			time.Sleep(time.Millisecond)
+
+			got, err := store.Scan(tt.args.prefix, tt.args.startAfter, tt.args.limit)
+			if err != nil {
+				t.Errorf("Scan() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Scan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemsLoad(t *testing.T) {
+	setupTest(t)
+	_ = store.PutWithTTL("session", "token", time.Hour)
+	_ = store.PutWithTTL("expired", "value", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	items := store.Items()
+
+	if len(items) != 3 || items[0].Key != "0123456789" || items[1].Key != "one" || items[2].Key != "session" {
+		t.Fatalf("Items() = %v, want 0123456789, one, session", items)
+	}
+	if items[1].Expires != 0 || items[2].Expires == 0 {
+		t.Errorf("Items() expires = %d, %d, want 0 and not 0", items[1].Expires, items[2].Expires)
+	}
+
+	restored := localstorage.New().(*localstorage.LocalStorage)
+	_ = restored.Put("stale", "value")
+	restored.Load(append(items, storage.Item{Key: "gone", Value: "value", Expires: 1}))
+
+	if got := restored.Items(); !reflect.DeepEqual(got, items) {
+		t.Errorf("Load() = %v, want %v", got, items)
+	}
+	if _, err := restored.Get("stale"); !errors.Is(err, storage.ErrorNoSuchKey) {
+		t.Errorf("Get() error = %v, want %v", err, storage.ErrorNoSuchKey)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     []storage.Op
+		wantErr error
+		want    map[string]string // "" means absent
+	}{
+		{
+			"move value",
+			[]storage.Op{
+				{Type: storage.OpCheck, Key: "one", Value: "ONE"},
+				{Type: storage.OpCheckAbsent, Key: "two"},
+				{Type: storage.OpPut, Key: "two", Value: "ONE"},
+				{Type: storage.OpDelete, Key: "one"},
+			},
+			nil,
+			map[string]string{"one": "", "two": "ONE"},
+		},
+		{
+			"check sees staged put",
+			[]storage.Op{
+				{Type: storage.OpPut, Key: "one", Value: "1"},
+				{Type: storage.OpCheck, Key: "one", Value: "1"},
+				{Type: storage.OpDelete, Key: "absent"},
+			},
+			nil,
+			map[string]string{"one": "1"},
+		},
+		{
+			"failed check changes nothing",
+			[]storage.Op{
+				{Type: storage.OpPut, Key: "two", Value: "2"},
+				{Type: storage.OpDelete, Key: "one"},
+				{Type: storage.OpCheck, Key: "0123456789", Value: "letters"},
+			},
+			storage.ErrorConditionFailed,
+			map[string]string{"one": "ONE", "two": ""},
+		},
+		{
+			"check absent of staged delete",
+			[]storage.Op{
+				{Type: storage.OpDelete, Key: "one"},
+				{Type: storage.OpCheckAbsent, Key: "one"},
+			},
+			nil,
+			map[string]string{"one": ""},
+		},
+		{
+			"unknown operation",
+			[]storage.Op{{Key: "one"}},
+			storage.ErrorUnknownOp,
+			map[string]string{"one": "ONE"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+
+			err := store.Apply(tt.ops)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Apply() error = %v, want %v", err, tt.wantErr)
+			}
+			for k, want := range tt.want {
+				if got, _ := store.Get(k); got != want {
+					t.Errorf("Get(%s) = %s, want %s", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBatch(t *testing.T) {
+	teardownTest := setupTest(t)
+	defer teardownTest(t)
+
+	got, err := store.Batch([]storage.Op{
+		{Type: storage.OpGet, Key: "one"},
+		{Type: storage.OpPut, Key: "two", Value: "TWO"},
+		{Type: storage.OpGet, Key: "two"},
+		{Type: storage.OpDelete, Key: "one"},
+		{Type: storage.OpDelete, Key: "one"},
+		{Type: storage.OpGet, Key: "one"},
+		{Type: storage.OpCheck, Key: "two"},
+	})
+
+	if err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+	want := []storage.Result{
+		{Value: "ONE"},
+		{},
+		{Value: "TWO"},
+		{},
+		{Err: storage.ErrorNoSuchKey},
+		{Err: storage.ErrorNoSuchKey},
+		{Err: storage.ErrorUnknownOp},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Batch() = %v, want %v", got, want)
+	}
+}
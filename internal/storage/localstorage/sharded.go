@@ -0,0 +1,240 @@
+package localstorage
+
+import (
+	"hash/fnv"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+// ShardedStorage splits the keys by hash across local storages, each with
+// its own lock, so writes of different keys mostly don't wait for each other.
+// Operations on several keys lock the shards they touch in shard order.
+type ShardedStorage struct {
+	shards []*LocalStorage
+}
+
+// NewSharded returns a storage of n shards, a single one for n < 1.
+// Every shard gets an equal part of the limits.
+func NewSharded(n int, limits Limits) storage.Storage {
+	shards := make([]*LocalStorage, max(n, 1))
+	if limits.MaxBytes > 0 {
+		limits.MaxBytes = max(limits.MaxBytes/int64(len(shards)), 1)
+	}
+	if limits.MaxKeys > 0 {
+		limits.MaxKeys = max(limits.MaxKeys/len(shards), 1)
+	}
+	for i := range shards {
+		shards[i] = NewBounded(limits).(*LocalStorage)
+	}
+
+	return &ShardedStorage{shards}
+}
+
+func (ss *ShardedStorage) Put(k string, v string) error {
+	return ss.shard(k).Put(k, v)
+}
+
+func (ss *ShardedStorage) PutWithTTL(k string, v string, ttl time.Duration) error {
+	return ss.shard(k).PutWithTTL(k, v, ttl)
+}
+
+func (ss *ShardedStorage) Expire(k string, ttl time.Duration) (string, error) {
+	return ss.shard(k).Expire(k, ttl)
+}
+
+func (ss *ShardedStorage) TTL(k string) (time.Duration, error) {
+	return ss.shard(k).TTL(k)
+}
+
+func (ss *ShardedStorage) PutIfAbsent(k string, v string) error {
+	return ss.shard(k).PutIfAbsent(k, v)
+}
+
+func (ss *ShardedStorage) CompareAndSwap(k, expected, new string) error {
+	return ss.shard(k).CompareAndSwap(k, expected, new)
+}
+
+func (ss *ShardedStorage) Get(k string) (string, error) {
+	return ss.shard(k).Get(k)
+}
+
+func (ss *ShardedStorage) GetWithTTL(k string) (string, time.Duration, error) {
+	return ss.shard(k).GetWithTTL(k)
+}
+
+func (ss *ShardedStorage) Delete(k string) error {
+	return ss.shard(k).Delete(k)
+}
+
+// Scan merges the first limit keys of every shard.
+func (ss *ShardedStorage) Scan(prefix, startAfter string, limit int) ([]string, error) {
+	return ss.scan(prefix, startAfter, limit, time.Now())
+}
+
+func (ss *ShardedStorage) scan(prefix, startAfter string, limit int, now time.Time) ([]string, error) {
+	keys := []string{}
+	for _, s := range ss.shards {
+		shardKeys, err := s.scan(prefix, startAfter, limit, now)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, shardKeys...)
+	}
+	slices.Sort(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	return keys, nil
+}
+
+// Apply checks and stages the operations like LocalStorage.Apply, holding
+// the locks of the touched shards.
+func (ss *ShardedStorage) Apply(ops []storage.Op) error {
+	return ss.apply(ops, time.Now())
+}
+
+func (ss *ShardedStorage) apply(ops []storage.Op, now time.Time) error {
+	unlock := ss.lock(ops)
+	defer unlock()
+
+	return applyOps(ops, ss.shard, now)
+}
+
+func (ss *ShardedStorage) Batch(ops []storage.Op) ([]storage.Result, error) {
+	return ss.batch(ops, time.Now())
+}
+
+func (ss *ShardedStorage) batch(ops []storage.Op, now time.Time) ([]storage.Result, error) {
+	unlock := ss.lock(ops)
+	defer unlock()
+
+	return batchOps(ops, ss.shard, now), nil
+}
+
+// Items returns all not expired items in key order, taken at once from
+// every shard.
+func (ss *ShardedStorage) Items() []storage.Item {
+	return ss.items(time.Now())
+}
+
+func (ss *ShardedStorage) items(now time.Time) []storage.Item {
+	for _, s := range ss.shards {
+		s.RLock()
+	}
+	defer func() {
+		for _, s := range ss.shards {
+			s.RUnlock()
+		}
+	}()
+
+	items := []storage.Item{}
+	for _, s := range ss.shards {
+		items = s.appendItems(items, now)
+	}
+	slices.SortFunc(items, func(a, b storage.Item) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return items
+}
+
+// Load replaces the content of the storage with items, expired ones are skipped.
+func (ss *ShardedStorage) Load(items []storage.Item) {
+	ss.load(items, time.Now())
+}
+
+func (ss *ShardedStorage) load(items []storage.Item, now time.Time) {
+	for _, s := range ss.shards {
+		s.Lock()
+	}
+	defer unlockShards(ss.shards)
+
+	shardItems := make([][]storage.Item, len(ss.shards))
+	for _, item := range items {
+		i := ss.index(item.Key)
+		shardItems[i] = append(shardItems[i], item)
+	}
+	for i, s := range ss.shards {
+		s.load(shardItems[i], now)
+	}
+}
+
+// RunSweeper starts a background goroutine which removes expired keys of
+// every shard each interval and reports each removed key to onExpire
+// with the lock of its shard held. Call the returned function to stop it.
+func (ss *ShardedStorage) RunSweeper(interval time.Duration, onExpire func(key string)) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				for _, s := range ss.shards {
+					s.deleteExpired(now, onExpire)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// OnEvict sets the function evicted keys are reported to with the lock of
+// their shard held, it must not call the storage.
+func (ss *ShardedStorage) OnEvict(onEvict func(key string)) {
+	for _, s := range ss.shards {
+		s.OnEvict(onEvict)
+	}
+}
+
+// lock locks the shards of the operation keys in shard order, so
+// concurrent operations on several keys don't deadlock.
+func (ss *ShardedStorage) lock(ops []storage.Op) (unlock func()) {
+	touched := make([]bool, len(ss.shards))
+	for _, op := range ops {
+		touched[ss.index(op.Key)] = true
+	}
+
+	locked := []*LocalStorage{}
+	for i, s := range ss.shards {
+		if touched[i] {
+			s.Lock()
+			locked = append(locked, s)
+		}
+	}
+
+	return func() { unlockShards(locked) }
+}
+
+// unlockShards evicts the keys over the limits of the shards, reports
+// each one before the lock of its shard is released.
+func unlockShards(shards []*LocalStorage) {
+	for _, s := range shards {
+		s.unlock()
+	}
+}
+
+func (ss *ShardedStorage) shard(k string) *LocalStorage {
+	return ss.shards[ss.index(k)]
+}
+
+func (ss *ShardedStorage) index(k string) int {
+	if len(ss.shards) == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(k))
+
+	return int(h.Sum32() % uint32(len(ss.shards)))
+}
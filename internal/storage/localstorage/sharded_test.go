@@ -0,0 +1,189 @@
+package localstorage_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/storagetest"
+)
+
+type localStorage interface {
+	storage.Storage
+	Items() []storage.Item
+	Load([]storage.Item)
+	RunSweeper(time.Duration, func(string)) func()
+}
+
+func TestContract(t *testing.T) {
+	t.Run("single", func(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.Storage { return localstorage.New() })
+	})
+	t.Run("sharded", func(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.Storage { return localstorage.NewSharded(8, localstorage.Limits{}) })
+	})
+	t.Run("at", func(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.Storage {
+			return localstorage.NewSharded(8, localstorage.Limits{}).(storage.Clocked).At(time.Now())
+		})
+	})
+}
+
+// TestSharded runs the same operations on a single and a sharded storage,
+// the results must be the same.
+func TestSharded(t *testing.T) {
+	single := localstorage.New().(localStorage)
+	sharded := localstorage.NewSharded(8, localstorage.Limits{}).(localStorage)
+
+	tests := []struct {
+		name string
+		run  func(s localStorage) any
+	}{
+		{"put", func(s localStorage) any {
+			for i := 0; i < 100; i++ {
+				_ = s.Put(fmt.Sprintf("key-%02d", i), fmt.Sprint(i))
+			}
+			return nil
+		}},
+		{"put if absent", func(s localStorage) any { return s.PutIfAbsent("key-01", "x") }},
+		{"compare and swap", func(s localStorage) any { return s.CompareAndSwap("key-02", "2", "two") }},
+		{"get", func(s localStorage) any {
+			v, err := s.Get("key-02")
+			return []any{v, err}
+		}},
+		{"delete", func(s localStorage) any { return []any{s.Delete("key-03"), s.Delete("key-03")} }},
+		{"scan", func(s localStorage) any {
+			keys, err := s.Scan("key-1", "", 0)
+			return []any{keys, err}
+		}},
+		{"scan after with limit", func(s localStorage) any {
+			keys, err := s.Scan("key-", "key-42", 5)
+			return []any{keys, err}
+		}},
+		{"apply", func(s localStorage) any {
+			return s.Apply([]storage.Op{
+				{Type: storage.OpCheck, Key: "key-04", Value: "4"},
+				{Type: storage.OpPut, Key: "key-04", Value: "four"},
+				{Type: storage.OpDelete, Key: "key-05"},
+				{Type: storage.OpPut, Key: "new", Value: "new"},
+			})
+		}},
+		{"failed apply", func(s localStorage) any {
+			err := s.Apply([]storage.Op{
+				{Type: storage.OpPut, Key: "key-06", Value: "six"},
+				{Type: storage.OpCheckAbsent, Key: "key-07"},
+			})
+			v, _ := s.Get("key-06")
+			return []any{err, v}
+		}},
+		{"batch", func(s localStorage) any {
+			results, err := s.Batch([]storage.Op{
+				{Type: storage.OpPut, Key: "key-08", Value: "eight"},
+				{Type: storage.OpGet, Key: "key-08"},
+				{Type: storage.OpDelete, Key: "key-09"},
+				{Type: storage.OpDelete, Key: "key-09"},
+			})
+			return []any{results, err}
+		}},
+		{"items", func(s localStorage) any { return s.Items() }},
+		{"load", func(s localStorage) any {
+			s.Load([]storage.Item{{Key: "b", Value: "2"}, {Key: "a", Value: "1"}, {Key: "c", Value: "3", Expires: 1}})
+			return s.Items()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.run(single)
+			got := tt.run(sharded)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("sharded = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestShardedRunSweeper(t *testing.T) {
+	s := localstorage.NewSharded(4, localstorage.Limits{}).(localStorage)
+	_ = s.PutWithTTL("short", "value", time.Millisecond)
+	_ = s.PutWithTTL("long", "value", time.Hour)
+
+	expired := make(chan string, 2)
+	stop := s.RunSweeper(time.Millisecond, func(k string) { expired <- k })
+	defer stop()
+
+	select {
+	case k := <-expired:
+		if k != "short" {
+			t.Errorf("expired key = %s, want short", k)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expired key is not swept")
+	}
+	if _, err := s.Get("long"); errors.Is(err, storage.ErrorNoSuchKey) {
+		t.Error("not expired key is swept")
+	}
+}
+
+// BenchmarkMixed runs parallel puts, gets and deletes of random keys.
+func BenchmarkMixed(b *testing.B) {
+	storages := []struct {
+		name string
+		new  func() storage.Storage
+	}{
+		{"local", localstorage.New},
+		{"sharded-4", func() storage.Storage { return localstorage.NewSharded(4, localstorage.Limits{}) }},
+		{"sharded-16", func() storage.Storage { return localstorage.NewSharded(16, localstorage.Limits{}) }},
+		{"sharded-64", func() storage.Storage { return localstorage.NewSharded(64, localstorage.Limits{}) }},
+	}
+	keys := make([]string, 100000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+
+	for _, st := range storages {
+		b.Run(st.name, func(b *testing.B) {
+			s := st.new()
+			for _, k := range keys {
+				_ = s.Put(k, "value")
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					k := keys[r.Intn(len(keys))]
+					switch n := r.Intn(10); {
+					case n < 5:
+						_ = s.Put(k, "value")
+					case n < 9:
+						_, _ = s.Get(k)
+					default:
+						_ = s.Delete(k)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkBulkLoad puts new keys and deletes them, as an import does,
+// which must not get slower with the number of keys.
+func BenchmarkBulkLoad(b *testing.B) {
+	keys := make([]string, b.N)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", rand.Int63())
+	}
+	s := localstorage.New()
+	b.ResetTimer()
+
+	for _, k := range keys {
+		_ = s.Put(k, "value")
+	}
+	for _, k := range keys {
+		_ = s.Delete(k)
+	}
+}
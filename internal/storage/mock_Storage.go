@@ -2,7 +2,11 @@
 
 package storage
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	time "time"
+
+	mock "github.com/stretchr/testify/mock"
+)
 
 // MockStorage is an autogenerated mock type for the Storage type
 type MockStorage struct {
@@ -17,6 +21,146 @@ func (_m *MockStorage) EXPECT() *MockStorage_Expecter {
 	return &MockStorage_Expecter{mock: &_m.Mock}
 }
 
+// Apply provides a mock function with given fields: ops
+func (_m *MockStorage) Apply(ops []Op) error {
+	ret := _m.Called(ops)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func([]Op) error); ok {
+		r0 = rf(ops)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockStorage_Apply_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Apply'
+type MockStorage_Apply_Call struct {
+	*mock.Call
+}
+
+// Apply is a helper method to define mock.On call
+//   - ops []Op
+func (_e *MockStorage_Expecter) Apply(ops interface{}) *MockStorage_Apply_Call {
+	return &MockStorage_Apply_Call{Call: _e.mock.On("Apply", ops)}
+}
+
+func (_c *MockStorage_Apply_Call) Run(run func(ops []Op)) *MockStorage_Apply_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].([]Op))
+	})
+	return _c
+}
+
+func (_c *MockStorage_Apply_Call) Return(_a0 error) *MockStorage_Apply_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockStorage_Apply_Call) RunAndReturn(run func([]Op) error) *MockStorage_Apply_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Batch provides a mock function with given fields: ops
+func (_m *MockStorage) Batch(ops []Op) ([]Result, error) {
+	ret := _m.Called(ops)
+
+	var r0 []Result
+	var r1 error
+	if rf, ok := ret.Get(0).(func([]Op) ([]Result, error)); ok {
+		return rf(ops)
+	}
+	if rf, ok := ret.Get(0).(func([]Op) []Result); ok {
+		r0 = rf(ops)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]Result)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func([]Op) error); ok {
+		r1 = rf(ops)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockStorage_Batch_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Batch'
+type MockStorage_Batch_Call struct {
+	*mock.Call
+}
+
+// Batch is a helper method to define mock.On call
+//   - ops []Op
+func (_e *MockStorage_Expecter) Batch(ops interface{}) *MockStorage_Batch_Call {
+	return &MockStorage_Batch_Call{Call: _e.mock.On("Batch", ops)}
+}
+
+func (_c *MockStorage_Batch_Call) Run(run func(ops []Op)) *MockStorage_Batch_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].([]Op))
+	})
+	return _c
+}
+
+func (_c *MockStorage_Batch_Call) Return(_a0 []Result, _a1 error) *MockStorage_Batch_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockStorage_Batch_Call) RunAndReturn(run func([]Op) ([]Result, error)) *MockStorage_Batch_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// CompareAndSwap provides a mock function with given fields: key, expected, new
+func (_m *MockStorage) CompareAndSwap(key string, expected string, new string) error {
+	ret := _m.Called(key, expected, new)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string) error); ok {
+		r0 = rf(key, expected, new)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockStorage_CompareAndSwap_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CompareAndSwap'
+type MockStorage_CompareAndSwap_Call struct {
+	*mock.Call
+}
+
+// CompareAndSwap is a helper method to define mock.On call
+//   - key string
+//   - expected string
+//   - new string
+func (_e *MockStorage_Expecter) CompareAndSwap(key interface{}, expected interface{}, new interface{}) *MockStorage_CompareAndSwap_Call {
+	return &MockStorage_CompareAndSwap_Call{Call: _e.mock.On("CompareAndSwap", key, expected, new)}
+}
+
+func (_c *MockStorage_CompareAndSwap_Call) Run(run func(key string, expected string, new string)) *MockStorage_CompareAndSwap_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *MockStorage_CompareAndSwap_Call) Return(_a0 error) *MockStorage_CompareAndSwap_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockStorage_CompareAndSwap_Call) RunAndReturn(run func(string, string, string) error) *MockStorage_CompareAndSwap_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Delete provides a mock function with given fields: _a0
 func (_m *MockStorage) Delete(_a0 string) error {
 	ret := _m.Called(_a0)
@@ -154,6 +298,149 @@ func (_c *MockStorage_Put_Call) RunAndReturn(run func(string, string) error) *Mo
 	return _c
 }
 
+// PutIfAbsent provides a mock function with given fields: _a0, _a1
+func (_m *MockStorage) PutIfAbsent(_a0 string, _a1 string) error {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockStorage_PutIfAbsent_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PutIfAbsent'
+type MockStorage_PutIfAbsent_Call struct {
+	*mock.Call
+}
+
+// PutIfAbsent is a helper method to define mock.On call
+//   - _a0 string
+//   - _a1 string
+func (_e *MockStorage_Expecter) PutIfAbsent(_a0 interface{}, _a1 interface{}) *MockStorage_PutIfAbsent_Call {
+	return &MockStorage_PutIfAbsent_Call{Call: _e.mock.On("PutIfAbsent", _a0, _a1)}
+}
+
+func (_c *MockStorage_PutIfAbsent_Call) Run(run func(_a0 string, _a1 string)) *MockStorage_PutIfAbsent_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *MockStorage_PutIfAbsent_Call) Return(_a0 error) *MockStorage_PutIfAbsent_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockStorage_PutIfAbsent_Call) RunAndReturn(run func(string, string) error) *MockStorage_PutIfAbsent_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// PutWithTTL provides a mock function with given fields: _a0, _a1, _a2
+func (_m *MockStorage) PutWithTTL(_a0 string, _a1 string, _a2 time.Duration) error {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, time.Duration) error); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockStorage_PutWithTTL_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PutWithTTL'
+type MockStorage_PutWithTTL_Call struct {
+	*mock.Call
+}
+
+// PutWithTTL is a helper method to define mock.On call
+//   - _a0 string
+//   - _a1 string
+//   - _a2 time.Duration
+func (_e *MockStorage_Expecter) PutWithTTL(_a0 interface{}, _a1 interface{}, _a2 interface{}) *MockStorage_PutWithTTL_Call {
+	return &MockStorage_PutWithTTL_Call{Call: _e.mock.On("PutWithTTL", _a0, _a1, _a2)}
+}
+
+func (_c *MockStorage_PutWithTTL_Call) Run(run func(_a0 string, _a1 string, _a2 time.Duration)) *MockStorage_PutWithTTL_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string), args[2].(time.Duration))
+	})
+	return _c
+}
+
+func (_c *MockStorage_PutWithTTL_Call) Return(_a0 error) *MockStorage_PutWithTTL_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockStorage_PutWithTTL_Call) RunAndReturn(run func(string, string, time.Duration) error) *MockStorage_PutWithTTL_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Scan provides a mock function with given fields: prefix, startAfter, limit
+func (_m *MockStorage) Scan(prefix string, startAfter string, limit int) ([]string, error) {
+	ret := _m.Called(prefix, startAfter, limit)
+
+	var r0 []string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string, int) ([]string, error)); ok {
+		return rf(prefix, startAfter, limit)
+	}
+	if rf, ok := ret.Get(0).(func(string, string, int) []string); ok {
+		r0 = rf(prefix, startAfter, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string, int) error); ok {
+		r1 = rf(prefix, startAfter, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockStorage_Scan_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Scan'
+type MockStorage_Scan_Call struct {
+	*mock.Call
+}
+
+// Scan is a helper method to define mock.On call
+//   - prefix string
+//   - startAfter string
+//   - limit int
+func (_e *MockStorage_Expecter) Scan(prefix interface{}, startAfter interface{}, limit interface{}) *MockStorage_Scan_Call {
+	return &MockStorage_Scan_Call{Call: _e.mock.On("Scan", prefix, startAfter, limit)}
+}
+
+func (_c *MockStorage_Scan_Call) Run(run func(prefix string, startAfter string, limit int)) *MockStorage_Scan_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string), args[2].(int))
+	})
+	return _c
+}
+
+func (_c *MockStorage_Scan_Call) Return(_a0 []string, _a1 error) *MockStorage_Scan_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockStorage_Scan_Call) RunAndReturn(run func(string, string, int) ([]string, error)) *MockStorage_Scan_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewMockStorage creates a new instance of MockStorage. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewMockStorage(t interface {
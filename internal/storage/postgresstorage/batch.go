@@ -0,0 +1,189 @@
+package postgresstorage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+// maxBatchRun is the number of operations in one statement,
+// postgres allows up to 65535 parameters.
+const maxBatchRun = 500
+
+// Batch runs every sequence of operations of the same type as one
+// multi-row statement, all of them in one transaction.
+func (s *PostgresStorage) Batch(ops []storage.Op) ([]storage.Result, error) {
+	results := make([]storage.Result, len(ops))
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for start := 0; start < len(ops); {
+		end := start + 1
+		for end < len(ops) && end-start < maxBatchRun && ops[end].Type == ops[start].Type {
+			end++
+		}
+
+		switch ops[start].Type {
+		case storage.OpPut:
+			err = s.batchPut(tx, ops[start:end])
+		case storage.OpDelete:
+			err = s.batchDelete(tx, ops[start:end], results[start:end])
+		case storage.OpGet:
+			err = s.batchGet(tx, ops[start:end], results[start:end])
+		default:
+			for i := start; i < end; i++ {
+				results[i].Err = storage.ErrorUnknownOp
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		start = end
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit batch: %w", err)
+	}
+
+	return results, nil
+}
+
+func (s *PostgresStorage) batchPut(tx *sql.Tx, ops []storage.Op) error {
+	// a row can't be changed twice by one statement, the last put wins
+	index := map[string]int{}
+	args := []any{}
+	for _, op := range ops {
+		if i, ok := index[op.Key]; ok {
+			args[i+1] = op.Value
+			continue
+		}
+		index[op.Key] = len(args)
+		args = append(args, op.Key, op.Value)
+	}
+
+	q := fmt.Sprintf(`
+	INSERT INTO %[1]s 
+	(key, value) 
+	VALUES %[2]s 
+	ON CONFLICT (key) DO UPDATE 
+	SET value=EXCLUDED.value, version=%[1]s.version+1, updated_at=CURRENT_TIMESTAMP
+`, s.name, placeholders(len(args)/2, 2))
+	if _, err := tx.Exec(q, args...); err != nil {
+		return fmt.Errorf("failed to upsert batch: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) batchDelete(tx *sql.Tx, ops []storage.Op, results []storage.Result) error {
+	q := fmt.Sprintf(`
+	DELETE FROM %s 
+	WHERE key IN %s 
+	RETURNING key
+`, s.name, placeholders(1, len(ops)))
+	deleted, err := s.queryKeys(tx, q, keyArgs(ops))
+	if err != nil {
+		return fmt.Errorf("failed to delete batch: %w", err)
+	}
+
+	for i, op := range ops {
+		if _, ok := deleted[op.Key]; !ok {
+			results[i].Err = storage.ErrorNoSuchKey
+			continue
+		}
+		// the next delete of the same key finds nothing
+		delete(deleted, op.Key)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) batchGet(tx *sql.Tx, ops []storage.Op, results []storage.Result) error {
+	q := fmt.Sprintf(`
+	SELECT key, value 
+	FROM %s 
+	WHERE key IN %s
+`, s.name, placeholders(1, len(ops)))
+	values, err := s.queryKeys(tx, q, keyArgs(ops))
+	if err != nil {
+		return fmt.Errorf("failed to get batch: %w", err)
+	}
+
+	for i, op := range ops {
+		v, ok := values[op.Key]
+		if !ok {
+			results[i].Err = storage.ErrorNoSuchKey
+			continue
+		}
+		results[i].Value = v
+	}
+
+	return nil
+}
+
+// queryKeys returns rows of key or key and value columns as a map.
+func (s *PostgresStorage) queryKeys(tx *sql.Tx, q string, args []any) (map[string]string, error) {
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]string{}
+	for rows.Next() {
+		var k, v string
+		if len(columns) == 1 {
+			err = rows.Scan(&k)
+		} else {
+			err = rows.Scan(&k, &v)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[k] = v
+	}
+
+	return result, rows.Err()
+}
+
+func keyArgs(ops []storage.Op) []any {
+	args := make([]any, len(ops))
+	for i, op := range ops {
+		args[i] = op.Key
+	}
+
+	return args
+}
+
+// placeholders returns "($1, $2), ($3, $4)" for 2 rows of 2 columns
+// and "($1, $2, $3)" for 1 row of 3 columns.
+func placeholders(rows, columns int) string {
+	var sb strings.Builder
+	n := 1
+	for r := 0; r < rows; r++ {
+		if r > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteByte('(')
+		for c := 0; c < columns; c++ {
+			if c > 0 {
+				sb.WriteString(", ")
+			}
+			fmt.Fprintf(&sb, "$%d", n)
+			n++
+		}
+		sb.WriteByte(')')
+	}
+
+	return sb.String()
+}
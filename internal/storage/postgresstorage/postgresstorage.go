@@ -1,14 +1,20 @@
 package postgresstorage
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
+	"unicode/utf8"
 
-	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
 	"github.com/dimishpatriot/kv-storage/internal/storage"
 )
 
+// DefaultTableName is the key/value table made by the migrations,
+// events are logged to a separate one.
+const DefaultTableName = "kv"
+
 type PostgresStorage struct {
 	db   *sql.DB
 	name string
@@ -18,74 +24,62 @@ func New(db *sql.DB, name string) *PostgresStorage {
 	return &PostgresStorage{db, name}
 }
 
-func (s *PostgresStorage) VerifyTableExists() bool {
-	qs := fmt.Sprintf(`
-	SELECT * FROM %s 
-	LIMIT 1
-	`, s.name)
-	rows, err := s.db.Query(qs)
-	if err != nil {
-		return false
-	}
-	rows.Close()
-
-	return true
-}
-
-func (s *PostgresStorage) CreateTable() error {
+func (s *PostgresStorage) Put(k, v string) error {
 	q := fmt.Sprintf(`
-	CREATE TABLE %s (
-	sequence BIGSERIAL PRIMARY KEY,
-	event_type SMALLINT,
-	key TEXT NOT NULL,
-	value TEXT NOT NULL)
-	`, s.name)
-	if _, err := s.db.Exec(q); err != nil {
-		return fmt.Errorf("can't create table: %w", err)
+	INSERT INTO %[1]s 
+	(key, value) 
+	VALUES ($1, $2) 
+	ON CONFLICT (key) DO UPDATE 
+	SET value=EXCLUDED.value, version=%[1]s.version+1, updated_at=CURRENT_TIMESTAMP
+`, s.name)
+	if _, err := s.db.Exec(q, k, v); err != nil {
+		return fmt.Errorf("failed to upsert data: %w", err)
 	}
 
 	return nil
 }
 
-func (s *PostgresStorage) Put(k, v string) error {
+// PutWithTTL is not supported: the table has no expiration column.
+func (s *PostgresStorage) PutWithTTL(k, v string, ttl time.Duration) error {
+	return storage.ErrorNotSupported
+}
+
+func (s *PostgresStorage) PutIfAbsent(k, v string) error {
 	q := fmt.Sprintf(`
 	INSERT INTO %s 
-	(event_type, key, value) 
-	VALUES ($1, $2, $3)
+	(key, value) 
+	VALUES ($1, $2) 
+	ON CONFLICT (key) DO NOTHING
 `, s.name)
-	if _, err := s.db.Exec(q, transactionlogger.EventPut, k, v); err != nil {
+	res, err := s.db.Exec(q, k, v)
+	if err != nil {
 		return fmt.Errorf("failed to insert data: %w", err)
 	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return storage.ErrorConditionFailed
+	}
 
 	return nil
 }
 
-func (s *PostgresStorage) GetAll() ([]transactionlogger.Event, error) {
+func (s *PostgresStorage) CompareAndSwap(k, expected, new string) error {
 	q := fmt.Sprintf(`
-	SELECT sequence, event_type, key, value FROM %s 
-	ORDER BY sequence
-	`, s.name)
-	result := []transactionlogger.Event{}
-
-	rows, err := s.db.Query(q)
+	UPDATE %s 
+	SET value=$1, version=version+1, updated_at=CURRENT_TIMESTAMP 
+	WHERE key=$2 AND value=$3
+`, s.name)
+	res, err := s.db.Exec(q, new, k, expected)
 	if err != nil {
-		return nil, fmt.Errorf("get all events error: %w", err)
+		return fmt.Errorf("failed to update data: %w", err)
 	}
-	defer rows.Close()
-
-	e := transactionlogger.Event{}
-	for rows.Next() {
-		err = rows.Scan(&e.Sequence, &e.EventType, &e.Key, &e.Value)
-		if err != nil {
-			return nil, fmt.Errorf("error reading row: %w", err)
-		}
-		result = append(result, e)
-	}
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("fail to read transaction log: %w", err)
+	if num, _ := res.RowsAffected(); num > 0 {
+		return nil
 	}
 
-	return result, nil
+	if _, err = s.Get(k); err != nil {
+		return err
+	}
+	return storage.ErrorConditionFailed
 }
 
 func (s *PostgresStorage) Get(k string) (string, error) {
@@ -94,20 +88,21 @@ func (s *PostgresStorage) Get(k string) (string, error) {
 	}
 
 	q := fmt.Sprintf(`
-	SELECT event_type, key, value 
+	SELECT value 
 	FROM %s 
 	WHERE key=$1
 	`, s.name)
-	row := s.db.QueryRow(q, k)
-
-	e := transactionlogger.Event{}
-	err := row.Scan(&e.EventType, &e.Key, &e.Value)
 
+	var v string
+	err := s.db.QueryRow(q, k).Scan(&v)
 	if errors.Is(err, sql.ErrNoRows) {
 		return "", storage.ErrorNoSuchKey
 	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get data: %w", err)
+	}
 
-	return e.Value, nil
+	return v, nil
 }
 
 func (s *PostgresStorage) Delete(k string) error {
@@ -129,3 +124,154 @@ func (s *PostgresStorage) Delete(k string) error {
 
 	return nil
 }
+
+// Scan looks the keys up by a range of the primary key index: the prefix
+// keys are in a row when the keys are ordered by bytes, as in sqlite and
+// in postgres with the "C" collation.
+func (s *PostgresStorage) Scan(prefix, startAfter string, limit int) ([]string, error) {
+	where := "key>$1"
+	args := []any{startAfter}
+	if prefix != "" {
+		args = append(args, prefix)
+		where += fmt.Sprintf(" AND key>=$%d", len(args))
+	}
+	if end, ok := prefixEnd(prefix); ok {
+		args = append(args, end)
+		where += fmt.Sprintf(" AND key<$%d", len(args))
+	}
+	q := fmt.Sprintf(`
+	SELECT key 
+	FROM %s 
+	WHERE %s 
+	ORDER BY key
+	`, s.name, where)
+	if limit > 0 {
+		args = append(args, limit)
+		q += fmt.Sprintf("LIMIT $%d", len(args))
+	}
+
+	rows, err := s.db.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("scan keys error: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var k string
+		if err = rows.Scan(&k); err != nil {
+			return nil, fmt.Errorf("error reading row: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("fail to scan keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// prefixEnd returns the least key after all the keys with the prefix,
+// false if there is none.
+func prefixEnd(prefix string) (string, bool) {
+	if !utf8.ValidString(prefix) {
+		// only sqlite keeps such keys, it compares them by bytes
+		b := []byte(prefix)
+		for i := len(b) - 1; i >= 0; i-- {
+			if b[i] < 0xFF {
+				b[i]++
+				return string(b[:i+1]), true
+			}
+		}
+		return "", false
+	}
+
+	runes := []rune(prefix)
+	for i := len(runes) - 1; i >= 0; i-- {
+		switch runes[i] {
+		case utf8.MaxRune:
+			continue
+		case 0xD7FF: // surrogates aren't valid in UTF-8
+			runes[i] = 0xE000
+		default:
+			runes[i]++
+		}
+		return string(runes[:i+1]), true
+	}
+
+	return "", false
+}
+
+// Apply runs the operations in a serializable transaction, a concurrent
+// change of the same keys makes it fail.
+func (s *PostgresStorage) Apply(ops []storage.Op) error {
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for i, op := range ops {
+		if err = s.applyOp(tx, op); err != nil {
+			return storage.OpFailed(i, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) applyOp(tx *sql.Tx, op storage.Op) error {
+	var q string
+	args := []any{op.Key}
+
+	switch op.Type {
+	case storage.OpPut:
+		q = `
+	INSERT INTO %[1]s 
+	(key, value) 
+	VALUES ($1, $2) 
+	ON CONFLICT (key) DO UPDATE 
+	SET value=EXCLUDED.value, version=%[1]s.version+1, updated_at=CURRENT_TIMESTAMP
+`
+		args = append(args, op.Value)
+	case storage.OpDelete:
+		q = `
+	DELETE FROM %s 
+	WHERE key=$1
+`
+	case storage.OpCheck:
+		q = `
+	SELECT COUNT(*) FROM %s 
+	WHERE key=$1 AND value=$2
+`
+		args = append(args, op.Value)
+	case storage.OpCheckAbsent:
+		q = `
+	SELECT 1 - COUNT(*) FROM %s 
+	WHERE key=$1
+`
+	default:
+		return storage.ErrorUnknownOp
+	}
+	q = fmt.Sprintf(q, s.name)
+
+	if op.Type == storage.OpPut || op.Type == storage.OpDelete {
+		if _, err := tx.Exec(q, args...); err != nil {
+			return fmt.Errorf("failed to change data: %w", err)
+		}
+		return nil
+	}
+
+	var ok int
+	if err := tx.QueryRow(q, args...).Scan(&ok); err != nil {
+		return fmt.Errorf("failed to check data: %w", err)
+	}
+	if ok != 1 {
+		return storage.ErrorConditionFailed
+	}
+
+	return nil
+}
@@ -5,17 +5,21 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
 
-	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/migrations"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
 	"github.com/dimishpatriot/kv-storage/internal/storage/postgresstorage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/storagetest"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
 	db        *sql.DB
-	tableName = "transactions"
+	tableName = postgresstorage.DefaultTableName
 )
 
 func TestMain(m *testing.M) {
@@ -28,256 +32,53 @@ func TestMain(m *testing.M) {
 }
 
 func prepareDB(m *testing.M) (code int, err error) {
-	var q string
+	dir, err := os.MkdirTemp("", "postgresstorage")
+	if err != nil {
+		return -1, fmt.Errorf("can't create db dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
 
-	db, err = sql.Open("sqlite3", "file:./test.db?cache=shared")
+	db, err = sql.Open("sqlite3", filepath.Join(dir, "test.db"))
 	if err != nil {
 		return -1, fmt.Errorf("can't connect to db: %w", err)
 	}
+	defer db.Close()
 
-	defer func() {
-		q = fmt.Sprintf("DELETE FROM %s", tableName)
-		_, _ = db.Exec(q)
-		db.Close()
-	}()
-
-	q = fmt.Sprintf(`
-	CREATE TABLE %s (
-	sequence BIGSERIAL PRIMARY KEY,
-	event_type SMALLINT,
-	key TEXT NOT NULL,
-	value TEXT NOT NULL)
-	`, tableName)
-	_, _ = db.Exec(q)
-
-	// need add sequence for sqlite3 test base!
-	q = fmt.Sprintf(`
-	INSERT INTO %s 
-	(sequence, event_type, key, value) 
-	VALUES ($1, $2, $3, $4)
-	`, tableName)
-	_, _ = db.Exec(q, 1, transactionlogger.EventPut, "one", "ONE")
-	_, _ = db.Exec(q, 2, transactionlogger.EventPut, "2", "two")
+	if _, err = migrations.Apply(db, migrations.Postgres); err != nil {
+		return -1, fmt.Errorf("can't migrate db: %w", err)
+	}
 
 	return m.Run(), nil
 }
 
-func TestPostgresStorage_VerifyTableExists(t *testing.T) {
-	type test struct {
-		name      string
-		tableName string
-		isExists  bool
-	}
-	tests := []test{
-		{
-			"existing table",
-			tableName,
-			true,
-		},
-		{
-			"not existing table",
-			"ABC",
-			false,
-		},
-		{
-			"empty table name",
-			"",
-			false,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			s := postgresstorage.New(db, tt.tableName)
+// newStorage empties the table shared by the tests.
+func newStorage(t *testing.T) storage.Storage {
+	t.Helper()
 
-			exists := s.VerifyTableExists()
+	_, err := db.Exec(fmt.Sprintf("DELETE FROM %s", tableName))
+	require.NoError(t, err)
 
-			assert.Equal(t, exists, tt.isExists)
-		})
-	}
+	return postgresstorage.New(db, tableName)
 }
 
-func TestPostgresStorage_CreateTable(t *testing.T) {
-	type test struct {
-		name      string
-		tableName string
-		wantErr   bool
-	}
-	tests := []test{
-		{
-			"new table",
-			"new",
-			false,
-		},
-		{
-			"existing table",
-			tableName,
-			true,
-		},
-		{
-			"table with empty name",
-			"",
-			true,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			s := postgresstorage.New(db, tt.tableName)
-
-			err := s.CreateTable()
-			defer func() {
-				if tt.tableName != tableName {
-					q := fmt.Sprintf("DROP TABLE %s", tt.tableName)
-					_, _ = db.Exec(q)
-				}
-			}()
-
-			assert.Equal(t, tt.wantErr, err != nil)
-		})
-	}
+func TestPostgresStorage(t *testing.T) {
+	storagetest.Run(t, newStorage)
 }
 
-func TestPostgresStorage_GetAll(t *testing.T) {
-	type want struct {
-		result []transactionlogger.Event
-		err    bool
-	}
-	type test struct {
-		name string
-		want want
-	}
-	tests := []test{
-		{
-			"simple",
-			want{
-				[]transactionlogger.Event{
-					{Sequence: 1, EventType: transactionlogger.EventPut, Key: "one", Value: "ONE"},
-					{Sequence: 2, EventType: transactionlogger.EventPut, Key: "2", Value: "two"},
-				},
-				false,
-			},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			store := postgresstorage.New(db, tableName)
-			res, err := store.GetAll()
+func TestPostgresStorage_PutUpsert(t *testing.T) {
+	s := newStorage(t)
 
-			assert.Equal(t, tt.want.err, err != nil)
-			assert.EqualValues(t, tt.want.result, res)
-		})
+	for _, v := range []string{"1", "2", "3"} {
+		assert.NoError(t, s.Put("upsert", v))
 	}
-}
 
-func TestPostgresStorage_Put(t *testing.T) {
-	type args struct {
-		key   string
-		value string
-	}
-	tests := []struct {
-		name    string
-		args    args
-		wantErr bool
-	}{
-		{
-			"correct args",
-			args{key: "key", value: "value"},
-			false,
-		},
-		{
-			"equal args",
-			args{key: "equal", value: "equal"},
-			false,
-		},
-		{
-			"short args",
-			args{key: "k", value: "v"},
-			false,
-		},
-		{
-			"with numbers args",
-			args{key: "100", value: "500"},
-			false,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			s := postgresstorage.New(db, tableName)
-
-			err := s.Put(tt.args.key, tt.args.value)
-
-			assert.Equal(t, tt.wantErr, err != nil)
-		})
-	}
-}
-
-func TestPostgresStorage_Get(t *testing.T) {
-	type want struct {
-		value string
-		error bool
-	}
-	tests := []struct {
-		name string
-		key  string
-		want want
-	}{
-		{
-			"existing key",
-			"one",
-			want{value: "ONE", error: false},
-		},
-		{
-			"no existing key",
-			" one ",
-			want{value: "", error: true},
-		},
-		{
-			"empty key",
-			"",
-			want{value: "", error: true},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			s := postgresstorage.New(db, tableName)
-
-			got, err := s.Get(tt.key)
-			assert.Equal(t, tt.want.value, got)
-			assert.Equal(t, tt.want.error, err != nil)
-		})
-	}
-}
+	got, err := s.Get("upsert")
+	assert.NoError(t, err)
+	assert.Equal(t, "3", got)
 
-func TestPostgresStorage_Delete(t *testing.T) {
-	type want struct {
-		error bool
-	}
-	tests := []struct {
-		name string
-		key  string
-		want want
-	}{
-		{
-			"existing key",
-			"one",
-			want{error: false},
-		},
-		{
-			"no existing key",
-			" one ",
-			want{error: true},
-		},
-		{
-			"empty key",
-			"",
-			want{error: true},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			s := postgresstorage.New(db, tableName)
-
-			err := s.Delete(tt.key)
-			assert.Equal(t, tt.want.error, err != nil)
-		})
-	}
+	var rows, version int
+	q := fmt.Sprintf("SELECT COUNT(*), MAX(version) FROM %s WHERE key=$1", tableName)
+	assert.NoError(t, db.QueryRow(q, "upsert").Scan(&rows, &version))
+	assert.Equal(t, 1, rows)
+	assert.Equal(t, 3, version)
 }
@@ -0,0 +1,35 @@
+package sqlitestorage
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/dimishpatriot/kv-storage/internal/migrations"
+	"github.com/dimishpatriot/kv-storage/internal/storage/postgresstorage"
+)
+
+// Open opens the database file and applies the migrations. The file keeps
+// both the key/value table and the transactions event log.
+func Open(filename string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000", filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db: %w", err)
+	}
+	// sqlite has a single writer, one connection avoids "database is locked"
+	db.SetMaxOpenConns(1)
+
+	if _, err = migrations.Apply(db, migrations.SQLite); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate db: %w", err)
+	}
+
+	return db, nil
+}
+
+// New returns the SQL storage over the key/value table of db:
+// the postgres queries are valid in sqlite.
+func New(db *sql.DB) *postgresstorage.PostgresStorage {
+	return postgresstorage.New(db, postgresstorage.DefaultTableName)
+}
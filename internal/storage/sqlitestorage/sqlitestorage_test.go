@@ -0,0 +1,42 @@
+package sqlitestorage_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/sqlitestorage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStorage(t *testing.T) storage.Storage {
+	t.Helper()
+
+	db, err := sqlitestorage.Open(filepath.Join(t.TempDir(), "kv.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return sqlitestorage.New(db)
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	storagetest.Run(t, newStorage)
+}
+
+func TestOpenTwice(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "kv.db")
+	db, err := sqlitestorage.Open(filename)
+	require.NoError(t, err)
+	require.NoError(t, sqlitestorage.New(db).Put("one", "ONE"))
+	db.Close()
+
+	db, err = sqlitestorage.Open(filename)
+	require.NoError(t, err)
+	defer db.Close()
+
+	got, err := sqlitestorage.New(db).Get("one")
+	assert.NoError(t, err)
+	assert.Equal(t, "ONE", got)
+}
@@ -0,0 +1,252 @@
+// Package storagetest is the contract every storage.Storage must pass,
+// backends run it from their own tests.
+package storagetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs the contract tests, newStorage must return an empty storage
+// for every test.
+func Run(t *testing.T, newStorage func(t *testing.T) storage.Storage) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s storage.Storage)
+	}{
+		{"Put", testPut},
+		{"Get", testGet},
+		{"Delete", testDelete},
+		{"PutWithTTL", testPutWithTTL},
+		{"PutIfAbsent", testPutIfAbsent},
+		{"CompareAndSwap", testCompareAndSwap},
+		{"Scan", testScan},
+		{"Apply", testApply},
+		{"Batch", testBatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStorage(t)
+			require.NoError(t, s.Put("one", "ONE"))
+			require.NoError(t, s.Put("2", "two"))
+
+			tt.run(t, s)
+		})
+	}
+}
+
+func testPut(t *testing.T, s storage.Storage) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{"correct args", "key", "value"},
+		{"equal args", "equal", "equal"},
+		{"short args", "k", "v"},
+		{"with numbers args", "100", "500"},
+		{"existing key", "one", "NEW ONE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, s.Put(tt.key, tt.value))
+
+			got, err := s.Get(tt.key)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.value, got)
+		})
+	}
+}
+
+func testGet(t *testing.T, s storage.Storage) {
+	tests := []struct {
+		name    string
+		key     string
+		want    string
+		wantErr error
+	}{
+		{"existing key", "one", "ONE", nil},
+		{"no existing key", " one ", "", storage.ErrorNoSuchKey},
+		{"empty key", "", "", storage.ErrorNoSuchKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Get(tt.key)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func testDelete(t *testing.T, s storage.Storage) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr error
+	}{
+		{"existing key", "one", nil},
+		{"deleted key", "one", storage.ErrorNoSuchKey},
+		{"no existing key", " one ", storage.ErrorNoSuchKey},
+		{"empty key", "", storage.ErrorNoSuchKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, s.Delete(tt.key), tt.wantErr)
+
+			_, err := s.Get(tt.key)
+			assert.ErrorIs(t, err, storage.ErrorNoSuchKey)
+		})
+	}
+}
+
+// testPutWithTTL checks that only an Expirer takes a ttl.
+func testPutWithTTL(t *testing.T, s storage.Storage) {
+	err := s.PutWithTTL("key", "value", time.Minute)
+
+	expirer, ok := s.(storage.Expirer)
+	if !ok {
+		assert.ErrorIs(t, err, storage.ErrorNotSupported)
+		return
+	}
+	assert.NoError(t, err)
+	got, err := s.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", got)
+	ttl, err := expirer.TTL("key")
+	assert.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Minute, "ttl = %v", ttl)
+}
+
+func testPutIfAbsent(t *testing.T, s storage.Storage) {
+	tests := []struct {
+		name    string
+		key     string
+		want    string
+		wantErr error
+	}{
+		{"absent key", "absent", "value", nil},
+		{"existing key", "one", "ONE", storage.ErrorConditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, s.PutIfAbsent(tt.key, "value"), tt.wantErr)
+
+			got, err := s.Get(tt.key)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func testCompareAndSwap(t *testing.T, s storage.Storage) {
+	tests := []struct {
+		name     string
+		key      string
+		expected string
+		wantErr  error
+	}{
+		{"expected value", "2", "two", nil},
+		{"unexpected value", "2", "two", storage.ErrorConditionFailed},
+		{"absent key", "absent key", "two", storage.ErrorNoSuchKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, s.CompareAndSwap(tt.key, tt.expected, "TWO"), tt.wantErr)
+		})
+	}
+	got, err := s.Get("2")
+	assert.NoError(t, err)
+	assert.Equal(t, "TWO", got)
+}
+
+func testScan(t *testing.T, s storage.Storage) {
+	for _, k := range []string{"user:3", "user:1", "user:2", "user:1", "users", "é:1", "é:2", "ê", "\uD7FFa", "\uE000"} {
+		require.NoError(t, s.Put(k, "value"))
+	}
+
+	tests := []struct {
+		name       string
+		prefix     string
+		startAfter string
+		limit      int
+		want       []string
+	}{
+		{"prefix", "user:", "", 0, []string{"user:1", "user:2", "user:3"}},
+		{"prefix with limit", "user:", "", 2, []string{"user:1", "user:2"}},
+		{"prefix after key", "user:", "user:1", 5, []string{"user:2", "user:3"}},
+		{"after last key", "user:", "user:3", 0, []string{}},
+		{"absent prefix", "absent:", "", 0, []string{}},
+		{"multibyte prefix", "é", "", 0, []string{"é:1", "é:2"}},
+		{"prefix before surrogates", "\uD7FF", "", 0, []string{"\uD7FFa"}},
+		{"all keys", "", "", 0, []string{"2", "one", "user:1", "user:2", "user:3", "users", "é:1", "é:2", "ê", "\uD7FFa", "\uE000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Scan(tt.prefix, tt.startAfter, tt.limit)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func testApply(t *testing.T, s storage.Storage) {
+	require.NoError(t, s.Put("from", "10"))
+	require.NoError(t, s.Put("to", "0"))
+
+	err := s.Apply([]storage.Op{
+		{Type: storage.OpCheck, Key: "from", Value: "10"},
+		{Type: storage.OpPut, Key: "to", Value: "10"},
+		{Type: storage.OpCheckAbsent, Key: "from"},
+	})
+
+	assert.ErrorIs(t, err, storage.ErrorConditionFailed)
+	got, _ := s.Get("to")
+	assert.Equal(t, "0", got, "failed apply must not change the storage")
+
+	err = s.Apply([]storage.Op{
+		{Type: storage.OpCheck, Key: "from", Value: "10"},
+		{Type: storage.OpCheckAbsent, Key: "never put"},
+		{Type: storage.OpPut, Key: "to", Value: "10"},
+		{Type: storage.OpDelete, Key: "from"},
+		{Type: storage.OpDelete, Key: "never put"},
+	})
+
+	assert.NoError(t, err)
+	got, _ = s.Get("to")
+	assert.Equal(t, "10", got)
+	_, err = s.Get("from")
+	assert.ErrorIs(t, err, storage.ErrorNoSuchKey)
+}
+
+func testBatch(t *testing.T, s storage.Storage) {
+	got, err := s.Batch([]storage.Op{
+		{Type: storage.OpGet, Key: "one"},
+		{Type: storage.OpPut, Key: "batch:1", Value: "1"},
+		{Type: storage.OpPut, Key: "batch:1", Value: "one"},
+		{Type: storage.OpGet, Key: "batch:1"},
+		{Type: storage.OpGet, Key: "batch:absent"},
+		{Type: storage.OpDelete, Key: "one"},
+		{Type: storage.OpDelete, Key: "one"},
+		{Type: storage.OpCheck, Key: "batch:1"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.Result{
+		{Value: "ONE"},
+		{},
+		{},
+		{Value: "one"},
+		{Err: storage.ErrorNoSuchKey},
+		{},
+		{Err: storage.ErrorNoSuchKey},
+		{Err: storage.ErrorUnknownOp},
+	}, got)
+	_, err = s.Get("one")
+	assert.ErrorIs(t, err, storage.ErrorNoSuchKey)
+}
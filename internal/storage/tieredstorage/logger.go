@@ -0,0 +1,39 @@
+package tieredstorage
+
+import (
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+)
+
+// Logger returns the logger of the storage changes. In write-behind mode
+// the events are logged after the changes are flushed, so other instances
+// don't invalidate their caches before the backing storage has the change.
+func (t *TieredStorage) Logger(next transactionlogger.TransactionLogger) transactionlogger.TransactionLogger {
+	if t.config.Mode != WriteBehind {
+		return next
+	}
+
+	return &flushedLogger{next, t}
+}
+
+type flushedLogger struct {
+	transactionlogger.TransactionLogger
+	storage *TieredStorage
+}
+
+func (l *flushedLogger) WritePut(key, value string) error {
+	return l.storage.deferLog(func() error { return l.TransactionLogger.WritePut(key, value) })
+}
+
+func (l *flushedLogger) WritePutWithTTL(key, value string, expires time.Time) error {
+	return l.storage.deferLog(func() error { return l.TransactionLogger.WritePutWithTTL(key, value, expires) })
+}
+
+func (l *flushedLogger) WriteDelete(key string) error {
+	return l.storage.deferLog(func() error { return l.TransactionLogger.WriteDelete(key) })
+}
+
+func (l *flushedLogger) WriteGroup(events []transactionlogger.Event) error {
+	return l.storage.deferLog(func() error { return l.TransactionLogger.WriteGroup(events) })
+}
@@ -0,0 +1,553 @@
+package tieredstorage
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+)
+
+const (
+	DefaultFlushInterval      = 100 * time.Millisecond
+	DefaultFlushSize          = 1000
+	DefaultInvalidateInterval = time.Second
+
+	// changes of other instances read from the feed at once
+	invalidateBatch = 1000
+	// key locks, a key is locked while it's written or read from the backing storage
+	stripes = 256
+)
+
+// counters of all tiered storages, published at /debug/vars
+var (
+	hits          = new(expvar.Int)
+	misses        = new(expvar.Int)
+	negativeHits  = new(expvar.Int)
+	invalidations = new(expvar.Int)
+	flushed       = new(expvar.Int)
+)
+
+func init() {
+	m := expvar.NewMap("tiered")
+	m.Set("hits", hits)
+	m.Set("misses", misses)
+	m.Set("negative_hits", negativeHits)
+	m.Set("invalidations", invalidations)
+	m.Set("flushed", flushed)
+}
+
+type Mode int
+
+const (
+	// WriteThrough writes a change to the backing storage before it returns.
+	WriteThrough Mode = iota
+	// WriteBehind writes a change to the cache and flushes it to the
+	// backing storage in background.
+	WriteBehind
+)
+
+// ParseMode returns the write mode by name: write-through or write-behind.
+func ParseMode(name string) (Mode, error) {
+	switch name {
+	case "write-through":
+		return WriteThrough, nil
+	case "write-behind":
+		return WriteBehind, nil
+	default:
+		return 0, fmt.Errorf("invalid tiered storage mode: %s", name)
+	}
+}
+
+type Config struct {
+	Mode               Mode
+	NegativeTTL        time.Duration // how long an absent key is cached, 0 to not cache absent keys
+	FlushInterval      time.Duration // of write-behind changes, DefaultFlushInterval if not set
+	FlushSize          int           // pending write-behind keys flushed at once, DefaultFlushSize if not set
+	InvalidateInterval time.Duration // how often the feed is polled, DefaultInvalidateInterval if not set
+}
+
+// ChangeFeed is the log of changes shared by all instances over the same
+// backing storage, the postgres event log.
+type ChangeFeed interface {
+	LastSequence() (uint64, error)
+	KeysChangedAfter(after uint64, limit int) (keys []string, last uint64, err error)
+}
+
+// TieredStorage reads the keys through the cache from the backing storage
+// and writes them to both. The keys changed by other instances are dropped
+// from the cache once they appear in the feed.
+//
+// Scans, conditional operations and transactions are served by the backing
+// storage, in write-behind mode after the pending changes are flushed.
+type TieredStorage struct {
+	logger  *log.Logger
+	cache   storage.Storage
+	backing storage.Storage
+	feed    ChangeFeed // nil if there are no other instances
+	config  Config
+	locks   [stripes]sync.Mutex
+
+	mu       sync.Mutex
+	missing  map[string]time.Time  // negative cache: absent key to its expiration
+	pending  map[string]storage.Op // latest not flushed change of a key
+	flushing map[string]storage.Op // changes being flushed
+	logs     []func() error        // events of pending changes, logged after the flush
+
+	flushMu  sync.Mutex
+	sequence uint64 // of the last change read from the feed
+}
+
+// New returns a storage caching backing in cache, the feed is read from
+// its current end.
+func New(
+	logger *log.Logger,
+	cache storage.Storage,
+	backing storage.Storage,
+	feed ChangeFeed,
+	config Config,
+) (*TieredStorage, error) {
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultFlushInterval
+	}
+	if config.FlushSize <= 0 {
+		config.FlushSize = DefaultFlushSize
+	}
+	if config.InvalidateInterval <= 0 {
+		config.InvalidateInterval = DefaultInvalidateInterval
+	}
+
+	t := &TieredStorage{
+		logger:  logger,
+		cache:   cache,
+		backing: backing,
+		feed:    feed,
+		config:  config,
+		missing: map[string]time.Time{},
+		pending: map[string]storage.Op{},
+	}
+	if feed != nil {
+		seq, err := feed.LastSequence()
+		if err != nil {
+			return nil, fmt.Errorf("cant read change feed: %w", err)
+		}
+		t.sequence = seq
+	}
+
+	return t, nil
+}
+
+func (t *TieredStorage) Put(k, v string) error {
+	unlock := t.lock(k)
+	defer unlock()
+
+	if t.config.Mode == WriteBehind {
+		t.queue(storage.Op{Type: storage.OpPut, Key: k, Value: v})
+	} else if err := t.backing.Put(k, v); err != nil {
+		return err
+	}
+	t.cached(k, v)
+
+	return nil
+}
+
+// PutWithTTL is not supported: the backing storage has no expiration.
+func (t *TieredStorage) PutWithTTL(k, v string, ttl time.Duration) error {
+	return storage.ErrorNotSupported
+}
+
+func (t *TieredStorage) PutIfAbsent(k, v string) error {
+	unlock := t.lock(k)
+	defer unlock()
+
+	if err := t.flushBehind(); err != nil {
+		return err
+	}
+	if err := t.backing.PutIfAbsent(k, v); err != nil {
+		t.drop(k)
+		return err
+	}
+	t.cached(k, v)
+
+	return nil
+}
+
+func (t *TieredStorage) CompareAndSwap(k, expected, new string) error {
+	unlock := t.lock(k)
+	defer unlock()
+
+	if err := t.flushBehind(); err != nil {
+		return err
+	}
+	if err := t.backing.CompareAndSwap(k, expected, new); err != nil {
+		// the cached value may be stale
+		t.drop(k)
+		return err
+	}
+	t.cached(k, new)
+
+	return nil
+}
+
+func (t *TieredStorage) Get(k string) (string, error) {
+	if v, ok, err := t.lookup(k); ok {
+		return v, err
+	}
+
+	unlock := t.lock(k)
+	defer unlock()
+
+	return t.load(k)
+}
+
+func (t *TieredStorage) Delete(k string) error {
+	unlock := t.lock(k)
+	defer unlock()
+
+	if t.config.Mode == WriteBehind {
+		if _, err := t.load(k); err != nil {
+			return err
+		}
+		t.queue(storage.Op{Type: storage.OpDelete, Key: k})
+		_ = t.cache.Delete(k)
+		return nil
+	}
+
+	err := t.backing.Delete(k)
+	if err != nil && !errors.Is(err, storage.ErrorNoSuchKey) {
+		return err
+	}
+	t.absent(k)
+
+	return err
+}
+
+func (t *TieredStorage) Scan(prefix, startAfter string, limit int) ([]string, error) {
+	if err := t.flushBehind(); err != nil {
+		return nil, err
+	}
+
+	return t.backing.Scan(prefix, startAfter, limit)
+}
+
+func (t *TieredStorage) Apply(ops []storage.Op) error {
+	unlock := t.lock(opKeys(ops)...)
+	defer unlock()
+
+	if err := t.flushBehind(); err != nil {
+		return err
+	}
+	if err := t.backing.Apply(ops); err != nil {
+		// a failed check may be caused by stale cached values
+		for _, op := range ops {
+			t.drop(op.Key)
+		}
+		return err
+	}
+	for _, op := range ops {
+		switch op.Type {
+		case storage.OpPut:
+			t.cached(op.Key, op.Value)
+		case storage.OpDelete:
+			t.absent(op.Key)
+		}
+	}
+
+	return nil
+}
+
+func (t *TieredStorage) Batch(ops []storage.Op) ([]storage.Result, error) {
+	unlock := t.lock(opKeys(ops)...)
+	defer unlock()
+
+	if err := t.flushBehind(); err != nil {
+		return nil, err
+	}
+	results, err := t.backing.Batch(ops)
+	if err != nil {
+		for _, op := range ops {
+			t.drop(op.Key)
+		}
+		return nil, err
+	}
+	for i, op := range ops {
+		switch {
+		case op.Type == storage.OpPut:
+			t.cached(op.Key, op.Value)
+		case op.Type == storage.OpDelete:
+			t.absent(op.Key)
+		case op.Type == storage.OpGet && results[i].Err == nil:
+			t.cached(op.Key, results[i].Value)
+		case op.Type == storage.OpGet && errors.Is(results[i].Err, storage.ErrorNoSuchKey):
+			t.absent(op.Key)
+		}
+	}
+
+	return results, nil
+}
+
+// Run starts polling the feed and, in write-behind mode, flushing the
+// changes in background. Call the returned function to stop them, it
+// flushes the pending changes.
+func (t *TieredStorage) Run() (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		invalidate := time.NewTicker(t.config.InvalidateInterval)
+		defer invalidate.Stop()
+		flush := time.NewTicker(t.config.FlushInterval)
+		defer flush.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-invalidate.C:
+				if err := t.Invalidate(); err != nil {
+					t.logger.Printf("cant invalidate cache: %s", err)
+				}
+			case <-flush.C:
+				if err := t.Flush(); err != nil {
+					t.logger.Printf("cant flush changes: %s", err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+			if err := t.Flush(); err != nil {
+				t.logger.Printf("cant flush changes: %s", err)
+			}
+		})
+	}
+}
+
+// Invalidate drops the keys changed since the last call from the cache,
+// it's called by Run and must not be called concurrently. The own changes
+// are dropped too, the next read gets them back.
+func (t *TieredStorage) Invalidate() error {
+	if t.feed == nil {
+		return nil
+	}
+
+	for {
+		keys, last, err := t.feed.KeysChangedAfter(t.sequence, invalidateBatch)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			unlock := t.lock(k)
+			t.drop(k)
+			unlock()
+		}
+		invalidations.Add(int64(len(keys)))
+		t.sequence = last
+
+		if len(keys) < invalidateBatch {
+			return nil
+		}
+	}
+}
+
+// Flush writes the pending changes to the backing storage in one batch and
+// logs their events, the changes are kept pending if it fails.
+func (t *TieredStorage) Flush() error {
+	t.flushMu.Lock()
+	defer t.flushMu.Unlock()
+
+	t.mu.Lock()
+	ops, logs := t.pending, t.logs
+	if len(ops) == 0 && len(logs) == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	t.flushing = ops
+	t.pending = map[string]storage.Op{}
+	t.logs = nil
+	t.mu.Unlock()
+
+	batch := make([]storage.Op, 0, len(ops))
+	for _, op := range ops {
+		batch = append(batch, op)
+	}
+	_, err := t.backing.Batch(batch)
+
+	t.mu.Lock()
+	t.flushing = nil
+	if err != nil {
+		for k, op := range ops {
+			if _, ok := t.pending[k]; !ok {
+				t.pending[k] = op
+			}
+		}
+		t.logs = append(logs, t.logs...)
+		t.mu.Unlock()
+		return fmt.Errorf("cant flush %d changes: %w", len(ops), err)
+	}
+	t.mu.Unlock()
+	flushed.Add(int64(len(ops)))
+
+	for _, write := range logs {
+		if err = write(); err != nil {
+			return fmt.Errorf("cant log flushed change: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// flushBehind flushes the pending changes before an operation the backing
+// storage has to see them for.
+func (t *TieredStorage) flushBehind() error {
+	if t.config.Mode != WriteBehind {
+		return nil
+	}
+
+	return t.Flush()
+}
+
+// queue makes the change pending, flushing the pending ones if there are
+// too many. It's called with the key locked.
+func (t *TieredStorage) queue(op storage.Op) {
+	t.mu.Lock()
+	t.pending[op.Key] = op
+	full := len(t.pending) >= t.config.FlushSize
+	t.mu.Unlock()
+
+	if full {
+		if err := t.Flush(); err != nil {
+			t.logger.Printf("cant flush changes: %s", err)
+		}
+	}
+}
+
+// deferLog logs the event with the next flush of the pending changes.
+func (t *TieredStorage) deferLog(write func() error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.logs = append(t.logs, write)
+
+	return nil
+}
+
+// lookup gets the key from the pending changes or the cache, ok is false
+// if it's not there.
+func (t *TieredStorage) lookup(k string) (v string, ok bool, err error) {
+	t.mu.Lock()
+	op, ok := t.pending[k]
+	if !ok {
+		op, ok = t.flushing[k]
+	}
+	expires, isMissing := t.missing[k]
+	t.mu.Unlock()
+
+	if ok {
+		if op.Type == storage.OpDelete {
+			return "", true, storage.ErrorNoSuchKey
+		}
+		return op.Value, true, nil
+	}
+	if v, err = t.cache.Get(k); err == nil {
+		hits.Add(1)
+		return v, true, nil
+	}
+	if isMissing && time.Now().Before(expires) {
+		negativeHits.Add(1)
+		return "", true, storage.ErrorNoSuchKey
+	}
+
+	return "", false, nil
+}
+
+// load gets the key like Get with the key locked, a missed key is read
+// from the backing storage and cached.
+func (t *TieredStorage) load(k string) (string, error) {
+	if v, ok, err := t.lookup(k); ok {
+		return v, err
+	}
+	misses.Add(1)
+
+	v, err := t.backing.Get(k)
+	switch {
+	case err == nil:
+		t.cached(k, v)
+	case errors.Is(err, storage.ErrorNoSuchKey):
+		t.absent(k)
+	}
+
+	return v, err
+}
+
+func (t *TieredStorage) cached(k, v string) {
+	_ = t.cache.Put(k, v)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.missing, k)
+}
+
+// absent drops the key from the cache and caches that it doesn't exist.
+func (t *TieredStorage) absent(k string) {
+	_ = t.cache.Delete(k)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.config.NegativeTTL > 0 {
+		t.missing[k] = time.Now().Add(t.config.NegativeTTL)
+	} else {
+		delete(t.missing, k)
+	}
+}
+
+// drop drops everything cached about the key.
+func (t *TieredStorage) drop(k string) {
+	_ = t.cache.Delete(k)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.missing, k)
+}
+
+// lock locks the keys in stripe order, so operations on several keys
+// don't deadlock.
+func (t *TieredStorage) lock(keys ...string) (unlock func()) {
+	indexes := make([]int, 0, len(keys))
+	for _, k := range keys {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(k))
+		indexes = append(indexes, int(h.Sum32()%stripes))
+	}
+	slices.Sort(indexes)
+	indexes = slices.Compact(indexes)
+
+	for _, i := range indexes {
+		t.locks[i].Lock()
+	}
+
+	return func() {
+		for _, i := range indexes {
+			t.locks[i].Unlock()
+		}
+	}
+}
+
+func opKeys(ops []storage.Op) []string {
+	keys := make([]string, 0, len(ops))
+	for _, op := range ops {
+		keys = append(keys, op.Key)
+	}
+
+	return keys
+}
@@ -0,0 +1,265 @@
+package tieredstorage_test
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/migrations"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger/postgreslogger"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/postgresstorage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/storagetest"
+	"github.com/dimishpatriot/kv-storage/internal/storage/tieredstorage"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = log.New(io.Discard, "", 0)
+
+// instance is a tiered storage over a database shared with other instances.
+type instance struct {
+	*tieredstorage.TieredStorage
+	cache   storage.Storage
+	dataLog *postgreslogger.PostgresTransactionLogger
+}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = migrations.Apply(db, migrations.SQLite) // the same tables with sqlite sequences
+	require.NoError(t, err)
+
+	return db
+}
+
+func newInstance(t *testing.T, db *sql.DB, config tieredstorage.Config) instance {
+	t.Helper()
+
+	cache := localstorage.New()
+	dataLog := postgreslogger.NewWithDB(logger, db, postgreslogger.DefaultTableName)
+	dataLog.Run()
+	s, err := tieredstorage.New(logger, cache, postgresstorage.New(db, postgresstorage.DefaultTableName), dataLog, config)
+	require.NoError(t, err)
+
+	return instance{s, cache, dataLog}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    tieredstorage.Mode
+		wantErr bool
+	}{
+		{"write-through", tieredstorage.WriteThrough, false},
+		{"write-behind", tieredstorage.WriteBehind, false},
+		{"write-around", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tieredstorage.ParseMode(tt.name)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTieredStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newInstance(t, openDB(t), tieredstorage.Config{NegativeTTL: time.Hour}).TieredStorage
+	})
+}
+
+func TestTieredStorage_ReadThrough(t *testing.T) {
+	db := openDB(t)
+	backing := postgresstorage.New(db, postgresstorage.DefaultTableName)
+	require.NoError(t, backing.Put("one", "1"))
+	s := newInstance(t, db, tieredstorage.Config{})
+
+	v, err := s.Get("one")
+	require.NoError(t, err)
+	assert.Equal(t, "1", v)
+
+	v, err = s.cache.Get("one")
+	require.NoError(t, err, "read key is not cached")
+	assert.Equal(t, "1", v)
+
+	// served by the cache until it's invalidated
+	require.NoError(t, backing.Put("one", "ONE"))
+	v, _ = s.Get("one")
+	assert.Equal(t, "1", v)
+}
+
+func TestTieredStorage_NegativeCache(t *testing.T) {
+	tests := []struct {
+		name        string
+		negativeTTL time.Duration
+		wait        time.Duration
+		want        error
+	}{
+		{"absent key is cached", time.Hour, 0, storage.ErrorNoSuchKey},
+		{"cached absent key expires", time.Millisecond, 5 * time.Millisecond, nil},
+		{"disabled", 0, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openDB(t)
+			s := newInstance(t, db, tieredstorage.Config{NegativeTTL: tt.negativeTTL})
+
+			_, err := s.Get("one")
+			require.ErrorIs(t, err, storage.ErrorNoSuchKey)
+
+			require.NoError(t, postgresstorage.New(db, postgresstorage.DefaultTableName).Put("one", "1"))
+			time.Sleep(tt.wait)
+
+			_, err = s.Get("one")
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestTieredStorage_WriteThrough(t *testing.T) {
+	db := openDB(t)
+	backing := postgresstorage.New(db, postgresstorage.DefaultTableName)
+	s := newInstance(t, db, tieredstorage.Config{NegativeTTL: time.Hour})
+
+	_, err := s.Get("one")
+	require.ErrorIs(t, err, storage.ErrorNoSuchKey)
+	require.NoError(t, s.Put("one", "1"))
+
+	v, err := backing.Get("one")
+	require.NoError(t, err)
+	assert.Equal(t, "1", v)
+	v, err = s.Get("one")
+	require.NoError(t, err, "put doesn't clear the cached absence")
+	assert.Equal(t, "1", v)
+
+	require.ErrorIs(t, s.PutIfAbsent("one", "x"), storage.ErrorConditionFailed)
+	require.NoError(t, s.CompareAndSwap("one", "1", "ONE"))
+	v, _ = backing.Get("one")
+	assert.Equal(t, "ONE", v)
+
+	require.NoError(t, s.Delete("one"))
+	_, err = backing.Get("one")
+	assert.ErrorIs(t, err, storage.ErrorNoSuchKey)
+	_, err = s.Get("one")
+	assert.ErrorIs(t, err, storage.ErrorNoSuchKey)
+	assert.ErrorIs(t, s.PutWithTTL("two", "2", time.Hour), storage.ErrorNotSupported)
+}
+
+func TestTieredStorage_WriteBehind(t *testing.T) {
+	db := openDB(t)
+	backing := postgresstorage.New(db, postgresstorage.DefaultTableName)
+	s := newInstance(t, db, tieredstorage.Config{Mode: tieredstorage.WriteBehind})
+	dataLog := s.Logger(s.dataLog)
+
+	require.NoError(t, s.Put("one", "1"))
+	require.NoError(t, dataLog.WritePut("one", "1"))
+	require.NoError(t, s.Put("two", "2"))
+	require.NoError(t, dataLog.WritePut("two", "2"))
+	require.NoError(t, s.Delete("two"))
+	require.NoError(t, dataLog.WriteDelete("two"))
+
+	// pending changes are served, but not written or logged yet
+	v, err := s.Get("one")
+	require.NoError(t, err)
+	assert.Equal(t, "1", v)
+	_, err = s.Get("two")
+	assert.ErrorIs(t, err, storage.ErrorNoSuchKey)
+	_, err = backing.Get("one")
+	assert.ErrorIs(t, err, storage.ErrorNoSuchKey)
+	seq, _ := s.dataLog.LastSequence()
+	assert.Equal(t, uint64(0), seq)
+
+	require.NoError(t, s.Flush())
+	v, err = backing.Get("one")
+	require.NoError(t, err)
+	assert.Equal(t, "1", v)
+	_, err = backing.Get("two")
+	assert.ErrorIs(t, err, storage.ErrorNoSuchKey)
+	assert.Eventually(t, func() bool {
+		seq, _ = s.dataLog.LastSequence()
+		return seq == 3
+	}, time.Second, time.Millisecond)
+
+	// operations served by the backing storage flush first
+	require.NoError(t, s.Put("three", "3"))
+	keys, err := s.Scan("", "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one", "three"}, keys)
+}
+
+func TestTieredStorage_Invalidate(t *testing.T) {
+	db := openDB(t)
+	a := newInstance(t, db, tieredstorage.Config{NegativeTTL: time.Hour})
+	b := newInstance(t, db, tieredstorage.Config{})
+
+	require.NoError(t, a.Put("one", "1"))
+	_, err := a.Get("two")
+	require.ErrorIs(t, err, storage.ErrorNoSuchKey)
+
+	// b changes the keys and logs the changes like the key service does
+	require.NoError(t, b.Put("one", "ONE"))
+	require.NoError(t, b.dataLog.WritePut("one", "ONE"))
+	require.NoError(t, b.Put("two", "2"))
+	require.NoError(t, b.dataLog.WritePut("two", "2"))
+	assert.Eventually(t, func() bool {
+		seq, _ := b.dataLog.LastSequence()
+		return seq == 2
+	}, time.Second, time.Millisecond)
+
+	v, _ := a.Get("one")
+	assert.Equal(t, "1", v, "cached value before invalidation")
+
+	require.NoError(t, a.Invalidate())
+	v, _ = a.Get("one")
+	assert.Equal(t, "ONE", v)
+	v, _ = a.Get("two")
+	assert.Equal(t, "2", v)
+}
+
+func TestTieredStorage_Apply(t *testing.T) {
+	db := openDB(t)
+	backing := postgresstorage.New(db, postgresstorage.DefaultTableName)
+	s := newInstance(t, db, tieredstorage.Config{})
+	require.NoError(t, s.Put("one", "1"))
+
+	// the cache is stale, the check fails in the backing storage
+	require.NoError(t, backing.Put("one", "ONE"))
+	err := s.Apply([]storage.Op{
+		{Type: storage.OpCheck, Key: "one", Value: "1"},
+		{Type: storage.OpPut, Key: "two", Value: "2"},
+	})
+	require.ErrorIs(t, err, storage.ErrorConditionFailed)
+	v, _ := s.Get("one")
+	assert.Equal(t, "ONE", v, "failed check doesn't drop the stale value")
+
+	require.NoError(t, s.Apply([]storage.Op{
+		{Type: storage.OpCheck, Key: "one", Value: "ONE"},
+		{Type: storage.OpPut, Key: "two", Value: "2"},
+		{Type: storage.OpDelete, Key: "one"},
+	}))
+	v, _ = s.cache.Get("two")
+	assert.Equal(t, "2", v)
+	_, err = s.Get("one")
+	assert.ErrorIs(t, err, storage.ErrorNoSuchKey)
+
+	results, err := s.Batch([]storage.Op{
+		{Type: storage.OpPut, Key: "three", Value: "3"},
+		{Type: storage.OpGet, Key: "two"},
+		{Type: storage.OpGet, Key: "one"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "2", results[1].Value)
+	assert.ErrorIs(t, results[2].Err, storage.ErrorNoSuchKey)
+	v, _ = s.cache.Get("three")
+	assert.Equal(t, "3", v)
+}
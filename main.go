@@ -3,20 +3,113 @@ package main
 import (
 	"flag"
 	"log"
+	"time"
 
 	"github.com/dimishpatriot/kv-storage/cmd/app"
+	"github.com/dimishpatriot/kv-storage/internal/services/raft"
+	"github.com/dimishpatriot/kv-storage/internal/services/replication"
+	"github.com/dimishpatriot/kv-storage/internal/services/router"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger/filelogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/watch"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/tieredstorage"
 	"github.com/joho/godotenv"
 )
 
 func main() {
 	storageType := flag.String("s", "local", "type of storage")
+	shards := flag.Int("shards", 1, "number of local storage shards, each with its own lock")
+	maxBytes := flag.Int64("max-bytes", 0, "local storage budget for keys and values in bytes, 0 for no limit")
+	maxKeys := flag.Int("max-keys", 0, "max number of local storage keys, 0 for no limit")
+	eviction := flag.String("eviction", "lru", "which keys local storage evicts over the budget: lru, lfu or random")
+	logEvictions := flag.Bool("log-evictions", false, "log evicted keys as deletes, so a restart doesn't restore them")
+	tieredMode := flag.String("tiered-mode", "write-through", "how tiered storage writes to postgres: write-through or write-behind")
+	negativeTTL := flag.Duration("negative-ttl", 0, "how long tiered storage caches that a key is absent, 0 to not cache it")
+	flushInterval := flag.Duration("flush-interval", tieredstorage.DefaultFlushInterval, "how often tiered storage flushes write-behind changes")
+	invalidateInterval := flag.Duration("invalidate-interval", tieredstorage.DefaultInvalidateInterval, "how often tiered storage polls the keys changed by other instances")
+	sqliteFilename := flag.String("db", "kv.db", "database file of sqlite storage")
+	snapshotInterval := flag.Duration("snapshot-interval", 10*time.Minute, "how often local storage snapshots are taken, 0 to disable")
+	snapshotEvents := flag.Uint64("snapshot-events", 100000, "take local storage snapshot or compact the raft log after this many events, 0 to disable")
+	syncMode := flag.String("sync", "interval", "when local storage log is flushed to disk: none, interval or always")
+	syncInterval := flag.Duration("sync-interval", filelogger.DefaultSyncInterval, "how often the log is flushed in interval sync mode")
+	watchHistory := flag.Int("watch-history", watch.DefaultHistory, "number of the latest changes a watch can resume from")
+	watchBuffer := flag.Int("watch-buffer", watch.DefaultBuffer, "number of changes a slow watch may lag behind before it's dropped")
+	addr := flag.String("addr", ":8080", "address to listen on")
+	respAddr := flag.String("resp-addr", "", "address to listen on for Redis clients, empty to not serve them")
+	grpcAddr := flag.String("grpc-addr", "", "address to listen on for gRPC clients, empty to not serve them")
+	replicateFrom := flag.String("replicate-from", "", "leader URL, runs the node as a read-only replica of local storage")
+	replicationInterval := flag.Duration("replication-interval", replication.DefaultInterval, "how often an up to date replica polls the leader")
+	raftID := flag.String("raft-id", "", "ID of the node, runs it as a member of a Raft cluster of local storages")
+	raftMembers := flag.String("raft-members", "", "initial cluster members as id=url pairs separated by commas, empty to join a running cluster")
+	raftDir := flag.String("raft-dir", "raft", "directory of the Raft log of the node")
+	routerNodes := flag.String("router-nodes", "", "nodes as id=url pairs separated by commas, runs the node as a router to them")
+	routerHealthInterval := flag.Duration("router-health-interval", router.DefaultHealthInterval, "how often the router checks the nodes")
 	flag.Parse()
 
+	sync, err := filelogger.ParseSyncMode(*syncMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	evictor, err := localstorage.ParseEvictor(*eviction)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mode, err := tieredstorage.ParseMode(*tieredMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	members, err := raft.ParseMembers(*raftMembers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	nodes, err := router.ParseNodes(*routerNodes)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	if err := godotenv.Load(".env"); err != nil {
 		log.Fatal("can't get environment variables: %w", err)
 	}
 
-	app, err := app.New(app.AppConfig{StorageType: *storageType})
+	config := app.AppConfig{
+		StorageType:      *storageType,
+		Shards:           *shards,
+		Limits:           localstorage.Limits{MaxBytes: *maxBytes, MaxKeys: *maxKeys, Evictor: evictor},
+		LogEvictions:     *logEvictions,
+		Tiered:           tieredstorage.Config{Mode: mode, NegativeTTL: *negativeTTL, FlushInterval: *flushInterval, InvalidateInterval: *invalidateInterval},
+		SQLiteFilename:   *sqliteFilename,
+		SnapshotInterval: *snapshotInterval,
+		SnapshotEvents:   *snapshotEvents,
+		Sync:             sync,
+		SyncInterval:     *syncInterval,
+		Watch:            watch.Config{History: *watchHistory, Buffer: *watchBuffer},
+		Addr:             *addr,
+		RESPAddr:         *respAddr,
+		GRPCAddr:         *grpcAddr,
+
+		ReplicateFrom:       *replicateFrom,
+		ReplicationInterval: *replicationInterval,
+
+		RaftID:      *raftID,
+		RaftMembers: members,
+		RaftDir:     *raftDir,
+
+		RouterNodes:          nodes,
+		RouterHealthInterval: *routerHealthInterval,
+	}
+
+	if flag.Arg(0) == "migrate" {
+		if err = app.Migrate(config); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	app, err := app.New(config)
 	if err != nil {
 		log.Fatal("can't create new application: %w", err)
 	}
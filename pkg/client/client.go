@@ -0,0 +1,359 @@
+// Package client is a Go client of the kv-storage HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRetries    = 3
+	DefaultBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff = 2 * time.Second
+	DefaultTimeout    = 30 * time.Second
+)
+
+var (
+	ErrorNoSuchKey        = errors.New("no such key")
+	ErrorConditionFailed  = errors.New("condition failed")
+	ErrorInvalidRequest   = errors.New("invalid request")
+	ErrorNotSupported     = errors.New("not supported by the storage")
+	ErrorUnexpectedStatus = errors.New("unexpected response")
+)
+
+type Config struct {
+	URL        string        // base URL of the service
+	HTTPClient *http.Client  // nil for a client keeping a pool of connections
+	Retries    int           // after a 5xx response or a network error, < 0 for none
+	Backoff    time.Duration // before the first retry, doubled for every next one
+	MaxBackoff time.Duration
+}
+
+// Client calls the key API. A request is retried after a network error or
+// a 5xx response if it's safe: gets, puts and deletes always, conditional
+// puts, batches and transactions only after 503, as they aren't run then.
+// A failed attempt may still have been applied, so a delete retried after
+// it doesn't report the key it may have deleted itself as absent.
+type Client struct {
+	base   string
+	config Config
+}
+
+func New(config Config) (*Client, error) {
+	if _, err := url.ParseRequestURI(config.URL); err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if config.HTTPClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = 64
+		config.HTTPClient = &http.Client{Transport: transport, Timeout: DefaultTimeout}
+	}
+	if config.Retries == 0 {
+		config.Retries = DefaultRetries
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = DefaultBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultMaxBackoff
+	}
+
+	return &Client{base: strings.TrimSuffix(config.URL, "/"), config: config}, nil
+}
+
+// Get returns the value of the key, ErrorNoSuchKey if there is none.
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	res, err := c.do(ctx, request{method: http.MethodGet, path: keyPath(key), idempotent: true})
+	if err != nil {
+		return "", err
+	}
+
+	return string(res.body), nil
+}
+
+func (c *Client) Put(ctx context.Context, key, value string) error {
+	return c.put(ctx, keyPath(key), value, nil)
+}
+
+// PutWithTTL puts the value which expires after the ttl.
+func (c *Client) PutWithTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	q := url.Values{"ttl": {ttl.String()}}
+	return c.put(ctx, keyPath(key)+"?"+q.Encode(), value, nil)
+}
+
+// PutIfAbsent puts the value only if the key is absent, ErrorConditionFailed if not.
+// It's retried only after 503: a retry of an applied put would fail the condition.
+func (c *Client) PutIfAbsent(ctx context.Context, key, value string) error {
+	_, err := c.do(ctx, request{
+		method: http.MethodPut,
+		path:   keyPath(key),
+		header: http.Header{"If-None-Match": {"*"}},
+		body:   []byte(value),
+	})
+
+	return err
+}
+
+func (c *Client) put(ctx context.Context, path, value string, header http.Header) error {
+	_, err := c.do(ctx, request{
+		method:     http.MethodPut,
+		path:       path,
+		header:     header,
+		body:       []byte(value),
+		idempotent: true,
+	})
+
+	return err
+}
+
+// Delete deletes the key, ErrorNoSuchKey if there is none. If an attempt
+// failed after it may have been applied, no key on the retry is a success.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	_, err := c.do(ctx, request{
+		method:     http.MethodDelete,
+		path:       keyPath(key),
+		idempotent: true,
+		deletes:    true,
+	})
+
+	return err
+}
+
+// Page is a page of keys in ascending order.
+type Page struct {
+	Keys []string `json:"keys"`
+	Next string   `json:"next,omitempty"` // pass as after to get the next page, empty for the last one
+}
+
+// Scan returns the keys with the prefix after the key, limit 0 is the
+// service default.
+func (c *Client) Scan(ctx context.Context, prefix, after string, limit int) (Page, error) {
+	q := url.Values{}
+	if prefix != "" {
+		q.Set("prefix", prefix)
+	}
+	if after != "" {
+		q.Set("after", after)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+
+	res, err := c.do(ctx, request{method: http.MethodGet, path: "/v1?" + q.Encode(), idempotent: true})
+	if err != nil {
+		return Page{}, err
+	}
+
+	var page Page
+	if err = json.Unmarshal(res.body, &page); err != nil {
+		return Page{}, fmt.Errorf("cant decode keys: %w", err)
+	}
+
+	return page, nil
+}
+
+type OpType string
+
+const (
+	OpGet         OpType = "get"          // batch only
+	OpPut         OpType = "put"          // both
+	OpDelete      OpType = "delete"       // both
+	OpCheck       OpType = "check"        // transaction only: the key has the value
+	OpCheckAbsent OpType = "check_absent" // transaction only: the key doesn't exist
+)
+
+type Op struct {
+	Op    OpType `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// Result is the result of a batch operation, Status is the code of the
+// same single key request.
+type Result struct {
+	Key    string `json:"key"`
+	Status int    `json:"status"`
+	Value  string `json:"value,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Err returns the error of the operation as a single key request would.
+func (r Result) Err() error {
+	if r.Status < 300 {
+		return nil
+	}
+
+	return statusError(r.Status, r.Error)
+}
+
+// Batch runs independent operations and returns their results in the same
+// order, a failed operation doesn't stop the others.
+func (c *Client) Batch(ctx context.Context, ops []Op) ([]Result, error) {
+	body, err := json.Marshal(ops)
+	if err != nil {
+		return nil, fmt.Errorf("cant encode operations: %w", err)
+	}
+
+	res, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/v1/batch",
+		header: http.Header{"Content-Type": {"application/json"}},
+		body:   body,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	if err = json.Unmarshal(res.body, &results); err != nil {
+		return nil, fmt.Errorf("cant decode results: %w", err)
+	}
+	if len(results) != len(ops) {
+		// the request broke after some of the results
+		return results, fmt.Errorf("%w: %d results of %d operations", ErrorUnexpectedStatus, len(results), len(ops))
+	}
+
+	return results, nil
+}
+
+// Txn applies the operations atomically: all of them or none,
+// ErrorConditionFailed if a check fails.
+func (c *Client) Txn(ctx context.Context, ops []Op) error {
+	body, err := json.Marshal(ops)
+	if err != nil {
+		return fmt.Errorf("cant encode operations: %w", err)
+	}
+
+	_, err = c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/v1/txn",
+		header: http.Header{"Content-Type": {"application/json"}},
+		body:   body,
+	})
+
+	return err
+}
+
+type request struct {
+	method     string
+	path       string
+	header     http.Header
+	body       []byte
+	idempotent bool // may be retried after any 5xx or a network error
+	deletes    bool // 404 after an attempt which may have been applied is a success
+}
+
+type response struct {
+	status int
+	body   []byte
+}
+
+// do sends the request, retrying it with backoff, and returns the response
+// of a 2xx status or the error of the other ones.
+func (c *Client) do(ctx context.Context, r request) (response, error) {
+	applied := false // by a failed attempt, as far as the client knows
+	for attempt := 0; ; attempt++ {
+		res, err := c.send(ctx, r)
+		if ctx.Err() != nil {
+			return response{}, ctx.Err()
+		}
+
+		retryable := r.idempotent
+		switch {
+		case err != nil:
+		case res.status == http.StatusServiceUnavailable:
+			retryable = true
+		case res.status >= 500 && res.status != http.StatusNotImplemented:
+		case res.status == http.StatusNotFound && r.deletes && applied:
+			return res, nil
+		case res.status >= 300:
+			return response{}, statusError(res.status, strings.TrimSpace(string(res.body)))
+		default:
+			return res, nil
+		}
+
+		if !retryable || attempt >= c.config.Retries {
+			if err != nil {
+				return response{}, err
+			}
+			return response{}, statusError(res.status, strings.TrimSpace(string(res.body)))
+		}
+		if err != nil || res.status != http.StatusServiceUnavailable {
+			applied = true
+		}
+		if err = c.wait(ctx, attempt); err != nil {
+			return response{}, err
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, r request) (response, error) {
+	req, err := http.NewRequestWithContext(ctx, r.method, c.base+r.path, bytes.NewReader(r.body))
+	if err != nil {
+		return response{}, fmt.Errorf("cant make request: %w", err)
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+
+	res, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return response{}, fmt.Errorf("cant send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return response{}, fmt.Errorf("cant read response: %w", err)
+	}
+
+	return response{res.StatusCode, b}, nil
+}
+
+// wait sleeps before the retry for the backoff of the attempt with jitter,
+// so the clients failed together don't retry together.
+func (c *Client) wait(ctx context.Context, attempt int) error {
+	d := c.config.Backoff << attempt
+	if d <= 0 || d > c.config.MaxBackoff {
+		d = c.config.MaxBackoff
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func statusError(status int, message string) error {
+	switch status {
+	case http.StatusNotFound:
+		return ErrorNoSuchKey
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("%w: %s", ErrorConditionFailed, message)
+	case http.StatusBadRequest:
+		return fmt.Errorf("%w: %s", ErrorInvalidRequest, message)
+	case http.StatusNotImplemented:
+		return fmt.Errorf("%w: %s", ErrorNotSupported, message)
+	default:
+		return fmt.Errorf("%w %d: %s", ErrorUnexpectedStatus, status, message)
+	}
+}
+
+func keyPath(key string) string {
+	return "/v1/" + url.PathEscape(key)
+}
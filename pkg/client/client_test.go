@@ -0,0 +1,345 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/handler"
+	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/watch"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
+	"github.com/dimishpatriot/kv-storage/pkg/client"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = log.New(io.Discard, "", 0)
+
+// serve starts the real handler over local storage, every request passes
+// through the middleware first.
+func serve(t *testing.T, middleware func(http.Handler) http.Handler) *client.Client {
+	t.Helper()
+
+	c, _ := serveWithHub(t, middleware)
+
+	return c
+}
+
+// serveWithHub is serve which returns the watch hub too.
+func serveWithHub(t *testing.T, middleware func(http.Handler) http.Handler) (*client.Client, *watch.Hub) {
+	t.Helper()
+
+	tLogger := transactionlogger.NewMockTransactionLogger(t)
+	tLogger.EXPECT().WritePut(mock.Anything, mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WritePutWithTTL(mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WriteDelete(mock.Anything).Return(nil).Maybe()
+	tLogger.EXPECT().WriteGroup(mock.Anything).Return(nil).Maybe()
+	hub := watch.New(logger, tLogger, watch.Config{History: 3})
+	h := handler.New(keyservice.New(logger, localstorage.New(), hub))
+
+	r := mux.NewRouter()
+	r.HandleFunc("/v1", h.Scan).Methods("GET")
+	r.HandleFunc("/v1/txn", h.Txn).Methods("POST")
+	r.HandleFunc("/v1/batch", h.Batch).Methods("POST")
+	r.HandleFunc("/v1/watch", handler.NewWatch(hub).Watch).Methods("GET")
+	r.HandleFunc("/v1/{key}", h.Put).Methods("PUT")
+	r.HandleFunc("/v1/{key}", h.Get).Methods("GET")
+	r.HandleFunc("/v1/{key}", h.Delete).Methods("DELETE")
+	var next http.Handler = r
+	if middleware != nil {
+		next = middleware(r)
+	}
+	s := httptest.NewServer(next)
+	t.Cleanup(s.Close)
+
+	c, err := client.New(client.Config{URL: s.URL + "/", Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	require.NoError(t, err)
+
+	return c, hub
+}
+
+func TestClient_Keys(t *testing.T) {
+	ctx := context.Background()
+	c := serve(t, nil)
+
+	require.NoError(t, c.Put(ctx, "one", "1"))
+	v, err := c.Get(ctx, "one")
+	require.NoError(t, err)
+	assert.Equal(t, "1", v)
+
+	assert.ErrorIs(t, c.PutIfAbsent(ctx, "one", "x"), client.ErrorConditionFailed)
+	require.NoError(t, c.PutIfAbsent(ctx, "two", "2"))
+	require.NoError(t, c.PutWithTTL(ctx, "three", "3", time.Hour))
+	v, err = c.Get(ctx, "three")
+	require.NoError(t, err)
+	assert.Equal(t, "3", v)
+
+	require.NoError(t, c.Delete(ctx, "one"))
+	assert.ErrorIs(t, c.Delete(ctx, "one"), client.ErrorNoSuchKey)
+	_, err = c.Get(ctx, "one")
+	assert.ErrorIs(t, err, client.ErrorNoSuchKey)
+
+	err = c.Put(ctx, "a b", "1")
+	assert.ErrorIs(t, err, client.ErrorInvalidRequest)
+	assert.EqualError(t, err, "invalid request: forbidden symbol in key")
+	assert.ErrorIs(t, c.Put(ctx, "one", ""), client.ErrorInvalidRequest)
+}
+
+func TestClient_Scan(t *testing.T) {
+	ctx := context.Background()
+	c := serve(t, nil)
+	for _, k := range []string{"a1", "a2", "a3", "b1"} {
+		require.NoError(t, c.Put(ctx, k, "v"))
+	}
+
+	page, err := c.Scan(ctx, "a", "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, client.Page{Keys: []string{"a1", "a2"}, Next: "a2"}, page)
+
+	page, err = c.Scan(ctx, "a", page.Next, 2)
+	require.NoError(t, err)
+	assert.Equal(t, client.Page{Keys: []string{"a3"}}, page)
+
+	page, err = c.Scan(ctx, "", "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a1", "a2", "a3", "b1"}, page.Keys)
+
+	_, err = c.Scan(ctx, "", "", 5000)
+	assert.ErrorIs(t, err, client.ErrorInvalidRequest)
+}
+
+func TestClient_BatchTxn(t *testing.T) {
+	ctx := context.Background()
+	c := serve(t, nil)
+
+	results, err := c.Batch(ctx, []client.Op{
+		{Op: client.OpPut, Key: "one", Value: "1"},
+		{Op: client.OpGet, Key: "one"},
+		{Op: client.OpDelete, Key: "absent"},
+		{Op: "check", Key: "one"},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	assert.Equal(t, client.Result{Key: "one", Status: http.StatusCreated}, results[0])
+	assert.Equal(t, client.Result{Key: "one", Status: http.StatusOK, Value: "1"}, results[1])
+	assert.NoError(t, results[1].Err())
+	assert.ErrorIs(t, results[2].Err(), client.ErrorNoSuchKey)
+	assert.ErrorIs(t, results[3].Err(), client.ErrorInvalidRequest)
+
+	require.NoError(t, c.Txn(ctx, []client.Op{
+		{Op: client.OpCheck, Key: "one", Value: "1"},
+		{Op: client.OpPut, Key: "one", Value: "2"},
+		{Op: client.OpCheckAbsent, Key: "two"},
+	}))
+	err = c.Txn(ctx, []client.Op{
+		{Op: client.OpCheck, Key: "one", Value: "1"},
+		{Op: client.OpDelete, Key: "one"},
+	})
+	assert.ErrorIs(t, err, client.ErrorConditionFailed)
+	v, err := c.Get(ctx, "one")
+	require.NoError(t, err)
+	assert.Equal(t, "2", v)
+}
+
+// failing fails the first n requests with the status.
+func failing(n int32, status int, calls *atomic.Int32) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= n {
+				http.Error(w, "failed", status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	tests := []struct {
+		name      string
+		fails     int32
+		status    int
+		call      func(*client.Client) error
+		wantCalls int32
+		wantErr   error
+	}{
+		{
+			"put retried",
+			2,
+			http.StatusBadGateway,
+			func(c *client.Client) error { return c.Put(context.Background(), "one", "1") },
+			3,
+			nil,
+		},
+		{
+			"retries exhausted",
+			10,
+			http.StatusInternalServerError,
+			func(c *client.Client) error { _, err := c.Get(context.Background(), "one"); return err },
+			1 + client.DefaultRetries,
+			client.ErrorUnexpectedStatus,
+		},
+		{
+			"not implemented isn't retried",
+			10,
+			http.StatusNotImplemented,
+			func(c *client.Client) error { return c.Put(context.Background(), "one", "1") },
+			1,
+			client.ErrorNotSupported,
+		},
+		{
+			"txn isn't retried after 500",
+			1,
+			http.StatusInternalServerError,
+			func(c *client.Client) error {
+				return c.Txn(context.Background(), []client.Op{{Op: client.OpPut, Key: "one", Value: "1"}})
+			},
+			1,
+			client.ErrorUnexpectedStatus,
+		},
+		{
+			"txn retried after 503",
+			1,
+			http.StatusServiceUnavailable,
+			func(c *client.Client) error {
+				return c.Txn(context.Background(), []client.Op{{Op: client.OpPut, Key: "one", Value: "1"}})
+			},
+			2,
+			nil,
+		},
+		{
+			"put if absent isn't retried after 500",
+			1,
+			http.StatusInternalServerError,
+			func(c *client.Client) error { return c.PutIfAbsent(context.Background(), "one", "1") },
+			1,
+			client.ErrorUnexpectedStatus,
+		},
+		{
+			"put if absent retried after 503",
+			1,
+			http.StatusServiceUnavailable,
+			func(c *client.Client) error { return c.PutIfAbsent(context.Background(), "one", "1") },
+			2,
+			nil,
+		},
+		{
+			"client error isn't retried",
+			1,
+			http.StatusConflict,
+			func(c *client.Client) error { return c.Delete(context.Background(), "one") },
+			1,
+			client.ErrorUnexpectedStatus,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := &atomic.Int32{}
+			c := serve(t, failing(tt.fails, tt.status, calls))
+
+			err := tt.call(c)
+
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantCalls, calls.Load())
+		})
+	}
+}
+
+// appliedFailing applies the first request of the method, but fails its
+// response with the status.
+func appliedFailing(method string, status int) func(http.Handler) http.Handler {
+	failed := &atomic.Bool{}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == method && failed.CompareAndSwap(false, true) {
+				next.ServeHTTP(httptest.NewRecorder(), r)
+				http.Error(w, "failed", status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestClient_DeleteRetried(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		status  int
+		wantErr error
+	}{
+		{"applied before 502", http.StatusBadGateway, nil},
+		// 503 isn't applied, so there was no key
+		{"applied before 503", http.StatusServiceUnavailable, client.ErrorNoSuchKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := serve(t, appliedFailing(http.MethodDelete, tt.status))
+			require.NoError(t, c.Put(ctx, "one", "1"))
+
+			err := c.Delete(ctx, "one")
+
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+			_, err = c.Get(ctx, "one")
+			assert.ErrorIs(t, err, client.ErrorNoSuchKey)
+		})
+	}
+	t.Run("no key", func(t *testing.T) {
+		c := serve(t, nil)
+
+		assert.ErrorIs(t, c.Delete(ctx, "one"), client.ErrorNoSuchKey)
+	})
+}
+
+func TestClient_Context(t *testing.T) {
+	calls := &atomic.Int32{}
+	s := httptest.NewServer(failing(1000, http.StatusServiceUnavailable, calls)(nil))
+	t.Cleanup(s.Close)
+	c, err := client.New(client.Config{URL: s.URL, Retries: 1000, Backoff: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.Get(ctx, "one")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, calls.Load(), int32(20))
+
+	_, err = client.New(client.Config{URL: "localhost"})
+	assert.Error(t, err)
+}
+
+func ExampleClient() {
+	c, err := client.New(client.Config{URL: "http://localhost:8080"})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	v, err := c.Get(context.Background(), "key")
+	switch {
+	case errors.Is(err, client.ErrorNoSuchKey):
+		fmt.Println("no key")
+	case err != nil:
+		log.Fatal(err)
+	default:
+		fmt.Println(v)
+	}
+}
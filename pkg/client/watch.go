@@ -0,0 +1,173 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorSequenceGone = errors.New("changes after the sequence are gone")
+	ErrorWatchDropped = errors.New("watch dropped by the service")
+)
+
+type EventType string
+
+const (
+	EventPut    EventType = "put"
+	EventDelete EventType = "delete"
+)
+
+// Event is a change of a watched key.
+type Event struct {
+	Sequence uint64    `json:"sequence"` // pass as after to resume the watch
+	Type     EventType `json:"type"`
+	Key      string    `json:"key"`
+	Value    string    `json:"value,omitempty"`
+	Expires  time.Time `json:"expires,omitempty"` // zero if the key never expires
+}
+
+// Watch streams the changes of keys with the prefix after the sequence,
+// 0 for new changes only. The events channel is closed when the stream
+// ends, then the error channel gets why: the context error if it's done,
+// ErrorSequenceGone if the changes to resume from are gone,
+// ErrorWatchDropped if the watch lagged too far behind.
+func (c *Client) Watch(ctx context.Context, prefix string, after uint64) (<-chan Event, <-chan error) {
+	events := make(chan Event)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+
+		errs <- c.watch(ctx, prefix, after, events)
+	}()
+
+	return events, errs
+}
+
+func (c *Client) watch(ctx context.Context, prefix string, after uint64, events chan<- Event) error {
+	q := url.Values{}
+	if prefix != "" {
+		q.Set("prefix", prefix)
+	}
+	if after > 0 {
+		q.Set("after", strconv.FormatUint(after, 10))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/v1/watch?"+q.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("cant make request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// the stream has no deadline, the context ends it
+	client := *c.config.HTTPClient
+	client.Timeout = 0
+	res, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("cant send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(res.Body)
+		if res.StatusCode == http.StatusGone {
+			return ErrorSequenceGone
+		}
+		return statusError(res.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	err = readEvents(res.Body, func(e Event) error {
+		select {
+		case events <- e:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+type eventData struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Expires string `json:"expires"`
+}
+
+// readEvents parses the Server-Sent Events of the stream.
+func readEvents(r io.Reader, send func(Event) error) error {
+	var id, name, data string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			name = value
+		case "data":
+			data = value
+		case "":
+			if line != "" {
+				// a comment
+				continue
+			}
+			if name == "" {
+				continue
+			}
+			if name == "error" {
+				return fmt.Errorf("%w: %s", ErrorWatchDropped, data)
+			}
+			e, err := parseEvent(id, name, data)
+			if err != nil {
+				return err
+			}
+			if err = send(e); err != nil {
+				return err
+			}
+			id, name, data = "", "", ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cant read events: %w", err)
+	}
+
+	return io.ErrUnexpectedEOF
+}
+
+func parseEvent(id, name, data string) (Event, error) {
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return Event{}, fmt.Errorf("invalid event id %q: %w", id, err)
+	}
+	var d eventData
+	if err = json.Unmarshal([]byte(data), &d); err != nil {
+		return Event{}, fmt.Errorf("cant decode event: %w", err)
+	}
+
+	e := Event{Sequence: seq, Type: EventType(name), Key: d.Key, Value: d.Value}
+	if d.Expires != "" {
+		if e.Expires, err = time.Parse(time.RFC3339Nano, d.Expires); err != nil {
+			return Event{}, fmt.Errorf("invalid event expires: %w", err)
+		}
+	}
+
+	return e, nil
+}
@@ -0,0 +1,51 @@
+package client_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Watch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, hub := serveWithHub(t, nil)
+	require.NoError(t, c.Put(ctx, "user-1", "1"))
+
+	// resumes after the first change
+	first := hub.Sequence()
+	events, errs := c.Watch(ctx, "user-", first)
+	require.NoError(t, c.Put(ctx, "other", "x"))
+	require.NoError(t, c.PutWithTTL(ctx, "user-2", "2", time.Hour))
+	require.NoError(t, c.Delete(ctx, "user-1"))
+
+	e := <-events
+	assert.Equal(t, first+2, e.Sequence)
+	assert.Equal(t, client.EventPut, e.Type)
+	assert.Equal(t, "user-2", e.Key)
+	assert.Equal(t, "2", e.Value)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), e.Expires, time.Minute)
+	assert.Equal(t, client.Event{Sequence: first + 3, Type: client.EventDelete, Key: "user-1"}, <-events)
+
+	cancel()
+	for range events {
+	}
+	assert.ErrorIs(t, <-errs, context.Canceled)
+}
+
+func TestClient_WatchGone(t *testing.T) {
+	ctx := context.Background()
+	c := serve(t, nil)
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, c.Put(ctx, k, "v"))
+	}
+
+	events, errs := c.Watch(ctx, "", 1)
+	_, ok := <-events
+	assert.False(t, ok)
+	assert.ErrorIs(t, <-errs, client.ErrorSequenceGone)
+}
@@ -0,0 +1,277 @@
+// Package kvstore embeds the key-value storage in a process: the local
+// storage with its transaction log and snapshots in a directory, restored
+// on Open the same way the service does it with -s=local.
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/internal/services/keyservice"
+	"github.com/dimishpatriot/kv-storage/internal/services/snapshot"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger"
+	"github.com/dimishpatriot/kv-storage/internal/services/transactionlogger/filelogger"
+	"github.com/dimishpatriot/kv-storage/internal/storage"
+	"github.com/dimishpatriot/kv-storage/internal/storage/localstorage"
+)
+
+const (
+	logFilename   = "transaction.log"
+	snapshotDir   = "snapshots"
+	sweepInterval = time.Second
+)
+
+var (
+	ErrorNoSuchKey       = storage.ErrorNoSuchKey
+	ErrorConditionFailed = storage.ErrorConditionFailed
+	ErrorInvalidTTL      = storage.ErrorInvalidTTL
+	ErrorClosed          = errors.New("store is closed")
+)
+
+// Op is an operation of Apply.
+type (
+	Op     = storage.Op
+	OpType = storage.OpType
+)
+
+const (
+	OpPut         = storage.OpPut
+	OpDelete      = storage.OpDelete
+	OpCheck       = storage.OpCheck
+	OpCheckAbsent = storage.OpCheckAbsent
+)
+
+// SyncMode sets when the log is flushed to disk.
+type SyncMode int
+
+const (
+	// SyncInterval flushes every Options.SyncInterval,
+	// a crash may lose changes of the last interval.
+	SyncInterval SyncMode = iota
+	// SyncNone leaves flushing to the OS, a crash may lose recent changes.
+	SyncNone
+	// SyncAlways flushes before a change returns.
+	SyncAlways
+)
+
+var syncModes = map[SyncMode]filelogger.SyncMode{
+	SyncInterval: filelogger.SyncModeInterval,
+	SyncNone:     filelogger.SyncModeNone,
+	SyncAlways:   filelogger.SyncModeAlways,
+}
+
+type Options struct {
+	Sync             SyncMode
+	SyncInterval     time.Duration // 100ms if not set
+	Shards           int           // a single one for < 2
+	SnapshotInterval time.Duration // take a snapshot this often, 0 disables the trigger
+	SnapshotEvents   uint64        // take a snapshot after this many changes, 0 disables the trigger
+	Logger           *log.Logger   // nil to discard
+}
+
+// localStorage is a single or a sharded local storage.
+type localStorage interface {
+	storage.Storage
+	snapshot.Storage
+	RunSweeper(interval time.Duration, onExpire func(key string)) (stop func())
+}
+
+// Store is safe for concurrent use. Only one Store may use a directory at a time.
+type Store struct {
+	keyService  keyservice.KeyService
+	log         *filelogger.FileTransactionLogger
+	snapshotter *snapshot.Snapshotter
+	stops       []func()
+
+	mu     sync.RWMutex // Close waits for the calls in progress
+	closed bool
+}
+
+// Open opens the store in the directory, creating it if needed,
+// and restores the data from the latest snapshot and the log.
+func Open(dir string, opts Options) (*Store, error) {
+	mode, ok := syncModes[opts.Sync]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", filelogger.ErrorUnknownSyncMode, opts.Sync)
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cant create dir: %w", err)
+	}
+
+	var ls localStorage
+	if opts.Shards > 1 {
+		ls = localstorage.NewSharded(opts.Shards, localstorage.Limits{}).(localStorage)
+	} else {
+		ls = localstorage.New().(localStorage)
+	}
+
+	l, err := filelogger.New(logger, filelogger.Config{
+		Filename:     filepath.Join(dir, logFilename),
+		Sync:         mode,
+		SyncInterval: opts.SyncInterval,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cant open log: %w", err)
+	}
+	fl := l.(*filelogger.FileTransactionLogger)
+
+	snapshotter, err := snapshot.New(logger, snapshot.Config{
+		Dir:      filepath.Join(dir, snapshotDir),
+		Interval: opts.SnapshotInterval,
+		Events:   opts.SnapshotEvents,
+	}, ls, fl)
+	if err == nil {
+		err = restore(fl, snapshotter, ls)
+	}
+	if err != nil {
+		fl.Close()
+		return nil, err
+	}
+
+	fl.Run()
+	s := &Store{
+		keyService:  keyservice.New(logger, ls, fl),
+		log:         fl,
+		snapshotter: snapshotter,
+	}
+	s.stops = append(s.stops, ls.RunSweeper(sweepInterval, func(key string) {
+		if err := fl.WriteDelete(key); err != nil {
+			logger.Printf("cant log expiration of %s: %s", key, err)
+		}
+	}))
+	if opts.SnapshotInterval > 0 || opts.SnapshotEvents > 0 {
+		s.stops = append(s.stops, snapshotter.Run())
+	}
+
+	return s, nil
+}
+
+func restore(l *filelogger.FileTransactionLogger, snapshotter *snapshot.Snapshotter, s storage.Storage) error {
+	after, err := snapshotter.Restore()
+	if err != nil {
+		return fmt.Errorf("cant restore snapshot: %w", err)
+	}
+	if err = transactionlogger.ReplayAfter(l, s, after); err != nil {
+		return fmt.Errorf("cant restore data: %w", err)
+	}
+
+	return nil
+}
+
+// Close stops the background work and flushes the log to disk.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrorClosed
+	}
+	s.closed = true
+
+	for _, stop := range s.stops {
+		stop()
+	}
+	if err := s.log.Close(); err != nil {
+		return fmt.Errorf("cant close log: %w", err)
+	}
+
+	return nil
+}
+
+// Snapshot saves the data to a snapshot, so the log before it can be
+// dropped, and returns the sequence of the last change in it.
+func (s *Store) Snapshot() (uint64, error) {
+	var seq uint64
+	err := s.call(func() (err error) {
+		seq, err = s.snapshotter.Take()
+		return err
+	})
+
+	return seq, err
+}
+
+func (s *Store) Get(key string) (string, error) {
+	var v string
+	err := s.call(func() (err error) {
+		v, err = s.keyService.Get(key)
+		return err
+	})
+
+	return v, err
+}
+
+func (s *Store) Put(key, value string) error {
+	return s.call(func() error { return s.keyService.Put(key, value) })
+}
+
+// PutWithTTL puts the value which expires after the ttl.
+func (s *Store) PutWithTTL(key, value string, ttl time.Duration) error {
+	return s.call(func() error { return s.keyService.PutWithTTL(key, value, ttl) })
+}
+
+// PutIfAbsent puts the value only if the key is absent, ErrorConditionFailed if not.
+func (s *Store) PutIfAbsent(key, value string) error {
+	return s.call(func() error { return s.keyService.PutIfAbsent(key, value) })
+}
+
+// CompareAndSwap replaces the value only if it's expected, ErrorConditionFailed if not.
+func (s *Store) CompareAndSwap(key, expected, value string) error {
+	return s.call(func() error { return s.keyService.CompareAndSwap(key, expected, value) })
+}
+
+func (s *Store) Delete(key string) error {
+	return s.call(func() error { return s.keyService.Delete(key) })
+}
+
+// Expire sets the ttl of an existing key.
+func (s *Store) Expire(key string, ttl time.Duration) error {
+	return s.call(func() error { return s.keyService.Expire(key, ttl) })
+}
+
+// TTL returns how long the key lives, 0 if it never expires.
+func (s *Store) TTL(key string) (time.Duration, error) {
+	var ttl time.Duration
+	err := s.call(func() (err error) {
+		ttl, err = s.keyService.TTL(key)
+		return err
+	})
+
+	return ttl, err
+}
+
+// Scan returns up to limit (all if limit <= 0) keys with the prefix in
+// ascending order, starting after the startAfter key.
+func (s *Store) Scan(prefix, startAfter string, limit int) ([]string, error) {
+	var keys []string
+	err := s.call(func() (err error) {
+		keys, err = s.keyService.Scan(prefix, startAfter, limit)
+		return err
+	})
+
+	return keys, err
+}
+
+// Apply applies all the operations in order or none of them, a failed
+// check returns ErrorConditionFailed.
+func (s *Store) Apply(ops []Op) error {
+	return s.call(func() error { return s.keyService.Apply(ops) })
+}
+
+func (s *Store) call(f func() error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrorClosed
+	}
+
+	return f()
+}
@@ -0,0 +1,98 @@
+package kvstore_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dimishpatriot/kv-storage/pkg/kvstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Reopen(t *testing.T) {
+	tests := []struct {
+		name string
+		opts kvstore.Options
+	}{
+		{"interval sync", kvstore.Options{SyncInterval: time.Hour}},
+		{"always sync", kvstore.Options{Sync: kvstore.SyncAlways}},
+		{"sharded", kvstore.Options{Shards: 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := kvstore.Open(dir, tt.opts)
+			require.NoError(t, err)
+
+			require.NoError(t, s.Put("one", "1"))
+			require.NoError(t, s.Put("two", "2"))
+			require.NoError(t, s.PutWithTTL("ttl", "t", time.Hour))
+			require.NoError(t, s.CompareAndSwap("one", "1", "ONE"))
+			assert.ErrorIs(t, s.PutIfAbsent("one", "x"), kvstore.ErrorConditionFailed)
+			require.NoError(t, s.Delete("two"))
+			require.NoError(t, s.Apply([]kvstore.Op{
+				{Type: kvstore.OpCheckAbsent, Key: "two"},
+				{Type: kvstore.OpPut, Key: "three", Value: "3"},
+			}))
+			require.NoError(t, s.Close())
+			assert.ErrorIs(t, s.Close(), kvstore.ErrorClosed)
+			_, err = s.Get("one")
+			assert.ErrorIs(t, err, kvstore.ErrorClosed)
+
+			s, err = kvstore.Open(dir, tt.opts)
+			require.NoError(t, err)
+			defer s.Close()
+
+			keys, err := s.Scan("", "", 0)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"one", "three", "ttl"}, keys)
+			v, err := s.Get("one")
+			require.NoError(t, err)
+			assert.Equal(t, "ONE", v)
+			_, err = s.Get("two")
+			assert.ErrorIs(t, err, kvstore.ErrorNoSuchKey)
+			ttl, err := s.TTL("ttl")
+			require.NoError(t, err)
+			assert.InDelta(t, time.Hour, ttl, float64(time.Minute))
+		})
+	}
+}
+
+func TestStore_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+	// every change is logged before it returns, so the snapshot has all of them
+	s, err := kvstore.Open(dir, kvstore.Options{Sync: kvstore.SyncAlways})
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, s.Put(fmt.Sprint(i), "before"))
+	}
+	seq, err := s.Snapshot()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), seq)
+	for i := 50; i < 150; i++ {
+		require.NoError(t, s.Put(fmt.Sprint(i), "after"))
+	}
+	require.NoError(t, s.Expire("0", time.Nanosecond))
+	require.NoError(t, s.Close())
+
+	s, err = kvstore.Open(dir, kvstore.Options{})
+	require.NoError(t, err)
+	defer s.Close()
+
+	keys, err := s.Scan("", "", 0)
+	require.NoError(t, err)
+	assert.Len(t, keys, 149)
+	v, err := s.Get("10")
+	require.NoError(t, err)
+	assert.Equal(t, "before", v)
+	v, err = s.Get("100")
+	require.NoError(t, err)
+	assert.Equal(t, "after", v)
+}
+
+func TestOpen(t *testing.T) {
+	_, err := kvstore.Open(t.TempDir(), kvstore.Options{Sync: 42})
+	assert.Error(t, err)
+}